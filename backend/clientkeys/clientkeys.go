@@ -0,0 +1,221 @@
+// Package clientkeys administra las llaves Ed25519 con las que el backend firma
+// sus peticiones a Open Payments. Las llaves privadas se guardan cifradas en la
+// base de datos y las públicas se publican como JWKS para la wallet del
+// cliente, que es donde los servidores de autorización las buscan.
+package clientkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+)
+
+// Algorithm es el algoritmo de firma de las llaves, con el nombre que usa JOSE.
+const Algorithm = "EdDSA"
+
+// ErrNoKey indica que la wallet no tiene ninguna llave que pueda firmar ahora.
+var ErrNoKey = errors.New("no hay llave de cliente vigente para la wallet")
+
+// ErrCompromisedKey indica que la llave privada se filtró y no se puede usar.
+var ErrCompromisedKey = errors.New("la llave está comprometida; genera otra con go run ./cmd/clientkeys rotate")
+
+// compromisedKeys son las llaves públicas, en base64url, de llaves privadas
+// que se filtraron. Ninguna se puede importar ni usar para firmar.
+var compromisedKeys = map[string]bool{
+	// test/private.key, que quedó en el historial del repositorio.
+	"cGBbd0Jbp4UlqJWvazJs3redR8hWCr3XwDOUyRfDSPo": true,
+}
+
+// compromised indica si la llave pública es de una llave privada filtrada.
+func compromised(publicKey ed25519.PublicKey) bool {
+	return compromisedKeys[base64.RawURLEncoding.EncodeToString(publicKey)]
+}
+
+// JWK es una llave pública en el formato que espera Open Payments (RFC 8037).
+type JWK struct {
+	KeyID     string `json:"kid"`
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+// SigningKey es una llave lista para firmar, con la llave privada en PEM tal
+// como la recibe el cliente de Open Payments.
+type SigningKey struct {
+	KeyID         string
+	WalletAddress string
+	PrivateKeyPEM []byte
+}
+
+// newKeyID genera un identificador con forma de UUID v4.
+func newKeyID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// save cifra y guarda una llave que empieza a firmar en activeFrom.
+func save(walletAddress, kid string, key ed25519.PrivateKey, activeFrom time.Time) (*model.ClientKey, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	clientKey := &model.ClientKey{
+		KeyID:         kid,
+		WalletAddress: walletAddress,
+		PublicKey:     key.Public().(ed25519.PublicKey),
+		CreatedAt:     time.Now().UTC(),
+		ActiveFrom:    activeFrom.UTC(),
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := store.CreateClientKey(clientKey, pemBytes); err != nil {
+		return nil, err
+	}
+	return clientKey, nil
+}
+
+// Generate crea una llave nueva para la wallet que firma desde activeFrom. No
+// retira las llaves anteriores; para eso está Rotate.
+func Generate(walletAddress string, activeFrom time.Time) (*model.ClientKey, error) {
+	kid, err := newKeyID()
+	if err != nil {
+		return nil, err
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return save(walletAddress, kid, key, activeFrom)
+}
+
+// Import guarda una llave PKCS#8 en PEM ya registrada en la wallet con el kid
+// indicado, por ejemplo la que se generó desde el panel de la wallet. La llave
+// firma de inmediato.
+func Import(walletAddress, kid string, pemBytes []byte) (*model.ClientKey, error) {
+	if kid == "" {
+		return nil, errors.New("falta el kid de la llave")
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("el archivo no contiene una llave PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("llave privada inválida: %v", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("la llave no es Ed25519")
+	}
+	if compromised(key.Public().(ed25519.PublicKey)) {
+		return nil, ErrCompromisedKey
+	}
+	existing, err := store.GetClientKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("ya existe una llave con kid %s", kid)
+	}
+	return save(walletAddress, kid, key, time.Now())
+}
+
+// Rotate crea una llave nueva para la wallet. La llave se publica enseguida,
+// pero solo empieza a firmar pasado overlap; en ese mismo momento se retiran
+// las llaves anteriores, que se siguen publicando otro overlap más. Así ningún
+// servidor que tenga el JWKS en caché ve firmas con una llave que no conoce.
+func Rotate(walletAddress string, overlap time.Duration) (*model.ClientKey, error) {
+	switchAt := time.Now().Add(overlap)
+	key, err := Generate(walletAddress, switchAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.RetireClientKeys(walletAddress, key.KeyID, switchAt); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Revoke retira una llave comprometida: deja de firmar y de publicarse de
+// inmediato, sin esperar al solapamiento.
+func Revoke(kid string) (bool, error) {
+	return store.RevokeClientKey(kid)
+}
+
+// RevokeCompromised revoca las llaves de la wallet que están comprometidas y
+// devuelve sus kid. Esas llaves también hay que darlas de baja en la wallet.
+func RevokeCompromised(walletAddress string) ([]string, error) {
+	keys, err := store.GetClientKeys(walletAddress)
+	if err != nil {
+		return nil, err
+	}
+	var revoked []string
+	for _, k := range keys {
+		if k.RevokedAt != nil || !compromised(k.PublicKey) {
+			continue
+		}
+		if _, err := store.RevokeClientKey(k.KeyID); err != nil {
+			return revoked, err
+		}
+		revoked = append(revoked, k.KeyID)
+	}
+	return revoked, nil
+}
+
+// Current devuelve la llave con la que se firma ahora en nombre de la wallet:
+// la más reciente de las que ya están activas, no retiradas ni revocadas. Las
+// llaves comprometidas nunca firman, aunque no se hayan revocado todavía.
+func Current(walletAddress string, now time.Time) (*SigningKey, error) {
+	keys, err := store.GetClientKeys(walletAddress)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if !k.Signs(now) || compromised(k.PublicKey) {
+			continue
+		}
+		pemBytes, err := store.GetClientPrivateKey(k.KeyID)
+		if err != nil {
+			return nil, err
+		}
+		return &SigningKey{KeyID: k.KeyID, WalletAddress: walletAddress, PrivateKeyPEM: pemBytes}, nil
+	}
+	return nil, ErrNoKey
+}
+
+// JWKS devuelve las llaves públicas que deben publicarse para la wallet.
+func JWKS(walletAddress string, now time.Time, overlap time.Duration) ([]JWK, error) {
+	keys, err := store.GetClientKeys(walletAddress)
+	if err != nil {
+		return nil, err
+	}
+	jwks := []JWK{}
+	for _, k := range keys {
+		if !k.Published(now, overlap) {
+			continue
+		}
+		jwks = append(jwks, JWK{
+			KeyID:     k.KeyID,
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(k.PublicKey),
+			Algorithm: Algorithm,
+			Use:       "sig",
+		})
+	}
+	return jwks, nil
+}
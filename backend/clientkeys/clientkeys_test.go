@@ -0,0 +1,71 @@
+package clientkeys
+
+import (
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+)
+
+const testWallet = "https://wallet.example/plataforma"
+
+func openTestStore(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	store.InitDB(filepath.Join(dir, "test.db"))
+	t.Cleanup(func() { store.DB.Close() })
+
+	kms, err := store.LoadOrCreateLocalKMS(filepath.Join(dir, "master.keys"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateLocalKMS: %v", err)
+	}
+	store.SetKMS(kms)
+}
+
+func TestCompromisedKeysAreRevokedAndNeverSign(t *testing.T) {
+	openTestStore(t)
+
+	// Solo hace falta la llave pública filtrada; la privada no vuelve al repositorio.
+	var leaked []byte
+	for encoded := range compromisedKeys {
+		var err error
+		if leaked, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := store.CreateClientKey(&model.ClientKey{
+		KeyID: "filtrada", WalletAddress: testWallet, PublicKey: leaked,
+		CreatedAt: time.Now(), ActiveFrom: time.Now().Add(-time.Hour),
+	}, []byte("no se usa"))
+	if err != nil {
+		t.Fatalf("CreateClientKey: %v", err)
+	}
+	if _, err := Current(testWallet, time.Now()); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("Current con solo la llave filtrada = %v, quería ErrNoKey", err)
+	}
+
+	fresh, err := Generate(testWallet, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	revoked, err := RevokeCompromised(testWallet)
+	if err != nil || !slices.Equal(revoked, []string{"filtrada"}) {
+		t.Fatalf("RevokeCompromised = %v, %v, quería [filtrada]", revoked, err)
+	}
+	if revoked, err := RevokeCompromised(testWallet); err != nil || len(revoked) != 0 {
+		t.Errorf("segunda RevokeCompromised = %v, %v", revoked, err)
+	}
+
+	jwks, err := JWKS(testWallet, time.Now(), time.Hour)
+	if err != nil || len(jwks) != 1 || jwks[0].KeyID != fresh.KeyID {
+		t.Errorf("JWKS = %v, %v, quería solo %s", jwks, err, fresh.KeyID)
+	}
+	if key, err := Current(testWallet, time.Now()); err != nil || key.KeyID != fresh.KeyID {
+		t.Errorf("Current = %v, %v, quería %s", key, err, fresh.KeyID)
+	}
+}
@@ -0,0 +1,43 @@
+// Comando auditverify comprueba la cadena de hashes del log de auditoría sin
+// modificar la base de datos. Sale con código 1 si la cadena está rota.
+//
+//	go run ./cmd/auditverify -db bd.db
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"gofundme-backend/store"
+
+	_ "github.com/mattn/go-sqlite3" // El driver de SQLite se registra en sql
+)
+
+func main() {
+	dbPath := flag.String("db", "bd.db", "ruta de la base de datos")
+	flag.Parse()
+
+	if _, err := os.Stat(*dbPath); err != nil {
+		log.Fatalf("No se puede abrir %s: %v", *dbPath, err)
+	}
+	db, err := sql.Open("sqlite3", "file:"+*dbPath+"?mode=ro")
+	if err != nil {
+		log.Fatalf("Error al abrir la base de datos: %v", err)
+	}
+	defer db.Close()
+
+	checked, err := store.VerifyAuditChain(db)
+	var chainErr *store.AuditChainError
+	switch {
+	case errors.As(err, &chainErr):
+		fmt.Printf("Cadena rota después de %d eventos válidos: %v\n", checked, chainErr)
+		os.Exit(1)
+	case err != nil:
+		log.Fatalf("Error al verificar el log de auditoría: %v", err)
+	}
+	fmt.Printf("Cadena íntegra: %d eventos verificados\n", checked)
+}
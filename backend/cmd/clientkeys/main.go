@@ -0,0 +1,104 @@
+// Comando clientkeys administra las llaves con las que el backend firma sus
+// peticiones a Open Payments. Las llaves privadas se guardan cifradas con la
+// llave maestra y nunca se escriben en disco ni en el repositorio.
+//
+//	go run ./cmd/clientkeys list
+//	go run ./cmd/clientkeys generate
+//	go run ./cmd/clientkeys import -kid <kid> -pem private.key
+//	go run ./cmd/clientkeys rotate
+//	go run ./cmd/clientkeys revoke -kid <kid>
+//
+// Después de generar o rotar, la llave pública aparece en
+// /api/openpayments/jwks.json; esa URL es la que se registra en la wallet.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"gofundme-backend/clientkeys"
+	"gofundme-backend/config"
+	"gofundme-backend/store"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "uso: clientkeys list|generate|import|rotate|revoke [opciones]")
+		os.Exit(2)
+	}
+	command := os.Args[1]
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	dbPath := flags.String("db", "bd.db", "ruta de la base de datos")
+	masterKeyPath := flags.String("master-key", config.MasterKeyFile(), "llavero de llaves maestras")
+	wallet := flags.String("wallet", config.ClientWalletAddress(), "wallet del cliente")
+	kid := flags.String("kid", "", "identificador de la llave (import y revoke)")
+	pemPath := flags.String("pem", "", "llave privada PKCS#8 en PEM (import)")
+	overlap := flags.Duration("overlap", config.ClientKeyOverlap(), "solapamiento entre la llave nueva y las anteriores (rotate)")
+	flags.Parse(os.Args[2:])
+
+	store.InitDB(*dbPath)
+	kms, err := store.OpenLocalKMS(config.MasterKey(), *masterKeyPath)
+	if err != nil {
+		log.Fatalf("Error con la llave maestra: %v", err)
+	}
+	store.SetKMS(kms)
+
+	switch command {
+	case "list":
+		keys, err := store.GetClientKeys(*wallet)
+		if err != nil {
+			log.Fatalf("Error al listar las llaves: %v", err)
+		}
+		now := time.Now()
+		for _, k := range keys {
+			state := "publicada"
+			switch {
+			case k.RevokedAt != nil:
+				state = "revocada"
+			case k.Signs(now):
+				state = "firmando"
+			case !k.Published(now, *overlap):
+				state = "retirada"
+			}
+			fmt.Printf("%s  %-9s  activa desde %s\n", k.KeyID, state, k.ActiveFrom.Local().Format(time.RFC3339))
+		}
+	case "generate":
+		k, err := clientkeys.Generate(*wallet, time.Now())
+		if err != nil {
+			log.Fatalf("Error al generar la llave: %v", err)
+		}
+		fmt.Printf("Llave %s creada para %s\n", k.KeyID, *wallet)
+	case "import":
+		data, err := os.ReadFile(*pemPath)
+		if err != nil {
+			log.Fatalf("Error al leer %s: %v", *pemPath, err)
+		}
+		k, err := clientkeys.Import(*wallet, *kid, data)
+		if err != nil {
+			log.Fatalf("Error al importar la llave: %v", err)
+		}
+		fmt.Printf("Llave %s importada para %s; ya puedes borrar %s\n", k.KeyID, *wallet, *pemPath)
+	case "rotate":
+		k, err := clientkeys.Rotate(*wallet, *overlap)
+		if err != nil {
+			log.Fatalf("Error al rotar la llave: %v", err)
+		}
+		fmt.Printf("Llave %s publicada; firmará desde %s\n", k.KeyID, k.ActiveFrom.Local().Format(time.RFC3339))
+	case "revoke":
+		ok, err := clientkeys.Revoke(*kid)
+		if err != nil {
+			log.Fatalf("Error al revocar la llave: %v", err)
+		}
+		if !ok {
+			log.Fatalf("No hay ninguna llave vigente con kid %q", *kid)
+		}
+		fmt.Printf("Llave %s revocada\n", *kid)
+	default:
+		fmt.Fprintf(os.Stderr, "comando desconocido %q\n", command)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,91 @@
+// Comando masterkey rota las llaves maestras que protegen los secretos
+// guardados en la base de datos.
+//
+//	go run ./cmd/masterkey status
+//	go run ./cmd/masterkey rotate
+//	go run ./cmd/masterkey reencrypt
+//
+// rotate agrega una llave al llavero y vuelve a envolver con ella todas las
+// llaves de datos. Las llaves anteriores quedan en el llavero; cuando status
+// indica que ya no se usan, se pueden borrar a mano (después de asegurarse de
+// que ningún respaldo de la base de datos las necesita).
+//
+// Con MASTER_KEY definida el llavero no se toca: agrega la llave nueva al
+// final de la variable, reinicia y ejecuta reencrypt.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"gofundme-backend/config"
+	"gofundme-backend/store"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "uso: masterkey status|rotate|reencrypt [opciones]")
+		os.Exit(2)
+	}
+	command := os.Args[1]
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	dbPath := flags.String("db", "bd.db", "ruta de la base de datos")
+	keyringPath := flags.String("master-key", config.MasterKeyFile(), "llavero de llaves maestras")
+	flags.Parse(os.Args[2:])
+
+	store.InitDB(*dbPath)
+
+	if command == "rotate" {
+		if config.MasterKey() != "" {
+			log.Fatalf("El llavero viene de MASTER_KEY: agrega ahí la llave nueva y ejecuta reencrypt")
+		}
+		keyID, err := store.AddLocalMasterKey(*keyringPath)
+		if err != nil {
+			log.Fatalf("Error al crear la llave maestra: %v", err)
+		}
+		fmt.Printf("Llave maestra %s agregada a %s\n", keyID, *keyringPath)
+	}
+
+	kms, err := store.OpenLocalKMS(config.MasterKey(), *keyringPath)
+	if err != nil {
+		log.Fatalf("Error con la llave maestra: %v", err)
+	}
+	store.SetKMS(kms)
+
+	switch command {
+	case "status":
+		inUse, err := store.SecretKeyIDsInUse()
+		if err != nil {
+			log.Fatalf("Error al revisar los secretos: %v", err)
+		}
+		ids := kms.KeyIDs()
+		sort.Strings(ids)
+		for _, id := range ids {
+			note := ""
+			switch {
+			case id == kms.CurrentKeyID():
+				note = " (actual)"
+			case inUse[id] == 0:
+				note = " (sin uso, se puede borrar)"
+			}
+			fmt.Printf("%s  %d secretos%s\n", id, inUse[id], note)
+			delete(inUse, id)
+		}
+		for id, n := range inUse {
+			fmt.Printf("%s  %d secretos (¡la llave no está en el llavero!)\n", id, n)
+		}
+	case "rotate", "reencrypt":
+		n, err := store.ReencryptSecrets()
+		if err != nil {
+			log.Fatalf("Error al volver a cifrar los secretos: %v", err)
+		}
+		fmt.Printf("%d secretos cifrados con la llave maestra %s\n", n, kms.CurrentKeyID())
+	default:
+		fmt.Fprintf(os.Stderr, "comando desconocido %q\n", command)
+		os.Exit(2)
+	}
+}
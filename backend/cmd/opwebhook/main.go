@@ -0,0 +1,72 @@
+// Comando opwebhook hace de servidor de recursos de Open Payments falso para
+// probar en local el endpoint de webhooks: firma un evento con
+// OP_WEBHOOK_SECRET y lo envía como lo haría Rafiki.
+//
+//	OP_WEBHOOK_SECRET=secreto go run ./cmd/opwebhook -type incoming_payment.completed -payment <id> -received 1000
+//	OP_WEBHOOK_SECRET=secreto go run ./cmd/opwebhook -type outgoing_payment.failed -payment <id> -error "sin fondos"
+//
+// Con el mismo -id se puede comprobar que un evento repetido no se procesa dos veces.
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"gofundme-backend/config"
+	"gofundme-backend/webhook"
+)
+
+func main() {
+	url := flag.String("url", "http://localhost:8080/api/webhooks/openpayments", "endpoint de webhooks del backend")
+	secret := flag.String("secret", config.OPWebhookSecret(), "secreto compartido para firmar")
+	id := flag.String("id", "", "ID del evento (por defecto uno aleatorio)")
+	eventType := flag.String("type", "incoming_payment.completed", "tipo de evento")
+	paymentID := flag.String("payment", "", "ID o URL del incoming/outgoing payment")
+	received := flag.String("received", "", "monto recibido en unidades mínimas (incoming_payment.*)")
+	paymentError := flag.String("error", "", "motivo del fallo (outgoing_payment.failed)")
+	flag.Parse()
+
+	if *secret == "" || *paymentID == "" {
+		log.Fatalf("Faltan -secret (u OP_WEBHOOK_SECRET) y -payment")
+	}
+	if *id == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		*id = hex.EncodeToString(b)
+	}
+
+	data := map[string]any{"id": *paymentID}
+	if *received != "" {
+		data["receivedAmount"] = map[string]string{"value": *received}
+	}
+	if *paymentError != "" {
+		data["error"] = *paymentError
+	}
+	body, err := json.Marshal(map[string]any{"id": *id, "type": *eventType, "data": data})
+	if err != nil {
+		log.Fatalf("Error al armar el evento: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, *url, bytes.NewReader(body))
+	if err != nil {
+		log.Fatalf("Error al armar la petición: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(*secret, body, time.Now()))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("Error al enviar el webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	fmt.Printf("Evento %s: %s %s", *id, resp.Status, respBody)
+}
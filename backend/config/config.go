@@ -0,0 +1,339 @@
+// Package config lee la configuración del backend desde variables de entorno.
+// Cada valor tiene un default pensado para el entorno de desarrollo.
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// PlatformWalletAddress es la wallet de la plataforma donde se retienen las
+// donaciones de las campañas con escrow. Debe ser la wallet del cliente de
+// Open Payments del backend, porque es quien firma los pagos de liberación.
+func PlatformWalletAddress() string {
+	return getEnv("PLATFORM_WALLET_ADDRESS", "https://ilp.interledger-test.dev/clientzerokm")
+}
+
+// BootstrapAdmin es el nombre de un usuario que recibe el rol de administrador
+// al arrancar, para poder asignar los demás roles desde la API.
+func BootstrapAdmin() string {
+	return os.Getenv("BOOTSTRAP_ADMIN")
+}
+
+// SessionTTL es la duración de las sesiones iniciadas con /api/login.
+func SessionTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("SESSION_TTL"))
+	if err != nil || ttl <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return ttl
+}
+
+// RatesFile es el archivo JSON con las tasas de cambio del proveedor estático.
+func RatesFile() string {
+	return getEnv("RATES_FILE", "rates.json")
+}
+
+// RiskRulesFile es el archivo JSON con los umbrales y las reglas del motor de
+// riesgo. Si no existe se usan los valores por defecto.
+func RiskRulesFile() string {
+	return getEnv("RISK_RULES_FILE", "risk.json")
+}
+
+// UploadDir es el directorio donde se guardan los archivos subidos por los usuarios.
+func UploadDir() string {
+	return getEnv("UPLOAD_DIR", "uploads")
+}
+
+// ReceiptKeyFile es la llave privada Ed25519 (PKCS#8 en PEM) con la que se
+// firman los comprobantes de donación. Si no existe, se genera al arrancar.
+func ReceiptKeyFile() string {
+	return getEnv("RECEIPT_KEY_FILE", "receipt_key.pem")
+}
+
+// UnverifiedMaxGoal es la meta máxima de las campañas sin verificar, en el
+// activo de cada campaña. 0 significa sin límite.
+func UnverifiedMaxGoal() float64 {
+	limit, err := strconv.ParseFloat(os.Getenv("UNVERIFIED_MAX_GOAL"), 64)
+	if err != nil || limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// HideUnverified oculta las campañas sin verificar de los listados y de la búsqueda.
+func HideUnverified() bool {
+	hide, _ := strconv.ParseBool(os.Getenv("HIDE_UNVERIFIED"))
+	return hide
+}
+
+// ReportThreshold es el número de denuncias abiertas de usuarios distintos a
+// partir del cual una campaña se oculta hasta que la revise un moderador. 0
+// desactiva el ocultamiento automático.
+func ReportThreshold() int {
+	threshold, err := strconv.Atoi(getEnv("REPORT_THRESHOLD", "5"))
+	if err != nil || threshold < 0 {
+		return 5
+	}
+	return threshold
+}
+
+// TrustProxy indica que el servidor está detrás de un proxy de confianza, así
+// que la IP del cliente se toma de la cabecera X-Forwarded-For.
+func TrustProxy() bool {
+	trust, _ := strconv.ParseBool(os.Getenv("TRUST_PROXY"))
+	return trust
+}
+
+// TokenSecretFile es la llave HMAC con la que se firman los tokens de
+// verificación de correo y de restablecimiento de contraseña. Si no existe, se
+// genera al arrancar.
+func TokenSecretFile() string {
+	return getEnv("TOKEN_SECRET_FILE", "token_secret.key")
+}
+
+// AppURL es la dirección del frontend, para armar los enlaces de los correos.
+func AppURL() string {
+	return getEnv("APP_URL", "http://localhost:5173")
+}
+
+// MailDriver elige cómo se envían los correos: "smtp", o "file" para
+// guardarlos en MailDir sin enviarlos.
+func MailDriver() string {
+	return getEnv("MAIL_DRIVER", "file")
+}
+
+// MailDir es el directorio donde el driver "file" guarda los correos.
+func MailDir() string {
+	return getEnv("MAIL_DIR", "sent_mail")
+}
+
+// MailFrom es el remitente de los correos.
+func MailFrom() string {
+	return getEnv("MAIL_FROM", "AidLoop <no-reply@aidloop.local>")
+}
+
+// SMTPAddr es el servidor SMTP en formato host:puerto.
+func SMTPAddr() string {
+	return getEnv("SMTP_ADDR", "localhost:587")
+}
+
+// SMTPUsername y SMTPPassword son las credenciales del servidor SMTP.
+func SMTPUsername() string {
+	return os.Getenv("SMTP_USERNAME")
+}
+
+func SMTPPassword() string {
+	return os.Getenv("SMTP_PASSWORD")
+}
+
+// PasswordResetLimit es cuántas solicitudes de restablecimiento de contraseña
+// se aceptan por cuenta en una hora.
+func PasswordResetLimit() int {
+	return positiveInt("PASSWORD_RESET_LIMIT", 3)
+}
+
+// PasswordResetIPLimit es cuántas solicitudes de restablecimiento de
+// contraseña se aceptan desde una misma IP en una hora.
+func PasswordResetIPLimit() int {
+	return positiveInt("PASSWORD_RESET_IP_LIMIT", 10)
+}
+
+func positiveInt(key string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n <= 0 {
+		return fallback
+	}
+	return n
+}
+
+// TwoFactorIssuer es el nombre con el que aparece la cuenta en las apps de
+// autenticación.
+func TwoFactorIssuer() string {
+	return getEnv("TWO_FACTOR_ISSUER", "AidLoop")
+}
+
+// TwoFactorFreshness es cuánto tiempo después de confirmar un código de
+// verificación en dos pasos se permiten las operaciones sensibles, como
+// cambiar la wallet de cobro de una campaña.
+func TwoFactorFreshness() time.Duration {
+	return positiveDuration("TWO_FACTOR_FRESHNESS", 10*time.Minute)
+}
+
+// LoginBackoffBase es la espera después del primer intento fallido de inicio
+// de sesión que excede los gratuitos; se duplica con cada fallo siguiente.
+func LoginBackoffBase() time.Duration {
+	return positiveDuration("LOGIN_BACKOFF_BASE", time.Second)
+}
+
+// LoginBackoffMax es la espera máxima entre intentos de inicio de sesión.
+func LoginBackoffMax() time.Duration {
+	return positiveDuration("LOGIN_BACKOFF_MAX", 5*time.Minute)
+}
+
+// LoginLockoutThreshold es cuántos intentos fallidos seguidos bloquean una
+// cuenta; se vuelve a bloquear cada vez que acumula otros tantos.
+func LoginLockoutThreshold() int {
+	return positiveInt("LOGIN_LOCKOUT_THRESHOLD", 10)
+}
+
+// LoginIPLockoutThreshold es cuántos intentos fallidos desde una IP, contra
+// cualquier cuenta, bloquean esa IP; igual que con las cuentas, el bloqueo se
+// repite cada tantos fallos.
+func LoginIPLockoutThreshold() int {
+	return positiveInt("LOGIN_IP_LOCKOUT_THRESHOLD", 50)
+}
+
+// LoginLockoutDuration es cuánto dura el bloqueo de una cuenta o de una IP.
+func LoginLockoutDuration() time.Duration {
+	return positiveDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+}
+
+func positiveDuration(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return fallback
+	}
+	return d
+}
+
+// AccountDeletionGrace es el tiempo entre que un usuario pide borrar su cuenta
+// y que se anonimiza; mientras tanto puede cancelarlo.
+func AccountDeletionGrace() time.Duration {
+	return positiveDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour)
+}
+
+// ClientWalletAddress es la wallet con la que el backend se identifica ante
+// los servidores de Open Payments. Sus llaves se administran con
+// cmd/clientkeys y se publican en /api/openpayments/jwks.json.
+func ClientWalletAddress() string {
+	return getEnv("OP_CLIENT_WALLET_ADDRESS", "https://ilp.interledger-test.dev/clientzerokm")
+}
+
+// MasterKeyFile es el llavero con las llaves maestras que protegen los
+// secretos guardados en la base de datos (llaves privadas de Open Payments y
+// tokens de grants). Si no existe, se genera al arrancar. Las llaves se rotan
+// con cmd/masterkey.
+func MasterKeyFile() string {
+	return getEnv("MASTER_KEY_FILE", "master.key")
+}
+
+// MasterKey es el llavero en texto, con llaves "id:hex" separadas por comas.
+// Si se define, se usa en lugar de MasterKeyFile.
+func MasterKey() string {
+	return os.Getenv("MASTER_KEY")
+}
+
+// ClientKeyOverlap es cuánto tiempo conviven dos llaves al rotarlas: la nueva
+// se publica enseguida pero no firma hasta pasado este tiempo, y la anterior
+// se sigue publicando el mismo tiempo después de dejar de firmar, para que los
+// servidores que guardan el JWKS en caché no rechacen ninguna firma.
+func ClientKeyOverlap() time.Duration {
+	return positiveDuration("CLIENT_KEY_OVERLAP", 24*time.Hour)
+}
+
+// OPWebhookSecret es el secreto compartido con el servidor de recursos de Open
+// Payments para firmar los webhooks. Sin él, /api/webhooks/openpayments no
+// acepta eventos.
+func OPWebhookSecret() string {
+	return os.Getenv("OP_WEBHOOK_SECRET")
+}
+
+// WebhookTolerance es la diferencia máxima entre la hora de la firma de un
+// webhook y la del servidor, para rechazar reenvíos de eventos viejos.
+func WebhookTolerance() time.Duration {
+	return positiveDuration("WEBHOOK_TOLERANCE", 5*time.Minute)
+}
+
+// WebhookMaxAttempts es cuántas veces se intenta procesar un webhook recibido,
+// o entregar uno enviado a un creador, antes de dejarlo para un reintento manual.
+func WebhookMaxAttempts() int {
+	return positiveInt("WEBHOOK_MAX_ATTEMPTS", 8)
+}
+
+// WebhookRetryBase es la espera antes del primer reintento de un webhook
+// fallido, recibido o enviado; se duplica en cada intento.
+func WebhookRetryBase() time.Duration {
+	return positiveDuration("WEBHOOK_RETRY_BASE", time.Minute)
+}
+
+// WebhookTimeout es cuánto se espera la respuesta de un endpoint de webhooks
+// de un creador.
+func WebhookTimeout() time.Duration {
+	return positiveDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+}
+
+// WebhookAllowHTTP permite registrar endpoints de webhooks sin HTTPS. Solo
+// para probar en local.
+func WebhookAllowHTTP() bool {
+	return os.Getenv("WEBHOOK_ALLOW_HTTP") == "true"
+}
+
+// WebhookAllowPrivateNetworks permite entregar webhooks a direcciones de
+// loopback, redes privadas o link-local. Solo para probar en local: en
+// producción dejaría que cualquier creador haga peticiones a la red interna.
+func WebhookAllowPrivateNetworks() bool {
+	return os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"
+}
+
+// JobPollInterval es cada cuánto busca la cola trabajos que ya toca ejecutar.
+// Los que se encolan desde este mismo proceso se ejecutan sin esperar.
+func JobPollInterval() time.Duration {
+	return positiveDuration("JOB_POLL_INTERVAL", 5*time.Second)
+}
+
+// JobMaxAttempts es cuántas veces se intenta un trabajo, salvo que su tipo
+// diga otra cosa, antes de dejarlo muerto para un reintento manual.
+func JobMaxAttempts() int {
+	return positiveInt("JOB_MAX_ATTEMPTS", 5)
+}
+
+// JobRetryBase es la espera antes del primer reintento de un trabajo fallido;
+// se duplica en cada intento.
+func JobRetryBase() time.Duration {
+	return positiveDuration("JOB_RETRY_BASE", 30*time.Second)
+}
+
+// JobTimeout es cuánto puede durar un intento de un trabajo.
+func JobTimeout() time.Duration {
+	return positiveDuration("JOB_TIMEOUT", 5*time.Minute)
+}
+
+// JobRetention es cuánto se guardan los trabajos terminados con éxito y los
+// eventos ya publicados del outbox.
+func JobRetention() time.Duration {
+	return positiveDuration("JOB_RETENTION", 7*24*time.Hour)
+}
+
+// PaymentGrantTTL es cuánto se guarda el grant de una donación que el donante
+// no terminó de aprobar. Una donación que pasa ese tiempo sin llegar a
+// aprobarse vence.
+func PaymentGrantTTL() time.Duration {
+	return positiveDuration("PAYMENT_GRANT_TTL", 24*time.Hour)
+}
+
+// IdempotencyKeyTTL es cuánto se guarda la respuesta de una petición con
+// Idempotency-Key. Pasado ese tiempo, la misma clave cuenta como nueva.
+func IdempotencyKeyTTL() time.Duration {
+	return positiveDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+}
+
+// ShutdownTimeout es cuánto se espera al apagar el servidor a que terminen
+// las peticiones y los trabajos en curso.
+func ShutdownTimeout() time.Duration {
+	return positiveDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+}
+
+// ReconcileDelay es cuánto se espera después de usar el grant de una donación
+// para revisar si su pago terminó.
+func ReconcileDelay() time.Duration {
+	return positiveDuration("RECONCILE_DELAY", 15*time.Minute)
+}
@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gofundme-backend/config"
+	mailer "gofundme-backend/mail"
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+	"gofundme-backend/token"
+)
+
+const (
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+	passwordResetWindow  = time.Hour
+)
+
+// normalizeEmail valida un correo y lo devuelve en minúsculas y sin espacios.
+// Solo se aceptan direcciones simples, sin nombre para mostrar.
+func normalizeEmail(raw string) (string, bool) {
+	email := strings.ToLower(strings.TrimSpace(raw))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", false
+	}
+	return email, true
+}
+
+// passwordBinding ata un token de restablecimiento a la contraseña vigente:
+// al cambiarla, el token deja de servir, así que se usa una sola vez.
+func passwordBinding(user *model.User) string {
+	sum := sha256.Sum256([]byte(user.PasswordHash))
+	return hex.EncodeToString(sum[:16])
+}
+
+// appLink arma un enlace al frontend con un token.
+func appLink(path, tok string) string {
+	return strings.TrimRight(config.AppURL(), "/") + path + "?token=" + url.QueryEscape(tok)
+}
+
+// sendVerificationEmail envía al correo del usuario el enlace para verificarlo.
+func sendVerificationEmail(ctx context.Context, user *model.User) error {
+	tok, err := token.Issue(token.PurposeVerifyEmail, user.ID, user.Email, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirma tu correo",
+		Body: "Hola " + user.Username + ",\n\n" +
+			"Para confirmar este correo en tu cuenta abre el siguiente enlace:\n\n" +
+			appLink("/verify-email", tok) + "\n\n" +
+			"El enlace caduca en 48 horas. Si no fuiste tú, ignora este mensaje.\n",
+	})
+}
+
+// UpdateEmailHandler cambia el correo del usuario autenticado y le envía el
+// enlace para verificarlo. El correo anterior deja de servir para recuperar la
+// cuenta en cuanto se cambia.
+func UpdateEmailHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	var requestBody struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la solicitud inválido", http.StatusBadRequest)
+		return
+	}
+	email, ok := normalizeEmail(requestBody.Email)
+	if !ok {
+		http.Error(w, "Correo inválido", http.StatusBadRequest)
+		return
+	}
+
+	if email == user.Email && user.EmailVerified() {
+		writeAccount(w, user.ID)
+		return
+	}
+	owner, err := store.GetUserByVerifiedEmail(email)
+	if err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if owner != nil && owner.ID != user.ID {
+		http.Error(w, "El correo ya está en uso", http.StatusConflict)
+		return
+	}
+
+	if err := store.SetUserEmail(user.ID, email); err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditEmailChanged, SubjectType: "user", SubjectID: subjectID(user.ID)},
+		map[string]string{"email": user.Email}, map[string]string{"email": email})
+	if user.EmailVerified() {
+		store.CreateNotification(user.ID, "email_changed", "El correo de tu cuenta cambió a "+email)
+	}
+
+	updated := *user
+	updated.Email = email
+	if err := sendVerificationEmail(r.Context(), &updated); err != nil {
+		log.Printf("Error al enviar el correo de verificación al usuario %d: %v", user.ID, err)
+	}
+	writeAccount(w, user.ID)
+}
+
+// ResendVerificationHandler vuelve a enviar el enlace de verificación al
+// correo del usuario autenticado.
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user.Email == "" {
+		http.Error(w, "La cuenta no tiene correo", http.StatusBadRequest)
+		return
+	}
+	if user.EmailVerified() {
+		http.Error(w, "El correo ya está verificado", http.StatusConflict)
+		return
+	}
+	if err := sendVerificationEmail(r.Context(), user); err != nil {
+		log.Printf("Error al enviar el correo de verificación al usuario %d: %v", user.ID, err)
+		http.Error(w, "No se pudo enviar el correo", http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// VerifyEmailHandler confirma un correo con el token del enlace enviado. El
+// token solo sirve mientras el usuario conserve ese correo.
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la solicitud inválido", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := parseAccountToken(w, requestBody.Token, token.PurposeVerifyEmail)
+	if !ok {
+		return
+	}
+	user, ok := loadUser(w, claims.UserID)
+	if !ok {
+		return
+	}
+	if user.Email != claims.Binding || user.EmailVerified() {
+		http.Error(w, "El enlace ya no es válido", http.StatusBadRequest)
+		return
+	}
+
+	verified, err := store.VerifyUserEmail(user.ID, claims.Binding)
+	if errors.Is(err, store.ErrEmailInUse) {
+		http.Error(w, "El correo ya está verificado en otra cuenta", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if !verified {
+		http.Error(w, "El enlace ya no es válido", http.StatusBadRequest)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditEmailVerified, ActorID: user.ID, SubjectType: "user", SubjectID: subjectID(user.ID)},
+		nil, map[string]string{"email": user.Email})
+	store.CreateNotification(user.ID, "email_verified", "Tu correo "+user.Email+" quedó verificado")
+	writeAccount(w, user.ID)
+}
+
+// ForgotPasswordHandler envía un enlace para restablecer la contraseña al
+// correo verificado de una cuenta. Responde igual exista o no la cuenta, para
+// no revelar qué correos están registrados; solo avisa con 429 cuando se supera
+// el límite de solicitudes de la IP.
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la solicitud inválido", http.StatusBadRequest)
+		return
+	}
+	email, ok := normalizeEmail(requestBody.Email)
+	if !ok {
+		http.Error(w, "Correo inválido", http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIP(r)
+	count, err := store.CountPasswordResetRequestsByIP(ip, passwordResetWindow)
+	if err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if count >= config.PasswordResetIPLimit() {
+		w.Header().Set("Retry-After", strconv.Itoa(int(passwordResetWindow.Seconds())))
+		http.Error(w, "Demasiadas solicitudes, inténtalo más tarde", http.StatusTooManyRequests)
+		return
+	}
+
+	user, err := store.GetUserByVerifiedEmail(email)
+	if err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	var userID int
+	if user != nil {
+		userID = user.ID
+	}
+	// Se cuenta antes de registrar esta solicitud.
+	var sent int
+	if user != nil {
+		sent, err = store.CountPasswordResetRequestsByUser(user.ID, passwordResetWindow)
+		if err != nil {
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := store.RecordPasswordResetRequest(userID, ip); err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case user == nil:
+		// Nada que enviar.
+	case sent >= config.PasswordResetLimit():
+		log.Printf("Límite de restablecimientos alcanzado para el usuario %d", user.ID)
+	default:
+		recordAudit(r.Context(), model.AuditEvent{Action: model.AuditPasswordResetRequested, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, nil)
+		if err := sendPasswordResetEmail(r.Context(), user); err != nil {
+			log.Printf("Error al enviar el correo de restablecimiento al usuario %d: %v", user.ID, err)
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func sendPasswordResetEmail(ctx context.Context, user *model.User) error {
+	tok, err := token.Issue(token.PurposeResetPassword, user.ID, passwordBinding(user), passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	return mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Restablece tu contraseña",
+		Body: "Hola " + user.Username + ",\n\n" +
+			"Recibimos una solicitud para restablecer la contraseña de tu cuenta. Para elegir una nueva abre el siguiente enlace:\n\n" +
+			appLink("/reset-password", tok) + "\n\n" +
+			"El enlace caduca en una hora y sirve una sola vez. Si no fuiste tú, ignora este mensaje: tu contraseña no cambiará.\n",
+	})
+}
+
+// ResetPasswordHandler cambia la contraseña con el token del enlace enviado y
+// cierra todas las sesiones de la cuenta.
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la solicitud inválido", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Password == "" {
+		http.Error(w, "La contraseña es obligatoria", http.StatusBadRequest)
+		return
+	}
+
+	claims, ok := parseAccountToken(w, requestBody.Token, token.PurposeResetPassword)
+	if !ok {
+		return
+	}
+	user, ok := loadUser(w, claims.UserID)
+	if !ok {
+		return
+	}
+	if claims.Binding != passwordBinding(user) {
+		http.Error(w, "El enlace ya no es válido", http.StatusBadRequest)
+		return
+	}
+
+	if err := store.UpdatePassword(user.ID, requestBody.Password, ""); err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditPasswordReset, ActorID: user.ID, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, nil)
+	store.CreateNotification(user.ID, "password_changed", "La contraseña de tu cuenta se restableció y se cerraron todas tus sesiones")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeAccount responde con el estado actual de la cuenta.
+func writeAccount(w http.ResponseWriter, userID int) {
+	user, err := store.GetUserByID(userID)
+	if err != nil || user == nil {
+		http.Error(w, "Error al recuperar el usuario", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// parseAccountToken valida un token de los enlaces enviados por correo y
+// responde con el error adecuado si no sirve.
+func parseAccountToken(w http.ResponseWriter, tok, purpose string) (*token.Claims, bool) {
+	claims, err := token.Parse(tok, purpose)
+	switch {
+	case errors.Is(err, token.ErrExpired):
+		http.Error(w, "El enlace caducó, solicita uno nuevo", http.StatusBadRequest)
+		return nil, false
+	case errors.Is(err, token.ErrInvalid):
+		http.Error(w, "El enlace no es válido", http.StatusBadRequest)
+		return nil, false
+	case err != nil:
+		log.Printf("Error al validar el token: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return nil, false
+	}
+	return claims, true
+}
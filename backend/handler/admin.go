@@ -0,0 +1,352 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gofundme-backend/model"
+	"gofundme-backend/openpayments"
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+// reasonRequest es el cuerpo de las acciones de moderación que piden un motivo.
+type reasonRequest struct {
+	Reason string `json:"reason"`
+}
+
+// decodeReason lee el motivo de una acción de moderación. Si required es
+// true y falta, responde 400 y devuelve false.
+func decodeReason(w http.ResponseWriter, r *http.Request, required bool) (string, bool) {
+	var body reasonRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Cuerpo de la petición inválido", http.StatusBadRequest)
+			return "", false
+		}
+	}
+	if required && body.Reason == "" {
+		http.Error(w, "El motivo es obligatorio", http.StatusBadRequest)
+		return "", false
+	}
+	return body.Reason, true
+}
+
+// AdminListUsersHandler lista todos los usuarios con su rol y estado.
+func AdminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := store.GetUsers()
+	if err != nil {
+		http.Error(w, "Error al recuperar los usuarios", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// AdminSuspendUserHandler suspende una cuenta y cierra sus sesiones.
+func AdminSuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+		return
+	}
+	reason, ok := decodeReason(w, r, true)
+	if !ok {
+		return
+	}
+	if user := currentUser(r); user != nil && user.ID == userID {
+		http.Error(w, "No puedes suspender tu propia cuenta", http.StatusBadRequest)
+		return
+	}
+
+	before, ok := loadUser(w, userID)
+	if !ok {
+		return
+	}
+	found, err := store.SuspendUser(userID, reason)
+	if err != nil {
+		http.Error(w, "No se pudo suspender al usuario", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Usuario no encontrado", http.StatusNotFound)
+		return
+	}
+	writeUser(w, r, before)
+}
+
+// AdminUnsuspendUserHandler reactiva una cuenta suspendida.
+func AdminUnsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+		return
+	}
+
+	before, ok := loadUser(w, userID)
+	if !ok {
+		return
+	}
+	found, err := store.UnsuspendUser(userID)
+	if err != nil {
+		http.Error(w, "No se pudo reactivar al usuario", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Usuario no encontrado", http.StatusNotFound)
+		return
+	}
+	writeUser(w, r, before)
+}
+
+// AdminSetUserRoleHandler cambia el rol de un usuario.
+func AdminSetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+		return
+	}
+	var requestBody struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la petición inválido", http.StatusBadRequest)
+		return
+	}
+	if !model.ValidRole(requestBody.Role) {
+		http.Error(w, "Rol inválido", http.StatusBadRequest)
+		return
+	}
+	if user := currentUser(r); user != nil && user.ID == userID && requestBody.Role != model.RoleAdmin {
+		http.Error(w, "No puedes quitarte el rol de administrador", http.StatusBadRequest)
+		return
+	}
+
+	before, ok := loadUser(w, userID)
+	if !ok {
+		return
+	}
+	found, err := store.SetUserRole(userID, requestBody.Role)
+	if err != nil {
+		http.Error(w, "No se pudo cambiar el rol", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Usuario no encontrado", http.StatusNotFound)
+		return
+	}
+	writeUser(w, r, before)
+}
+
+// loadUser carga el usuario sobre el que actúa un administrador. Si no existe
+// o falla la consulta, ya escribió la respuesta de error.
+func loadUser(w http.ResponseWriter, userID int) (*model.User, bool) {
+	user, err := store.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, "Error al recuperar el usuario", http.StatusInternalServerError)
+		return nil, false
+	}
+	if user == nil {
+		http.Error(w, "Usuario no encontrado", http.StatusNotFound)
+		return nil, false
+	}
+	return user, true
+}
+
+// writeUser responde con el usuario ya modificado y deja el cambio en el log
+// de auditoría junto con su estado anterior.
+func writeUser(w http.ResponseWriter, r *http.Request, before *model.User) {
+	user, err := store.GetUserByID(before.ID)
+	if err != nil || user == nil {
+		http.Error(w, "Error al recuperar el usuario", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditUserChanged, SubjectType: "user", SubjectID: subjectID(user.ID)}, before, user)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// AdminTakedownCampaignHandler retira una campaña: deja de listarse y de recibir donaciones.
+func AdminTakedownCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	reason, ok := decodeReason(w, r, true)
+	if !ok {
+		return
+	}
+	setCampaignStatus(w, r, model.CampaignTakenDown, reason)
+}
+
+// AdminRestoreCampaignHandler vuelve a publicar una campaña retirada.
+func AdminRestoreCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	setCampaignStatus(w, r, model.CampaignActive, "")
+}
+
+func setCampaignStatus(w http.ResponseWriter, r *http.Request, status, reason string) {
+	campaignID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+
+	before, _ := store.GetCampaignByID(campaignID)
+	found, err := store.SetCampaignStatus(campaignID, status, reason)
+	if err != nil {
+		http.Error(w, "No se pudo cambiar el estado de la campaña", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Campaña no encontrada", http.StatusNotFound)
+		return
+	}
+
+	campaign, err := store.GetCampaignByID(campaignID)
+	if err != nil || campaign == nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	campaignStatusChanged(r.Context(), before, campaign)
+	if status == model.CampaignTakenDown {
+		store.CreateNotification(campaign.UserID, "campaign_taken_down", "Tu campaña fue retirada: "+reason)
+	} else {
+		store.CreateNotification(campaign.UserID, "campaign_restored", "Tu campaña volvió a publicarse")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(campaign)
+}
+
+// AdminLedgerHandler devuelve el ledger de donaciones. Acepta los filtros
+// opcionales ?campaignId= y ?status=.
+func AdminLedgerHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID, _ := strconv.Atoi(r.URL.Query().Get("campaignId"))
+	donations, err := store.GetDonations(campaignID, r.URL.Query().Get("status"))
+	if err != nil {
+		http.Error(w, "Error al recuperar el ledger", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(donations)
+}
+
+// FailedPaymentsResponse reúne los pagos que necesitan atención de un administrador.
+type FailedPaymentsResponse struct {
+	Donations             []model.Donation     `json:"donations"`             // El donante debe volver a donar
+	UnreconciledDonations []model.Donation     `json:"unreconciledDonations"` // Pagadas a medias o sin confirmar; se revisan en la wallet del donante
+	SponsorMatches        []model.SponsorMatch `json:"sponsorMatches"`        // Reintentables con el grant del patrocinador
+	Refunds               []model.Refund       `json:"refunds"`               // Se pueden volver a solicitar
+	UnreleasedMilestones  []model.Milestone    `json:"unreleasedMilestones"`  // Aprobados pero sin pago; se reintenta aprobándolos otra vez
+	ReleasingMilestones   []model.Milestone    `json:"releasingMilestones"`   // Con el pago en curso o sin confirmar; se concilian en /admin/milestones/{id}/reconcile
+}
+
+// AdminFailedPaymentsHandler lista los pagos fallidos o a medio completar.
+func AdminFailedPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	var resp FailedPaymentsResponse
+	var err error
+	if resp.Donations, err = store.GetDonations(0, model.DonationFailed); err != nil {
+		http.Error(w, "Error al recuperar las donaciones fallidas", http.StatusInternalServerError)
+		return
+	}
+	if resp.UnreconciledDonations, err = store.GetDonations(0, model.DonationNeedsReconciliation); err != nil {
+		http.Error(w, "Error al recuperar las donaciones sin conciliar", http.StatusInternalServerError)
+		return
+	}
+	if resp.SponsorMatches, err = store.GetMatchesByStatus(model.MatchFailed); err != nil {
+		http.Error(w, "Error al recuperar las contrapartidas fallidas", http.StatusInternalServerError)
+		return
+	}
+	if resp.Refunds, err = store.GetRefundsByStatus(model.RefundFailed); err != nil {
+		http.Error(w, "Error al recuperar los reembolsos fallidos", http.StatusInternalServerError)
+		return
+	}
+	if resp.UnreleasedMilestones, err = store.GetMilestonesByStatus(model.MilestoneApproved); err != nil {
+		http.Error(w, "Error al recuperar los hitos sin liberar", http.StatusInternalServerError)
+		return
+	}
+	if resp.ReleasingMilestones, err = store.GetMilestonesByStatus(model.MilestoneReleasing); err != nil {
+		http.Error(w, "Error al recuperar los hitos sin liberar", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// AdminRetrySponsorMatchHandler vuelve a intentar el pago de una contrapartida fallida.
+func AdminRetrySponsorMatchHandler(w http.ResponseWriter, r *http.Request) {
+	matchID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de contrapartida inválido", http.StatusBadRequest)
+		return
+	}
+
+	match, err := store.RetrySponsorMatch(matchID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrMatchNotFailed):
+			http.Error(w, "La contrapartida no existe o no está fallida", http.StatusConflict)
+		case errors.Is(err, store.ErrMatchCapExceeded):
+			http.Error(w, "El patrocinador ya no tiene capacidad para esta contrapartida", http.StatusConflict)
+		default:
+			http.Error(w, "No se pudo reintentar la contrapartida", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	sponsor, err := store.GetSponsorByID(match.SponsorID)
+	if err != nil || sponsor == nil {
+		store.FailSponsorMatch(match)
+		http.Error(w, "Error al recuperar el patrocinador", http.StatusInternalServerError)
+		return
+	}
+	if sponsor.Status != model.SponsorActive {
+		store.FailSponsorMatch(match)
+		http.Error(w, "El grant del patrocinador ya no está activo", http.StatusConflict)
+		return
+	}
+	campaign, err := store.GetCampaignByID(sponsor.CampaignID)
+	if err != nil || campaign == nil {
+		store.FailSponsorMatch(match)
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	opClient, err := openpayments.NewClient()
+	if err != nil {
+		store.FailSponsorMatch(match)
+		http.Error(w, "Error al inicializar el cliente de Open Payments", http.StatusInternalServerError)
+		return
+	}
+	if err := payMatch(r.Context(), opClient, campaign, sponsor, match); err != nil {
+		http.Error(w, "El pago de la contrapartida volvió a fallar", http.StatusBadGateway)
+		return
+	}
+
+	matches, _ := store.GetMatchesByDonation(match.DonationID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matches)
+}
+
+// AdminAuditLogHandler devuelve el registro de auditoría de administración.
+// Acepta ?limit= (máximo 500) y ?offset=.
+func AdminAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	entries, err := store.GetAdminAuditLog(limit, offset)
+	if err != nil {
+		http.Error(w, "Error al recuperar el registro de auditoría", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gofundme-backend/config"
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+)
+
+const (
+	requestIDContextKey contextKey = "requestId"
+	clientIPContextKey  contextKey = "clientIp"
+	actorContextKey     contextKey = "actorId"
+)
+
+// validRequestID acepta los IDs de petición que mandan proxies y clientes.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestContext da a cada petición un ID (el de la cabecera X-Request-ID si
+// viene una válida) y guarda en el contexto la IP del cliente y, si trae una
+// sesión vigente, quién la hace. Son los datos con los que se auditan las
+// acciones; la autorización sigue siendo cosa de Authenticate.
+func RequestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(requestID) {
+			raw := make([]byte, 16)
+			rand.Read(raw)
+			requestID = hex.EncodeToString(raw)
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+		ctx = context.WithValue(ctx, clientIPContextKey, clientIP(r))
+		if token := bearerToken(r); token != "" {
+			if user, err := store.GetSessionUser(token); err == nil && user != nil {
+				ctx = context.WithValue(ctx, actorContextKey, user.ID)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clientIP devuelve la IP de quien hace la petición. Solo se confía en
+// X-Forwarded-For si la configuración dice que hay un proxy delante.
+func clientIP(r *http.Request) string {
+	if config.TrustProxy() {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// recordAudit agrega un evento al log de auditoría con el actor, la IP y el ID
+// de la petición del contexto. Si event.ActorID es 0 se toma del usuario
+// autenticado o de la sesión de la petición. before y after son el estado
+// antes y después de la acción; pueden ser nil. Un fallo al auditar se
+// registra pero no interrumpe la acción, que puede haber movido dinero ya.
+func recordAudit(ctx context.Context, event model.AuditEvent, before, after any) {
+	if event.ActorID == 0 {
+		if user, ok := ctx.Value(userContextKey).(*model.User); ok && user != nil {
+			event.ActorID = user.ID
+		} else {
+			event.ActorID, _ = ctx.Value(actorContextKey).(int)
+		}
+	}
+	event.IP, _ = ctx.Value(clientIPContextKey).(string)
+	event.RequestID, _ = ctx.Value(requestIDContextKey).(string)
+	event.Before = auditPayload(before)
+	event.After = auditPayload(after)
+
+	if err := store.AddAuditEvent(&event); err != nil {
+		log.Printf("[ERROR] Evento de auditoría sin registrar: %s %s %s", event.Action, event.SubjectType, event.SubjectID)
+	}
+}
+
+func auditPayload(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	payload, err := json.Marshal(v)
+	if err != nil || string(payload) == "null" {
+		return nil
+	}
+	return payload
+}
+
+// campaignStatusChanged deja en el log de auditoría un cambio en el estado de
+// una campaña y, si la campaña dejó de recibir donaciones, avisa al creador
+// con el webhook campaign.closed.
+func campaignStatusChanged(ctx context.Context, before, after *model.Campaign) {
+	if after == nil {
+		return
+	}
+	var previous any
+	if before != nil {
+		previous = map[string]string{"status": before.Status, "takedownReason": before.TakedownReason}
+	}
+	recordAudit(ctx, model.AuditEvent{Action: model.AuditCampaignStatusChanged, SubjectType: "campaign", SubjectID: subjectID(after.ID)},
+		previous, map[string]string{"status": after.Status, "takedownReason": after.TakedownReason})
+
+	closed := after.Status == model.CampaignTakenDown || after.Status == model.CampaignClosed
+	if closed && (before == nil || before.Status != after.Status) {
+		emitCreatorEvent(after.UserID, newEventID(), model.CreatorEventCampaignClosed, map[string]any{
+			"campaignId": after.ID, "status": after.Status, "reason": after.TakedownReason,
+			"amountRaised": after.AmountRaised, "goal": after.Goal, "currency": after.Asset(),
+		})
+	}
+}
+
+// subjectID convierte el ID numérico de una entidad al formato del log de auditoría.
+func subjectID(id int) string {
+	return strconv.Itoa(id)
+}
+
+// AdminAuditEventsHandler consulta el log de auditoría. Filtros opcionales:
+// ?action= (exacta, o un prefijo terminado en punto como "refund."),
+// ?actorId=, ?requestId=, ?subjectType=, ?subjectId=, ?from= y ?to= en
+// RFC 3339, ?limit= (máximo 500) y ?offset=.
+func AdminAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := store.AuditFilter{
+		Action:      query.Get("action"),
+		RequestID:   query.Get("requestId"),
+		SubjectType: query.Get("subjectType"),
+		SubjectID:   query.Get("subjectId"),
+	}
+	filter.ActorID, _ = strconv.Atoi(query.Get("actorId"))
+	for name, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				http.Error(w, "Fecha inválida en "+name+", se espera RFC 3339", http.StatusBadRequest)
+				return
+			}
+			*dst = t
+		}
+	}
+	filter.Limit, _ = strconv.Atoi(query.Get("limit"))
+	if filter.Limit <= 0 || filter.Limit > 500 {
+		filter.Limit = 100
+	}
+	filter.Offset, _ = strconv.Atoi(query.Get("offset"))
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	events, err := store.GetAuditEvents(filter)
+	if err != nil {
+		http.Error(w, "Error al recuperar los eventos de auditoría", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// AuditVerification es el resultado de comprobar la cadena de auditoría.
+type AuditVerification struct {
+	Valid        bool   `json:"valid"`
+	Checked      int    `json:"checked"`
+	BrokenAtID   int    `json:"brokenAtId,omitempty"`
+	BrokenReason string `json:"brokenReason,omitempty"`
+}
+
+// AdminVerifyAuditHandler recorre la cadena de auditoría y dice si alguien la
+// alteró y desde qué evento.
+func AdminVerifyAuditHandler(w http.ResponseWriter, r *http.Request) {
+	checked, err := store.VerifyAuditChain(store.DB)
+	result := AuditVerification{Valid: err == nil, Checked: checked}
+	if err != nil {
+		var chainErr *store.AuditChainError
+		if !errors.As(err, &chainErr) {
+			http.Error(w, "Error al verificar el log de auditoría", http.StatusInternalServerError)
+			return
+		}
+		result.BrokenAtID = chainErr.EventID
+		result.BrokenReason = chainErr.Reason
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// currentUser devuelve el usuario autenticado por Authenticate, o nil.
+func currentUser(r *http.Request) *model.User {
+	user, _ := r.Context().Value(userContextKey).(*model.User)
+	return user
+}
+
+// bearerToken extrae el token de la cabecera "Authorization: Bearer <token>".
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// Authenticate exige una sesión vigente y deja el usuario en el contexto de la
+// petición. Las cuentas suspendidas no pueden usar la API autenticada.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" {
+			http.Error(w, "Se requiere iniciar sesión", http.StatusUnauthorized)
+			return
+		}
+		user, err := store.GetSessionUser(token)
+		if err != nil {
+			http.Error(w, "Error al validar la sesión", http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, "Sesión inválida o expirada", http.StatusUnauthorized)
+			return
+		}
+		if user.Suspended() {
+			http.Error(w, "La cuenta está suspendida", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	})
+}
+
+// RequirePermission envuelve un handler para que solo lo usen los roles con el
+// permiso indicado. Debe ir detrás de Authenticate.
+func RequirePermission(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := currentUser(r)
+		if user == nil || !model.HasPermission(user.Role, permission) {
+			http.Error(w, "Acceso denegado", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// maxAuditBody limita cuánto del cuerpo de una petición se guarda en auditoría.
+const maxAuditBody = 4 << 10
+
+// statusRecorder guarda el código de estado que escribe un handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// AuditAdmin registra en el log de auditoría cada acción de administración que
+// modifica algo: quién la hizo, la ruta, sus parámetros, el cuerpo y el
+// resultado. Las consultas (GET) no se registran.
+func AuditAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body []byte
+		if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			body, _ = io.ReadAll(io.LimitReader(r.Body, maxAuditBody+1))
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+			if len(body) > maxAuditBody {
+				body = body[:maxAuditBody]
+			}
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		params, _ := json.Marshal(mux.Vars(r))
+		entry := &model.AdminAuditEntry{
+			Method:     r.Method,
+			Route:      route,
+			Params:     string(params),
+			Body:       string(body),
+			StatusCode: recorder.status,
+		}
+		if user := currentUser(r); user != nil {
+			entry.ActorID = user.ID
+			entry.ActorName = user.Username
+		}
+		if err := store.AddAdminAuditEntry(entry); err != nil {
+			log.Printf("[ERROR] Acción de administración sin auditar: %s %s", r.Method, route)
+		}
+		recordAudit(r.Context(), model.AuditEvent{Action: model.AuditAdminAction, ActorID: entry.ActorID, SubjectType: "route", SubjectID: r.Method + " " + route}, nil,
+			map[string]any{"params": json.RawMessage(params), "body": entry.Body, "statusCode": entry.StatusCode})
+	})
+}
@@ -2,12 +2,18 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
 
+	"gofundme-backend/config"
 	"gofundme-backend/model"
+	"gofundme-backend/openpayments"
+	"gofundme-backend/risk"
 	"gofundme-backend/store"
 
 	"github.com/gorilla/mux"
@@ -18,9 +24,11 @@ func CreateCampaignHandler(w http.ResponseWriter, r *http.Request) {
 		Title          string  `json:"title"`
 		Description    string  `json:"description"`
 		Goal           float64 `json:"goal"`
-		Currency       string  `json:"currency"`
+		Currency       string  `json:"currency"` // Ignorado: la moneda real se toma de la wallet
 		PaymentPointer string  `json:"paymentPointer"`
-		UserID         int     `json:"userId"` // El ID del usuario que crea la campaña
+
+		Beneficiaries []model.Beneficiary `json:"beneficiaries"`
+		Escrow        bool                `json:"escrow"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
@@ -28,18 +36,73 @@ func CreateCampaignHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if requestBody.UserID == 0 {
-		http.Error(w, "El ID del usuario es obligatorio", http.StatusBadRequest)
+	creator := currentUser(r)
+
+	// Las campañas nacen sin verificar y pueden tener una meta máxima.
+	if limit := config.UnverifiedMaxGoal(); limit > 0 && requestBody.Goal > limit {
+		http.Error(w, fmt.Sprintf("Las campañas sin verificar tienen una meta máxima de %.2f", limit), http.StatusBadRequest)
+		return
+	}
+
+	// Sin reparto explícito, todo va al payment pointer de la campaña.
+	beneficiaries := requestBody.Beneficiaries
+	if len(beneficiaries) == 0 {
+		beneficiaries = []model.Beneficiary{{WalletAddress: requestBody.PaymentPointer, Share: 100}}
+	}
+	if err := validateBeneficiaries(beneficiaries); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if requestBody.Escrow && len(beneficiaries) > 1 {
+		http.Error(w, "Las campañas con escrow liberan los fondos a un solo payment pointer", http.StatusBadRequest)
+		return
+	}
+
+	// Resolver cada wallet: así los errores de escritura aparecen ahora y no
+	// cuando alguien intenta donar.
+	opClient, err := openpayments.NewClient()
+	if err != nil {
+		http.Error(w, "Error al inicializar el cliente de Open Payments", http.StatusInternalServerError)
+		return
+	}
+	for i := range beneficiaries {
+		info, ok := resolveWallet(w, r, opClient, beneficiaries[i].WalletAddress)
+		if !ok {
+			return
+		}
+		beneficiaries[i].WalletAddress = info.URL
+	}
+	if requestBody.PaymentPointer == "" {
+		requestBody.PaymentPointer = beneficiaries[0].WalletAddress
+	}
+	wallet, ok := resolveWallet(w, r, opClient, requestBody.PaymentPointer)
+	if !ok {
 		return
 	}
 
 	campaign := model.Campaign{
-		UserID:         requestBody.UserID,
+		UserID:         creator.ID,
 		Title:          requestBody.Title,
 		Description:    requestBody.Description,
 		Goal:           requestBody.Goal,
-		Currency:       requestBody.Currency,
-		PaymentPointer: requestBody.PaymentPointer,
+		Currency:       wallet.AssetCode,
+		PaymentPointer: wallet.URL,
+		Beneficiaries:  beneficiaries,
+		Escrow:         requestBody.Escrow,
+		AssetCode:      wallet.AssetCode,
+		AssetScale:     wallet.AssetScale,
+		AuthServer:     wallet.AuthServer,
+	}
+
+	assessment, err := risk.EvaluateCampaign(&campaign, creator)
+	if err != nil {
+		http.Error(w, "Error al evaluar el riesgo de la campaña", http.StatusInternalServerError)
+		return
+	}
+	if assessment.Action == model.RiskBlock {
+		risk.Record(assessment)
+		http.Error(w, "La campaña no se puede publicar", http.StatusForbidden)
+		return
 	}
 
 	id, err := store.CreateCampaign(campaign)
@@ -49,13 +112,121 @@ func CreateCampaignHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	campaign.ID = id
+	campaign.Status = model.CampaignActive
+	assessment.SubjectID = id
+	risk.Record(assessment)
+	if assessment.Action == model.RiskHold {
+		if _, err := store.SetCampaignStatus(id, model.CampaignUnderReview, ""); err == nil {
+			campaign.Status = model.CampaignUnderReview
+		}
+	}
 	campaign.CreatedAt = time.Now() // Aproximación, idealmente se leería de la BD.
+	store.PromoteToCreator(creator.ID)
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditCampaignCreated, SubjectType: "campaign", SubjectID: subjectID(id)}, nil, campaign)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(campaign)
 }
 
+// UpdateCampaignPayoutHandler cambia a dónde van las donaciones de una
+// campaña. Solo puede hacerlo su creador y, si tiene la verificación en dos
+// pasos, con un código confirmado hace poco (ver RequireFreshTwoFactor).
+func UpdateCampaignPayoutHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		PaymentPointer string              `json:"paymentPointer"`
+		Beneficiaries  []model.Beneficiary `json:"beneficiaries"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la petición inválido", http.StatusBadRequest)
+		return
+	}
+
+	campaign, err := store.GetCampaignByID(id)
+	if err != nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	if campaign == nil {
+		http.Error(w, "Campaña no encontrada", http.StatusNotFound)
+		return
+	}
+	if campaign.UserID != currentUser(r).ID {
+		http.Error(w, "Solo el creador puede cambiar la wallet de la campaña", http.StatusForbidden)
+		return
+	}
+	if campaign.Status == model.CampaignTakenDown {
+		http.Error(w, "La campaña fue retirada", http.StatusGone)
+		return
+	}
+
+	beneficiaries := requestBody.Beneficiaries
+	if len(beneficiaries) == 0 {
+		beneficiaries = []model.Beneficiary{{WalletAddress: requestBody.PaymentPointer, Share: 100}}
+	}
+	if err := validateBeneficiaries(beneficiaries); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if campaign.Escrow && len(beneficiaries) > 1 {
+		http.Error(w, "Las campañas con escrow liberan los fondos a un solo payment pointer", http.StatusBadRequest)
+		return
+	}
+
+	// Los montos de la campaña están en su activo, así que las wallets nuevas
+	// tienen que usar el mismo.
+	opClient, err := openpayments.NewClient()
+	if err != nil {
+		http.Error(w, "Error al inicializar el cliente de Open Payments", http.StatusInternalServerError)
+		return
+	}
+	for i := range beneficiaries {
+		info, ok := resolveWallet(w, r, opClient, beneficiaries[i].WalletAddress)
+		if !ok {
+			return
+		}
+		if info.AssetCode != campaign.Asset() {
+			http.Error(w, fmt.Sprintf("La wallet %s usa %s, pero la campaña recauda en %s", info.URL, info.AssetCode, campaign.Asset()), http.StatusBadRequest)
+			return
+		}
+		beneficiaries[i].WalletAddress = info.URL
+	}
+	if requestBody.PaymentPointer == "" {
+		requestBody.PaymentPointer = beneficiaries[0].WalletAddress
+	}
+	wallet, ok := resolveWallet(w, r, opClient, requestBody.PaymentPointer)
+	if !ok {
+		return
+	}
+	if wallet.AssetCode != campaign.Asset() {
+		http.Error(w, fmt.Sprintf("La wallet %s usa %s, pero la campaña recauda en %s", wallet.URL, wallet.AssetCode, campaign.Asset()), http.StatusBadRequest)
+		return
+	}
+
+	if err := store.UpdateCampaignPayout(campaign.ID, wallet.URL, wallet.AuthServer, beneficiaries); err != nil {
+		http.Error(w, "No se pudo cambiar la wallet de la campaña", http.StatusInternalServerError)
+		return
+	}
+	updated, err := store.GetCampaignByID(campaign.ID)
+	if err != nil || updated == nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditCampaignPayoutChanged, SubjectType: "campaign", SubjectID: subjectID(campaign.ID)},
+		map[string]any{"paymentPointer": campaign.PaymentPointer, "beneficiaries": campaign.Beneficiaries},
+		map[string]any{"paymentPointer": updated.PaymentPointer, "beneficiaries": updated.Beneficiaries})
+	store.CreateNotification(campaign.UserID, "campaign_payout_changed", "Cambió la wallet que recibe las donaciones de tu campaña: "+campaign.Title)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
 func GetCampaignsHandler(w http.ResponseWriter, r *http.Request) {
 	campaigns, err := store.GetCampaigns()
 	if err != nil {
@@ -65,7 +236,7 @@ func GetCampaignsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(campaigns)
+	json.NewEncoder(w).Encode(visibleCampaigns(campaigns))
 }
 
 func GetCampaignHandler(w http.ResponseWriter, r *http.Request) {
@@ -89,11 +260,100 @@ func GetCampaignHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Campaña no encontrada", http.StatusNotFound)
 		return
 	}
+	if campaign.Status == model.CampaignTakenDown {
+		http.Error(w, "La campaña fue retirada: "+campaign.TakedownReason, http.StatusGone)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(campaign)
 }
 
+// CloseCampaignHandler permite al creador cerrar su campaña: deja de listarse
+// y de recibir donaciones. Una campaña cerrada no se puede reabrir.
+func CloseCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+
+	before, err := store.GetCampaignByID(id)
+	if err != nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	if before == nil {
+		http.Error(w, "Campaña no encontrada", http.StatusNotFound)
+		return
+	}
+	if before.UserID != currentUser(r).ID {
+		http.Error(w, "Solo el creador puede cerrar la campaña", http.StatusForbidden)
+		return
+	}
+	switch before.Status {
+	case model.CampaignTakenDown:
+		http.Error(w, "La campaña fue retirada", http.StatusGone)
+		return
+	case model.CampaignClosed:
+		http.Error(w, "La campaña ya está cerrada", http.StatusConflict)
+		return
+	}
+
+	if _, err := store.SetCampaignStatus(id, model.CampaignClosed, ""); err != nil {
+		http.Error(w, "No se pudo cerrar la campaña", http.StatusInternalServerError)
+		return
+	}
+	campaign, err := store.GetCampaignByID(id)
+	if err != nil || campaign == nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	campaignStatusChanged(r.Context(), before, campaign)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(campaign)
+}
+
+// GetCampaignProgressHandler devuelve lo recaudado en el activo de la campaña,
+// desglosado por el activo con el que pagaron los donantes.
+func GetCampaignProgressHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+
+	campaign, err := store.GetCampaignByID(id)
+	if err != nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	if campaign == nil {
+		http.Error(w, "Campaña no encontrada", http.StatusNotFound)
+		return
+	}
+
+	breakdown, err := store.GetDonationBreakdown(campaign.ID)
+	if err != nil {
+		http.Error(w, "Error al calcular el progreso de la campaña", http.StatusInternalServerError)
+		return
+	}
+
+	progress := model.CampaignProgress{
+		AssetCode:    campaign.Asset(),
+		Goal:         campaign.Goal,
+		AmountRaised: campaign.AmountRaised,
+		Breakdown:    breakdown,
+	}
+	if campaign.Goal > 0 {
+		progress.Percent = math.Round(campaign.AmountRaised/campaign.Goal*10000) / 100
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
+
 func GetAllCampaignsForIndexingHandler(w http.ResponseWriter, r *http.Request) {
 	// Usamos la función que ya existe en el store para obtener todas las campañas
 	campaigns, err := store.GetCampaigns()
@@ -105,5 +365,24 @@ func GetAllCampaignsForIndexingHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Establecemos la cabecera y enviamos la respuesta en formato JSON
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(campaigns)
+	json.NewEncoder(w).Encode(visibleCampaigns(campaigns))
+}
+
+// validateBeneficiaries comprueba que cada beneficiario tenga wallet y un
+// porcentaje positivo, y que los porcentajes sumen 100.
+func validateBeneficiaries(beneficiaries []model.Beneficiary) error {
+	var total float64
+	for _, b := range beneficiaries {
+		if b.WalletAddress == "" {
+			return errors.New("Cada beneficiario necesita una wallet")
+		}
+		if b.Share <= 0 {
+			return errors.New("El porcentaje de cada beneficiario debe ser mayor que cero")
+		}
+		total += b.Share
+	}
+	if math.Abs(total-100) > 0.01 {
+		return fmt.Errorf("Los porcentajes de los beneficiarios suman %.2f, deben sumar 100", total)
+	}
+	return nil
 }
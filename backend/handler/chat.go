@@ -3,6 +3,8 @@ package handler
 import (
 	"encoding/json"
 	"gofundme-backend/chatbot" // Importamos nuestro nuevo paquete
+	"gofundme-backend/model"
+	"gofundme-backend/store"
 	"log"
 	"net/http"
 )
@@ -36,7 +38,19 @@ func ChatHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 3. Si todo fue bien, devolvemos la respuesta del bot como JSON
+	// 3. Si la petición trae sesión, guardamos la conversación en el historial
+	// del usuario, que puede exportar con GET /api/me/export.
+	if userID, ok := r.Context().Value(actorContextKey).(int); ok {
+		store.SaveChatMessage(&model.ChatMessage{
+			UserID:   userID,
+			Prompt:   requestPayload.Prompt,
+			Response: botResponse.Respuesta,
+			Action:   botResponse.Action,
+			URL:      botResponse.URL,
+		})
+	}
+
+	// 4. Si todo fue bien, devolvemos la respuesta del bot como JSON
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(botResponse)
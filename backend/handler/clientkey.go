@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"gofundme-backend/clientkeys"
+	"gofundme-backend/config"
+)
+
+// GetClientJWKSHandler publica las llaves públicas con las que el backend firma
+// sus peticiones a Open Payments. Es la URL que se registra como JWKS de la
+// wallet del cliente, la única identidad con la que firma el backend.
+func GetClientJWKSHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := clientkeys.JWKS(config.ClientWalletAddress(), time.Now(), config.ClientKeyOverlap())
+	if err != nil {
+		http.Error(w, "Error al obtener las llaves de cliente", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(struct {
+		Keys []clientkeys.JWK `json:"keys"`
+	}{keys})
+}
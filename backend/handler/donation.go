@@ -2,11 +2,18 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"math"
 	"net/http"
 	"strconv"
+	"time"
 
+	"gofundme-backend/config"
+	"gofundme-backend/model"
 	"gofundme-backend/openpayments"
+	"gofundme-backend/openpayments/final"
+	"gofundme-backend/rates"
 	"gofundme-backend/store"
 
 	"github.com/gorilla/mux"
@@ -14,7 +21,17 @@ import (
 
 type DonationRequest struct {
 	Amount   float64 `json:"amount"`
-	Currency string  `json:"currency"`
+	Currency string  `json:"currency"` // Moneda del monto; por defecto la de la campaña
+	UserID   int     `json:"userId"`   // Donante registrado, para avisarle de reembolsos; opcional
+}
+
+// DonationResponse conserva en la raíz los campos del primer incoming payment
+// (el frontend lee `ID`) y añade la donación completa con todos sus pagos.
+type DonationResponse struct {
+	*final.FinalResponse
+	DonationID       int                    `json:"donationId"`
+	Status           string                 `json:"status"`
+	IncomingPayments []*final.FinalResponse `json:"incomingPayments"`
 }
 
 func CreateDonationHandler(w http.ResponseWriter, r *http.Request) {
@@ -40,6 +57,50 @@ func CreateDonationHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Campaña no encontrada", http.StatusNotFound)
 		return
 	}
+	if campaign.Status == model.CampaignTakenDown {
+		http.Error(w, "La campaña fue retirada y no acepta donaciones", http.StatusGone)
+		return
+	}
+	if campaign.Status == model.CampaignClosed {
+		http.Error(w, "La campaña fue cerrada por su creador y no acepta donaciones", http.StatusGone)
+		return
+	}
+	if campaign.Status == model.CampaignUnderReview {
+		http.Error(w, "La campaña está en revisión y no acepta donaciones por ahora", http.StatusConflict)
+		return
+	}
+
+	// En campañas con escrow todo se deposita en la wallet de la plataforma
+	// hasta que se aprueben los hitos.
+	recipients := campaign.Beneficiaries
+	if campaign.Escrow {
+		recipients = []model.Beneficiary{{WalletAddress: config.PlatformWalletAddress(), Share: 100}}
+	}
+	if len(recipients) == 0 {
+		http.Error(w, "La campaña no tiene beneficiarios", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Amount <= 0 {
+		http.Error(w, "El monto de la donación debe ser positivo", http.StatusBadRequest)
+		return
+	}
+
+	// El donante puede expresar el monto en su moneda; los incoming payments se
+	// crean en el activo de la campaña.
+	donorCurrency := req.Currency
+	if donorCurrency == "" {
+		donorCurrency = campaign.Asset()
+	}
+	campaignAmount, err := rates.Convert(r.Context(), req.Amount, donorCurrency, campaign.Asset())
+	if err != nil {
+		if errors.Is(err, rates.ErrRateNotFound) {
+			http.Error(w, "No hay tasa de cambio de "+donorCurrency+" a "+campaign.Asset(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "Error al convertir el monto de la donación", http.StatusInternalServerError)
+		return
+	}
 
 	opClient, err := openpayments.NewClient()
 	if err != nil {
@@ -47,16 +108,181 @@ func CreateDonationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	amountInMinorUnits := int64(math.Round(req.Amount * 100))
+	scale := math.Pow10(campaign.Scale())
+	amountInMinorUnits := int64(math.Round(campaignAmount * scale))
 	description := "Donación para la campaña: " + campaign.Title
 
-	incomingPayment, err := opClient.CreateIncomingPayment(r.Context(), campaign.PaymentPointer, amountInMinorUnits, description)
-	if err != nil {
-		http.Error(w, "No se pudo procesar la solicitud de donación con Open Payments", http.StatusInternalServerError)
+	// Un incoming payment por beneficiario, cada uno por su parte de la donación.
+	amounts := splitAmount(amountInMinorUnits, recipients)
+	donation := &model.Donation{
+		CampaignID:       campaign.ID,
+		Amount:           float64(amountInMinorUnits) / scale,
+		Currency:         campaign.Asset(),
+		OriginalAmount:   req.Amount,
+		OriginalCurrency: donorCurrency,
+		DonorUserID:      req.UserID,
+	}
+	var incomingPayments []*final.FinalResponse
+	for i, b := range recipients {
+		if amounts[i] == 0 {
+			continue
+		}
+		incomingPayment, err := opClient.CreateIncomingPayment(r.Context(), b.WalletAddress, amounts[i], description)
+		if err != nil {
+			log.Printf("Error al crear el incoming payment para %s: %v", b.WalletAddress, err)
+			http.Error(w, "No se pudo procesar la solicitud de donación con Open Payments", http.StatusInternalServerError)
+			return
+		}
+		incomingPayments = append(incomingPayments, incomingPayment)
+		donation.Splits = append(donation.Splits, model.DonationSplit{
+			WalletAddress:     b.WalletAddress,
+			Share:             b.Share,
+			Amount:            amounts[i],
+			IncomingPaymentID: incomingPayment.ID,
+		})
+	}
+	if len(incomingPayments) == 0 {
+		http.Error(w, "El monto de la donación es demasiado pequeño", http.StatusBadRequest)
+		return
+	}
+
+	if err := store.CreateDonation(donation); err != nil {
+		http.Error(w, "No se pudo registrar la donación", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(incomingPayment)
+	json.NewEncoder(w).Encode(DonationResponse{
+		FinalResponse:    incomingPayments[0],
+		DonationID:       donation.ID,
+		Status:           donation.Status,
+		IncomingPayments: incomingPayments,
+	})
+}
+
+// DonationStatusResponse es el estado de una donación con su historial, sin
+// los datos del donante.
+type DonationStatusResponse struct {
+	ID               int                        `json:"id"`
+	CampaignID       int                        `json:"campaignId"`
+	Status           string                     `json:"status"`
+	InProgress       bool                       `json:"inProgress"`
+	Amount           float64                    `json:"amount"`
+	Currency         string                     `json:"currency"`
+	OriginalAmount   float64                    `json:"originalAmount"`
+	OriginalCurrency string                     `json:"originalCurrency"`
+	RefundedAmount   float64                    `json:"refundedAmount"`
+	StatusUpdatedAt  time.Time                  `json:"statusUpdatedAt"`
+	CreatedAt        time.Time                  `json:"createdAt"`
+	CompletedAt      *time.Time                 `json:"completedAt,omitempty"`
+	Transitions      []model.DonationTransition `json:"transitions"`
+}
+
+const (
+	// maxDonationWait limita cuánto espera GET /donations/{id}?wait=.
+	maxDonationWait = 30 * time.Second
+
+	// donationPollInterval es cada cuánto se vuelve a leer la donación mientras
+	// se espera un cambio de estado.
+	donationPollInterval = 500 * time.Millisecond
+)
+
+// GetDonationHandler devuelve el estado de una donación y su historial, para
+// que el frontend siga el pago después de volver de la wallet. Con ?wait=N
+// (segundos, hasta 30) la respuesta espera a que el estado deje de ser el de
+// ?status= o, sin él, el actual; si no cambia, devuelve el mismo estado al
+// terminar la espera. Así el frontend puede quedarse escuchando en lugar de
+// consultar sin parar.
+func GetDonationHandler(w http.ResponseWriter, r *http.Request) {
+	donationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de donación inválido", http.StatusBadRequest)
+		return
+	}
+	wait := time.Duration(0)
+	if value := r.URL.Query().Get("wait"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			http.Error(w, "wait debe ser un número de segundos", http.StatusBadRequest)
+			return
+		}
+		wait = min(time.Duration(seconds)*time.Second, maxDonationWait)
+	}
+
+	donation, err := store.GetDonationByID(donationID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la donación", http.StatusInternalServerError)
+		return
+	}
+	if donation == nil {
+		http.Error(w, "Donación no encontrada", http.StatusNotFound)
+		return
+	}
+
+	known := r.URL.Query().Get("status")
+	if known == "" {
+		known = donation.Status
+	}
+	if wait > 0 && donation.Status == known {
+		deadline := time.NewTimer(wait)
+		defer deadline.Stop()
+		ticker := time.NewTicker(donationPollInterval)
+		defer ticker.Stop()
+	poll:
+		for donation.Status == known {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-deadline.C:
+				break poll
+			case <-ticker.C:
+				current, err := store.GetDonationByID(donationID)
+				if err != nil || current == nil {
+					http.Error(w, "Error al recuperar la donación", http.StatusInternalServerError)
+					return
+				}
+				donation = current
+			}
+		}
+	}
+
+	transitions, err := store.GetDonationTransitions(donation.ID)
+	if err != nil {
+		http.Error(w, "Error al recuperar el historial de la donación", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(DonationStatusResponse{
+		ID:               donation.ID,
+		CampaignID:       donation.CampaignID,
+		Status:           donation.Status,
+		InProgress:       model.DonationInProgress(donation.Status),
+		Amount:           donation.Amount,
+		Currency:         donation.Currency,
+		OriginalAmount:   donation.OriginalAmount,
+		OriginalCurrency: donation.OriginalCurrency,
+		RefundedAmount:   donation.RefundedAmount,
+		StatusUpdatedAt:  donation.StatusUpdatedAt,
+		CreatedAt:        donation.CreatedAt,
+		CompletedAt:      donation.CompletedAt,
+		Transitions:      transitions,
+	})
+}
+
+// splitAmount reparte un monto en unidades mínimas según los porcentajes de los
+// beneficiarios. Lo que sobra por redondeo se asigna al primer beneficiario
+// para que la suma coincida siempre con el total.
+func splitAmount(total int64, beneficiaries []model.Beneficiary) []int64 {
+	amounts := make([]int64, len(beneficiaries))
+	var assigned int64
+	for i, b := range beneficiaries {
+		amounts[i] = int64(math.Floor(float64(total) * b.Share / 100))
+		assigned += amounts[i]
+	}
+	if len(amounts) > 0 {
+		amounts[0] += total - assigned
+	}
+	return amounts
 }
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"slices"
+	"testing"
+
+	"gofundme-backend/model"
+)
+
+func TestSplitAmount(t *testing.T) {
+	shares := func(s ...float64) []model.Beneficiary {
+		beneficiaries := make([]model.Beneficiary, len(s))
+		for i, share := range s {
+			beneficiaries[i] = model.Beneficiary{Share: share}
+		}
+		return beneficiaries
+	}
+
+	tests := []struct {
+		name          string
+		total         int64
+		beneficiaries []model.Beneficiary
+		want          []int64
+	}{
+		{"una sola parte", 1234, shares(100), []int64{1234}},
+		{"partes exactas", 1000, shares(70, 30), []int64{700, 300}},
+		{"resto de redondeo a la primera", 100, shares(33.34, 33.33, 33.33), []int64{34, 33, 33}},
+		{"impar a medias", 101, shares(50, 50), []int64{51, 50}},
+		{"un centavo", 1, shares(50, 50), []int64{1, 0}},
+		{"sin beneficiarios", 100, nil, []int64{}},
+	}
+	for _, tt := range tests {
+		if got := splitAmount(tt.total, tt.beneficiaries); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: splitAmount(%d) = %v, quería %v", tt.name, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestSplitAmountAddsUpToTheTotal(t *testing.T) {
+	beneficiaries := []model.Beneficiary{{Share: 12.5}, {Share: 33.3}, {Share: 0.7}, {Share: 53.5}}
+	for total := int64(0); total < 5000; total += 7 {
+		var sum int64
+		for _, amount := range splitAmount(total, beneficiaries) {
+			if amount < 0 {
+				t.Fatalf("splitAmount(%d) tiene una parte negativa", total)
+			}
+			sum += amount
+		}
+		if sum != total {
+			t.Fatalf("splitAmount(%d) suma %d", total, sum)
+		}
+	}
+}
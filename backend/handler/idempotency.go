@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gofundme-backend/config"
+	"gofundme-backend/store"
+)
+
+const (
+	// idempotencyLease es cuánto se reserva una clave mientras su petición se
+	// procesa. Si el servidor se cae a mitad, la misma petición se puede
+	// repetir pasado este tiempo.
+	idempotencyLease = 2 * time.Minute
+
+	// maxIdempotentBody limita el cuerpo de una petición con Idempotency-Key.
+	maxIdempotentBody = 1 << 20
+
+	// maxIdempotencyKey limita el largo de la cabecera Idempotency-Key.
+	maxIdempotencyKey = 255
+)
+
+// idempotencyRecorder guarda el código y el cuerpo de la respuesta mientras
+// se escriben.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *idempotencyRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Idempotent hace que una petición con la cabecera Idempotency-Key se procese
+// una sola vez. Si se repite con la misma clave, se devuelve la respuesta
+// original con Idempotent-Replayed: true, sin volver a ejecutar el handler.
+// Reusar la clave para otra petición (otra ruta u otro cuerpo) da 422, y
+// repetirla mientras la primera sigue en curso da 409. Una respuesta 5xx no
+// se guarda y libera la clave, para que se pueda reintentar. Las claves son de
+// cada usuario, o de cada IP para quien no inició sesión, y se guardan
+// config.IdempotencyKeyTTL. Sin la cabecera la petición pasa igual que
+// siempre. Va después de Authenticate y RequirePermission, si los hay.
+func Idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			http.Error(w, "Idempotency-Key demasiado larga", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+		if err != nil {
+			http.Error(w, "Cuerpo de la petición demasiado grande", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(r, body)
+		entry, reserved, err := store.ReserveIdempotencyKey(idempotencyScope(r), key, fingerprint, idempotencyLease, config.IdempotencyKeyTTL())
+		if err != nil || entry == nil {
+			http.Error(w, "Error al comprobar la Idempotency-Key", http.StatusInternalServerError)
+			return
+		}
+		if !reserved {
+			switch {
+			case entry.Fingerprint != fingerprint:
+				http.Error(w, "La Idempotency-Key ya se usó con otra petición", http.StatusUnprocessableEntity)
+			case entry.StatusCode == 0:
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "Ya hay una petición en curso con esta Idempotency-Key", http.StatusConflict)
+			default:
+				if entry.ContentType != "" {
+					w.Header().Set("Content-Type", entry.ContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(entry.StatusCode)
+				w.Write(entry.ResponseBody)
+			}
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		// Un error del servidor no se guarda: la clave se libera para que el
+		// cliente pueda reintentar la misma petición.
+		if rec.status >= http.StatusInternalServerError {
+			store.ReleaseIdempotencyKey(entry.ID)
+			return
+		}
+		store.SaveIdempotentResponse(entry.ID, rec.status, w.Header().Get("Content-Type"), rec.body.Bytes())
+	}
+}
+
+// idempotencyScope es el dueño de las claves de la petición: el usuario de la
+// sesión o, si no hay, la IP.
+func idempotencyScope(r *http.Request) string {
+	if user := currentUser(r); user != nil {
+		return "user:" + strconv.Itoa(user.ID)
+	}
+	if userID, ok := r.Context().Value(actorContextKey).(int); ok {
+		return "user:" + strconv.Itoa(userID)
+	}
+	return "ip:" + clientIP(r)
+}
+
+// requestFingerprint resume el método, la ruta y el cuerpo de la petición
+// para reconocer si una clave se reusa para otra cosa.
+func requestFingerprint(r *http.Request, body []byte) string {
+	sum := sha256.New()
+	io.WriteString(sum, r.Method+" "+r.URL.RequestURI()+"\n")
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// countingHandler responde status con un cuerpo que dice cuántas veces se
+// ejecutó.
+func countingHandler(status *int, calls *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(*status)
+		fmt.Fprintf(w, `{"call":%d}`, *calls)
+	}
+}
+
+func postIdempotent(h http.HandlerFunc, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/payments/initiate", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	h(w, req)
+	return w
+}
+
+func TestIdempotentReplaysTheFirstResponse(t *testing.T) {
+	openTestStore(t)
+	status, calls := http.StatusCreated, 0
+	h := Idempotent(countingHandler(&status, &calls))
+
+	first := postIdempotent(h, "clave-1", `{"amount":10}`)
+	second := postIdempotent(h, "clave-1", `{"amount":10}`)
+	if calls != 1 {
+		t.Fatalf("el handler se ejecutó %d veces, quería 1", calls)
+	}
+	if second.Code != first.Code || second.Body.String() != first.Body.String() || second.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("repetición = %d %q, quería %d %q", second.Code, second.Body.String(), first.Code, first.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("falta Idempotent-Replayed en la repetición")
+	}
+
+	if w := postIdempotent(h, "clave-1", `{"amount":20}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("clave reusada con otro cuerpo = %d, quería 422", w.Code)
+	}
+	if w := postIdempotent(h, "clave-2", `{"amount":20}`); w.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("otra clave = %d tras %d llamadas, quería 201 tras 2", w.Code, calls)
+	}
+}
+
+func TestIdempotentDoesNotStoreServerErrors(t *testing.T) {
+	openTestStore(t)
+	status, calls := http.StatusBadGateway, 0
+	h := Idempotent(countingHandler(&status, &calls))
+
+	if w := postIdempotent(h, "clave", `{}`); w.Code != http.StatusBadGateway {
+		t.Fatalf("primer intento = %d, quería 502", w.Code)
+	}
+	status = http.StatusOK
+	w := postIdempotent(h, "clave", `{}`)
+	if w.Code != http.StatusOK || calls != 2 || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("reintento = %d tras %d llamadas, quería 200 ejecutando el handler otra vez", w.Code, calls)
+	}
+
+	// Un 4xx sí se guarda.
+	status = http.StatusBadRequest
+	postIdempotent(h, "otra", `{}`)
+	status = http.StatusOK
+	if w := postIdempotent(h, "otra", `{}`); w.Code != http.StatusBadRequest || calls != 3 {
+		t.Errorf("repetición de un 400 = %d tras %d llamadas, quería 400 tras 3", w.Code, calls)
+	}
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gofundme-backend/config"
+	"gofundme-backend/jobs"
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+// Tipos de trabajo en segundo plano.
+const (
+	jobDeliverWebhook     = "webhooks.deliver"
+	jobRetryWebhookEvents = "openpayments.webhooks.retry"
+	jobPurgeAccounts      = "accounts.purge"
+	jobCleanupGrants      = "payments.grants.cleanup"
+	jobPruneJobs          = "jobs.prune"
+	jobRelayOutbox        = "outbox.relay"
+	jobReconcileDonation  = "donations.reconcile"
+	jobSweepDeliveries    = "webhooks.sweep"
+	jobCleanupIdempotency = "idempotency.cleanup"
+)
+
+// deliverWebhookJob es el payload de jobDeliverWebhook.
+type deliverWebhookJob struct {
+	DeliveryID int `json:"deliveryId"`
+}
+
+// reconcileDonationJob es el payload de jobReconcileDonation.
+type reconcileDonationJob struct {
+	DonationID int `json:"donationId"`
+}
+
+// RegisterJobs registra los handlers de los trabajos en segundo plano. main la
+// llama antes de jobs.Run.
+func RegisterJobs() {
+	// Cada trabajo es un intento de entrega; los reintentos los encola
+	// sendWebhook según el log de la entrega.
+	jobs.Register(jobDeliverWebhook, jobs.Options{Concurrency: 4, Timeout: config.WebhookTimeout() + 10*time.Second},
+		func(ctx context.Context, job deliverWebhookJob) error {
+			deliverWebhook(ctx, job.DeliveryID)
+			return nil
+		})
+
+	jobs.Register(jobSweepDeliveries, jobs.Options{Every: 5 * time.Minute}, func(ctx context.Context, _ struct{}) error {
+		return SweepWebhookDeliveries(ctx)
+	})
+
+	// El relay se adelanta cada vez que se guarda algo en el outbox; la
+	// ejecución periódica recoge lo que quedó si el proceso murió antes.
+	jobs.Register(jobRelayOutbox, jobs.Options{Every: time.Minute}, func(ctx context.Context, _ struct{}) error {
+		return RelayOutbox(ctx)
+	})
+
+	// Con una espera base de 10 minutos, los reintentos cubren unas 10 horas
+	// esperando el webhook del incoming payment.
+	jobs.Register(jobReconcileDonation, jobs.Options{RetryBase: 10 * time.Minute, MaxAttempts: 7}, reconcileDonation)
+
+	jobs.Register(jobRetryWebhookEvents, jobs.Options{Every: time.Minute}, func(ctx context.Context, _ struct{}) error {
+		RetryWebhookEvents(ctx)
+		return nil
+	})
+
+	jobs.Register(jobPurgeAccounts, jobs.Options{Every: time.Hour}, func(ctx context.Context, _ struct{}) error {
+		PurgeDeletedAccounts(ctx)
+		return nil
+	})
+
+	jobs.Register(jobCleanupGrants, jobs.Options{Every: time.Hour}, func(ctx context.Context, _ struct{}) error {
+		expired, err := store.ExpireStaleDonations(config.PaymentGrantTTL())
+		if expired > 0 {
+			log.Printf("%d donaciones sin terminar vencidas", expired)
+		}
+		if err != nil {
+			return err
+		}
+		n, err := store.DeleteExpiredPaymentGrants(config.PaymentGrantTTL())
+		if n > 0 {
+			log.Printf("%d grants de pago vencidos borrados", n)
+		}
+		return err
+	})
+
+	jobs.Register(jobCleanupIdempotency, jobs.Options{Every: time.Hour}, func(ctx context.Context, _ struct{}) error {
+		_, err := store.DeleteExpiredIdempotencyKeys(config.IdempotencyKeyTTL())
+		return err
+	})
+
+	jobs.Register(jobPruneJobs, jobs.Options{Every: 24 * time.Hour}, func(ctx context.Context, _ struct{}) error {
+		if _, err := store.PruneJobs(time.Now().Add(-config.JobRetention())); err != nil {
+			return err
+		}
+		_, err := store.PruneOutbox(time.Now().Add(-config.JobRetention()))
+		return err
+	})
+}
+
+// AdminListJobsHandler lista los trabajos en segundo plano. Filtros opcionales:
+// ?status=, ?type=, ?limit= (máximo 500) y ?offset=.
+func AdminListJobsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	list, err := store.GetJobs(query.Get("status"), query.Get("type"), limit, offset)
+	if err != nil {
+		http.Error(w, "Error al recuperar los trabajos", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// AdminRetryJobHandler vuelve a encolar un trabajo fallido o muerto con todos
+// sus intentos disponibles.
+func AdminRetryJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de trabajo inválido", http.StatusBadRequest)
+		return
+	}
+	job, err := store.GetJob(id)
+	if err != nil {
+		http.Error(w, "Error al recuperar el trabajo", http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		http.Error(w, "Trabajo no encontrado", http.StatusNotFound)
+		return
+	}
+	if job.Status != model.JobFailed && job.Status != model.JobDead {
+		http.Error(w, "Solo se pueden reintentar trabajos fallidos o muertos", http.StatusConflict)
+		return
+	}
+
+	if _, err := jobs.Retry(id); err != nil {
+		http.Error(w, "No se pudo reintentar el trabajo", http.StatusInternalServerError)
+		return
+	}
+	job, err = store.GetJob(id)
+	if err != nil || job == nil {
+		http.Error(w, "Error al recuperar el trabajo", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
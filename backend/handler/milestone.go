@@ -0,0 +1,361 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gofundme-backend/config"
+	"gofundme-backend/model"
+	"gofundme-backend/openpayments"
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+// milestoneReleaseLease es cuánto dura la reserva de un hito antes de empezar
+// a pagarlo. Si el servidor se cae en ese tramo, pasado este tiempo el hito se
+// puede volver a aprobar.
+const milestoneReleaseLease = 2 * time.Minute
+
+// MilestonesResponse es el estado del escrow de una campaña.
+type MilestonesResponse struct {
+	EscrowBalance float64             `json:"escrowBalance"`
+	Milestones    []model.Milestone   `json:"milestones"`
+	Entries       []model.EscrowEntry `json:"entries"`
+}
+
+// CreateMilestoneHandler permite al creador de una campaña con escrow definir un hito.
+func CreateMilestoneHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		Title        string  `json:"title"`
+		Description  string  `json:"description"`
+		TargetAmount float64 `json:"targetAmount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la petición inválido", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Title == "" || requestBody.TargetAmount <= 0 {
+		http.Error(w, "El título y un monto positivo son obligatorios", http.StatusBadRequest)
+		return
+	}
+
+	campaign, ok := loadOwnedEscrowCampaign(w, campaignID, currentUser(r).ID)
+	if !ok {
+		return
+	}
+
+	milestone := &model.Milestone{
+		CampaignID:   campaign.ID,
+		Title:        requestBody.Title,
+		Description:  requestBody.Description,
+		TargetAmount: requestBody.TargetAmount,
+		Evidence:     []model.MilestoneEvidence{},
+	}
+	if err := store.CreateMilestone(milestone); err != nil {
+		http.Error(w, "No se pudo crear el hito", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(milestone)
+}
+
+// GetMilestonesHandler devuelve los hitos, el saldo retenido y los movimientos del escrow.
+func GetMilestonesHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+
+	milestones, err := store.GetMilestonesByCampaign(campaignID)
+	if err != nil {
+		http.Error(w, "Error al recuperar los hitos", http.StatusInternalServerError)
+		return
+	}
+	balance, err := store.GetEscrowBalance(campaignID)
+	if err != nil {
+		http.Error(w, "Error al calcular el saldo del escrow", http.StatusInternalServerError)
+		return
+	}
+	entries, err := store.GetEscrowEntries(campaignID)
+	if err != nil {
+		http.Error(w, "Error al recuperar los movimientos del escrow", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MilestonesResponse{
+		EscrowBalance: balance,
+		Milestones:    milestones,
+		Entries:       entries,
+	})
+}
+
+// UploadMilestoneEvidenceHandler recibe un archivo de evidencia (campo "file")
+// de un formulario multipart. Solo la sube el creador de la campaña.
+func UploadMilestoneEvidenceHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	campaignID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+	milestoneID, err := strconv.Atoi(vars["milestoneId"])
+	if err != nil {
+		http.Error(w, "ID de hito inválido", http.StatusBadRequest)
+		return
+	}
+	if _, ok := loadOwnedEscrowCampaign(w, campaignID, currentUser(r).ID); !ok {
+		return
+	}
+	milestone, err := store.GetMilestoneByID(milestoneID)
+	if err != nil {
+		http.Error(w, "Error al recuperar el hito", http.StatusInternalServerError)
+		return
+	}
+	if milestone == nil || milestone.CampaignID != campaignID {
+		http.Error(w, "Hito no encontrado", http.StatusNotFound)
+		return
+	}
+	if milestone.Status == model.MilestoneReleasing || milestone.Status == model.MilestoneReleased {
+		http.Error(w, "El hito ya fue liberado", http.StatusConflict)
+		return
+	}
+
+	upload, err := saveUpload(w, r, "file", fmt.Sprintf("milestones/%d", milestoneID))
+	if err != nil {
+		log.Printf("Error al guardar la evidencia: %v", err)
+		http.Error(w, "No se pudo guardar el archivo", http.StatusBadRequest)
+		return
+	}
+
+	evidence := &model.MilestoneEvidence{
+		MilestoneID: milestoneID,
+		Filename:    upload.Filename,
+		ContentType: upload.ContentType,
+		Path:        upload.Path,
+	}
+	if err := store.AddMilestoneEvidence(evidence); err != nil {
+		http.Error(w, "No se pudo registrar la evidencia", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(evidence)
+}
+
+// GetSubmittedMilestonesHandler lista los hitos con evidencia pendientes de revisión.
+func GetSubmittedMilestonesHandler(w http.ResponseWriter, r *http.Request) {
+	milestones, err := store.GetMilestonesByStatus(model.MilestoneSubmitted)
+	if err != nil {
+		http.Error(w, "Error al recuperar los hitos", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(milestones)
+}
+
+// GetMilestoneEvidenceFileHandler descarga un archivo de evidencia para revisarlo.
+func GetMilestoneEvidenceFileHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	milestoneID, _ := strconv.Atoi(vars["id"])
+	evidenceID, _ := strconv.Atoi(vars["evidenceId"])
+
+	milestone, err := store.GetMilestoneByID(milestoneID)
+	if err != nil {
+		http.Error(w, "Error al recuperar el hito", http.StatusInternalServerError)
+		return
+	}
+	if milestone == nil {
+		http.Error(w, "Hito no encontrado", http.StatusNotFound)
+		return
+	}
+	for _, e := range milestone.Evidence {
+		if e.ID == evidenceID {
+			w.Header().Set("Content-Type", e.ContentType)
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", e.Filename))
+			http.ServeFile(w, r, e.Path)
+			return
+		}
+	}
+	http.Error(w, "Evidencia no encontrada", http.StatusNotFound)
+}
+
+// ApproveMilestoneHandler aprueba un hito y envía su monto desde la wallet de la
+// plataforma al payment pointer del creador. Antes de pagar, el monto se
+// reserva del escrow pasando el hito a releasing, así que un hito se paga una
+// sola vez aunque la petición se repita. Si el pago falla antes de crear el
+// outgoing payment, el hito vuelve a aprobado y se puede reintentar; si falla
+// después, no se sabe si se pagó y queda en releasing hasta conciliarlo en
+// /admin/milestones/{id}/reconcile.
+func ApproveMilestoneHandler(w http.ResponseWriter, r *http.Request) {
+	milestoneID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de hito inválido", http.StatusBadRequest)
+		return
+	}
+
+	milestone, err := store.GetMilestoneByID(milestoneID)
+	if err != nil {
+		http.Error(w, "Error al recuperar el hito", http.StatusInternalServerError)
+		return
+	}
+	if milestone == nil {
+		http.Error(w, "Hito no encontrado", http.StatusNotFound)
+		return
+	}
+	campaign, err := store.GetCampaignByID(milestone.CampaignID)
+	if err != nil || campaign == nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+
+	available, err := store.ReserveMilestoneRelease(milestone.ID, milestoneReleaseLease)
+	switch {
+	case errors.Is(err, store.ErrMilestoneNotReleasable):
+		http.Error(w, "El hito no está pendiente de aprobación", http.StatusConflict)
+		return
+	case errors.Is(err, store.ErrInsufficientEscrow):
+		http.Error(w, fmt.Sprintf("Saldo insuficiente en escrow: %.2f disponible", available), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "No se pudo aprobar el hito", http.StatusInternalServerError)
+		return
+	}
+
+	opClient, err := openpayments.NewClient()
+	if err != nil {
+		store.CancelMilestoneRelease(milestone.ID, "open_payments_client")
+		http.Error(w, "Error al inicializar el cliente de Open Payments", http.StatusInternalServerError)
+		return
+	}
+	amount := int64(math.Round(milestone.TargetAmount * math.Pow10(campaign.Scale())))
+	description := fmt.Sprintf("Liberación del hito %q de la campaña: %s", milestone.Title, campaign.Title)
+	prepared, err := opClient.PrepareSendPayment(r.Context(), config.PlatformWalletAddress(), campaign.PaymentPointer, amount, description)
+	if err != nil {
+		log.Printf("[ERROR] No se pudo preparar la liberación del hito %d: %v", milestone.ID, err)
+		store.CancelMilestoneRelease(milestone.ID, err.Error())
+		recordAudit(r.Context(), model.AuditEvent{Action: model.AuditOutgoingPaymentFailed, SubjectType: "milestone", SubjectID: subjectID(milestone.ID)}, nil,
+			map[string]any{"amount": milestone.TargetAmount, "receiver": campaign.PaymentPointer, "error": err.Error()})
+		http.Error(w, "El hito fue aprobado pero el pago falló; vuelve a intentarlo", http.StatusBadGateway)
+		return
+	}
+
+	if err := store.StartMilestonePayment(milestone.ID); err != nil {
+		store.CancelMilestoneRelease(milestone.ID, "start_payment")
+		http.Error(w, "No se pudo registrar el inicio del pago", http.StatusInternalServerError)
+		return
+	}
+	outgoingPayment, err := opClient.CreateOutgoingPayment(r.Context(), config.PlatformWalletAddress(), prepared.AccessToken, prepared.QuoteID)
+	if err != nil {
+		log.Printf("[ERROR] No se sabe si se liberó el hito %d: %v", milestone.ID, err)
+		store.RecordMilestoneReleaseError(milestone.ID, err.Error())
+		recordAudit(r.Context(), model.AuditEvent{Action: model.AuditOutgoingPaymentFailed, SubjectType: "milestone", SubjectID: subjectID(milestone.ID)}, nil,
+			map[string]any{"amount": milestone.TargetAmount, "receiver": campaign.PaymentPointer, "quoteId": prepared.QuoteID, "error": err.Error(), "uncertain": true})
+		http.Error(w, "No se pudo confirmar el pago del hito; queda pendiente de conciliar", http.StatusBadGateway)
+		return
+	}
+
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditOutgoingPaymentCreated, SubjectType: "milestone", SubjectID: subjectID(milestone.ID)},
+		map[string]string{"status": milestone.Status}, map[string]any{"status": model.MilestoneReleased, "amount": milestone.TargetAmount, "receiver": campaign.PaymentPointer, "outgoingPaymentId": *outgoingPayment.Id})
+	if err := store.ReleaseMilestone(milestone, *outgoingPayment.Id); err != nil {
+		log.Printf("[ERROR] Pago %s enviado pero no registrado para el hito %d: %v", *outgoingPayment.Id, milestone.ID, err)
+		store.RecordMilestoneReleaseError(milestone.ID, "pagado con "+*outgoingPayment.Id+" pero sin registrar")
+		http.Error(w, "El pago se envió pero no se pudo registrar; queda pendiente de conciliar", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Hito %d liberado: %s", milestone.ID, *outgoingPayment.Id)
+
+	released, _ := store.GetMilestoneByID(milestone.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(released)
+}
+
+// AdminReconcileMilestoneHandler cierra a mano la liberación de un hito cuyo
+// pago quedó sin confirmar. Con el outgoing payment que se encontró en la
+// wallet de la plataforma se marca liberado; sin él, se da por no pagado y el
+// hito vuelve a aprobado.
+func AdminReconcileMilestoneHandler(w http.ResponseWriter, r *http.Request) {
+	milestoneID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de hito inválido", http.StatusBadRequest)
+		return
+	}
+	var requestBody struct {
+		OutgoingPaymentID string `json:"outgoingPaymentId"` // Vacío si el pago no se hizo
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la petición inválido", http.StatusBadRequest)
+		return
+	}
+
+	milestone, err := store.GetMilestoneByID(milestoneID)
+	if err != nil {
+		http.Error(w, "Error al recuperar el hito", http.StatusInternalServerError)
+		return
+	}
+	if milestone == nil {
+		http.Error(w, "Hito no encontrado", http.StatusNotFound)
+		return
+	}
+	if milestone.Status != model.MilestoneReleasing || milestone.ReleaseStartedAt == nil {
+		http.Error(w, "El hito no tiene un pago pendiente de conciliar", http.StatusConflict)
+		return
+	}
+
+	if requestBody.OutgoingPaymentID == "" {
+		if _, err := store.CancelMilestoneRelease(milestone.ID, "conciliado sin pago"); err != nil {
+			http.Error(w, "No se pudo conciliar el hito", http.StatusInternalServerError)
+			return
+		}
+	} else if err := store.ReleaseMilestone(milestone, requestBody.OutgoingPaymentID); err != nil {
+		http.Error(w, "No se pudo conciliar el hito", http.StatusInternalServerError)
+		return
+	}
+
+	reconciled, _ := store.GetMilestoneByID(milestone.ID)
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditMilestoneReconciled, SubjectType: "milestone", SubjectID: subjectID(milestone.ID)},
+		map[string]string{"status": milestone.Status}, map[string]string{"status": reconciled.Status, "outgoingPaymentId": requestBody.OutgoingPaymentID})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reconciled)
+}
+
+// loadOwnedEscrowCampaign carga la campaña y comprueba que use escrow y que
+// pertenezca al usuario. Si algo falla, ya escribió la respuesta de error.
+func loadOwnedEscrowCampaign(w http.ResponseWriter, campaignID, userID int) (*model.Campaign, bool) {
+	campaign, err := store.GetCampaignByID(campaignID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return nil, false
+	}
+	if campaign == nil {
+		http.Error(w, "Campaña no encontrada", http.StatusNotFound)
+		return nil, false
+	}
+	if campaign.UserID != userID {
+		http.Error(w, "Solo el creador de la campaña puede gestionar sus hitos", http.StatusForbidden)
+		return nil, false
+	}
+	if !campaign.Escrow {
+		http.Error(w, "La campaña no usa escrow", http.StatusBadRequest)
+		return nil, false
+	}
+	return campaign, true
+}
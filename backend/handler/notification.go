@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+// GetNotificationsHandler devuelve los avisos de un usuario. Cada usuario solo
+// puede leer los suyos.
+func GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+		return
+	}
+	if userID != currentUser(r).ID {
+		http.Error(w, "Solo puedes ver tus notificaciones", http.StatusForbidden)
+		return
+	}
+
+	notifications, err := store.GetNotificationsByUser(userID)
+	if err != nil {
+		http.Error(w, "Error al recuperar las notificaciones", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notifications)
+}
+
+// MarkNotificationReadHandler marca como leído un aviso del usuario de la sesión.
+func MarkNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	notificationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de notificación inválido", http.StatusBadRequest)
+		return
+	}
+
+	found, err := store.MarkNotificationRead(notificationID, currentUser(r).ID)
+	if err != nil {
+		http.Error(w, "No se pudo marcar la notificación", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Notificación no encontrada", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"gofundme-backend/config"
+	"gofundme-backend/jobs"
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+)
+
+// outboxLease es cuánto tiempo se reserva un evento del outbox mientras se publica.
+const outboxLease = 5 * time.Minute
+
+// outboxHandlers publica cada tema del outbox. Un evento se puede publicar más
+// de una vez, así que cada handler usa la dedupKey para no repetir efectos
+// donde importa.
+var outboxHandlers = map[string]func(ctx context.Context, msg *model.OutboxMessage) error{
+	model.OutboxDonationPaymentStarted: publishDonationPaymentStarted,
+	model.OutboxDonationCompleted:      publishDonationCompleted,
+	model.OutboxDonationRefunded:       publishDonationRefunded,
+}
+
+// relayOutboxSoon pide publicar enseguida lo que se acaba de guardar en el
+// outbox. Si falla, el relay periódico lo publica igual.
+func relayOutboxSoon() {
+	if err := jobs.Trigger(jobRelayOutbox); err != nil {
+		log.Printf("[WARN] No se pudo adelantar la publicación del outbox: %v", err)
+	}
+}
+
+// RelayOutbox publica los eventos pendientes del outbox hasta vaciarlo. Un
+// evento que falla se reintenta más tarde y, si agota sus intentos, queda
+// muerto. Es un trabajo periódico de la cola.
+func RelayOutbox(ctx context.Context) error {
+	const batch = 50
+	for {
+		messages, err := store.ClaimOutboxMessages(batch, outboxLease)
+		if err != nil {
+			return err
+		}
+		for i := range messages {
+			publishOutboxMessage(ctx, &messages[i])
+		}
+		if len(messages) < batch {
+			return nil
+		}
+	}
+}
+
+func publishOutboxMessage(ctx context.Context, msg *model.OutboxMessage) {
+	publish, ok := outboxHandlers[msg.Topic]
+	err := fmt.Errorf("tema desconocido %q", msg.Topic)
+	if ok {
+		err = publish(ctx, msg)
+	}
+	if err == nil {
+		store.MarkOutboxPublished(msg.ID)
+		return
+	}
+
+	var next *time.Time
+	if ok && msg.Attempts < config.JobMaxAttempts() {
+		at := time.Now().Add(time.Duration(float64(config.JobRetryBase()) * math.Pow(2, float64(msg.Attempts-1))))
+		next = &at
+	} else {
+		log.Printf("[ERROR] El evento %s del outbox no se pudo publicar tras %d intentos: %v", msg.DedupKey, msg.Attempts, err)
+	}
+	store.MarkOutboxFailed(msg.ID, err.Error(), next)
+}
+
+// publishDonationPaymentStarted programa la conciliación de una donación cuyo
+// grant ya se usó, por si el pago no llega a terminar.
+func publishDonationPaymentStarted(ctx context.Context, msg *model.OutboxMessage) error {
+	var event model.DonationPaymentStartedEvent
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return err
+	}
+	_, err := jobs.EnqueueAt(jobReconcileDonation, reconcileDonationJob{DonationID: event.DonationID}, time.Now().Add(config.ReconcileDelay()))
+	return err
+}
+
+// publishDonationCompleted avisa al creador de la donación completada y, si con
+// ella la campaña alcanzó su meta, también de campaign.goal_reached.
+func publishDonationCompleted(ctx context.Context, msg *model.OutboxMessage) error {
+	var event model.DonationCompletedEvent
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return err
+	}
+	donation, err := store.GetDonationByID(event.DonationID)
+	if err != nil || donation == nil {
+		return fmt.Errorf("no se pudo recuperar la donación %d: %v", event.DonationID, err)
+	}
+	campaign, err := store.GetCampaignByID(event.CampaignID)
+	if err != nil || campaign == nil {
+		return fmt.Errorf("no se pudo recuperar la campaña %d: %v", event.CampaignID, err)
+	}
+
+	err = emitCreatorEvent(campaign.UserID, outboxEventID(msg.DedupKey), model.CreatorEventDonationCompleted, map[string]any{
+		"donationId": donation.ID, "campaignId": campaign.ID, "amount": donation.Amount, "currency": donation.Currency,
+		"originalAmount": donation.OriginalAmount, "originalCurrency": donation.OriginalCurrency,
+	})
+	if err != nil {
+		return err
+	}
+	if campaign.Goal > 0 && event.AmountRaised >= campaign.Goal && event.AmountRaised-event.Amount < campaign.Goal {
+		return emitCreatorEvent(campaign.UserID, outboxEventID(msg.DedupKey+":goal"), model.CreatorEventCampaignGoalReached, map[string]any{
+			"campaignId": campaign.ID, "goal": campaign.Goal, "amountRaised": event.AmountRaised, "currency": campaign.Asset(),
+		})
+	}
+	return nil
+}
+
+// publishDonationRefunded avisa del reembolso al creador y al donante.
+func publishDonationRefunded(ctx context.Context, msg *model.OutboxMessage) error {
+	var event model.DonationRefundedEvent
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return err
+	}
+	donation, err := store.GetDonationByID(event.DonationID)
+	if err != nil || donation == nil {
+		return fmt.Errorf("no se pudo recuperar la donación %d: %v", event.DonationID, err)
+	}
+	campaign, err := store.GetCampaignByID(event.CampaignID)
+	if err != nil || campaign == nil {
+		return fmt.Errorf("no se pudo recuperar la campaña %d: %v", event.CampaignID, err)
+	}
+
+	kind := "donation_partially_refunded"
+	if event.FullyRefunded {
+		kind = "donation_refunded"
+	}
+	message := fmt.Sprintf("Se reembolsaron %.2f %s de la donación %d a la campaña %q", event.Amount, campaign.Asset(), donation.ID, campaign.Title)
+	for _, userID := range []int{campaign.UserID, donation.DonorUserID} {
+		if err := store.CreateNotificationOnce(userID, kind, message, msg.DedupKey); err != nil {
+			return err
+		}
+	}
+
+	return emitCreatorEvent(campaign.UserID, outboxEventID(msg.DedupKey), model.CreatorEventDonationRefunded, map[string]any{
+		"donationId": donation.ID, "refundId": event.RefundID, "campaignId": campaign.ID,
+		"amount": event.Amount, "currency": campaign.Asset(), "fullyRefunded": event.FullyRefunded,
+	})
+}
+
+// reconcileDonation revisa una donación cuyo grant se usó hace
+// RECONCILE_DELAY. Si sigue aprobada o enviándose:
+//   - ninguna parte se llegó a pagar: el pago se abandonó y la donación falla;
+//   - todas tienen outgoing payment: se espera al webhook del incoming payment
+//     reintentando la conciliación;
+//   - si no, alguna parte quedó a medias o no se sabe si su pago se creó, así
+//     que la donación pasa a needs_reconciliation y queda en el log de
+//     auditoría para que la revise un administrador.
+func reconcileDonation(ctx context.Context, job reconcileDonationJob) error {
+	donation, err := store.GetDonationByID(job.DonationID)
+	if err != nil {
+		return err
+	}
+	if donation == nil || (donation.Status != model.DonationApproved && donation.Status != model.DonationSending) {
+		return nil
+	}
+
+	var uncertain, unpaid []int
+	for _, split := range donation.Splits {
+		switch {
+		case split.OutgoingPaymentID != "":
+		case split.PaymentStartedAt != nil:
+			uncertain = append(uncertain, split.ID)
+		default:
+			unpaid = append(unpaid, split.ID)
+		}
+	}
+
+	switch {
+	case len(unpaid) == len(donation.Splits):
+		failed, err := store.TransitionDonation(donation.ID, model.DonationFailed, "pago abandonado")
+		if err != nil || !failed {
+			return err
+		}
+		recordAudit(ctx, model.AuditEvent{Action: model.AuditDonationFailed, SubjectType: "donation", SubjectID: subjectID(donation.ID)},
+			map[string]string{"status": donation.Status}, map[string]string{"status": model.DonationFailed, "reason": "pago abandonado"})
+		return nil
+	case len(uncertain) == 0 && len(unpaid) == 0:
+		return fmt.Errorf("la donación %d sigue pendiente de confirmar", donation.ID)
+	}
+	reason := fmt.Sprintf("pagada a medias: partes sin confirmar %v, sin pagar %v", uncertain, unpaid)
+	if _, err := store.TransitionDonation(donation.ID, model.DonationNeedsReconciliation, reason); err != nil {
+		return err
+	}
+	recordAudit(ctx, model.AuditEvent{Action: model.AuditDonationUncertain, SubjectType: "donation", SubjectID: subjectID(donation.ID)},
+		map[string]string{"status": donation.Status}, map[string]any{"status": model.DonationNeedsReconciliation, "uncertainSplits": uncertain, "unpaidSplits": unpaid})
+	return nil
+}
@@ -4,15 +4,17 @@ package handler
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 
+	"gofundme-backend/model"
 	"gofundme-backend/openpayments"
+	"gofundme-backend/risk"
+	"gofundme-backend/store"
 
 	op "github.com/interledger/open-payments-go"
 	as "github.com/interledger/open-payments-go/generated/authserver"
@@ -22,55 +24,25 @@ import (
 // Estructuras y constantes (sin cambios)
 type InitiatePaymentRequest struct {
 	IncomingPaymentId string `json:"incomingPaymentId"`
+	DonationId        int    `json:"donationId"`
 }
 type InitiatePaymentResponse struct {
-	RedirectUrl string `json:"redirectUrl"`
+	RedirectUrl string `json:"redirectUrl,omitempty"`
+	Status      string `json:"status,omitempty"` // Estado de la donación: awaiting_approval, o held si el motor de riesgo la retuvo
 }
 type FinalizePaymentRequest struct {
 	InteractRef string `json:"interactRef"`
 }
-type GrantInfo struct {
-	ContinueToken string `json:"continueToken"`
-	ContinueUri   string `json:"continueUri"`
-	QuoteId       string `json:"quoteId"`
+type FinalizePaymentResponse struct {
+	DonationId       int                  `json:"donationId"`
+	Status           string               `json:"status"`
+	OutgoingPayments []rs.OutgoingPayment `json:"outgoingPayments"`
 }
 
 const (
 	sendingWalletAddressURL = "https://ilp.interledger-test.dev/zerokmaccount"
 )
 
-// Funciones save/load (sin cambios)
-func saveGrantInfo(ref string, info GrantInfo) error {
-	bytes, err := json.Marshal(info)
-	if err != nil {
-		return fmt.Errorf("error al serializar grant info: %w", err)
-	}
-	filename := filepath.Join(os.TempDir(), "grant_"+ref+".json")
-	log.Printf("[DEBUG] Guardando grant info en el archivo: %s", filename)
-	return os.WriteFile(filename, bytes, 0600)
-}
-func loadAndClearGrantInfo(ref string) (GrantInfo, error) {
-	var info GrantInfo
-	filename := filepath.Join(os.TempDir(), "grant_"+ref+".json")
-	log.Printf("[DEBUG] Buscando grant info en el archivo: %s", filename)
-	bytes, err := os.ReadFile(filename)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			log.Printf("[WARN] No se encontró el archivo de grant para la referencia: %s", ref)
-			return info, os.ErrNotExist
-		}
-		return info, fmt.Errorf("error al leer el archivo de grant: %w", err)
-	}
-	defer func() {
-		log.Printf("[DEBUG] Borrando archivo de grant: %s", filename)
-		os.Remove(filename)
-	}()
-	if err := json.Unmarshal(bytes, &info); err != nil {
-		return info, fmt.Errorf("error al deserializar grant info: %w", err)
-	}
-	return info, nil
-}
-
 // InitiatePaymentHandler con la corrección
 func InitiatePaymentHandler(w http.ResponseWriter, r *http.Request) {
 	// ... (código inicial sin cambios hasta la creación del grant interactivo) ...
@@ -79,6 +51,32 @@ func InitiatePaymentHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Cuerpo inválido", http.StatusBadRequest)
 		return
 	}
+	donation, err := findDonation(req)
+	if err != nil {
+		http.Error(w, "Error al recuperar la donación", http.StatusInternalServerError)
+		return
+	}
+	if donation == nil {
+		http.Error(w, "Donación no encontrada", http.StatusNotFound)
+		return
+	}
+	if donation.Status == model.DonationHeld {
+		http.Error(w, "La donación está en revisión", http.StatusConflict)
+		return
+	}
+	switch donation.Status {
+	case model.DonationCreated, model.DonationQuoted, model.DonationAwaitingApproval:
+	default:
+		http.Error(w, "La donación ya fue procesada", http.StatusConflict)
+		return
+	}
+	// Si el donante vuelve a empezar, el grant anterior deja de servir: la
+	// donación ya no está esperando su aprobación.
+	if donation.Status == model.DonationAwaitingApproval {
+		if !transitionDonation(w, donation, model.DonationQuoted, "el donante volvió a iniciar el pago") {
+			return
+		}
+	}
 	opClient, err := openpayments.NewClient()
 	if err != nil {
 		http.Error(w, "Error cliente", http.StatusInternalServerError)
@@ -100,12 +98,44 @@ func InitiatePaymentHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error grant quote", http.StatusInternalServerError)
 		return
 	}
-	quote, err := opClient.Quote.Create(ctx, op.QuoteCreateParams{BaseURL: *sendingWalletAddress.ResourceServer, AccessToken: quoteGrant.AccessToken.Value, Payload: rs.CreateQuoteJSONBody0{WalletAddressSchema: *sendingWalletAddress.Id, Receiver: req.IncomingPaymentId, Method: "ilp"}})
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error creando quote: %v", err), http.StatusInternalServerError)
+
+	// Una quote por beneficiario. El grant interactivo cubre la suma de todas,
+	// así el donante aprueba una sola vez.
+	var totalDebit int64
+	var debitAmount rs.Amount
+	for _, split := range donation.Splits {
+		quote, err := opClient.Quote.Create(ctx, op.QuoteCreateParams{BaseURL: *sendingWalletAddress.ResourceServer, AccessToken: quoteGrant.AccessToken.Value, Payload: rs.CreateQuoteJSONBody0{WalletAddressSchema: *sendingWalletAddress.Id, Receiver: split.IncomingPaymentID, Method: "ilp"}})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error creando quote: %v", err), http.StatusInternalServerError)
+			return
+		}
+		value, err := strconv.ParseInt(quote.DebitAmount.Value, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Monto de quote inválido: %v", err), http.StatusInternalServerError)
+			return
+		}
+		totalDebit += value
+		debitAmount = quote.DebitAmount
+		if err := store.SetSplitQuote(split.ID, *quote.Id); err != nil {
+			http.Error(w, "Error al guardar la quote", http.StatusInternalServerError)
+			return
+		}
+	}
+	debitTotal := float64(totalDebit) / math.Pow10(debitAmount.AssetScale)
+	if err := store.SetDonationDebit(donation.ID, *sendingWalletAddress.Id, debitTotal, debitAmount.AssetCode); err != nil {
+		http.Error(w, "Error al guardar el monto de la donación", http.StatusInternalServerError)
 		return
 	}
-	limitData := as.LimitsOutgoing1{DebitAmount: as.Amount{AssetCode: quote.DebitAmount.AssetCode, AssetScale: quote.DebitAmount.AssetScale, Value: quote.DebitAmount.Value}}
+	donation.DonorWalletAddress = *sendingWalletAddress.Id
+	if donation.Status != model.DonationQuoted {
+		if !transitionDonation(w, donation, model.DonationQuoted, "") {
+			return
+		}
+	}
+	if !checkDonationRisk(w, donation) {
+		return
+	}
+	limitData := as.LimitsOutgoing1{DebitAmount: as.Amount{AssetCode: debitAmount.AssetCode, AssetScale: debitAmount.AssetScale, Value: strconv.FormatInt(totalDebit, 10)}}
 	var limits as.LimitsOutgoing
 	_ = limits.FromLimitsOutgoing1(limitData)
 	outgoingAccess := as.AccessOutgoing{Type: as.OutgoingPayment, Actions: []as.AccessOutgoingActions{as.AccessOutgoingActionsCreate, as.AccessOutgoingActionsRead}, Identifier: *sendingWalletAddress.Id, Limits: &limits}
@@ -122,6 +152,8 @@ func InitiatePaymentHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Respuesta no interactiva", http.StatusInternalServerError)
 		return
 	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditGrantRequested, ActorID: donation.DonorUserID, SubjectType: "donation", SubjectID: subjectID(donation.ID)}, nil,
+		map[string]any{"walletAddress": *sendingWalletAddress.Id, "debitAmount": limitData.DebitAmount, "purpose": "donation"})
 
 	// --- INICIO DE LA CORRECCIÓN ---
 	// La referencia que nos devolverá el frontend es la que está en la URL de REDIRECCIÓN.
@@ -134,23 +166,29 @@ func InitiatePaymentHandler(w http.ResponseWriter, r *http.Request) {
 	// --- FIN DE LA CORRECCIÓN ---
 
 	// Ahora usamos esta referencia correcta como clave para guardar los datos.
-	grantInfo := GrantInfo{
+	grant := &model.PaymentGrant{
+		InteractRef:   interactRef,
+		DonationID:    donation.ID,
+		ContinueURI:   outgoingPaymentGrant.Continue.Uri,
 		ContinueToken: outgoingPaymentGrant.Continue.AccessToken.Value,
-		ContinueUri:   outgoingPaymentGrant.Continue.Uri,
-		QuoteId:       *quote.Id,
 	}
-	if err := saveGrantInfo(interactRef, grantInfo); err != nil {
+	if err := store.SavePaymentGrant(grant); err != nil {
 		log.Printf("[ERROR] No se pudo guardar la información del grant: %v", err)
 		http.Error(w, "Error al guardar estado del pago", http.StatusInternalServerError)
 		return
 	}
 
+	if !transitionDonation(w, donation, model.DonationAwaitingApproval, "") {
+		return
+	}
+
 	log.Printf("Grant interactivo iniciado. Ref a guardar: %s. Redirigiendo al usuario a: %s", interactRef, redirectUrl)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(InitiatePaymentResponse{
 		RedirectUrl: redirectUrl,
+		Status:      model.DonationAwaitingApproval,
 	})
 }
 
@@ -162,58 +200,214 @@ func FinalizePaymentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	grantInfo, err := loadAndClearGrantInfo(req.InteractRef)
+	grantInfo, err := store.TakePaymentGrant(req.InteractRef)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			http.Error(w, "Referencia de interacción inválida o expirada", http.StatusNotFound)
-		} else {
-			log.Printf("[ERROR] No se pudo cargar info de grant: %v", err)
-			http.Error(w, "Error al recuperar estado del pago", http.StatusInternalServerError)
-		}
+		log.Printf("[ERROR] No se pudo cargar info de grant: %v", err)
+		http.Error(w, "Error al recuperar estado del pago", http.StatusInternalServerError)
+		return
+	}
+	if grantInfo == nil {
+		log.Printf("[WARN] No se encontró el grant para la referencia: %s", req.InteractRef)
+		http.Error(w, "Referencia de interacción inválida o expirada", http.StatusNotFound)
+		return
+	}
+	relayOutboxSoon()
+
+	donation, err := store.GetDonationByID(grantInfo.DonationID)
+	if err != nil || donation == nil {
+		http.Error(w, "Error al recuperar la donación", http.StatusInternalServerError)
+		return
+	}
+	if !transitionDonation(w, donation, model.DonationApproved, "") {
 		return
 	}
 
 	opClient, err := openpayments.NewClient()
 	if err != nil {
+		store.TransitionDonation(donation.ID, model.DonationFailed, "no se pudo crear el cliente de Open Payments")
 		http.Error(w, "Error cliente", http.StatusInternalServerError)
 		return
 	}
 
-	ctx := context.Background()
-	sendingWalletAddress, _ := opClient.WalletAddress.Get(ctx, op.WalletAddressGetParams{URL: sendingWalletAddressURL})
+	// Los pagos siguen aunque el cliente se desconecte, pero el contexto
+	// conserva los datos de la petición para la auditoría.
+	ctx := context.WithoutCancel(r.Context())
+	sendingWalletAddress, err := opClient.WalletAddress.Get(ctx, op.WalletAddressGetParams{URL: sendingWalletAddressURL})
+	if err != nil {
+		log.Printf("[ERROR] No se pudo obtener la wallet emisora para la donación %d: %v", donation.ID, err)
+		store.TransitionDonation(donation.ID, model.DonationFailed, fmt.Sprintf("no se pudo obtener la wallet emisora: %v", err))
+		http.Error(w, "No se pudo contactar la wallet emisora", http.StatusBadGateway)
+		return
+	}
 
 	finalizedGrant, err := opClient.Grant.Continue(ctx, op.GrantContinueParams{
-		URL:         grantInfo.ContinueUri,
+		URL:         grantInfo.ContinueURI,
 		AccessToken: grantInfo.ContinueToken,
 	})
 	if err != nil {
+		store.TransitionDonation(donation.ID, model.DonationFailed, fmt.Sprintf("no se pudo continuar el grant: %v", err))
 		http.Error(w, fmt.Sprintf("Error al continuar grant: %v", err), http.StatusInternalServerError)
 		return
 	}
 	log.Println("Grant finalizado con éxito.")
 
-	var paymentPayload rs.CreateOutgoingPaymentRequest
-	err = paymentPayload.FromCreateOutgoingPaymentWithQuote(rs.CreateOutgoingPaymentWithQuote{
-		WalletAddressSchema: *sendingWalletAddress.Id,
-		QuoteId:             grantInfo.QuoteId,
-	})
-	if err != nil {
-		http.Error(w, "Error creando payload", http.StatusInternalServerError)
+	recordAudit(ctx, model.AuditEvent{Action: model.AuditGrantContinued, ActorID: donation.DonorUserID, SubjectType: "donation", SubjectID: subjectID(donation.ID)}, nil,
+		map[string]any{"walletAddress": *sendingWalletAddress.Id, "purpose": "donation"})
+
+	// Un outgoing payment por quote, todos bajo el mismo grant.
+	if !transitionDonation(w, donation, model.DonationSending, "") {
 		return
 	}
+	var outgoingPayments []rs.OutgoingPayment
+	for _, split := range donation.Splits {
+		var paymentPayload rs.CreateOutgoingPaymentRequest
+		err = paymentPayload.FromCreateOutgoingPaymentWithQuote(rs.CreateOutgoingPaymentWithQuote{
+			WalletAddressSchema: *sendingWalletAddress.Id,
+			QuoteId:             split.QuoteID,
+		})
+		if err != nil {
+			stopSendingDonation(ctx, donation, split, len(outgoingPayments), fmt.Errorf("payload inválido: %v", err))
+			http.Error(w, "Error creando payload", http.StatusInternalServerError)
+			return
+		}
 
-	outgoingPayment, err := opClient.OutgoingPayment.Create(ctx, op.OutgoingPaymentCreateParams{
-		BaseURL:     *sendingWalletAddress.ResourceServer,
-		AccessToken: finalizedGrant.AccessToken.Value,
-		Payload:     paymentPayload,
-	})
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Error creando outgoing payment: %v", err), http.StatusInternalServerError)
-		return
+		// Si el proceso muere entre la llamada remota y guardar el pago, la
+		// conciliación de la donación encuentra la parte iniciada y sin pago.
+		if err := store.StartSplitPayment(split.ID); err != nil {
+			stopSendingDonation(ctx, donation, split, len(outgoingPayments), fmt.Errorf("no se pudo registrar el inicio del pago: %v", err))
+			http.Error(w, "Error al registrar el pago", http.StatusInternalServerError)
+			return
+		}
+		outgoingPayment, err := opClient.OutgoingPayment.Create(ctx, op.OutgoingPaymentCreateParams{
+			BaseURL:     *sendingWalletAddress.ResourceServer,
+			AccessToken: finalizedGrant.AccessToken.Value,
+			Payload:     paymentPayload,
+		})
+		if err != nil {
+			stopSendingDonation(ctx, donation, split, len(outgoingPayments), err)
+			http.Error(w, fmt.Sprintf("Error creando outgoing payment: %v", err), http.StatusInternalServerError)
+			return
+		}
+		// El pago ya salió, así que se sigue con las demás partes aunque no se
+		// pueda guardar; el outgoing payment queda en la auditoría para
+		// conciliar la parte.
+		recorded := true
+		if err := store.SetSplitOutgoingPayment(split.ID, *outgoingPayment.Id); err != nil {
+			log.Printf("[ERROR] Outgoing payment %s creado pero no registrado para la parte %d de la donación %d: %v", *outgoingPayment.Id, split.ID, donation.ID, err)
+			recorded = false
+		}
+		recordAudit(ctx, model.AuditEvent{Action: model.AuditOutgoingPaymentCreated, ActorID: donation.DonorUserID, SubjectType: "donation", SubjectID: subjectID(donation.ID)}, nil,
+			map[string]any{"outgoingPaymentId": *outgoingPayment.Id, "receiver": split.WalletAddress, "amount": split.Amount, "quoteId": split.QuoteID, "splitId": split.ID, "recorded": recorded})
+		outgoingPayments = append(outgoingPayments, outgoingPayment)
 	}
 	log.Println("Outgoing payment creado con éxito. ¡Fondos en camino!")
 
+	completeDonation(ctx, opClient, donation)
+	if current, err := store.GetDonationByID(donation.ID); err == nil && current != nil {
+		donation.Status = current.Status
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(outgoingPayment)
+	json.NewEncoder(w).Encode(FinalizePaymentResponse{
+		DonationId:       donation.ID,
+		Status:           donation.Status,
+		OutgoingPayments: outgoingPayments,
+	})
+}
+
+// stopSendingDonation saca de sending una donación cuyo pago se cortó en la
+// parte split. Si alguna parte anterior ya se pagó, la donación no falló del
+// todo y queda para conciliar; si no, falla. Sin esto la donación quedaría en
+// sending para siempre, porque su grant ya se consumió.
+func stopSendingDonation(ctx context.Context, donation *model.Donation, split model.DonationSplit, paidSplits int, cause error) {
+	status := model.DonationFailed
+	if paidSplits > 0 {
+		status = model.DonationNeedsReconciliation
+	}
+	if _, err := store.TransitionDonation(donation.ID, status, fmt.Sprintf("no se pudo pagar la parte %d: %v", split.ID, cause)); err != nil {
+		log.Printf("[ERROR] La donación %d quedó en %s: %v", donation.ID, model.DonationSending, err)
+	}
+	recordAudit(ctx, model.AuditEvent{Action: model.AuditOutgoingPaymentFailed, ActorID: donation.DonorUserID, SubjectType: "donation", SubjectID: subjectID(donation.ID)},
+		map[string]string{"status": donation.Status}, map[string]any{"status": status, "splitId": split.ID, "quoteId": split.QuoteID, "paidSplits": paidSplits, "error": cause.Error()})
+}
+
+// completeDonation confirma una donación en curso y paga las contrapartidas de
+// los patrocinadores. La confirma quien llegue primero, el flujo de pago o el
+// webhook del incoming payment; para el otro no hace nada y devuelve false.
+// Los avisos al creador salen del outbox.
+func completeDonation(ctx context.Context, opClient *openpayments.Client, donation *model.Donation) (bool, error) {
+	completed, err := store.CompleteDonation(donation.ID)
+	if err != nil || !completed {
+		return false, err
+	}
+	relayOutboxSoon()
+	matchDonation(ctx, opClient, donation)
+	return true, nil
+}
+
+// checkDonationRisk evalúa la donación una vez conocida la wallet del donante.
+// Si hay que retenerla o bloquearla responde al cliente y devuelve false. Las
+// donaciones que un moderador ya liberó no se vuelven a evaluar.
+func checkDonationRisk(w http.ResponseWriter, donation *model.Donation) bool {
+	cleared, err := store.RiskCleared(model.RiskSubjectDonation, donation.ID)
+	if err != nil {
+		http.Error(w, "Error al evaluar el riesgo de la donación", http.StatusInternalServerError)
+		return false
+	}
+	if cleared {
+		return true
+	}
+	campaign, err := store.GetCampaignByID(donation.CampaignID)
+	if err != nil || campaign == nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return false
+	}
+	assessment, err := risk.EvaluateDonation(donation, campaign)
+	if err != nil {
+		http.Error(w, "Error al evaluar el riesgo de la donación", http.StatusInternalServerError)
+		return false
+	}
+	risk.Record(assessment)
+
+	switch assessment.Action {
+	case model.RiskBlock:
+		store.TransitionDonation(donation.ID, model.DonationFailed, "rechazada por el motor de riesgo")
+		http.Error(w, "La donación fue rechazada", http.StatusForbidden)
+		return false
+	case model.RiskHold:
+		store.TransitionDonation(donation.ID, model.DonationHeld, "retenida por el motor de riesgo")
+		store.CreateNotification(donation.DonorUserID, "donation_held", "Tu donación quedó en revisión; te avisaremos cuando puedas completarla")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(InitiatePaymentResponse{Status: model.DonationHeld})
+		return false
+	}
+	return true
+}
+
+// transitionDonation pasa la donación del flujo de pago a su siguiente estado.
+// Si no puede, porque otra petición o un webhook la cambió antes, responde
+// 409 y devuelve false.
+func transitionDonation(w http.ResponseWriter, donation *model.Donation, to, reason string) bool {
+	changed, err := store.TransitionDonation(donation.ID, to, reason)
+	if err != nil {
+		http.Error(w, "Error al actualizar el estado de la donación", http.StatusInternalServerError)
+		return false
+	}
+	if !changed {
+		http.Error(w, "La donación cambió de estado y no puede pasar a "+to, http.StatusConflict)
+		return false
+	}
+	donation.Status = to
+	return true
+}
+
+// findDonation localiza la donación a pagar, ya sea por su ID o por el ID de
+// cualquiera de sus incoming payments (el frontend envía el primero).
+func findDonation(req InitiatePaymentRequest) (*model.Donation, error) {
+	if req.DonationId != 0 {
+		return store.GetDonationByID(req.DonationId)
+	}
+	return store.GetDonationByIncomingPaymentID(req.IncomingPaymentId)
 }
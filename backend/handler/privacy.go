@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"gofundme-backend/config"
+	mailer "gofundme-backend/mail"
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+)
+
+// ExportMeHandler descarga un ZIP con los datos personales del usuario
+// autenticado: perfil, campañas, donaciones hechas y recibidas, denuncias,
+// avisos e historial del chat, cada uno en un archivo JSON.
+func ExportMeHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadUser(w, currentUser(r).ID)
+	if !ok {
+		return
+	}
+
+	campaigns, err := store.GetCampaignsByUser(user.ID)
+	if err != nil {
+		http.Error(w, "Error al exportar las campañas", http.StatusInternalServerError)
+		return
+	}
+	received := []model.Donation{}
+	for _, c := range campaigns {
+		donations, err := store.GetDonations(c.ID, "")
+		if err != nil {
+			http.Error(w, "Error al exportar las donaciones", http.StatusInternalServerError)
+			return
+		}
+		received = append(received, donations...)
+	}
+	made, err := store.GetDonationsByDonor(user.ID)
+	if err != nil {
+		http.Error(w, "Error al exportar las donaciones", http.StatusInternalServerError)
+		return
+	}
+	reports, err := store.GetReportsByReporter(user.ID)
+	if err != nil {
+		http.Error(w, "Error al exportar las denuncias", http.StatusInternalServerError)
+		return
+	}
+	notifications, err := store.GetNotificationsByUser(user.ID)
+	if err != nil {
+		http.Error(w, "Error al exportar los avisos", http.StatusInternalServerError)
+		return
+	}
+	chat, err := store.GetChatMessagesByUser(user.ID)
+	if err != nil {
+		http.Error(w, "Error al exportar el historial del chat", http.StatusInternalServerError)
+		return
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", user},
+		{"campaigns.json", campaigns},
+		{"donations_made.json", made},
+		{"donations_received.json", received},
+		{"reports.json", reports},
+		{"notifications.json", notifications},
+		{"chat_history.json", chat},
+	}
+
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditAccountExported, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, nil)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="aidloop-export-`+time.Now().UTC().Format("20060102")+`.zip"`)
+
+	// A partir de aquí ya se enviaron las cabeceras: un error solo se puede
+	// registrar y cortar el ZIP, que el cliente verá incompleto.
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			log.Printf("Error al escribir %s en la exportación del usuario %d: %v", f.name, user.ID, err)
+			return
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			log.Printf("Error al escribir %s en la exportación del usuario %d: %v", f.name, user.ID, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Error al cerrar la exportación del usuario %d: %v", user.ID, err)
+	}
+}
+
+// DeleteMeHandler programa el borrado de la cuenta del usuario autenticado.
+// Pide la contraseña y, si la cuenta la tiene, una verificación en dos pasos
+// reciente. La cuenta se anonimiza al terminar config.AccountDeletionGrace;
+// hasta entonces sigue funcionando y el borrado se puede cancelar.
+func DeleteMeHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	var requestBody struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la solicitud inválido", http.StatusBadRequest)
+		return
+	}
+	attempt, ok := reserveLoginAttempt(w, r, user.Username)
+	if !ok {
+		return
+	}
+	if !store.CheckPasswordHash(requestBody.Password, user.PasswordHash) {
+		attempt.failed(user)
+		http.Error(w, "La contraseña no es correcta", http.StatusUnauthorized)
+		return
+	}
+	attempt.release()
+	if !freshTwoFactor(w, r) {
+		return
+	}
+
+	scheduled, err := store.RequestAccountDeletion(user.ID)
+	if err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if !scheduled {
+		http.Error(w, "El borrado de la cuenta ya está programado", http.StatusConflict)
+		return
+	}
+
+	deleteAt := time.Now().Add(config.AccountDeletionGrace())
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditAccountDeletionRequested, SubjectType: "user", SubjectID: subjectID(user.ID)},
+		nil, map[string]any{"deleteAt": deleteAt})
+	message := "Tu cuenta se borrará el " + deleteAt.Format("02/01/2006") + ". Hasta entonces puedes cancelarlo desde tu perfil"
+	store.CreateNotification(user.ID, "account_deletion_scheduled", message)
+	if user.EmailVerified() {
+		if err := mailer.Send(r.Context(), mailer.Message{To: user.Email, Subject: "Borrado de tu cuenta", Body: "Hola " + user.Username + ",\n\n" + message + ".\n"}); err != nil {
+			log.Printf("Error al avisar del borrado al usuario %d: %v", user.ID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]time.Time{"deleteAt": deleteAt})
+}
+
+// CancelDeletionHandler cancela el borrado programado de la cuenta del usuario autenticado.
+func CancelDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	canceled, err := store.CancelAccountDeletion(user.ID)
+	if err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if !canceled {
+		http.Error(w, "La cuenta no tiene un borrado programado", http.StatusConflict)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditAccountDeletionCanceled, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, nil)
+	store.CreateNotification(user.ID, "account_deletion_canceled", "Cancelaste el borrado de tu cuenta")
+	writeAccount(w, user.ID)
+}
+
+// PurgeDeletedAccounts anonimiza las cuentas cuyo periodo de gracia terminó y
+// borra del disco sus documentos de verificación y evidencias de hitos. Es un
+// trabajo periódico de la cola.
+func PurgeDeletedAccounts(ctx context.Context) {
+	ids, err := store.GetUsersDueForDeletion(config.AccountDeletionGrace())
+	if err != nil {
+		return
+	}
+	for _, id := range ids {
+		paths, err := store.AnonymizeUser(id)
+		if err != nil {
+			continue
+		}
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				log.Printf("Error al borrar el archivo %s de la cuenta %d: %v", path, id, err)
+			}
+		}
+		recordAudit(ctx, model.AuditEvent{Action: model.AuditAccountDeleted, SubjectType: "user", SubjectID: subjectID(id)}, nil, nil)
+		log.Printf("Cuenta %d anonimizada", id)
+	}
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"gofundme-backend/model"
+	"gofundme-backend/openpayments"
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxDisplayNameLength = 60
+	maxBioLength         = 500
+)
+
+// GetMeHandler devuelve la cuenta del usuario autenticado.
+func GetMeHandler(w http.ResponseWriter, r *http.Request) {
+	writeAccount(w, currentUser(r).ID)
+}
+
+// UpdateMeHandler cambia los campos enviados del perfil del usuario
+// autenticado; los que no vienen se conservan. Cambiar la wallet la vuelve a
+// validar con Open Payments y, como decide a dónde va el dinero, exige una
+// verificación en dos pasos reciente.
+func UpdateMeHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	var requestBody struct {
+		DisplayName   *string `json:"displayName"`
+		Bio           *string `json:"bio"`
+		AvatarURL     *string `json:"avatarUrl"`
+		WalletAddress *string `json:"walletAddress"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la solicitud inválido", http.StatusBadRequest)
+		return
+	}
+
+	updated := *user
+	if requestBody.DisplayName != nil {
+		updated.DisplayName = strings.TrimSpace(*requestBody.DisplayName)
+		if utf8.RuneCountInString(updated.DisplayName) > maxDisplayNameLength {
+			http.Error(w, "El nombre para mostrar es demasiado largo", http.StatusBadRequest)
+			return
+		}
+	}
+	if requestBody.Bio != nil {
+		updated.Bio = strings.TrimSpace(*requestBody.Bio)
+		if utf8.RuneCountInString(updated.Bio) > maxBioLength {
+			http.Error(w, "La biografía es demasiado larga", http.StatusBadRequest)
+			return
+		}
+	}
+	if requestBody.AvatarURL != nil {
+		updated.AvatarURL = strings.TrimSpace(*requestBody.AvatarURL)
+		if updated.AvatarURL != "" && !validAvatarURL(updated.AvatarURL) {
+			http.Error(w, "La URL del avatar debe ser https", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if requestBody.WalletAddress != nil {
+		if *requestBody.WalletAddress == "" {
+			http.Error(w, "La wallet es obligatoria", http.StatusBadRequest)
+			return
+		}
+		if !freshTwoFactor(w, r) {
+			return
+		}
+		opClient, err := openpayments.NewClient()
+		if err != nil {
+			http.Error(w, "Error al inicializar el cliente de Open Payments", http.StatusInternalServerError)
+			return
+		}
+		wallet, ok := resolveWallet(w, r, opClient, *requestBody.WalletAddress)
+		if !ok {
+			return
+		}
+		updated.WalletAddress = wallet.URL
+		updated.WalletAssetCode = wallet.AssetCode
+		updated.WalletAssetScale = wallet.AssetScale
+		updated.WalletAuthServer = wallet.AuthServer
+	}
+
+	if err := store.UpdateUserProfile(user.ID, updated.DisplayName, updated.Bio, updated.AvatarURL); err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if updated.WalletAddress != user.WalletAddress {
+		if err := store.UpdateUserWallet(&updated); err != nil {
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+		store.CreateNotification(user.ID, "wallet_changed", "La wallet de tu cuenta cambió a "+updated.WalletAddress)
+	}
+	writeUser(w, r, user)
+}
+
+// validAvatarURL acepta solo URLs https absolutas, para que el frontend no
+// cargue contenido mixto ni esquemas como javascript:.
+func validAvatarURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// ChangePasswordHandler cambia la contraseña del usuario autenticado. Pide la
+// actual y cierra las demás sesiones de la cuenta.
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	var requestBody struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la solicitud inválido", http.StatusBadRequest)
+		return
+	}
+	if requestBody.CurrentPassword == "" || requestBody.NewPassword == "" {
+		http.Error(w, "La contraseña actual y la nueva son obligatorias", http.StatusBadRequest)
+		return
+	}
+
+	// La contraseña actual se prueba con el mismo límite que el inicio de sesión.
+	attempt, ok := reserveLoginAttempt(w, r, user.Username)
+	if !ok {
+		return
+	}
+	if !store.CheckPasswordHash(requestBody.CurrentPassword, user.PasswordHash) {
+		attempt.failed(user)
+		http.Error(w, "La contraseña actual no es correcta", http.StatusUnauthorized)
+		return
+	}
+	attempt.release()
+
+	if err := store.UpdatePassword(user.ID, requestBody.NewPassword, bearerToken(r)); err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditPasswordChanged, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, nil)
+	store.CreateNotification(user.ID, "password_changed", "Cambiaste la contraseña de tu cuenta y se cerraron tus otras sesiones")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetPublicProfileHandler devuelve el perfil público de un usuario con sus
+// campañas visibles y un resumen de lo que recaudaron.
+func GetPublicProfileHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := store.GetUserByUsername(mux.Vars(r)["username"])
+	if err != nil {
+		http.Error(w, "Error al recuperar el usuario", http.StatusInternalServerError)
+		return
+	}
+	if user == nil || user.Suspended() || user.Deleted() {
+		http.Error(w, "Usuario no encontrado", http.StatusNotFound)
+		return
+	}
+
+	campaigns, err := store.GetCampaignsByUser(user.ID)
+	if err != nil {
+		http.Error(w, "No se pudieron recuperar las campañas", http.StatusInternalServerError)
+		return
+	}
+	campaigns = visibleCampaigns(campaigns)
+
+	stats := model.ProfileStats{CampaignCount: len(campaigns), Raised: map[string]float64{}}
+	ids := make([]int, len(campaigns))
+	for i, c := range campaigns {
+		ids[i] = c.ID
+		stats.Raised[c.Asset()] += c.AmountRaised
+		if c.Verified {
+			stats.VerifiedCampaigns++
+		}
+	}
+	if stats.DonationCount, err = store.CountCompletedDonations(ids); err != nil {
+		http.Error(w, "Error al calcular las estadísticas", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(model.PublicProfile{
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarURL,
+		CreatedAt:   user.CreatedAt,
+		Campaigns:   campaigns,
+		Stats:       stats,
+	})
+}
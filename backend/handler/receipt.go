@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gofundme-backend/model"
+	"gofundme-backend/receipt"
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+// canViewDonation indica si el usuario de la sesión puede ver los detalles de
+// una donación: su donante, el creador de la campaña o quien puede ver el ledger.
+func canViewDonation(user *model.User, donation *model.Donation, campaign *model.Campaign) bool {
+	return user != nil && ((donation.DonorUserID != 0 && donation.DonorUserID == user.ID) || campaign.UserID == user.ID ||
+		model.HasPermission(user.Role, model.PermViewLedger))
+}
+
+// GetDonationReceiptHandler descarga el comprobante de una donación finalizada
+// para su donante, el creador de la campaña o un administrador. La wallet del
+// donante solo aparece en el comprobante del propio donante o del ledger.
+// Por defecto es un PDF; con ?format=json (o Accept: application/json)
+// devuelve el comprobante firmado.
+func GetDonationReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	donationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de donación inválido", http.StatusBadRequest)
+		return
+	}
+
+	donation, err := store.GetDonationByID(donationID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la donación", http.StatusInternalServerError)
+		return
+	}
+	if donation == nil {
+		http.Error(w, "Donación no encontrada", http.StatusNotFound)
+		return
+	}
+	campaign, err := store.GetCampaignByID(donation.CampaignID)
+	if err != nil || campaign == nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	user := currentUser(r)
+	if !canViewDonation(user, donation, campaign) {
+		http.Error(w, "Donación no encontrada", http.StatusNotFound)
+		return
+	}
+	switch donation.Status {
+	case model.DonationCompleted, model.DonationPartiallyRefunded, model.DonationRefunded:
+	default:
+		http.Error(w, "La donación todavía no fue finalizada", http.StatusConflict)
+		return
+	}
+
+	rec := receipt.New(campaign, donation)
+	if donation.DonorUserID != user.ID && !model.HasPermission(user.Role, model.PermViewLedger) {
+		rec.DonorWalletAddress = ""
+	}
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		signed, err := receipt.Sign(rec)
+		if err != nil {
+			http.Error(w, "No se pudo firmar el comprobante", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(signed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("recibo-donacion-%d.pdf", donation.ID)))
+	w.Write(receipt.RenderPDF(rec))
+}
+
+// GetReceiptKeysHandler publica las llaves para verificar comprobantes firmados.
+func GetReceiptKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := receipt.PublishedKeys()
+	if err != nil {
+		http.Error(w, "No hay llaves de comprobantes configuradas", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Keys []receipt.PublicKey `json:"keys"`
+	}{keys})
+}
+
+// VerifyReceiptHandler comprueba un comprobante firmado y devuelve su
+// contenido si la firma es válida.
+func VerifyReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	var signed receipt.SignedReceipt
+	if err := json.NewDecoder(r.Body).Decode(&signed); err != nil {
+		http.Error(w, "Cuerpo de la petición inválido", http.StatusBadRequest)
+		return
+	}
+
+	verified, err := receipt.Verify(signed)
+	if errors.Is(err, receipt.ErrNoSigner) {
+		http.Error(w, "No hay llaves de comprobantes configuradas", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Valid   bool             `json:"valid"`
+		Receipt *receipt.Receipt `json:"receipt,omitempty"`
+	}{err == nil, verified})
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+func TestDonationReceiptRequiresDonorOrCreator(t *testing.T) {
+	openTestStore(t)
+	donation := createTestDonation(t, "https://wallet.example/incoming-payments/ip-1")
+	donorID := createTestUser(t, "donante")
+	const donorWallet = "https://wallet.example/donante"
+	if _, err := store.DB.Exec("UPDATE donations SET donor_user_id = ? WHERE id = ?", donorID, donation.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetDonationDebit(donation.ID, donorWallet, donation.Amount, donation.Currency); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := store.CompleteDonation(donation.ID); err != nil || !ok {
+		t.Fatalf("CompleteDonation: %v, %v", ok, err)
+	}
+	campaign, _ := store.GetCampaignByID(donation.CampaignID)
+
+	session := func(userID int) string {
+		token, _, err := store.CreateSession(userID, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	get := func(handler http.HandlerFunc, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(donation.ID)})
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		Authenticate(handler).ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		code       int
+		showWallet bool
+	}{
+		{"sin sesión", "", http.StatusUnauthorized, false},
+		{"otro usuario", session(createTestUser(t, "curioso")), http.StatusNotFound, false},
+		{"creador", session(campaign.UserID), http.StatusOK, false},
+		{"donante", session(donorID), http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(GetDonationReceiptHandler, tt.token)
+			if rec.Code != tt.code {
+				t.Fatalf("comprobante: código = %d, quería %d", rec.Code, tt.code)
+			}
+			if shown := bytes.Contains(rec.Body.Bytes(), []byte(donorWallet)); rec.Code == http.StatusOK && shown != tt.showWallet {
+				t.Errorf("wallet del donante en el comprobante = %v, quería %v", shown, tt.showWallet)
+			}
+			if rec := get(GetRefundsHandler, tt.token); rec.Code != tt.code {
+				t.Errorf("reembolsos: código = %d, quería %d", rec.Code, tt.code)
+			}
+		})
+	}
+}
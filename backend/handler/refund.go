@@ -0,0 +1,472 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gofundme-backend/config"
+	"gofundme-backend/model"
+	"gofundme-backend/openpayments"
+	"gofundme-backend/rates"
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+// RefundRequest pide devolver una donación. Si Amount es 0 se devuelve todo lo
+// que queda por reembolsar.
+type RefundRequest struct {
+	Amount float64 `json:"amount"` // En el activo de la campaña
+	Reason string  `json:"reason"`
+}
+
+// RefundResponse devuelve el reembolso y, si el creador debe aprobar el pago en
+// su wallet, la URL de aprobación.
+type RefundResponse struct {
+	Refund      *model.Refund `json:"refund"`
+	RedirectUrl string        `json:"redirectUrl,omitempty"`
+}
+
+// CreateRefundHandler permite al creador de la campaña devolver total o
+// parcialmente una donación.
+func CreateRefundHandler(w http.ResponseWriter, r *http.Request) {
+	createRefund(w, r, model.RefundByCreator)
+}
+
+// AdminCreateRefundHandler permite a un administrador devolver una donación.
+func AdminCreateRefundHandler(w http.ResponseWriter, r *http.Request) {
+	createRefund(w, r, model.RefundByAdmin)
+}
+
+// createRefund registra el reembolso y lo paga desde la wallet que tiene los
+// fondos: la de la plataforma si la campaña usa escrow, o la de la campaña con
+// el grant preaprobado por el creador. Si no hay grant preaprobado, el creador
+// debe aprobar el pago en redirectUrl y luego llamar a /refunds/{id}/finalize.
+func createRefund(w http.ResponseWriter, r *http.Request, initiatedBy string) {
+	donationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de donación inválido", http.StatusBadRequest)
+		return
+	}
+
+	var req RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Cuerpo de la petición inválido", http.StatusBadRequest)
+		return
+	}
+	if req.Amount < 0 {
+		http.Error(w, "El monto del reembolso no puede ser negativo", http.StatusBadRequest)
+		return
+	}
+
+	donation, err := store.GetDonationByID(donationID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la donación", http.StatusInternalServerError)
+		return
+	}
+	if donation == nil {
+		http.Error(w, "Donación no encontrada", http.StatusNotFound)
+		return
+	}
+	if donation.DonorWalletAddress == "" {
+		http.Error(w, "No se conoce la wallet del donante", http.StatusConflict)
+		return
+	}
+	campaign, err := store.GetCampaignByID(donation.CampaignID)
+	if err != nil || campaign == nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	if initiatedBy == model.RefundByCreator && campaign.UserID != currentUser(r).ID {
+		http.Error(w, "Solo el creador de la campaña puede reembolsar sus donaciones", http.StatusForbidden)
+		return
+	}
+
+	amount := req.Amount
+	if amount == 0 {
+		if amount, err = store.RefundableAmount(donation); err != nil {
+			http.Error(w, "Error al calcular el monto reembolsable", http.StatusInternalServerError)
+			return
+		}
+	}
+	if amount <= 0 {
+		http.Error(w, "La donación ya fue reembolsada por completo", http.StatusConflict)
+		return
+	}
+
+	refund := &model.Refund{
+		DonationID:  donation.ID,
+		CampaignID:  campaign.ID,
+		Amount:      amount,
+		Reason:      req.Reason,
+		Status:      model.RefundAwaitingApproval,
+		InitiatedBy: initiatedBy,
+	}
+	if err := store.CreateRefund(refund); err != nil {
+		switch {
+		case errors.Is(err, store.ErrDonationNotCompleted):
+			http.Error(w, "La donación no está completada", http.StatusConflict)
+		case errors.Is(err, store.ErrRefundExceedsDonation):
+			http.Error(w, "El monto supera lo que queda por reembolsar de la donación", http.StatusConflict)
+		case errors.Is(err, store.ErrInsufficientEscrow):
+			http.Error(w, "El escrow de la campaña no alcanza para pagar el reembolso", http.StatusConflict)
+		default:
+			http.Error(w, "No se pudo registrar el reembolso", http.StatusInternalServerError)
+		}
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditRefundRequested, SubjectType: "refund", SubjectID: subjectID(refund.ID)}, nil, refund)
+
+	opClient, err := openpayments.NewClient()
+	if err != nil {
+		failRefund(r.Context(), refund, "open_payments_client")
+		http.Error(w, "Error al inicializar el cliente de Open Payments", http.StatusInternalServerError)
+		return
+	}
+
+	// El incoming payment se crea en la wallet del donante, en su activo.
+	donorWallet, err := opClient.ResolveWalletAddress(r.Context(), donation.DonorWalletAddress)
+	if err != nil {
+		log.Printf("Error al resolver la wallet del donante %s: %v", donation.DonorWalletAddress, err)
+		failRefund(r.Context(), refund, "donor_wallet_unreachable")
+		http.Error(w, "No se pudo contactar la wallet del donante", http.StatusBadGateway)
+		return
+	}
+	donorAmount, err := rates.Convert(r.Context(), amount, campaign.Asset(), donorWallet.AssetCode)
+	if err != nil {
+		failRefund(r.Context(), refund, "exchange_rate")
+		if errors.Is(err, rates.ErrRateNotFound) {
+			http.Error(w, "No hay tasa de cambio de "+campaign.Asset()+" a "+donorWallet.AssetCode, http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "Error al convertir el monto del reembolso", http.StatusInternalServerError)
+		return
+	}
+	minorUnits := int64(math.Round(donorAmount * math.Pow10(donorWallet.AssetScale)))
+	description := fmt.Sprintf("Reembolso de la donación %d a la campaña: %s", donation.ID, campaign.Title)
+
+	if campaign.Escrow {
+		outgoingPayment, err := opClient.SendPayment(r.Context(), config.PlatformWalletAddress(), donorWallet.URL, minorUnits, description)
+		if err != nil {
+			log.Printf("[ERROR] Falló el reembolso %d desde el escrow: %v", refund.ID, err)
+			failRefund(r.Context(), refund, "escrow_payment")
+			http.Error(w, "No se pudo pagar el reembolso", http.StatusBadGateway)
+			return
+		}
+		completeRefund(w, r, refund, campaign, donation, *outgoingPayment.Id)
+		return
+	}
+
+	grant, err := store.GetRefundGrant(campaign.ID)
+	if err != nil {
+		failRefund(r.Context(), refund, "refund_grant_lookup")
+		http.Error(w, "Error al recuperar el grant de reembolsos", http.StatusInternalServerError)
+		return
+	}
+	if grant != nil && grant.Status == model.RefundGrantActive {
+		outgoingPayment, err := opClient.PayWithGrant(r.Context(), campaign.PaymentPointer, grant.AccessToken, donorWallet.URL, minorUnits, description)
+		if err == nil {
+			completeRefund(w, r, refund, campaign, donation, *outgoingPayment.Id)
+			return
+		}
+		// Grant agotado o revocado: se pide la aprobación del creador.
+		log.Printf("El grant de reembolsos de la campaña %d no pudo pagar el reembolso %d: %v", campaign.ID, refund.ID, err)
+		recordAudit(r.Context(), model.AuditEvent{Action: model.AuditOutgoingPaymentFailed, SubjectType: "refund", SubjectID: subjectID(refund.ID)}, nil,
+			map[string]any{"sender": campaign.PaymentPointer, "receiver": donorWallet.URL, "amount": minorUnits, "error": err.Error()})
+	}
+
+	interactive, quoteID, err := opClient.PrepareInteractivePayment(r.Context(), campaign.PaymentPointer, donorWallet.URL, minorUnits, description)
+	if err != nil {
+		log.Printf("[ERROR] No se pudo preparar el reembolso %d: %v", refund.ID, err)
+		failRefund(r.Context(), refund, "interactive_grant")
+		http.Error(w, "No se pudo solicitar la aprobación del reembolso", http.StatusBadGateway)
+		return
+	}
+	if err := store.SetRefundGrant(refund.ID, quoteID, interactive.ContinueURI, interactive.ContinueToken); err != nil {
+		failRefund(r.Context(), refund, "save_grant")
+		http.Error(w, "No se pudo guardar el grant del reembolso", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditGrantRequested, SubjectType: "refund", SubjectID: subjectID(refund.ID)}, nil,
+		map[string]any{"walletAddress": campaign.PaymentPointer, "receiver": donorWallet.URL, "amount": minorUnits, "quoteId": quoteID, "purpose": "refund"})
+	store.CreateNotification(campaign.UserID, "refund_approval",
+		fmt.Sprintf("Aprueba en tu wallet el reembolso de %.2f %s de la donación %d", amount, campaign.Asset(), donation.ID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(RefundResponse{Refund: refund, RedirectUrl: interactive.RedirectURL})
+}
+
+// FinalizeRefundHandler paga un reembolso después de que el creador aprobó el
+// grant en su wallet.
+func FinalizeRefundHandler(w http.ResponseWriter, r *http.Request) {
+	refundID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de reembolso inválido", http.StatusBadRequest)
+		return
+	}
+
+	refund, err := store.GetRefundByID(refundID)
+	if err != nil {
+		http.Error(w, "Error al recuperar el reembolso", http.StatusInternalServerError)
+		return
+	}
+	if refund == nil {
+		http.Error(w, "Reembolso no encontrado", http.StatusNotFound)
+		return
+	}
+	if refund.Status != model.RefundAwaitingApproval || refund.ContinueToken == "" {
+		http.Error(w, "El reembolso no está pendiente de aprobación", http.StatusConflict)
+		return
+	}
+	campaign, err := store.GetCampaignByID(refund.CampaignID)
+	if err != nil || campaign == nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	if campaign.UserID != currentUser(r).ID {
+		http.Error(w, "Solo el creador de la campaña puede finalizar sus reembolsos", http.StatusForbidden)
+		return
+	}
+	donation, err := store.GetDonationByID(refund.DonationID)
+	if err != nil || donation == nil {
+		http.Error(w, "Error al recuperar la donación", http.StatusInternalServerError)
+		return
+	}
+
+	opClient, err := openpayments.NewClient()
+	if err != nil {
+		http.Error(w, "Error al inicializar el cliente de Open Payments", http.StatusInternalServerError)
+		return
+	}
+	accessToken, err := opClient.ContinueGrant(r.Context(), refund.ContinueURI, refund.ContinueToken)
+	if err != nil {
+		log.Printf("Error al continuar el grant del reembolso %d: %v", refund.ID, err)
+		http.Error(w, "El creador todavía no aprobó el reembolso", http.StatusConflict)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditGrantContinued, SubjectType: "refund", SubjectID: subjectID(refund.ID)}, nil,
+		map[string]any{"walletAddress": campaign.PaymentPointer, "purpose": "refund"})
+	outgoingPayment, err := opClient.CreateOutgoingPayment(r.Context(), campaign.PaymentPointer, accessToken, refund.QuoteID)
+	if err != nil {
+		log.Printf("[ERROR] Falló el pago del reembolso %d: %v", refund.ID, err)
+		failRefund(r.Context(), refund, "outgoing_payment")
+		http.Error(w, "No se pudo pagar el reembolso", http.StatusBadGateway)
+		return
+	}
+	completeRefund(w, r, refund, campaign, donation, *outgoingPayment.Id)
+}
+
+// completeRefund registra un reembolso pagado y responde con el reembolso
+// actualizado. Los avisos al creador y al donante salen del outbox.
+func completeRefund(w http.ResponseWriter, r *http.Request, refund *model.Refund, campaign *model.Campaign, donation *model.Donation, outgoingPaymentID string) {
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditOutgoingPaymentCreated, SubjectType: "refund", SubjectID: subjectID(refund.ID)}, nil,
+		map[string]any{"outgoingPaymentId": outgoingPaymentID, "receiver": donation.DonorWalletAddress, "amount": refund.Amount, "escrow": campaign.Escrow})
+
+	before := map[string]any{"donationStatus": donation.Status, "refundedAmount": donation.RefundedAmount}
+	if _, err := store.CompleteRefund(refund, outgoingPaymentID, campaign.Escrow); err != nil {
+		log.Printf("[ERROR] Reembolso %d pagado (%s) pero no registrado: %v", refund.ID, outgoingPaymentID, err)
+		http.Error(w, "El reembolso se pagó pero no se pudo registrar", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Reembolso %d pagado: %s", refund.ID, outgoingPaymentID)
+	if updated, err := store.GetDonationByID(donation.ID); err == nil && updated != nil {
+		recordAudit(r.Context(), model.AuditEvent{Action: model.AuditRefundCompleted, SubjectType: "refund", SubjectID: subjectID(refund.ID)}, before,
+			map[string]any{"donationStatus": updated.Status, "refundedAmount": updated.RefundedAmount, "outgoingPaymentId": outgoingPaymentID})
+	}
+	relayOutboxSoon()
+
+	completed, _ := store.GetRefundByID(refund.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RefundResponse{Refund: completed})
+}
+
+// failRefund marca un reembolso como fallido y lo deja en el log de auditoría.
+func failRefund(ctx context.Context, refund *model.Refund, reason string) {
+	store.FailRefund(refund.ID)
+	recordAudit(ctx, model.AuditEvent{Action: model.AuditRefundFailed, SubjectType: "refund", SubjectID: subjectID(refund.ID)},
+		map[string]string{"status": refund.Status}, map[string]string{"status": model.RefundFailed, "reason": reason})
+}
+
+// GetRefundsHandler lista los reembolsos de una donación a su donante, al
+// creador de la campaña o a un administrador.
+func GetRefundsHandler(w http.ResponseWriter, r *http.Request) {
+	donationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de donación inválido", http.StatusBadRequest)
+		return
+	}
+	donation, err := store.GetDonationByID(donationID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la donación", http.StatusInternalServerError)
+		return
+	}
+	var campaign *model.Campaign
+	if donation != nil {
+		if campaign, err = store.GetCampaignByID(donation.CampaignID); err != nil {
+			http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+			return
+		}
+	}
+	if campaign == nil || !canViewDonation(currentUser(r), donation, campaign) {
+		http.Error(w, "Donación no encontrada", http.StatusNotFound)
+		return
+	}
+
+	refunds, err := store.GetRefundsByDonation(donationID)
+	if err != nil {
+		http.Error(w, "Error al recuperar los reembolsos", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refunds)
+}
+
+// CreateRefundGrantHandler pide al creador un grant de intervalo sobre la wallet
+// de la campaña para que los reembolsos se paguen sin aprobarlos uno a uno.
+func CreateRefundGrantHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		Cap       float64   `json:"cap"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la petición inválido", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Cap <= 0 {
+		http.Error(w, "El tope debe ser positivo", http.StatusBadRequest)
+		return
+	}
+	if !requestBody.ExpiresAt.After(time.Now()) {
+		http.Error(w, "La fecha de expiración debe ser futura", http.StatusBadRequest)
+		return
+	}
+
+	campaign, err := store.GetCampaignByID(campaignID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	if campaign == nil {
+		http.Error(w, "Campaña no encontrada", http.StatusNotFound)
+		return
+	}
+	if campaign.UserID != currentUser(r).ID {
+		http.Error(w, "Solo el creador de la campaña puede autorizar reembolsos", http.StatusForbidden)
+		return
+	}
+	if campaign.Escrow {
+		http.Error(w, "Los reembolsos de campañas con escrow se pagan desde la plataforma", http.StatusBadRequest)
+		return
+	}
+
+	opClient, err := openpayments.NewClient()
+	if err != nil {
+		http.Error(w, "Error al inicializar el cliente de Open Payments", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	interval := fmt.Sprintf("R1/%s/PT%dS", now.Format(time.RFC3339), int64(requestBody.ExpiresAt.Sub(now).Seconds()))
+	debit := int64(math.Round(requestBody.Cap * math.Pow10(campaign.Scale())))
+	interactive, err := opClient.RequestIntervalGrant(r.Context(), campaign.PaymentPointer, debit, interval)
+	if err != nil {
+		log.Printf("Error al solicitar el grant de reembolsos: %v", err)
+		http.Error(w, "No se pudo solicitar la autorización en la wallet de la campaña", http.StatusBadGateway)
+		return
+	}
+
+	grant := &model.RefundGrant{
+		CampaignID:    campaign.ID,
+		Status:        model.RefundGrantPendingAuthorization,
+		ExpiresAt:     requestBody.ExpiresAt,
+		ContinueURI:   interactive.ContinueURI,
+		ContinueToken: interactive.ContinueToken,
+	}
+	if err := store.SaveRefundGrant(grant); err != nil {
+		http.Error(w, "No se pudo guardar el grant de reembolsos", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditGrantRequested, SubjectType: "campaign", SubjectID: subjectID(campaign.ID)}, nil,
+		map[string]any{"walletAddress": campaign.PaymentPointer, "cap": requestBody.Cap, "interval": interval, "purpose": "refund_grant"})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		Grant       *model.RefundGrant `json:"grant"`
+		RedirectUrl string             `json:"redirectUrl"`
+	}{grant, interactive.RedirectURL})
+}
+
+// AuthorizeRefundGrantHandler finaliza el grant de reembolsos después de que el
+// creador lo aprobó en su wallet.
+func AuthorizeRefundGrantHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+
+	campaign, err := store.GetCampaignByID(campaignID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	if campaign == nil {
+		http.Error(w, "Campaña no encontrada", http.StatusNotFound)
+		return
+	}
+	if campaign.UserID != currentUser(r).ID {
+		http.Error(w, "Solo el creador de la campaña puede autorizar reembolsos", http.StatusForbidden)
+		return
+	}
+
+	grant, err := store.GetRefundGrant(campaignID)
+	if err != nil {
+		http.Error(w, "Error al recuperar el grant de reembolsos", http.StatusInternalServerError)
+		return
+	}
+	if grant == nil {
+		http.Error(w, "La campaña no solicitó un grant de reembolsos", http.StatusNotFound)
+		return
+	}
+	if grant.Status != model.RefundGrantPendingAuthorization {
+		http.Error(w, "El grant de reembolsos ya fue autorizado", http.StatusConflict)
+		return
+	}
+
+	opClient, err := openpayments.NewClient()
+	if err != nil {
+		http.Error(w, "Error al inicializar el cliente de Open Payments", http.StatusInternalServerError)
+		return
+	}
+	accessToken, err := opClient.ContinueGrant(r.Context(), grant.ContinueURI, grant.ContinueToken)
+	if err != nil {
+		log.Printf("Error al continuar el grant de reembolsos de la campaña %d: %v", campaignID, err)
+		http.Error(w, "El creador todavía no aprobó el grant", http.StatusConflict)
+		return
+	}
+	if err := store.ActivateRefundGrant(campaignID, accessToken); err != nil {
+		http.Error(w, "No se pudo activar el grant de reembolsos", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditGrantContinued, SubjectType: "campaign", SubjectID: subjectID(campaignID)},
+		map[string]string{"status": grant.Status}, map[string]string{"status": model.RefundGrantActive, "purpose": "refund_grant"})
+
+	grant, _ = store.GetRefundGrant(campaignID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(grant)
+}
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"gofundme-backend/config"
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+// maxReportDetails limita el texto libre de una denuncia.
+const maxReportDetails = 2000
+
+// CreateReportHandler registra la denuncia del usuario autenticado sobre una
+// campaña. Cada usuario puede denunciar una campaña una sola vez; al llegar al
+// umbral configurado la campaña se oculta hasta que la revise un moderador.
+func CreateReportHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		Category string `json:"category"`
+		Details  string `json:"details"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la petición inválido", http.StatusBadRequest)
+		return
+	}
+	if !model.ValidReportCategory(requestBody.Category) {
+		http.Error(w, "Categoría de denuncia inválida", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Category == model.ReportOther && requestBody.Details == "" {
+		http.Error(w, "Describe el motivo de la denuncia", http.StatusBadRequest)
+		return
+	}
+	if len(requestBody.Details) > maxReportDetails {
+		http.Error(w, fmt.Sprintf("La descripción no puede superar %d caracteres", maxReportDetails), http.StatusBadRequest)
+		return
+	}
+
+	campaign, err := store.GetCampaignByID(campaignID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	if campaign == nil {
+		http.Error(w, "Campaña no encontrada", http.StatusNotFound)
+		return
+	}
+	if campaign.Status == model.CampaignTakenDown {
+		http.Error(w, "La campaña ya fue retirada", http.StatusGone)
+		return
+	}
+	reporter := currentUser(r)
+	if campaign.UserID == reporter.ID {
+		http.Error(w, "No puedes denunciar tu propia campaña", http.StatusBadRequest)
+		return
+	}
+
+	report := &model.Report{
+		CampaignID:    campaign.ID,
+		CampaignTitle: campaign.Title,
+		ReporterID:    reporter.ID,
+		Category:      requestBody.Category,
+		Details:       requestBody.Details,
+	}
+	hidden, err := store.CreateReport(report, config.ReportThreshold())
+	if err != nil {
+		if errors.Is(err, store.ErrDuplicateReport) {
+			http.Error(w, "Ya denunciaste esta campaña", http.StatusConflict)
+			return
+		}
+		http.Error(w, "No se pudo registrar la denuncia", http.StatusInternalServerError)
+		return
+	}
+
+	store.CreateNotification(reporter.ID, "report_received", "Recibimos tu denuncia sobre la campaña: "+campaign.Title)
+	if hidden {
+		store.CreateNotification(campaign.UserID, "campaign_under_review", "Tu campaña quedó oculta mientras revisamos las denuncias recibidas")
+		if updated, err := store.GetCampaignByID(campaign.ID); err == nil {
+			campaignStatusChanged(r.Context(), campaign, updated)
+		}
+	}
+
+	created, _ := store.GetReportByID(report.ID)
+	if created != nil {
+		report = created
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetMyReportsHandler lista las denuncias del usuario autenticado y su estado.
+func GetMyReportsHandler(w http.ResponseWriter, r *http.Request) {
+	reports, err := store.GetReportsByReporter(currentUser(r).ID)
+	if err != nil {
+		http.Error(w, "Error al recuperar las denuncias", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// AdminListReportsHandler es la cola de moderación de denuncias. Por defecto
+// lista las abiertas; ?status= permite consultar las resueltas.
+func AdminListReportsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = model.ReportOpen
+	}
+
+	reports, err := store.GetReportsByStatus(status)
+	if err != nil {
+		http.Error(w, "Error al recuperar las denuncias", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// AdminResolveReportHandler resuelve una denuncia junto con las demás denuncias
+// abiertas de la misma campaña. El cuerpo indica el estado ("dismissed" o
+// "actioned") y una nota; al actuar, la nota es el motivo del retiro.
+func AdminResolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	reportID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de denuncia inválido", http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		Status     string `json:"status"`
+		Resolution string `json:"resolution"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la petición inválido", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Status != model.ReportDismissed && requestBody.Status != model.ReportActioned {
+		http.Error(w, "El estado debe ser dismissed o actioned", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Status == model.ReportActioned && requestBody.Resolution == "" {
+		http.Error(w, "El motivo del retiro es obligatorio", http.StatusBadRequest)
+		return
+	}
+
+	report, err := store.GetReportByID(reportID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la denuncia", http.StatusInternalServerError)
+		return
+	}
+	if report == nil {
+		http.Error(w, "Denuncia no encontrada", http.StatusNotFound)
+		return
+	}
+	campaign, err := store.GetCampaignByID(report.CampaignID)
+	if err != nil || campaign == nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+
+	resolved, err := store.ResolveReports(report.ID, requestBody.Status, requestBody.Resolution, currentUser(r).ID)
+	if err != nil {
+		if errors.Is(err, store.ErrReportNotOpen) {
+			http.Error(w, "La denuncia ya fue resuelta", http.StatusConflict)
+			return
+		}
+		http.Error(w, "No se pudo resolver la denuncia", http.StatusInternalServerError)
+		return
+	}
+
+	if updated, err := store.GetCampaignByID(campaign.ID); err == nil && updated != nil && updated.Status != campaign.Status {
+		campaignStatusChanged(r.Context(), campaign, updated)
+	}
+	for _, rep := range resolved {
+		if requestBody.Status == model.ReportActioned {
+			store.CreateNotification(rep.ReporterID, "report_actioned", "Gracias por tu denuncia: la campaña "+campaign.Title+" fue retirada")
+		} else {
+			store.CreateNotification(rep.ReporterID, "report_dismissed", "Revisamos tu denuncia sobre la campaña "+campaign.Title+" y no encontramos infracciones")
+		}
+	}
+	if requestBody.Status == model.ReportActioned {
+		store.CreateNotification(campaign.UserID, "campaign_taken_down", "Tu campaña fue retirada: "+requestBody.Resolution)
+	} else if campaign.Status == model.CampaignUnderReview {
+		store.CreateNotification(campaign.UserID, "campaign_restored", "Tu campaña volvió a publicarse")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resolved)
+}
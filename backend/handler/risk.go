@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+// AdminListRiskAssessmentsHandler es la cola de revisión del motor de riesgo.
+// Por defecto lista las evaluaciones abiertas; acepta ?status= para consultar
+// las demás, o ?subjectType= y ?subjectId= para ver el historial de una
+// donación o campaña.
+func AdminListRiskAssessmentsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var assessments []model.RiskAssessment
+	var err error
+	if subjectType := query.Get("subjectType"); subjectType != "" {
+		subjectID, _ := strconv.Atoi(query.Get("subjectId"))
+		assessments, err = store.GetRiskAssessmentsBySubject(subjectType, subjectID)
+	} else {
+		status := query.Get("status")
+		if status == "" {
+			status = model.RiskOpen
+		}
+		assessments, err = store.GetRiskAssessmentsByStatus(status)
+	}
+	if err != nil {
+		http.Error(w, "Error al recuperar las evaluaciones de riesgo", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(assessments)
+}
+
+// AdminClearRiskHandler da por legítimo lo evaluado. Si estaba retenido, la
+// donación vuelve a poder pagarse o la campaña vuelve a publicarse.
+func AdminClearRiskHandler(w http.ResponseWriter, r *http.Request) {
+	reviewRisk(w, r, model.RiskCleared)
+}
+
+// AdminConfirmRiskHandler confirma el fraude. Si estaba retenido, la donación
+// queda fallida o la campaña queda retirada.
+func AdminConfirmRiskHandler(w http.ResponseWriter, r *http.Request) {
+	reviewRisk(w, r, model.RiskConfirmed)
+}
+
+func reviewRisk(w http.ResponseWriter, r *http.Request, status string) {
+	assessmentID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de evaluación inválido", http.StatusBadRequest)
+		return
+	}
+
+	assessment, err := store.GetRiskAssessmentByID(assessmentID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la evaluación", http.StatusInternalServerError)
+		return
+	}
+	if assessment == nil {
+		http.Error(w, "Evaluación no encontrada", http.StatusNotFound)
+		return
+	}
+	var campaignBefore *model.Campaign
+	if assessment.SubjectType == model.RiskSubjectCampaign {
+		campaignBefore, _ = store.GetCampaignByID(assessment.SubjectID)
+	}
+	if err := store.ReviewRiskAssessment(assessment.ID, status, currentUser(r).ID); err != nil {
+		if errors.Is(err, store.ErrRiskNotOpen) {
+			http.Error(w, "La evaluación ya fue revisada", http.StatusConflict)
+			return
+		}
+		http.Error(w, "No se pudo revisar la evaluación", http.StatusInternalServerError)
+		return
+	}
+
+	if assessment.Action == model.RiskHold {
+		notifyRiskReview(assessment, status)
+		if campaignBefore != nil {
+			if updated, err := store.GetCampaignByID(campaignBefore.ID); err == nil {
+				campaignStatusChanged(r.Context(), campaignBefore, updated)
+			}
+		}
+	}
+
+	reviewed, _ := store.GetRiskAssessmentByID(assessment.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviewed)
+}
+
+// notifyRiskReview avisa al donante o al creador de lo que pasó con lo retenido.
+func notifyRiskReview(assessment *model.RiskAssessment, status string) {
+	switch assessment.SubjectType {
+	case model.RiskSubjectDonation:
+		if status == model.RiskCleared {
+			store.CreateNotification(assessment.UserID, "donation_released", "Tu donación fue revisada y ya puedes completarla")
+		} else {
+			store.CreateNotification(assessment.UserID, "donation_rejected", "Tu donación fue rechazada tras la revisión")
+		}
+	case model.RiskSubjectCampaign:
+		if status == model.RiskCleared {
+			store.CreateNotification(assessment.UserID, "campaign_restored", "Tu campaña fue revisada y ya está publicada")
+		} else {
+			store.CreateNotification(assessment.UserID, "campaign_taken_down", "Tu campaña fue retirada: actividad fraudulenta")
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gofundme-backend/config"
+	"gofundme-backend/model"
+	"gofundme-backend/openpayments"
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateSponsorResponse devuelve el patrocinador y la URL donde debe aprobar el grant.
+type CreateSponsorResponse struct {
+	Sponsor     *model.Sponsor `json:"sponsor"`
+	RedirectUrl string         `json:"redirectUrl"`
+}
+
+// CreateSponsorHandler registra, a nombre del usuario de la sesión, un
+// patrocinador que igualará las donaciones de una campaña. Se le pide un grant de intervalo en su wallet por el tope
+// comprometido y hasta la fecha de expiración; debe aprobarlo en redirectUrl.
+func CreateSponsorHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+
+	var requestBody struct {
+		Name          string    `json:"name"`
+		WalletAddress string    `json:"walletAddress"`
+		Cap           float64   `json:"cap"`
+		MatchRatio    float64   `json:"matchRatio"`
+		ExpiresAt     time.Time `json:"expiresAt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Cuerpo de la petición inválido", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Name == "" || requestBody.WalletAddress == "" {
+		http.Error(w, "El nombre y la wallet son obligatorios", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Cap <= 0 || requestBody.MatchRatio <= 0 {
+		http.Error(w, "El tope y la proporción deben ser positivos", http.StatusBadRequest)
+		return
+	}
+	if !requestBody.ExpiresAt.After(time.Now()) {
+		http.Error(w, "La fecha de expiración debe ser futura", http.StatusBadRequest)
+		return
+	}
+
+	campaign, err := store.GetCampaignByID(campaignID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	if campaign == nil {
+		http.Error(w, "Campaña no encontrada", http.StatusNotFound)
+		return
+	}
+
+	opClient, err := openpayments.NewClient()
+	if err != nil {
+		http.Error(w, "Error al inicializar el cliente de Open Payments", http.StatusInternalServerError)
+		return
+	}
+	now := time.Now().UTC()
+	interval := fmt.Sprintf("R1/%s/PT%dS", now.Format(time.RFC3339), int64(requestBody.ExpiresAt.Sub(now).Seconds()))
+	grant, err := opClient.RequestIntervalGrant(r.Context(), requestBody.WalletAddress, int64(math.Round(requestBody.Cap*100)), interval)
+	if err != nil {
+		log.Printf("Error al solicitar el grant del patrocinador: %v", err)
+		http.Error(w, "No se pudo solicitar la autorización en la wallet del patrocinador", http.StatusBadGateway)
+		return
+	}
+
+	sponsor := &model.Sponsor{
+		CampaignID:    campaign.ID,
+		UserID:        currentUser(r).ID,
+		Name:          requestBody.Name,
+		WalletAddress: requestBody.WalletAddress,
+		Cap:           requestBody.Cap,
+		MatchRatio:    requestBody.MatchRatio,
+		ExpiresAt:     requestBody.ExpiresAt,
+		ContinueURI:   grant.ContinueURI,
+		ContinueToken: grant.ContinueToken,
+	}
+	if err := store.CreateSponsor(sponsor); err != nil {
+		http.Error(w, "No se pudo registrar el patrocinador", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditGrantRequested, SubjectType: "sponsor", SubjectID: subjectID(sponsor.ID)}, nil,
+		map[string]any{"walletAddress": sponsor.WalletAddress, "cap": sponsor.Cap, "interval": interval, "purpose": "sponsor_match"})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(CreateSponsorResponse{Sponsor: sponsor, RedirectUrl: grant.RedirectURL})
+}
+
+// AuthorizeSponsorHandler finaliza el grant del patrocinador después de que lo
+// aprobó en su wallet. A partir de aquí sus contrapartidas se pagan solas.
+func AuthorizeSponsorHandler(w http.ResponseWriter, r *http.Request) {
+	sponsorID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de patrocinador inválido", http.StatusBadRequest)
+		return
+	}
+
+	sponsor, err := store.GetSponsorByID(sponsorID)
+	if err != nil {
+		http.Error(w, "Error al recuperar el patrocinador", http.StatusInternalServerError)
+		return
+	}
+	if sponsor == nil {
+		http.Error(w, "Patrocinador no encontrado", http.StatusNotFound)
+		return
+	}
+	if sponsor.UserID != currentUser(r).ID {
+		http.Error(w, "Solo quien registró al patrocinador puede autorizarlo", http.StatusForbidden)
+		return
+	}
+	if sponsor.Status != model.SponsorPendingAuthorization {
+		http.Error(w, "El patrocinador ya fue autorizado", http.StatusConflict)
+		return
+	}
+
+	opClient, err := openpayments.NewClient()
+	if err != nil {
+		http.Error(w, "Error al inicializar el cliente de Open Payments", http.StatusInternalServerError)
+		return
+	}
+	accessToken, err := opClient.ContinueGrant(r.Context(), sponsor.ContinueURI, sponsor.ContinueToken)
+	if err != nil {
+		log.Printf("Error al continuar el grant del patrocinador %d: %v", sponsor.ID, err)
+		http.Error(w, "El patrocinador todavía no aprobó el grant", http.StatusConflict)
+		return
+	}
+	if err := store.ActivateSponsor(sponsor.ID, accessToken); err != nil {
+		http.Error(w, "No se pudo activar el patrocinador", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditGrantContinued, SubjectType: "sponsor", SubjectID: subjectID(sponsor.ID)},
+		map[string]string{"status": sponsor.Status}, map[string]string{"status": model.SponsorActive})
+
+	sponsor, _ = store.GetSponsorByID(sponsor.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sponsor)
+}
+
+// GetSponsorsHandler lista los patrocinadores de una campaña.
+func GetSponsorsHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+
+	sponsors, err := store.GetSponsorsByCampaign(campaignID)
+	if err != nil {
+		http.Error(w, "Error al recuperar los patrocinadores", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sponsors)
+}
+
+// ReverseDonationHandler revierte una donación completada en el ledger, junto
+// con las contrapartidas que generó.
+func ReverseDonationHandler(w http.ResponseWriter, r *http.Request) {
+	donationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de donación inválido", http.StatusBadRequest)
+		return
+	}
+
+	if err := store.ReverseDonation(donationID, "revertida por un administrador"); err != nil {
+		if errors.Is(err, store.ErrDonationNotCompleted) {
+			http.Error(w, "La donación no existe o no está completada", http.StatusConflict)
+			return
+		}
+		http.Error(w, "No se pudo revertir la donación", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// matchDonation paga las contrapartidas de los patrocinadores activos de la
+// campaña para una donación confirmada. Los errores se registran pero no
+// afectan a la donación, que ya fue pagada.
+func matchDonation(ctx context.Context, opClient *openpayments.Client, donation *model.Donation) {
+	campaign, err := store.GetCampaignByID(donation.CampaignID)
+	if err != nil || campaign == nil {
+		log.Printf("[ERROR] No se pudo cargar la campaña %d para las contrapartidas: %v", donation.CampaignID, err)
+		return
+	}
+	sponsors, err := store.GetSponsorsByCampaign(campaign.ID)
+	if err != nil {
+		return
+	}
+
+	for _, sponsor := range sponsors {
+		amount := math.Min(donation.Amount*sponsor.MatchRatio, sponsor.RemainingCapacity())
+		amount = math.Floor(amount*100) / 100
+		if amount <= 0 {
+			continue
+		}
+
+		match, err := store.ReserveSponsorMatch(sponsor.ID, donation.ID, amount)
+		if err != nil {
+			log.Printf("No se pudo reservar la contrapartida de %s: %v", sponsor.Name, err)
+			continue
+		}
+		payMatch(ctx, opClient, campaign, &sponsor, match)
+	}
+}
+
+// payMatch paga una contrapartida ya reservada con el grant del patrocinador.
+// Si el pago falla, la contrapartida queda fallida y se libera su capacidad.
+func payMatch(ctx context.Context, opClient *openpayments.Client, campaign *model.Campaign, sponsor *model.Sponsor, match *model.SponsorMatch) error {
+	// La contrapartida va al payment pointer principal, o a la wallet de la
+	// plataforma si la campaña retiene fondos en escrow.
+	recipient := campaign.PaymentPointer
+	if campaign.Escrow {
+		recipient = config.PlatformWalletAddress()
+	}
+
+	description := fmt.Sprintf("Contrapartida de %s para la campaña: %s", sponsor.Name, campaign.Title)
+	outgoingPayment, err := opClient.PayWithGrant(ctx, sponsor.WalletAddress, sponsor.AccessToken, recipient, int64(math.Round(match.Amount*math.Pow10(campaign.Scale()))), description)
+	if err != nil {
+		log.Printf("[ERROR] Falló la contrapartida de %s para la donación %d: %v", sponsor.Name, match.DonationID, err)
+		store.FailSponsorMatch(match)
+		recordAudit(ctx, model.AuditEvent{Action: model.AuditOutgoingPaymentFailed, SubjectType: "sponsor_match", SubjectID: subjectID(match.ID)}, nil,
+			map[string]any{"sponsorId": sponsor.ID, "donationId": match.DonationID, "amount": match.Amount, "receiver": recipient, "error": err.Error()})
+		return err
+	}
+	store.CompleteSponsorMatch(match.ID, *outgoingPayment.Id)
+	recordAudit(ctx, model.AuditEvent{Action: model.AuditOutgoingPaymentCreated, SubjectType: "sponsor_match", SubjectID: subjectID(match.ID)}, nil,
+		map[string]any{"sponsorId": sponsor.ID, "donationId": match.DonationID, "amount": match.Amount, "receiver": recipient, "outgoingPaymentId": *outgoingPayment.Id})
+	if campaign.Escrow {
+		store.AddEscrowDeposit(campaign.ID, match.DonationID, match.Amount)
+	}
+	log.Printf("Contrapartida de %s por %.2f enviada: %s", sponsor.Name, match.Amount, *outgoingPayment.Id)
+	return nil
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gofundme-backend/config"
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// freeLoginFailures es cuántos intentos fallidos se permiten sin espera.
+	freeLoginFailures = 3
+
+	// loginFailureWindow es cuánto tiempo sin fallos hace falta para que el
+	// contador vuelva a cero.
+	loginFailureWindow = 24 * time.Hour
+)
+
+// loginAttemptsMu serializa la lectura y escritura de los contadores, para
+// que dos intentos simultáneos no pierdan un fallo.
+var loginAttemptsMu sync.Mutex
+
+// loginRetryAfter devuelve cuánto falta para que una clave pueda volver a
+// intentar iniciar sesión: lo que quede de su bloqueo o de la espera
+// exponencial tras su último fallo. 0 si puede intentarlo ya.
+func loginRetryAfter(attempt *model.LoginAttempt, now time.Time) time.Duration {
+	if attempt == nil {
+		return 0
+	}
+	if attempt.LockedUntil != nil && attempt.LockedUntil.After(now) {
+		return attempt.LockedUntil.Sub(now)
+	}
+	if attempt.Failures < freeLoginFailures || now.Sub(attempt.LastFailureAt) > loginFailureWindow {
+		return 0
+	}
+	exp := float64(attempt.Failures - freeLoginFailures)
+	delay := time.Duration(math.Min(float64(config.LoginBackoffBase())*math.Pow(2, exp), float64(config.LoginBackoffMax())))
+	return time.Until(attempt.LastFailureAt.Add(delay))
+}
+
+// loginReservation es un intento de inicio de sesión que ya se contó como
+// fallido antes de comprobar la contraseña. Así dos intentos simultáneos no
+// pueden pasar los dos antes de que el primero sume su fallo.
+type loginReservation struct {
+	ip, username         string
+	ipLocked, userLocked bool
+}
+
+// reserveLoginAttempt comprueba, antes de gastar un bcrypt, si la IP o el
+// usuario tienen que esperar para volver a intentarlo y, si no, suma ya el
+// intento como fallido a los dos. El nombre de usuario se cuenta igual exista
+// o no la cuenta, para que la respuesta no revele cuáles existen. Si hay que
+// esperar responde 429 con Retry-After y devuelve false.
+func reserveLoginAttempt(w http.ResponseWriter, r *http.Request, username string) (*loginReservation, bool) {
+	loginAttemptsMu.Lock()
+	defer loginAttemptsMu.Unlock()
+
+	now := time.Now()
+	res := &loginReservation{ip: clientIP(r), username: username}
+	keys := [][2]string{{model.LoginKeyIP, res.ip}, {model.LoginKeyUsername, res.username}}
+	attempts := make([]*model.LoginAttempt, len(keys))
+	var wait time.Duration
+	for i, key := range keys {
+		attempt, err := store.GetLoginAttempt(key[0], key[1])
+		if err != nil {
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return nil, false
+		}
+		attempts[i] = attempt
+		wait = max(wait, loginRetryAfter(attempt, now))
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Demasiados intentos fallidos, espera antes de volver a intentarlo", http.StatusTooManyRequests)
+		return nil, false
+	}
+
+	var err error
+	if res.ipLocked, err = addLoginFailure(attempts[0], keys[0], config.LoginIPLockoutThreshold(), now); err == nil {
+		res.userLocked, err = addLoginFailure(attempts[1], keys[1], config.LoginLockoutThreshold(), now)
+	}
+	if err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return nil, false
+	}
+	return res, true
+}
+
+// failed confirma que el intento reservado falló. Si con él se bloqueó una
+// cuenta que existe, avisa a su dueño.
+func (res *loginReservation) failed(user *model.User) {
+	if res.userLocked && user != nil {
+		store.CreateNotification(user.ID, "account_locked", "Bloqueamos el inicio de sesión en tu cuenta por "+strconv.Itoa(int(math.Ceil(config.LoginLockoutDuration().Minutes())))+
+			" minutos tras varios intentos fallidos. Si no fuiste tú, te recomendamos cambiar tu contraseña y activar la verificación en dos pasos")
+	}
+}
+
+// release devuelve el intento reservado cuando no fue un fallo: la contraseña
+// era correcta o no se llegó a comprobar por un error interno.
+func (res *loginReservation) release() {
+	loginAttemptsMu.Lock()
+	defer loginAttemptsMu.Unlock()
+
+	removeLoginFailure(model.LoginKeyIP, res.ip, res.ipLocked)
+	removeLoginFailure(model.LoginKeyUsername, res.username, res.userLocked)
+}
+
+// addLoginFailure suma un fallo al contador de una clave y devuelve true si la
+// bloqueó. La clave se bloquea cada threshold fallos. El contador no se
+// reinicia al bloquear, así que tras el bloqueo la espera exponencial sigue
+// creciendo; solo vuelve a cero con un inicio de sesión correcto o tras
+// loginFailureWindow sin fallos. Se llama con loginAttemptsMu tomado.
+func addLoginFailure(attempt *model.LoginAttempt, key [2]string, threshold int, now time.Time) (bool, error) {
+	if attempt == nil || now.Sub(attempt.LastFailureAt) > loginFailureWindow {
+		attempt = &model.LoginAttempt{Kind: key[0], Key: key[1]}
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	locked := attempt.Failures%threshold == 0
+	if locked {
+		until := now.Add(config.LoginLockoutDuration())
+		attempt.LockedUntil = &until
+	}
+	return locked, store.SaveLoginAttempt(attempt)
+}
+
+// removeLoginFailure descuenta un fallo reservado de una clave y quita el
+// bloqueo si lo había puesto esa reserva. Se llama con loginAttemptsMu tomado.
+func removeLoginFailure(kind, key string, unlock bool) {
+	attempt, err := store.GetLoginAttempt(kind, key)
+	if err != nil || attempt == nil {
+		return
+	}
+	attempt.Failures--
+	if attempt.Failures <= 0 {
+		store.ClearLoginAttempt(kind, key)
+		return
+	}
+	if unlock {
+		attempt.LockedUntil = nil
+	}
+	store.SaveLoginAttempt(attempt)
+}
+
+// clearLoginFailures reinicia el contador de una cuenta tras un inicio de
+// sesión correcto. El de la IP no se toca: si no, bastaría con entrar en una
+// cuenta propia para seguir probando contraseñas ajenas.
+func clearLoginFailures(user *model.User) {
+	store.ClearLoginAttempt(model.LoginKeyUsername, user.Username)
+}
+
+// AdminUnlockUserHandler quita el bloqueo por intentos fallidos de una cuenta.
+func AdminUnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de usuario inválido", http.StatusBadRequest)
+		return
+	}
+	user, ok := loadUser(w, userID)
+	if !ok {
+		return
+	}
+	if err := store.ClearLoginAttempt(model.LoginKeyUsername, user.Username); err != nil {
+		http.Error(w, "No se pudo desbloquear al usuario", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
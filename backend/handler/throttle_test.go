@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+)
+
+// postLogin intenta iniciar sesión desde la IP remote con una contraseña que
+// no es la del usuario.
+func postLogin(username, remote string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"username":"`+username+`","password":"incorrecta"}`))
+	req.RemoteAddr = remote + ":1234"
+	w := httptest.NewRecorder()
+	LoginUser(w, req)
+	return w
+}
+
+func TestLoginRetryAfter(t *testing.T) {
+	t.Setenv("LOGIN_BACKOFF_BASE", "1s")
+	t.Setenv("LOGIN_BACKOFF_MAX", "10s")
+	now := time.Now()
+	lockedUntil := now.Add(time.Minute)
+
+	tests := []struct {
+		name    string
+		attempt *model.LoginAttempt
+		want    time.Duration
+	}{
+		{"sin intentos", nil, 0},
+		{"fallos gratis", &model.LoginAttempt{Failures: freeLoginFailures - 1, LastFailureAt: now}, 0},
+		{"primera espera", &model.LoginAttempt{Failures: freeLoginFailures, LastFailureAt: now}, time.Second},
+		{"espera exponencial", &model.LoginAttempt{Failures: freeLoginFailures + 2, LastFailureAt: now}, 4 * time.Second},
+		{"espera máxima", &model.LoginAttempt{Failures: freeLoginFailures + 20, LastFailureAt: now}, 10 * time.Second},
+		{"fallos viejos", &model.LoginAttempt{Failures: 9, LastFailureAt: now.Add(-loginFailureWindow - time.Minute)}, 0},
+		{"bloqueada", &model.LoginAttempt{Failures: 1, LastFailureAt: now, LockedUntil: &lockedUntil}, time.Minute},
+	}
+	for _, tt := range tests {
+		got := loginRetryAfter(tt.attempt, now)
+		// time.Until mide desde otro instante; basta con que no difiera en más de un segundo.
+		if got > tt.want || got < tt.want-time.Second {
+			t.Errorf("%s: loginRetryAfter = %v, quería %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoginThrottleTreatsUnknownUsernamesLikeExistingOnes(t *testing.T) {
+	openTestStore(t)
+	createTestUser(t, "ana")
+
+	statuses := map[string][]int{}
+	for i, username := range []string{"ana", "nadie"} {
+		// Una IP distinta por usuario, para que solo cuente el nombre.
+		remote := fmt.Sprintf("203.0.113.%d", i+1)
+		for range freeLoginFailures + 1 {
+			statuses[username] = append(statuses[username], postLogin(username, remote).Code)
+		}
+	}
+	want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}
+	for username, got := range statuses {
+		if len(got) != len(want) {
+			t.Fatalf("%s: %v", username, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: respuestas %v, quería %v", username, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestLoginReservationCountsBeforeThePasswordCheck(t *testing.T) {
+	openTestStore(t)
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+
+	// Intentos simultáneos: cada uno se cuenta antes de comprobar la
+	// contraseña, así que no pasan más que los gratis.
+	var reservations []*loginReservation
+	for range freeLoginFailures {
+		res, ok := reserveLoginAttempt(httptest.NewRecorder(), req, "ana")
+		if !ok {
+			t.Fatalf("reserva %d rechazada", len(reservations)+1)
+		}
+		reservations = append(reservations, res)
+	}
+	w := httptest.NewRecorder()
+	if _, ok := reserveLoginAttempt(w, req, "ana"); ok || w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("reserva de más: ok=%v, %d, Retry-After %q", ok, w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// Un intento correcto devuelve su reserva y deja pasar otro.
+	reservations[0].release()
+	if _, ok := reserveLoginAttempt(httptest.NewRecorder(), req, "ana"); !ok {
+		t.Fatal("reserva tras devolver otra rechazada")
+	}
+}
+
+func TestLoginLockoutAtThreshold(t *testing.T) {
+	openTestStore(t)
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "2")
+	t.Setenv("LOGIN_BACKOFF_BASE", "1ns")
+	t.Setenv("LOGIN_BACKOFF_MAX", "1ns")
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+
+	first, _ := reserveLoginAttempt(httptest.NewRecorder(), req, "ana")
+	first.failed(nil)
+	second, ok := reserveLoginAttempt(httptest.NewRecorder(), req, "ana")
+	if !ok || !second.userLocked {
+		t.Fatalf("la segunda reserva no bloqueó la cuenta: ok=%v", ok)
+	}
+	if attempt, err := store.GetLoginAttempt(model.LoginKeyUsername, "ana"); err != nil || attempt == nil || attempt.LockedUntil == nil {
+		t.Fatalf("GetLoginAttempt = %+v, %v, quería un bloqueo", attempt, err)
+	}
+
+	// Si ese intento era correcto, el bloqueo que puso su reserva se quita.
+	second.release()
+	attempt, err := store.GetLoginAttempt(model.LoginKeyUsername, "ana")
+	if err != nil || attempt == nil || attempt.Failures != 1 || attempt.LockedUntil != nil {
+		t.Errorf("tras devolver la reserva: %+v, %v", attempt, err)
+	}
+}
@@ -0,0 +1,344 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gofundme-backend/config"
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+	"gofundme-backend/token"
+	"gofundme-backend/totp"
+)
+
+const (
+	recoveryCodeCount = 10
+
+	// twoFactorChallengeTTL es cuánto tiempo hay para escribir el código
+	// después de dar la contraseña.
+	twoFactorChallengeTTL = 5 * time.Minute
+
+	// maxTwoFactorFailures es cuántos códigos incorrectos seguidos se aceptan
+	// antes de tener que volver a dar la contraseña.
+	maxTwoFactorFailures = 5
+)
+
+// hashRecoveryCode normaliza un código de recuperación (sin guiones, espacios
+// ni mayúsculas) y devuelve su hash. Los códigos tienen 80 bits aleatorios, así
+// que basta con SHA-256.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateRecoveryCodes devuelve códigos de recuperación nuevos y sus hashes.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(raw))
+		codes[i] = s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// twoFactorChallengeBinding ata el desafío de inicio de sesión a la
+// contraseña vigente y a la tanda de fallos: tras maxTwoFactorFailures códigos
+// incorrectos el desafío deja de servir y hay que volver a dar la contraseña.
+func twoFactorChallengeBinding(user *model.User) string {
+	return passwordBinding(user) + ":" + strconv.Itoa(user.TOTPFailures/maxTwoFactorFailures)
+}
+
+// TwoFactorCode es el cuerpo con el que se confirma la verificación en dos
+// pasos: un código de la app o, si se perdió el teléfono, uno de recuperación.
+type TwoFactorCode struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// checkTwoFactor valida un código TOTP o de recuperación de un usuario con la
+// verificación en dos pasos activada. Cuenta los fallos; devuelve cuántos
+// lleva seguidos si el código no sirve.
+func checkTwoFactor(r *http.Request, user *model.User, req TwoFactorCode) (bool, int, error) {
+	var ok bool
+	var err error
+	switch {
+	case req.Code != "":
+		if step, valid := totp.Validate(user.TOTPSecret, req.Code, time.Now()); valid {
+			ok, err = store.UseTOTPStep(user.ID, step)
+		}
+	case req.RecoveryCode != "":
+		ok, err = store.UseRecoveryCode(user.ID, hashRecoveryCode(req.RecoveryCode))
+		if ok {
+			recordAudit(r.Context(), model.AuditEvent{Action: model.AuditRecoveryCodeUsed, ActorID: user.ID, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, nil)
+			if left, err := store.CountRecoveryCodes(user.ID); err == nil && left <= 2 {
+				store.CreateNotification(user.ID, "recovery_codes_low", "Te quedan "+strconv.Itoa(left)+" códigos de recuperación; genera nuevos desde tu cuenta")
+			}
+		}
+	}
+	if err != nil || ok {
+		return ok, 0, err
+	}
+
+	failures, err := store.AddTOTPFailure(user.ID)
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditTwoFactorFailed, ActorID: user.ID, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, map[string]int{"failures": failures})
+	return false, failures, err
+}
+
+// EnrollTwoFactorHandler inicia la inscripción en la verificación en dos
+// pasos: genera un secreto y devuelve el URI otpauth:// para escanearlo. No se
+// exige hasta confirmarlo con ActivateTwoFactorHandler.
+func EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user.TwoFactorEnabled() {
+		http.Error(w, "La verificación en dos pasos ya está activada", http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	saved, err := store.SetPendingTOTPSecret(user.ID, secret)
+	if err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if !saved {
+		http.Error(w, "La verificación en dos pasos ya está activada", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":     secret,
+		"otpauthUri": totp.URI(config.TwoFactorIssuer(), user.Username, secret),
+	})
+}
+
+// ActivateTwoFactorHandler confirma la inscripción con un código de la app y
+// devuelve los códigos de recuperación. Es la única vez que se muestran.
+func ActivateTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user.TwoFactorEnabled() {
+		http.Error(w, "La verificación en dos pasos ya está activada", http.StatusConflict)
+		return
+	}
+	if user.TOTPSecret == "" {
+		http.Error(w, "Primero inicia la inscripción", http.StatusBadRequest)
+		return
+	}
+
+	var req TwoFactorCode
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Cuerpo de la solicitud inválido", http.StatusBadRequest)
+		return
+	}
+	step, ok := totp.Validate(user.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		http.Error(w, "Código incorrecto", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if err := store.EnableTOTP(user.ID, step, hashes); err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	store.MarkSessionTwoFactor(bearerToken(r))
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditTwoFactorEnabled, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, nil)
+	store.CreateNotification(user.ID, "two_factor_enabled", "Activaste la verificación en dos pasos en tu cuenta")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recoveryCodes": codes})
+}
+
+// VerifyTwoFactorHandler confirma un código en una sesión ya iniciada, para
+// poder hacer operaciones sensibles durante config.TwoFactorFreshness. Tras
+// demasiados fallos se cierra la sesión.
+func VerifyTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if !user.TwoFactorEnabled() {
+		http.Error(w, "La verificación en dos pasos no está activada", http.StatusBadRequest)
+		return
+	}
+
+	var req TwoFactorCode
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Cuerpo de la solicitud inválido", http.StatusBadRequest)
+		return
+	}
+	ok, failures, err := checkTwoFactor(r, user, req)
+	if err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		if failures%maxTwoFactorFailures == 0 {
+			store.DeleteSession(bearerToken(r))
+			http.Error(w, "Demasiados códigos incorrectos, inicia sesión de nuevo", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Código incorrecto", http.StatusUnauthorized)
+		return
+	}
+	store.MarkSessionTwoFactor(bearerToken(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodesHandler invalida los códigos de recuperación y
+// devuelve unos nuevos.
+func RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if !user.TwoFactorEnabled() {
+		http.Error(w, "La verificación en dos pasos no está activada", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if err := store.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditRecoveryCodesRegenerated, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"recoveryCodes": codes})
+}
+
+// DisableTwoFactorHandler desactiva la verificación en dos pasos.
+func DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if !user.TwoFactorEnabled() {
+		http.Error(w, "La verificación en dos pasos no está activada", http.StatusBadRequest)
+		return
+	}
+	if err := store.DisableTOTP(user.ID); err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditTwoFactorDisabled, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, nil)
+	store.CreateNotification(user.ID, "two_factor_disabled", "Se desactivó la verificación en dos pasos de tu cuenta")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RequireFreshTwoFactor protege operaciones sensibles con freshTwoFactor. Va
+// después de Authenticate.
+func RequireFreshTwoFactor(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if freshTwoFactor(w, r) {
+			next(w, r)
+		}
+	}
+}
+
+// freshTwoFactor comprueba que, si la cuenta tiene la verificación en dos
+// pasos activada, en esta sesión se haya confirmado un código hace menos de
+// config.TwoFactorFreshness. Si no, responde 403 y devuelve false.
+func freshTwoFactor(w http.ResponseWriter, r *http.Request) bool {
+	user := currentUser(r)
+	if user == nil {
+		http.Error(w, "Se requiere iniciar sesión", http.StatusUnauthorized)
+		return false
+	}
+	if !user.TwoFactorEnabled() {
+		return true
+	}
+	at, err := store.GetSessionTwoFactorAt(bearerToken(r))
+	if err != nil {
+		http.Error(w, "Error al validar la sesión", http.StatusInternalServerError)
+		return false
+	}
+	if at == nil || time.Since(*at) > config.TwoFactorFreshness() {
+		http.Error(w, "Confirma tu código de verificación en dos pasos para continuar", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// LoginTwoFactorHandler es el segundo paso del inicio de sesión en cuentas con
+// la verificación en dos pasos: recibe el desafío que devolvió LoginUser y un
+// código, y abre la sesión.
+func LoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Challenge string `json:"challenge"`
+		TwoFactorCode
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Cuerpo de la solicitud inválido", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := token.Parse(req.Challenge, token.PurposeLoginTwoFactor)
+	if err != nil {
+		http.Error(w, "El desafío no es válido o caducó, inicia sesión de nuevo", http.StatusUnauthorized)
+		return
+	}
+	user, ok := loadUser(w, claims.UserID)
+	if !ok {
+		return
+	}
+	if !user.TwoFactorEnabled() || claims.Binding != twoFactorChallengeBinding(user) {
+		http.Error(w, "El desafío ya no es válido, inicia sesión de nuevo", http.StatusUnauthorized)
+		return
+	}
+	if user.Suspended() {
+		http.Error(w, "La cuenta está suspendida", http.StatusForbidden)
+		return
+	}
+	attempt, ok := reserveLoginAttempt(w, r, user.Username)
+	if !ok {
+		return
+	}
+
+	valid, _, err := checkTwoFactor(r, user, req.TwoFactorCode)
+	if err != nil {
+		attempt.release()
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		recordAudit(r.Context(), model.AuditEvent{Action: model.AuditLoginFailed, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, map[string]string{"reason": "bad_2fa_code"})
+		attempt.failed(user)
+		http.Error(w, "Código incorrecto", http.StatusUnauthorized)
+		return
+	}
+	attempt.release()
+	startSession(w, r, user, true)
+}
+
+// writeTwoFactorChallenge responde al primer paso del inicio de sesión de una
+// cuenta con la verificación en dos pasos.
+func writeTwoFactorChallenge(w http.ResponseWriter, user *model.User) {
+	challenge, err := token.Issue(token.PurposeLoginTwoFactor, user.ID, twoFactorChallengeBinding(user), twoFactorChallengeTTL)
+	if err != nil {
+		log.Printf("Error al emitir el desafío de verificación en dos pasos: %v", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"twoFactorRequired": true, "challenge": challenge})
+}
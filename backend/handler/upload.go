@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"gofundme-backend/config"
+)
+
+// maxUploadSize limita el tamaño de los archivos que suben los usuarios.
+const maxUploadSize = 10 << 20 // 10 MB
+
+// uploadedFile describe un archivo guardado en disco por saveUpload.
+type uploadedFile struct {
+	Filename    string
+	ContentType string
+	Path        string
+}
+
+// saveUpload guarda el archivo del campo `field` de un formulario multipart en
+// un subdirectorio de config.UploadDir. El nombre en disco es aleatorio para no
+// confiar en el nombre que manda el cliente.
+func saveUpload(w http.ResponseWriter, r *http.Request, field, subdir string) (*uploadedFile, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, header, err := r.FormFile(field)
+	if err != nil {
+		return nil, fmt.Errorf("archivo inválido: %w", err)
+	}
+	file.Close()
+	return storeUpload(header, subdir)
+}
+
+// saveUploads guarda todos los archivos del campo `field`, que puede repetirse
+// en el formulario. El límite de tamaño aplica a la petición completa. Si un
+// archivo falla, se borran los que ya se habían guardado.
+func saveUploads(w http.ResponseWriter, r *http.Request, field, subdir string) ([]*uploadedFile, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		return nil, fmt.Errorf("formulario inválido: %w", err)
+	}
+	headers := r.MultipartForm.File[field]
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("archivo inválido: %w", http.ErrMissingFile)
+	}
+
+	var saved []*uploadedFile
+	for _, header := range headers {
+		upload, err := storeUpload(header, subdir)
+		if err != nil {
+			for _, f := range saved {
+				os.Remove(f.Path)
+			}
+			return nil, err
+		}
+		saved = append(saved, upload)
+	}
+	return saved, nil
+}
+
+func storeUpload(header *multipart.FileHeader, subdir string) (*uploadedFile, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("archivo inválido: %w", err)
+	}
+	defer file.Close()
+
+	dir := filepath.Join(config.UploadDir(), subdir)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+
+	randomName := make([]byte, 16)
+	if _, err := rand.Read(randomName); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, hex.EncodeToString(randomName)+filepath.Ext(header.Filename))
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, file); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &uploadedFile{
+		Filename:    filepath.Base(header.Filename),
+		ContentType: contentType,
+		Path:        path,
+	}, nil
+}
@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 
+	"gofundme-backend/config"
 	"gofundme-backend/model"
+	"gofundme-backend/openpayments"
 	"gofundme-backend/store"
 )
 
@@ -15,6 +18,7 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 		Username      string `json:"username"`
 		Password      string `json:"password"`
 		WalletAddress string `json:"walletAddress"`
+		Email         string `json:"email"` // Opcional, para recuperar la cuenta
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
@@ -27,6 +31,15 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var email string
+	if requestBody.Email != "" {
+		var ok bool
+		if email, ok = normalizeEmail(requestBody.Email); !ok {
+			http.Error(w, "Correo inválido", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Comprobar si el nombre de usuario ya existe
 	existingUser, err := store.GetUserByUsername(requestBody.Username)
 	if err != nil {
@@ -39,10 +52,25 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Validar la wallet antes de crear la cuenta
+	opClient, err := openpayments.NewClient()
+	if err != nil {
+		http.Error(w, "Error al inicializar el cliente de Open Payments", http.StatusInternalServerError)
+		return
+	}
+	wallet, ok := resolveWallet(w, r, opClient, requestBody.WalletAddress)
+	if !ok {
+		return
+	}
+
 	// Crear el nuevo usuario
 	newUser := &model.User{
-		Username:      requestBody.Username,
-		WalletAddress: requestBody.WalletAddress,
+		Username:         requestBody.Username,
+		WalletAddress:    wallet.URL,
+		WalletAssetCode:  wallet.AssetCode,
+		WalletAssetScale: wallet.AssetScale,
+		WalletAuthServer: wallet.AuthServer,
+		Email:            email,
 	}
 
 	if err := store.CreateUser(newUser, requestBody.Password); err != nil {
@@ -50,12 +78,25 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
 		return
 	}
+	if newUser.Email != "" {
+		if err := sendVerificationEmail(r.Context(), newUser); err != nil {
+			log.Printf("Error al enviar el correo de verificación al usuario %d: %v", newUser.ID, err)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(newUser) // El hash de la contraseña no se enviará gracias a `json:"-"`
 }
 
+// LoginResponse es el usuario autenticado junto con el token de su sesión,
+// que se envía como "Authorization: Bearer <token>".
+type LoginResponse struct {
+	*model.User
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 // LoginUser maneja el inicio de sesión de un usuario.
 func LoginUser(w http.ResponseWriter, r *http.Request) {
 	var requestBody struct {
@@ -73,24 +114,79 @@ func LoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	attempt, ok := reserveLoginAttempt(w, r, requestBody.Username)
+	if !ok {
+		return
+	}
+
 	// Obtener el usuario por su nombre de usuario
 	user, err := store.GetUserByUsername(requestBody.Username)
 	if err != nil {
 		log.Printf("Error al obtener el usuario: %v", err)
+		attempt.release()
 		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
 		return
 	}
 	if user == nil {
+		recordAudit(r.Context(), model.AuditEvent{Action: model.AuditLoginFailed, SubjectType: "user", SubjectID: requestBody.Username}, nil, map[string]string{"reason": "unknown_user"})
+		attempt.failed(nil)
 		http.Error(w, "Credenciales inválidas", http.StatusUnauthorized)
 		return
 	}
 
 	// Comprobar la contraseña
 	if !store.CheckPasswordHash(requestBody.Password, user.PasswordHash) {
+		recordAudit(r.Context(), model.AuditEvent{Action: model.AuditLoginFailed, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, map[string]string{"reason": "bad_password"})
+		attempt.failed(user)
 		http.Error(w, "Credenciales inválidas", http.StatusUnauthorized)
 		return
 	}
 
+	attempt.release()
+
+	if user.Suspended() {
+		recordAudit(r.Context(), model.AuditEvent{Action: model.AuditLoginFailed, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, map[string]string{"reason": "suspended"})
+		http.Error(w, "La cuenta está suspendida", http.StatusForbidden)
+		return
+	}
+
+	// Con la verificación en dos pasos, la sesión se abre en LoginTwoFactorHandler
+	// y el contador de fallos sigue hasta que se confirme el código.
+	if user.TwoFactorEnabled() {
+		writeTwoFactorChallenge(w, user)
+		return
+	}
+	startSession(w, r, user, false)
+}
+
+// startSession abre una sesión para un usuario que ya se identificó y la
+// devuelve. twoFactor indica si se comprobó un código de verificación en dos
+// pasos, lo que habilita las operaciones sensibles por un rato.
+func startSession(w http.ResponseWriter, r *http.Request, user *model.User, twoFactor bool) {
+	token, expiresAt, err := store.CreateSession(user.ID, config.SessionTTL())
+	if err != nil {
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+	if twoFactor {
+		store.MarkSessionTwoFactor(token)
+	}
+	clearLoginFailures(user)
+	recordAudit(r.Context(), model.AuditEvent{Action: model.AuditLoginSucceeded, ActorID: user.ID, SubjectType: "user", SubjectID: subjectID(user.ID)}, nil, map[string]any{"sessionExpiresAt": expiresAt, "twoFactor": twoFactor})
+
+	// Los campos del usuario siguen en la raíz de la respuesta, como antes.
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user) // El hash de la contraseña no se enviará
+	json.NewEncoder(w).Encode(LoginResponse{User: user, Token: token, ExpiresAt: expiresAt}) // El hash de la contraseña no se enviará
+}
+
+// LogoutUser cierra la sesión del token enviado en la cabecera Authorization.
+func LogoutUser(w http.ResponseWriter, r *http.Request) {
+	if token := bearerToken(r); token != "" {
+		if err := store.DeleteSession(token); err != nil {
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+		recordAudit(r.Context(), model.AuditEvent{Action: model.AuditLogout}, nil, nil)
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
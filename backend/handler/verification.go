@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"gofundme-backend/config"
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+
+	"github.com/gorilla/mux"
+)
+
+// SubmitVerificationHandler recibe la solicitud de verificación de una campaña
+// como formulario multipart: "fullName", "documentType", "documentNumber",
+// "notes" opcional y uno o más archivos en "documents". Solo la envía el
+// creador de la campaña.
+func SubmitVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+
+	campaign, err := store.GetCampaignByID(campaignID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la campaña", http.StatusInternalServerError)
+		return
+	}
+	if campaign == nil {
+		http.Error(w, "Campaña no encontrada", http.StatusNotFound)
+		return
+	}
+	if campaign.UserID != currentUser(r).ID {
+		http.Error(w, "Solo el creador de la campaña puede solicitar su verificación", http.StatusForbidden)
+		return
+	}
+
+	uploads, err := saveUploads(w, r, "documents", fmt.Sprintf("verifications/%d", campaignID))
+	if err != nil {
+		log.Printf("Error al guardar los documentos de verificación: %v", err)
+		http.Error(w, "Se necesita al menos un documento válido", http.StatusBadRequest)
+		return
+	}
+	removeUploads := func() {
+		for _, u := range uploads {
+			os.Remove(u.Path)
+		}
+	}
+
+	request := &model.VerificationRequest{
+		CampaignID:     campaignID,
+		UserID:         campaign.UserID,
+		FullName:       r.FormValue("fullName"),
+		DocumentType:   r.FormValue("documentType"),
+		DocumentNumber: r.FormValue("documentNumber"),
+		Notes:          r.FormValue("notes"),
+	}
+	if request.FullName == "" || request.DocumentType == "" || request.DocumentNumber == "" {
+		removeUploads()
+		http.Error(w, "El nombre completo y los datos del documento son obligatorios", http.StatusBadRequest)
+		return
+	}
+
+	if campaign.Verified {
+		removeUploads()
+		http.Error(w, "La campaña ya está verificada", http.StatusConflict)
+		return
+	}
+	latest, err := store.GetLatestVerificationRequest(campaignID)
+	if err != nil {
+		removeUploads()
+		http.Error(w, "Error al recuperar la verificación", http.StatusInternalServerError)
+		return
+	}
+	if latest != nil && latest.Status == model.VerificationPending {
+		removeUploads()
+		http.Error(w, "La campaña ya tiene una solicitud en revisión", http.StatusConflict)
+		return
+	}
+
+	for _, u := range uploads {
+		request.Documents = append(request.Documents, model.VerificationDocument{
+			Filename:    u.Filename,
+			ContentType: u.ContentType,
+			Path:        u.Path,
+		})
+	}
+	if err := store.CreateVerificationRequest(request); err != nil {
+		removeUploads()
+		http.Error(w, "No se pudo registrar la solicitud", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(request)
+}
+
+// GetVerificationHandler devuelve el estado de la última solicitud de
+// verificación de una campaña.
+func GetVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de campaña inválido", http.StatusBadRequest)
+		return
+	}
+
+	request, err := store.GetLatestVerificationRequest(campaignID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la verificación", http.StatusInternalServerError)
+		return
+	}
+	if request == nil {
+		http.Error(w, "La campaña no tiene solicitudes de verificación", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(request)
+}
+
+// GetPendingVerificationsHandler lista las solicitudes pendientes de revisión.
+func GetPendingVerificationsHandler(w http.ResponseWriter, r *http.Request) {
+	requests, err := store.GetVerificationRequestsByStatus(model.VerificationPending)
+	if err != nil {
+		http.Error(w, "Error al recuperar las solicitudes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
+}
+
+// GetVerificationDocumentHandler descarga un documento de una solicitud para revisarlo.
+func GetVerificationDocumentHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	requestID, _ := strconv.Atoi(vars["id"])
+	documentID, _ := strconv.Atoi(vars["documentId"])
+
+	request, err := store.GetVerificationRequestByID(requestID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la solicitud", http.StatusInternalServerError)
+		return
+	}
+	if request == nil {
+		http.Error(w, "Solicitud no encontrada", http.StatusNotFound)
+		return
+	}
+	for _, d := range request.Documents {
+		if d.ID == documentID {
+			w.Header().Set("Content-Type", d.ContentType)
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", d.Filename))
+			http.ServeFile(w, r, d.Path)
+			return
+		}
+	}
+	http.Error(w, "Documento no encontrado", http.StatusNotFound)
+}
+
+// ApproveVerificationHandler aprueba una solicitud y marca la campaña como verificada.
+func ApproveVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	reviewVerification(w, r, model.VerificationApproved)
+}
+
+// RejectVerificationHandler rechaza una solicitud. El cuerpo debe incluir el motivo.
+func RejectVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	reviewVerification(w, r, model.VerificationRejected)
+}
+
+func reviewVerification(w http.ResponseWriter, r *http.Request, status string) {
+	requestID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de solicitud inválido", http.StatusBadRequest)
+		return
+	}
+
+	reason, ok := decodeReason(w, r, status == model.VerificationRejected)
+	if !ok {
+		return
+	}
+
+	request, err := store.GetVerificationRequestByID(requestID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la solicitud", http.StatusInternalServerError)
+		return
+	}
+	if request == nil {
+		http.Error(w, "Solicitud no encontrada", http.StatusNotFound)
+		return
+	}
+	if err := store.ReviewVerificationRequest(request.ID, status, reason); err != nil {
+		if errors.Is(err, store.ErrVerificationNotPending) {
+			http.Error(w, "La solicitud ya fue revisada", http.StatusConflict)
+			return
+		}
+		http.Error(w, "No se pudo revisar la solicitud", http.StatusInternalServerError)
+		return
+	}
+
+	if status == model.VerificationApproved {
+		store.CreateNotification(request.UserID, "verification_approved", "Tu campaña fue verificada")
+	} else {
+		store.CreateNotification(request.UserID, "verification_rejected", "Tu solicitud de verificación fue rechazada: "+reason)
+	}
+
+	reviewed, _ := store.GetVerificationRequestByID(request.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reviewed)
+}
+
+// visibleCampaigns quita de un listado las campañas retiradas u ocultas por
+// moderación y, si la configuración lo pide, las que no están verificadas.
+func visibleCampaigns(campaigns []model.Campaign) []model.Campaign {
+	hideUnverified := config.HideUnverified()
+	visible := []model.Campaign{}
+	for _, c := range campaigns {
+		if c.Status != model.CampaignActive || (hideUnverified && !c.Verified) {
+			continue
+		}
+		visible = append(visible, c)
+	}
+	return visible
+}
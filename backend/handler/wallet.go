@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"gofundme-backend/openpayments"
+)
+
+// resolveWallet valida una wallet address o payment pointer y la resuelve en su
+// servidor. Si falla, ya escribió la respuesta de error.
+func resolveWallet(w http.ResponseWriter, r *http.Request, opClient *openpayments.Client, raw string) (*openpayments.WalletAddressInfo, bool) {
+	info, err := opClient.ResolveWalletAddress(r.Context(), raw)
+	switch {
+	case err == nil:
+		return info, true
+	case errors.Is(err, openpayments.ErrInvalidWalletAddress):
+		http.Error(w, "La wallet address no es válida: "+raw, http.StatusBadRequest)
+	case errors.Is(err, openpayments.ErrUnreachableWalletAddress):
+		log.Printf("No se pudo resolver la wallet %s: %v", raw, err)
+		http.Error(w, "No se pudo encontrar la wallet address: "+raw, http.StatusUnprocessableEntity)
+	default:
+		log.Printf("Error al resolver la wallet %s: %v", raw, err)
+		http.Error(w, "Error al validar la wallet address", http.StatusInternalServerError)
+	}
+	return nil, false
+}
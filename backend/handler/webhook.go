@@ -0,0 +1,350 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gofundme-backend/config"
+	"gofundme-backend/model"
+	"gofundme-backend/openpayments"
+	"gofundme-backend/store"
+	"gofundme-backend/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxWebhookBody limita el tamaño de un webhook.
+	maxWebhookBody = 1 << 20
+
+	// webhookLease es cuánto tiempo se reserva un webhook mientras se
+	// procesa. Si el proceso muere, el evento se reintenta al vencer.
+	webhookLease = 5 * time.Minute
+)
+
+// webhookAmount es un monto tal como lo envía Open Payments, en unidades
+// mínimas del activo.
+type webhookAmount struct {
+	Value      string `json:"value"`
+	AssetCode  string `json:"assetCode"`
+	AssetScale int    `json:"assetScale"`
+}
+
+// webhookPayment son los campos que usamos del incoming o outgoing payment que
+// viene en los datos del webhook.
+type webhookPayment struct {
+	ID             string         `json:"id"`
+	IncomingAmount *webhookAmount `json:"incomingAmount,omitempty"`
+	ReceivedAmount *webhookAmount `json:"receivedAmount,omitempty"`
+	Error          string         `json:"error,omitempty"`
+}
+
+// OpenPaymentsWebhookHandler recibe los eventos del servidor de recursos de
+// Open Payments. Verifica la firma, guarda el evento y lo procesa. Un evento
+// repetido no se vuelve a procesar; uno que falla queda guardado y se
+// reintenta más tarde, por lo que también se responde 2xx.
+func OpenPaymentsWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	secret := config.OPWebhookSecret()
+	if secret == "" {
+		http.Error(w, "Los webhooks de Open Payments no están configurados", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "Cuerpo inválido", http.StatusBadRequest)
+		return
+	}
+	if err := webhook.Verify(secret, r.Header.Get(webhook.SignatureHeader), body, time.Now(), config.WebhookTolerance()); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var event model.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" || event.Type == "" {
+		http.Error(w, "El evento debe tener id, type y data", http.StatusBadRequest)
+		return
+	}
+	if len(event.Data) == 0 {
+		event.Data = json.RawMessage("{}")
+	}
+
+	if _, err := store.SaveWebhookEvent(&event); err != nil {
+		http.Error(w, "Error al guardar el evento", http.StatusInternalServerError)
+		return
+	}
+
+	status, err := runWebhookEvent(r.Context(), event.ID, false)
+	if err != nil {
+		http.Error(w, "Error al procesar el evento", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if status != model.WebhookProcessed {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id": event.ID, "status": status})
+}
+
+// runWebhookEvent procesa un webhook guardado si nadie más lo está
+// procesando y devuelve su estado final. force permite reintentar eventos que
+// agotaron sus reintentos.
+func runWebhookEvent(ctx context.Context, id string, force bool) (string, error) {
+	claimed, err := store.ClaimWebhookEvent(id, webhookLease, force)
+	if err != nil {
+		return "", err
+	}
+	event, err := store.GetWebhookEvent(id)
+	if err != nil || event == nil {
+		return "", err
+	}
+	if !claimed {
+		return event.Status, nil
+	}
+
+	if err := processWebhookEvent(ctx, event); err != nil {
+		log.Printf("[ERROR] No se pudo procesar el webhook %s (%s), intento %d: %v", event.ID, event.Type, event.Attempts+1, err)
+		var next *time.Time
+		if event.Attempts+1 < config.WebhookMaxAttempts() {
+			at := time.Now().Add(time.Duration(float64(config.WebhookRetryBase()) * math.Pow(2, float64(event.Attempts))))
+			next = &at
+		}
+		if err := store.MarkWebhookEventFailed(event.ID, err.Error(), next); err != nil {
+			return "", err
+		}
+		if next == nil {
+			return model.WebhookDead, nil
+		}
+		return model.WebhookFailed, nil
+	}
+
+	if err := store.MarkWebhookEventProcessed(event.ID); err != nil {
+		return "", err
+	}
+	return model.WebhookProcessed, nil
+}
+
+// RetryWebhookEvents vuelve a procesar los webhooks fallidos cuyo siguiente
+// intento ya venció. Es un trabajo periódico de la cola.
+func RetryWebhookEvents(ctx context.Context) {
+	events, err := store.GetDueWebhookEvents(time.Now(), 50)
+	if err != nil {
+		return
+	}
+	for _, event := range events {
+		if _, err := runWebhookEvent(ctx, event.ID, false); err != nil {
+			log.Printf("[ERROR] No se pudo reintentar el webhook %s: %v", event.ID, err)
+		}
+	}
+}
+
+// processWebhookEvent aplica un webhook al ledger. Tiene que poder ejecutarse
+// más de una vez con el mismo evento sin efectos duplicados.
+func processWebhookEvent(ctx context.Context, event *model.WebhookEvent) error {
+	var payment webhookPayment
+	if err := json.Unmarshal(event.Data, &payment); err != nil {
+		return fmt.Errorf("datos del evento inválidos: %v", err)
+	}
+
+	switch event.Type {
+	case model.WebhookIncomingPaymentCompleted:
+		return incomingPaymentCompleted(ctx, event, &payment)
+	case model.WebhookIncomingPaymentExpired:
+		return incomingPaymentExpired(ctx, event, &payment)
+	case model.WebhookOutgoingPaymentFailed:
+		return outgoingPaymentFailed(ctx, event, &payment)
+	}
+	log.Printf("Webhook %s de tipo %s ignorado", event.ID, event.Type)
+	return nil
+}
+
+// paymentIDMatches compara el ID guardado de un pago (su URL) con el que
+// llega en el webhook, que puede ser la URL o solo el último segmento.
+func paymentIDMatches(stored, id string) bool {
+	return stored != "" && (stored == id || strings.HasSuffix(stored, "/"+id))
+}
+
+// incomingPaymentCompleted registra lo recibido por una parte de la donación.
+// Cuando todas las partes recibieron su monto, la donación en curso se
+// confirma: suma a lo recaudado y se pagan las contrapartidas.
+func incomingPaymentCompleted(ctx context.Context, event *model.WebhookEvent, payment *webhookPayment) error {
+	donation, err := store.GetDonationByIncomingPaymentRef(payment.ID)
+	if err != nil {
+		return err
+	}
+	if donation == nil {
+		log.Printf("Webhook %s: el incoming payment %s no pertenece a ninguna donación", event.ID, payment.ID)
+		return nil
+	}
+
+	for i := range donation.Splits {
+		split := &donation.Splits[i]
+		if !paymentIDMatches(split.IncomingPaymentID, payment.ID) {
+			continue
+		}
+		received := split.Amount
+		if payment.ReceivedAmount != nil {
+			if received, err = strconv.ParseInt(payment.ReceivedAmount.Value, 10, 64); err != nil {
+				return fmt.Errorf("monto recibido inválido %q", payment.ReceivedAmount.Value)
+			}
+		}
+		if err := store.SetSplitReceived(split.ID, received); err != nil {
+			return err
+		}
+		split.ReceivedAmount = received
+	}
+
+	if !model.DonationInProgress(donation.Status) && donation.Status != model.DonationNeedsReconciliation {
+		return nil
+	}
+	for _, split := range donation.Splits {
+		if !split.Received() {
+			return nil
+		}
+	}
+
+	opClient, err := openpayments.NewClient()
+	if err != nil {
+		return err
+	}
+	completed, err := completeDonation(ctx, opClient, donation)
+	if err != nil {
+		return err
+	}
+	if completed {
+		recordAudit(ctx, model.AuditEvent{Action: model.AuditDonationCompleted, SubjectType: "donation", SubjectID: subjectID(donation.ID)},
+			map[string]string{"status": donation.Status}, map[string]any{"status": model.DonationCompleted, "webhookId": event.ID})
+	}
+	return nil
+}
+
+// incomingPaymentExpired se recibe cuando un incoming payment venció sin
+// recibir todo su monto: la parte correspondiente de la donación no llegó.
+func incomingPaymentExpired(ctx context.Context, event *model.WebhookEvent, payment *webhookPayment) error {
+	donation, err := store.GetDonationByIncomingPaymentRef(payment.ID)
+	if err != nil {
+		return err
+	}
+	if donation == nil {
+		log.Printf("Webhook %s: el incoming payment %s no pertenece a ninguna donación", event.ID, payment.ID)
+		return nil
+	}
+	for _, split := range donation.Splits {
+		if paymentIDMatches(split.IncomingPaymentID, payment.ID) && split.Received() {
+			return nil
+		}
+	}
+	// Si el donante ya aprobó el pago, no es que no terminara a tiempo: el
+	// pago no llegó.
+	status := model.DonationExpired
+	if donation.Status == model.DonationApproved || donation.Status == model.DonationSending {
+		status = model.DonationFailed
+	}
+	return undoDonation(ctx, event, donation, status, "el incoming payment venció sin recibir el monto")
+}
+
+// outgoingPaymentFailed se recibe cuando el pago desde la wallet del donante
+// no se pudo enviar.
+func outgoingPaymentFailed(ctx context.Context, event *model.WebhookEvent, payment *webhookPayment) error {
+	donation, err := store.GetDonationByOutgoingPaymentRef(payment.ID)
+	if err != nil {
+		return err
+	}
+	if donation == nil {
+		log.Printf("Webhook %s: el outgoing payment %s no pertenece a ninguna donación", event.ID, payment.ID)
+		return nil
+	}
+	recordAudit(ctx, model.AuditEvent{Action: model.AuditOutgoingPaymentFailed, SubjectType: "donation", SubjectID: subjectID(donation.ID)}, nil,
+		map[string]any{"outgoingPaymentId": payment.ID, "error": payment.Error, "webhookId": event.ID})
+
+	reason := "el pago saliente falló"
+	if payment.Error != "" {
+		reason += ": " + payment.Error
+	}
+	return undoDonation(ctx, event, donation, model.DonationFailed, reason)
+}
+
+// undoDonation deja sin efecto una donación cuyo pago no llegó: si estaba en
+// curso o retenida pasa a failedStatus (failed o expired), y si ya se había
+// confirmado se revierte, lo que descuenta su monto de lo recaudado.
+func undoDonation(ctx context.Context, event *model.WebhookEvent, donation *model.Donation, failedStatus, reason string) error {
+	var action, status string
+	switch {
+	case model.DonationInProgress(donation.Status) || donation.Status == model.DonationHeld:
+		failed, err := store.TransitionDonation(donation.ID, failedStatus, reason)
+		if err != nil || !failed {
+			return err
+		}
+		action, status = model.AuditDonationFailed, failedStatus
+	case donation.Status == model.DonationCompleted:
+		if err := store.ReverseDonation(donation.ID, reason); err != nil {
+			if errors.Is(err, store.ErrDonationNotCompleted) {
+				return nil
+			}
+			return err
+		}
+		action, status = model.AuditDonationReversed, model.DonationReversed
+	default:
+		return nil
+	}
+
+	recordAudit(ctx, model.AuditEvent{Action: action, SubjectType: "donation", SubjectID: subjectID(donation.ID)},
+		map[string]string{"status": donation.Status}, map[string]any{"status": status, "reason": reason, "webhookId": event.ID})
+	if donation.DonorUserID != 0 {
+		store.CreateNotification(donation.DonorUserID, "donation_"+status, fmt.Sprintf("Tu donación #%d no se pudo completar: %s", donation.ID, reason))
+	}
+	return nil
+}
+
+// AdminListWebhookEventsHandler lista los webhooks recibidos, opcionalmente
+// filtrados por estado (?status=failed).
+func AdminListWebhookEventsHandler(w http.ResponseWriter, r *http.Request) {
+	events, err := store.GetWebhookEvents(r.URL.Query().Get("status"), 200)
+	if err != nil {
+		http.Error(w, "Error al recuperar los webhooks", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// AdminRetryWebhookEventHandler vuelve a procesar un webhook fallido, aunque
+// haya agotado sus reintentos.
+func AdminRetryWebhookEventHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	event, err := store.GetWebhookEvent(id)
+	if err != nil {
+		http.Error(w, "Error al recuperar el webhook", http.StatusInternalServerError)
+		return
+	}
+	if event == nil {
+		http.Error(w, "Webhook no encontrado", http.StatusNotFound)
+		return
+	}
+	if event.Status == model.WebhookProcessed {
+		http.Error(w, "El webhook ya se procesó", http.StatusConflict)
+		return
+	}
+
+	if _, err := runWebhookEvent(r.Context(), id, true); err != nil {
+		http.Error(w, "Error al procesar el webhook", http.StatusInternalServerError)
+		return
+	}
+	event, err = store.GetWebhookEvent(id)
+	if err != nil || event == nil {
+		http.Error(w, "Error al recuperar el webhook", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(event)
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gofundme-backend/clientkeys"
+	"gofundme-backend/config"
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+	"gofundme-backend/webhook"
+)
+
+const testWebhookSecret = "secreto-de-prueba"
+
+// openTestStore abre una base de datos nueva con su propio llavero.
+func openTestStore(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	store.InitDB(filepath.Join(dir, "test.db"))
+	t.Cleanup(func() { store.DB.Close() })
+
+	kms, err := store.LoadOrCreateLocalKMS(filepath.Join(dir, "master.keys"))
+	if err != nil {
+		t.Fatalf("LoadOrCreateLocalKMS: %v", err)
+	}
+	store.SetKMS(kms)
+}
+
+// setupWebhookTest abre una base de datos nueva con webhooks configurados y
+// una llave de cliente, para que el flujo pueda crear el cliente de Open
+// Payments sin salir a la red.
+func setupWebhookTest(t *testing.T) {
+	t.Helper()
+	openTestStore(t)
+	if _, err := clientkeys.Generate(config.ClientWalletAddress(), time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+
+	t.Setenv("OP_WEBHOOK_SECRET", testWebhookSecret)
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+	t.Setenv("WEBHOOK_RETRY_BASE", "1m")
+}
+
+// createTestUser inserta un usuario sin pasar por CreateUser, que hashea con
+// bcrypt y haría lenta la prueba.
+func createTestUser(t *testing.T, username string) int {
+	t.Helper()
+	res, err := store.DB.Exec("INSERT INTO users (username, password_hash, wallet_address) VALUES (?, '', ?)", username, "https://wallet.example/"+username)
+	if err != nil {
+		t.Fatalf("insertar usuario: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return int(id)
+}
+
+// createTestDonation crea una campaña y una donación en curso de una sola
+// parte, pagada al incoming payment incomingPaymentID.
+func createTestDonation(t *testing.T, incomingPaymentID string) *model.Donation {
+	t.Helper()
+	campaignID, err := store.CreateCampaign(model.Campaign{
+		UserID: createTestUser(t, "creador"), Title: "Campaña", Goal: 100, Currency: "USD", AssetCode: "USD", AssetScale: 2,
+		PaymentPointer: "https://wallet.example/campana",
+		Beneficiaries:  []model.Beneficiary{{WalletAddress: "https://wallet.example/campana", Share: 100}},
+	})
+	if err != nil {
+		t.Fatalf("CreateCampaign: %v", err)
+	}
+	donation := &model.Donation{
+		CampaignID: campaignID, Amount: 25, Currency: "USD",
+		Splits: []model.DonationSplit{{WalletAddress: "https://wallet.example/campana", Share: 100, Amount: 2500, IncomingPaymentID: incomingPaymentID}},
+	}
+	if err := store.CreateDonation(donation); err != nil {
+		t.Fatalf("CreateDonation: %v", err)
+	}
+	return donation
+}
+
+// postWebhook envía el evento firmado con secret al handler y devuelve la respuesta.
+func postWebhook(t *testing.T, secret string, event map[string]any) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks/openpayments", bytes.NewReader(body))
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(secret, body, time.Now()))
+	rec := httptest.NewRecorder()
+	OpenPaymentsWebhookHandler(rec, req)
+	return rec
+}
+
+func amountRaised(t *testing.T, campaignID int) float64 {
+	t.Helper()
+	campaign, err := store.GetCampaignByID(campaignID)
+	if err != nil || campaign == nil {
+		t.Fatalf("GetCampaignByID: %v", err)
+	}
+	return campaign.AmountRaised
+}
+
+func TestOpenPaymentsWebhookRejectsBadSignature(t *testing.T) {
+	setupWebhookTest(t)
+	donation := createTestDonation(t, "https://wallet.example/incoming-payments/ip-1")
+
+	rec := postWebhook(t, "otro-secreto", map[string]any{
+		"id": "evt-forjado", "type": model.WebhookIncomingPaymentCompleted,
+		"data": map[string]any{"id": "ip-1"},
+	})
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("código = %d, quería 401", rec.Code)
+	}
+	if raised := amountRaised(t, donation.CampaignID); raised != 0 {
+		t.Errorf("amount_raised = %v tras un webhook sin firma válida", raised)
+	}
+}
+
+func TestOpenPaymentsWebhookAppliesEventOnce(t *testing.T) {
+	setupWebhookTest(t)
+	donation := createTestDonation(t, "https://wallet.example/incoming-payments/ip-1")
+
+	event := map[string]any{
+		"id": "evt-1", "type": model.WebhookIncomingPaymentCompleted,
+		"data": map[string]any{
+			"id":             "ip-1",
+			"receivedAmount": map[string]any{"value": "2500", "assetCode": "USD", "assetScale": 2},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		rec := postWebhook(t, testWebhookSecret, event)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("envío %d: código = %d (%s)", i+1, rec.Code, rec.Body.String())
+		}
+		var resp map[string]string
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if resp["status"] != model.WebhookProcessed {
+			t.Errorf("envío %d: estado = %q, quería %q", i+1, resp["status"], model.WebhookProcessed)
+		}
+	}
+
+	if raised := amountRaised(t, donation.CampaignID); raised != donation.Amount {
+		t.Errorf("amount_raised = %v, quería %v", raised, donation.Amount)
+	}
+	got, err := store.GetDonationByID(donation.ID)
+	if err != nil || got == nil {
+		t.Fatalf("GetDonationByID: %v", err)
+	}
+	if got.Status != model.DonationCompleted {
+		t.Errorf("estado de la donación = %q, quería %q", got.Status, model.DonationCompleted)
+	}
+	saved, err := store.GetWebhookEvent("evt-1")
+	if err != nil || saved == nil {
+		t.Fatalf("GetWebhookEvent: %v", err)
+	}
+	if saved.Attempts != 1 {
+		t.Errorf("el evento se procesó %d veces, quería 1", saved.Attempts)
+	}
+}
+
+func TestWebhookRetryBackoffAndDeadLetter(t *testing.T) {
+	setupWebhookTest(t)
+	ctx := context.Background()
+
+	// Datos que no son un objeto: el procesamiento falla siempre.
+	rec := postWebhook(t, testWebhookSecret, map[string]any{
+		"id": "evt-roto", "type": model.WebhookIncomingPaymentCompleted, "data": "no es un objeto",
+	})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("código = %d, quería 202 (%s)", rec.Code, rec.Body.String())
+	}
+
+	expectEvent := func(status string, attempts int, backoff time.Duration) {
+		t.Helper()
+		event, err := store.GetWebhookEvent("evt-roto")
+		if err != nil || event == nil {
+			t.Fatalf("GetWebhookEvent: %v", err)
+		}
+		if event.Status != status || event.Attempts != attempts {
+			t.Fatalf("evento %s con %d intentos, quería %s con %d", event.Status, event.Attempts, status, attempts)
+		}
+		if backoff == 0 {
+			if event.NextAttemptAt != nil {
+				t.Errorf("un evento muerto no debe tener próximo intento: %v", event.NextAttemptAt)
+			}
+			return
+		}
+		if event.NextAttemptAt == nil {
+			t.Fatal("el evento fallido no tiene próximo intento")
+		}
+		if wait := time.Until(*event.NextAttemptAt); wait < backoff-5*time.Second || wait > backoff+5*time.Second {
+			t.Errorf("próximo intento en %v, quería unos %v", wait, backoff)
+		}
+	}
+	expectEvent(model.WebhookFailed, 1, time.Minute)
+
+	// El reintento periódico solo toma eventos vencidos.
+	RetryWebhookEvents(ctx)
+	expectEvent(model.WebhookFailed, 1, time.Minute)
+
+	// La espera se duplica en cada intento hasta agotar WEBHOOK_MAX_ATTEMPTS.
+	if status, err := runWebhookEvent(ctx, "evt-roto", false); err != nil || status != model.WebhookFailed {
+		t.Fatalf("segundo intento: %q, %v", status, err)
+	}
+	expectEvent(model.WebhookFailed, 2, 2*time.Minute)
+
+	if status, err := runWebhookEvent(ctx, "evt-roto", false); err != nil || status != model.WebhookDead {
+		t.Fatalf("tercer intento: %q, %v", status, err)
+	}
+	expectEvent(model.WebhookDead, 3, 0)
+
+	// Muerto, solo se reintenta a la fuerza, como desde el panel de administración.
+	if status, err := runWebhookEvent(ctx, "evt-roto", false); err != nil || status != model.WebhookDead {
+		t.Fatalf("intento sin forzar: %q, %v", status, err)
+	}
+	expectEvent(model.WebhookDead, 3, 0)
+	if status, err := runWebhookEvent(ctx, "evt-roto", true); err != nil || status != model.WebhookDead {
+		t.Fatalf("intento forzado: %q, %v", status, err)
+	}
+	expectEvent(model.WebhookDead, 4, 0)
+}
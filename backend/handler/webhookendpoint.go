@@ -0,0 +1,433 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gofundme-backend/config"
+	"gofundme-backend/jobs"
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+	"gofundme-backend/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// maxWebhookEndpoints es cuántos endpoints puede registrar un creador.
+	maxWebhookEndpoints = 10
+
+	// deliveryLease es cuánto tiempo se reserva una entrega mientras se envía.
+	deliveryLease = time.Minute
+)
+
+// Cabeceras de los webhooks que se envían a los creadores. La firma usa el
+// mismo esquema que los webhooks que recibimos de Open Payments.
+const (
+	deliverySignatureHeader = "AidLoop-Signature"
+	deliveryEventHeader     = "AidLoop-Event"
+	deliveryIDHeader        = "AidLoop-Delivery"
+)
+
+// errBlockedAddress indica que el endpoint resolvió a una dirección a la que
+// no se entregan webhooks.
+var errBlockedAddress = errors.New("dirección no permitida")
+
+// cgnatPrefix es el espacio compartido de RFC 6598, que net/netip no
+// considera privado pero tampoco es alcanzable desde internet.
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddress indica si una IP es pública. Las de loopback, redes privadas,
+// link-local (como el servicio de metadatos 169.254.169.254), multicast y la
+// no especificada quedan fuera.
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() && !addr.IsLoopback() && !addr.IsPrivate() && !addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() && !addr.IsInterfaceLocalMulticast() && !addr.IsMulticast() &&
+		!addr.IsUnspecified() && !cgnatPrefix.Contains(addr)
+}
+
+// checkDialAddress se ejecuta después de resolver el DNS y antes de cada
+// conexión, así que también cubre un DNS que cambia entre el registro del
+// endpoint y la entrega.
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	if config.WebhookAllowPrivateNetworks() {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !publicAddress(addr) {
+		return errBlockedAddress
+	}
+	return nil
+}
+
+var webhookClient = &http.Client{
+	Transport: &http.Transport{
+		// Sin proxy: la conexión tiene que ir a la dirección que se comprobó.
+		Proxy:                 nil,
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second, Control: checkDialAddress}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		MaxIdleConns:          20,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	// No se siguen redirecciones: el endpoint registrado es el que recibe el evento.
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// CreatorEvent es el cuerpo de un webhook enviado a un creador.
+type CreatorEvent struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"createdAt"`
+	Data      any       `json:"data"`
+}
+
+// CreateWebhookEndpointRequest registra un endpoint. Sin events se suscribe a todos.
+type CreateWebhookEndpointRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validateEndpointURL exige una URL absoluta con HTTPS, salvo que
+// WEBHOOK_ALLOW_HTTP permita HTTP para probar en local, y rechaza de entrada
+// localhost y las IPs que no son públicas. Los nombres que resuelven a una
+// dirección interna se bloquean al conectar, en checkDialAddress.
+func validateEndpointURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("la URL del endpoint no es válida")
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && config.WebhookAllowHTTP()) {
+		return fmt.Errorf("la URL del endpoint debe usar https")
+	}
+	if config.WebhookAllowPrivateNetworks() {
+		return nil
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("la URL del endpoint debe ser pública")
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !publicAddress(addr) {
+		return fmt.Errorf("la URL del endpoint debe ser pública")
+	}
+	return nil
+}
+
+// deliveryError describe para el creador por qué falló un intento. El error
+// de red completo solo va al log: guardarlo en la entrega le diría al creador
+// qué puertos y hosts responden del otro lado.
+func deliveryError(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errBlockedAddress):
+		return "la dirección del endpoint no está permitida"
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		return "el endpoint no respondió a tiempo"
+	default:
+		return "no se pudo conectar con el endpoint"
+	}
+}
+
+// CreateWebhookEndpointHandler registra un endpoint de webhooks del usuario
+// autenticado. El secreto para verificar las firmas solo se muestra aquí.
+func CreateWebhookEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	var req CreateWebhookEndpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Cuerpo inválido", http.StatusBadRequest)
+		return
+	}
+	if err := validateEndpointURL(req.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Events) == 0 {
+		req.Events = model.CreatorEvents
+	}
+	for _, event := range req.Events {
+		if !(model.WebhookEndpoint{Events: model.CreatorEvents}).Subscribed(event) {
+			http.Error(w, fmt.Sprintf("Evento desconocido: %s", event), http.StatusBadRequest)
+			return
+		}
+	}
+
+	user := currentUser(r)
+	existing, err := store.GetWebhookEndpointsByUser(user.ID)
+	if err != nil {
+		http.Error(w, "Error al recuperar los endpoints", http.StatusInternalServerError)
+		return
+	}
+	if len(existing) >= maxWebhookEndpoints {
+		http.Error(w, fmt.Sprintf("Solo se pueden registrar %d endpoints", maxWebhookEndpoints), http.StatusConflict)
+		return
+	}
+
+	endpoint := &model.WebhookEndpoint{UserID: user.ID, URL: req.URL, Events: req.Events, Secret: "whsec_" + randomHex(24)}
+	if err := store.CreateWebhookEndpoint(endpoint); err != nil {
+		http.Error(w, "No se pudo registrar el endpoint", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(endpoint)
+}
+
+// GetWebhookEndpointsHandler lista los endpoints del usuario autenticado, sin sus secretos.
+func GetWebhookEndpointsHandler(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := store.GetWebhookEndpointsByUser(currentUser(r).ID)
+	if err != nil {
+		http.Error(w, "Error al recuperar los endpoints", http.StatusInternalServerError)
+		return
+	}
+	for i := range endpoints {
+		endpoints[i].Secret = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(endpoints)
+}
+
+// loadOwnEndpoint lee el endpoint de la URL y comprueba que sea del usuario
+// autenticado. Si no, responde y devuelve nil.
+func loadOwnEndpoint(w http.ResponseWriter, r *http.Request) *model.WebhookEndpoint {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de endpoint inválido", http.StatusBadRequest)
+		return nil
+	}
+	endpoint, err := store.GetWebhookEndpoint(id)
+	if err != nil {
+		http.Error(w, "Error al recuperar el endpoint", http.StatusInternalServerError)
+		return nil
+	}
+	if endpoint == nil || endpoint.UserID != currentUser(r).ID {
+		http.Error(w, "Endpoint no encontrado", http.StatusNotFound)
+		return nil
+	}
+	return endpoint
+}
+
+// DeleteWebhookEndpointHandler borra un endpoint y su log de entregas.
+func DeleteWebhookEndpointHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint := loadOwnEndpoint(w, r)
+	if endpoint == nil {
+		return
+	}
+	if err := store.DeleteWebhookEndpoint(endpoint.ID); err != nil {
+		http.Error(w, "No se pudo borrar el endpoint", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetWebhookDeliveriesHandler devuelve el log de entregas de un endpoint.
+func GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint := loadOwnEndpoint(w, r)
+	if endpoint == nil {
+		return
+	}
+	deliveries, err := store.GetWebhookDeliveriesByEndpoint(endpoint.ID, 100)
+	if err != nil {
+		http.Error(w, "Error al recuperar las entregas", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// RedeliverWebhookHandler vuelve a enviar una entrega, en cualquier estado, y
+// devuelve el resultado con su log de intentos.
+func RedeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	endpoint := loadOwnEndpoint(w, r)
+	if endpoint == nil {
+		return
+	}
+	deliveryID, err := strconv.Atoi(mux.Vars(r)["deliveryId"])
+	if err != nil {
+		http.Error(w, "ID de entrega inválido", http.StatusBadRequest)
+		return
+	}
+	delivery, err := store.GetWebhookDelivery(deliveryID)
+	if err != nil {
+		http.Error(w, "Error al recuperar la entrega", http.StatusInternalServerError)
+		return
+	}
+	if delivery == nil || delivery.EndpointID != endpoint.ID {
+		http.Error(w, "Entrega no encontrada", http.StatusNotFound)
+		return
+	}
+
+	claimed, err := store.ClaimWebhookDelivery(delivery.ID, deliveryLease, true)
+	if err != nil {
+		http.Error(w, "Error al reservar la entrega", http.StatusInternalServerError)
+		return
+	}
+	if !claimed {
+		http.Error(w, "La entrega se está enviando en este momento", http.StatusConflict)
+		return
+	}
+	sendWebhook(r.Context(), endpoint, delivery)
+
+	delivery, err = store.GetWebhookDelivery(delivery.ID)
+	if err != nil || delivery == nil {
+		http.Error(w, "Error al recuperar la entrega", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// newEventID genera el ID de un evento que no sale del outbox.
+func newEventID() string {
+	return "evt_" + randomHex(16)
+}
+
+// outboxEventID deriva el ID del evento de la dedupKey de un mensaje del
+// outbox, para que publicarlo otra vez no genere entregas nuevas.
+func outboxEventID(dedupKey string) string {
+	sum := sha256.Sum256([]byte(dedupKey))
+	return "evt_" + hex.EncodeToString(sum[:16])
+}
+
+// emitCreatorEvent encola un evento para los endpoints del creador suscritos
+// a él; la cola de trabajos los envía en segundo plano. Un evento que ya se
+// había encolado para un endpoint no se vuelve a encolar.
+func emitCreatorEvent(creatorID int, eventID, eventType string, data any) error {
+	endpoints, err := store.GetWebhookEndpointsByUser(creatorID)
+	if err != nil || len(endpoints) == 0 {
+		return err
+	}
+
+	event := CreatorEvent{ID: eventID, Type: eventType, CreatedAt: time.Now().UTC(), Data: data}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	for _, endpoint := range endpoints {
+		if !endpoint.Subscribed(eventType) {
+			continue
+		}
+		delivery := &model.WebhookDelivery{EndpointID: endpoint.ID, EventID: event.ID, EventType: eventType, Payload: payload}
+		created, err := store.CreateWebhookDelivery(delivery)
+		if err != nil {
+			return err
+		}
+		if !created {
+			continue
+		}
+		if _, err := jobs.Enqueue(jobDeliverWebhook, deliverWebhookJob{DeliveryID: delivery.ID}); err != nil {
+			log.Printf("[ERROR] No se pudo encolar la entrega %d: %v", delivery.ID, err)
+		}
+	}
+	return nil
+}
+
+// SweepWebhookDeliveries encola las entregas que debieron enviarse hace más de
+// un minuto y siguen pendientes, por ejemplo porque el proceso murió entre
+// guardar la entrega y encolar su envío. Es un trabajo periódico de la cola.
+func SweepWebhookDeliveries(ctx context.Context) error {
+	deliveries, err := store.GetDueWebhookDeliveries(time.Now().Add(-time.Minute), 100)
+	if err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		if _, err := jobs.Enqueue(jobDeliverWebhook, deliverWebhookJob{DeliveryID: delivery.ID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverWebhook envía una entrega si nadie más la está enviando.
+func deliverWebhook(ctx context.Context, deliveryID int) {
+	claimed, err := store.ClaimWebhookDelivery(deliveryID, deliveryLease, false)
+	if err != nil || !claimed {
+		return
+	}
+	delivery, err := store.GetWebhookDelivery(deliveryID)
+	if err != nil || delivery == nil {
+		return
+	}
+	endpoint, err := store.GetWebhookEndpoint(delivery.EndpointID)
+	if err != nil || endpoint == nil {
+		return
+	}
+	sendWebhook(ctx, endpoint, delivery)
+}
+
+// sendWebhook hace un intento de entrega, ya reservado, y guarda el resultado.
+// Cualquier respuesta 2xx cuenta como entregada.
+func sendWebhook(ctx context.Context, endpoint *model.WebhookEndpoint, delivery *model.WebhookDelivery) {
+	attempt := model.WebhookAttempt{AttemptedAt: time.Now()}
+
+	ctx, cancel := context.WithTimeout(ctx, config.WebhookTimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "AidLoop-Webhooks/1.0")
+		req.Header.Set(deliveryEventHeader, delivery.EventType)
+		req.Header.Set(deliveryIDHeader, strconv.Itoa(delivery.ID))
+		req.Header.Set(deliverySignatureHeader, webhook.Sign(endpoint.Secret, delivery.Payload, attempt.AttemptedAt))
+
+		var resp *http.Response
+		if resp, err = webhookClient.Do(req); err == nil {
+			resp.Body.Close()
+			attempt.StatusCode = resp.StatusCode
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				err = fmt.Errorf("el endpoint respondió %s", resp.Status)
+				attempt.Error = err.Error()
+			}
+		} else {
+			log.Printf("Entrega %d a %s fallida: %v", delivery.ID, endpoint.URL, err)
+			attempt.Error = deliveryError(err)
+		}
+	} else {
+		attempt.Error = "la URL del endpoint no es válida"
+	}
+	attempt.DurationMs = time.Since(attempt.AttemptedAt).Milliseconds()
+
+	var next *time.Time
+	if err != nil {
+		if delivery.Attempts+1 < config.WebhookMaxAttempts() {
+			at := time.Now().Add(time.Duration(float64(config.WebhookRetryBase()) * math.Pow(2, float64(delivery.Attempts))))
+			next = &at
+		}
+	}
+	if err := store.RecordWebhookAttempt(delivery.ID, attempt, next); err != nil {
+		log.Printf("[ERROR] No se pudo registrar el intento de entrega %d: %v", delivery.ID, err)
+		return
+	}
+	if next != nil {
+		if _, err := jobs.EnqueueAt(jobDeliverWebhook, deliverWebhookJob{DeliveryID: delivery.ID}, *next); err != nil {
+			log.Printf("[ERROR] No se pudo encolar el reintento de la entrega %d: %v", delivery.ID, err)
+		}
+	}
+}
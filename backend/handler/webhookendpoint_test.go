@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestValidateEndpointURLRejectsInternalHosts(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://hooks.example.com/aidloop", true},
+		{"https://93.184.216.34/hook", true},
+		{"http://hooks.example.com/aidloop", false},
+		{"https://localhost/hook", false},
+		{"https://api.localhost./hook", false},
+		{"https://127.0.0.1:8080/hook", false},
+		{"https://10.0.0.5/hook", false},
+		{"https://192.168.1.1/hook", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://100.64.0.1/hook", false},
+		{"https://[::1]/hook", false},
+		{"https://[::ffff:127.0.0.1]/hook", false},
+		{"https://[fd00::1]/hook", false},
+		{"https://0.0.0.0/hook", false},
+	}
+	for _, tt := range tests {
+		if err := validateEndpointURL(tt.url); (err == nil) != tt.ok {
+			t.Errorf("validateEndpointURL(%q) = %v, quería ok=%v", tt.url, err, tt.ok)
+		}
+	}
+}
+
+func TestWebhookClientBlocksPrivateAddressesAtDial(t *testing.T) {
+	var hit bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hit = true }))
+	defer server.Close()
+
+	_, err := webhookClient.Post(server.URL, "application/json", nil)
+	if !errors.Is(err, errBlockedAddress) {
+		t.Fatalf("Post a %s = %v, quería errBlockedAddress", server.URL, err)
+	}
+	if hit {
+		t.Error("la petición llegó al servidor de loopback")
+	}
+	if got := deliveryError(err); got != "la dirección del endpoint no está permitida" {
+		t.Errorf("deliveryError = %q", got)
+	}
+
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	resp, err := webhookClient.Post(server.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("con WEBHOOK_ALLOW_PRIVATE_NETWORKS: %v", err)
+	}
+	resp.Body.Close()
+	if !hit {
+		t.Error("la petición no llegó al servidor de loopback")
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"8.8.8.8":         true,
+		"2606:4700::1111": true,
+		"127.0.0.53":      false,
+		"172.16.0.1":      false,
+		"169.254.169.254": false,
+		"fe80::1":         false,
+		"224.0.0.1":       false,
+		"::":              false,
+	} {
+		if got := publicAddress(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("publicAddress(%s) = %v, quería %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Package jobs ejecuta en segundo plano los trabajos guardados en la tabla
+// jobs. Cada tipo de trabajo registra un handler con Register; los trabajos se
+// encolan con Enqueue o EnqueueAt y los ejecuta Run, que al cancelarse espera a
+// que terminen los que están en curso.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"gofundme-backend/config"
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+)
+
+// Options configura un tipo de trabajo. Los valores en cero usan los de config.
+type Options struct {
+	Concurrency int           // Trabajos de este tipo a la vez; 1 por omisión
+	MaxAttempts int           // Intentos antes de dejarlo muerto
+	RetryBase   time.Duration // Espera antes del primer reintento; se duplica en cada uno
+	Timeout     time.Duration // Duración máxima de un intento
+
+	// Every hace que el trabajo sea periódico: Run lo encola al arrancar y,
+	// cada vez que termina, lo vuelve a encolar para dentro de Every.
+	Every time.Duration
+}
+
+// ErrUnknownType se devuelve al encolar un trabajo de un tipo sin registrar.
+var ErrUnknownType = errors.New("tipo de trabajo desconocido")
+
+// permanentError marca un error que no se arregla reintentando.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent envuelve un error para que el trabajo quede muerto sin agotar sus
+// reintentos, por ejemplo si su payload no es válido.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+type jobType struct {
+	name string
+	opts Options
+	run  func(ctx context.Context, payload []byte) error
+	sem  chan struct{}
+}
+
+var (
+	mu    sync.RWMutex
+	types = map[string]*jobType{}
+
+	// wake despierta a Run cuando se encola un trabajo para ya.
+	wake = make(chan struct{}, 1)
+)
+
+// Register asocia un tipo de trabajo con su handler. El payload de cada
+// trabajo se decodifica de JSON a T antes de llamarlo. Se llama al arrancar,
+// antes de Run.
+func Register[T any](name string, opts Options, fn func(ctx context.Context, payload T) error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = config.JobMaxAttempts()
+	}
+	if opts.RetryBase <= 0 {
+		opts.RetryBase = config.JobRetryBase()
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = config.JobTimeout()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	types[name] = &jobType{
+		name: name,
+		opts: opts,
+		sem:  make(chan struct{}, opts.Concurrency),
+		run: func(ctx context.Context, data []byte) error {
+			var payload T
+			if err := json.Unmarshal(data, &payload); err != nil {
+				return Permanent(fmt.Errorf("payload inválido: %v", err))
+			}
+			return fn(ctx, payload)
+		},
+	}
+}
+
+func lookup(name string) *jobType {
+	mu.RLock()
+	defer mu.RUnlock()
+	return types[name]
+}
+
+// Enqueue encola un trabajo para ejecutarse cuanto antes.
+func Enqueue(name string, payload any) (int, error) {
+	return EnqueueAt(name, payload, time.Now())
+}
+
+// EnqueueAt encola un trabajo para ejecutarse a partir de at.
+func EnqueueAt(name string, payload any, at time.Time) (int, error) {
+	t := lookup(name)
+	if t == nil {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownType, name)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	job := &model.Job{Type: name, Payload: data, MaxAttempts: t.opts.MaxAttempts, RunAt: at}
+	if err := store.EnqueueJob(job); err != nil {
+		return 0, err
+	}
+	if !at.After(time.Now()) {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	return job.ID, nil
+}
+
+// schedule encola la siguiente ejecución de un trabajo periódico, si no hay ya una.
+func schedule(t *jobType, at time.Time) {
+	job := &model.Job{Type: t.name, Payload: []byte("{}"), MaxAttempts: t.opts.MaxAttempts, RunAt: at}
+	store.EnqueueJobOnce(job)
+}
+
+// Run ejecuta los trabajos encolados hasta que se cancela ctx. Entonces deja
+// de tomar trabajos nuevos y espera a que terminen los que están en curso; los
+// intentos no se cancelan con ctx, sino al vencer el Timeout de su tipo.
+func Run(ctx context.Context) {
+	mu.RLock()
+	var all []*jobType
+	for _, t := range types {
+		all = append(all, t)
+	}
+	mu.RUnlock()
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+
+	for _, t := range all {
+		if t.opts.Every > 0 {
+			schedule(t, time.Now())
+		}
+	}
+
+	var wg sync.WaitGroup
+	ticker := time.NewTicker(config.JobPollInterval())
+	defer ticker.Stop()
+	for {
+		for _, t := range all {
+			claim(t, &wg)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("Esperando a que terminen los trabajos en curso...")
+			wg.Wait()
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// claim reserva tantos trabajos del tipo como lugares libres tenga y los
+// ejecuta en paralelo.
+func claim(t *jobType, wg *sync.WaitGroup) {
+	free := cap(t.sem) - len(t.sem)
+	if free == 0 {
+		return
+	}
+	// La reserva dura algo más que el intento para que nadie lo retome mientras sigue en curso.
+	claimed, err := store.ClaimJobs(t.name, free, t.opts.Timeout+time.Minute)
+	if err != nil {
+		return
+	}
+	for _, job := range claimed {
+		t.sem <- struct{}{}
+		wg.Add(1)
+		go func(job model.Job) {
+			defer wg.Done()
+			defer func() { <-t.sem }()
+			execute(t, job)
+		}(job)
+	}
+}
+
+// execute hace un intento de un trabajo ya reservado y guarda el resultado.
+func execute(t *jobType, job model.Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.opts.Timeout)
+	defer cancel()
+
+	err := func() (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("panic: %v", p)
+			}
+		}()
+		return t.run(ctx, job.Payload)
+	}()
+
+	if err == nil {
+		store.CompleteJob(job.ID)
+	} else {
+		var permanent permanentError
+		var next *time.Time
+		if !errors.As(err, &permanent) && job.Attempts < job.MaxAttempts {
+			at := time.Now().Add(time.Duration(float64(t.opts.RetryBase) * math.Pow(2, float64(job.Attempts-1))))
+			next = &at
+		}
+		store.FailJob(job.ID, err.Error(), next)
+		if next == nil {
+			log.Printf("[ERROR] El trabajo %d (%s) quedó muerto tras %d intentos: %v", job.ID, t.name, job.Attempts, err)
+			if t.opts.Every > 0 {
+				// Que un trabajo periódico muera no detiene las siguientes ejecuciones.
+				schedule(t, time.Now().Add(t.opts.Every))
+			}
+		}
+		return
+	}
+	if t.opts.Every > 0 {
+		schedule(t, time.Now().Add(t.opts.Every))
+	}
+}
+
+// Retry vuelve a encolar para ya un trabajo fallido o muerto. Devuelve false
+// si no existe o no está en esos estados.
+func Retry(id int) (bool, error) {
+	retried, err := store.RetryJob(id)
+	if err == nil && retried {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	return retried, err
+}
+
+// Trigger ejecuta cuanto antes un trabajo periódico sin esperar a su
+// siguiente ejecución: adelanta la que está encolada o, si no hay ninguna sin
+// terminar, encola una.
+func Trigger(name string) error {
+	t := lookup(name)
+	if t == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownType, name)
+	}
+	expedited, err := store.ExpediteJob(name)
+	if err != nil {
+		return err
+	}
+	if !expedited {
+		schedule(t, time.Now())
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
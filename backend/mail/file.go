@@ -0,0 +1,34 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileSender guarda cada correo como un archivo .eml en Dir en lugar de
+// enviarlo, y deja una línea en el log. Sirve para desarrollo y pruebas.
+type FileSender struct {
+	Dir  string
+	From string
+}
+
+// Send implementa Sender.
+func (s *FileSender) Send(_ context.Context, msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return fmt.Errorf("error al crear el directorio de correos: %w", err)
+	}
+	from := s.From
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	path := filepath.Join(s.Dir, fmt.Sprintf("%d.eml", time.Now().UnixNano()))
+	if err := os.WriteFile(path, format(from, msg), 0600); err != nil {
+		return fmt.Errorf("error al guardar el correo: %w", err)
+	}
+	log.Printf("Correo para %s (%q) guardado en %s", msg.To, msg.Subject, path)
+	return nil
+}
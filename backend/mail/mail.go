@@ -0,0 +1,58 @@
+// Package mail envía correos a los usuarios con un Sender intercambiable. El
+// sender por defecto guarda los correos en archivos para trabajar en local;
+// main configura SMTP si así lo indica la configuración.
+package mail
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidMessage indica un destinatario o asunto que no se puede enviar,
+// por ejemplo porque contiene saltos de línea.
+var ErrInvalidMessage = errors.New("correo inválido")
+
+// Message es un correo de texto plano.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender entrega correos.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	mu      sync.RWMutex
+	current Sender = &FileSender{Dir: "sent_mail"}
+)
+
+// SetSender cambia el sender usado por Send.
+func SetSender(s Sender) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = s
+}
+
+// Send entrega un correo con el sender actual.
+func Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	mu.RLock()
+	s := current
+	mu.RUnlock()
+	return s.Send(ctx, msg)
+}
+
+// validate evita que un destinatario o asunto inyecte cabeceras.
+func (m Message) validate() error {
+	if m.To == "" || strings.ContainsAny(m.To, "\r\n") || strings.ContainsAny(m.Subject, "\r\n") {
+		return ErrInvalidMessage
+	}
+	return nil
+}
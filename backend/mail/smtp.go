@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+)
+
+// SMTPSender entrega los correos a un servidor SMTP. Si el servidor lo
+// admite, la conexión pasa a TLS con STARTTLS antes de autenticarse.
+type SMTPSender struct {
+	Addr     string // host:puerto
+	Username string // Vacío si el servidor no pide autenticación
+	Password string
+	From     string
+}
+
+// Send implementa Sender.
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return fmt.Errorf("dirección SMTP inválida %q: %w", s.Addr, err)
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	if err := smtp.SendMail(s.Addr, auth, s.From, []string{msg.To}, format(s.From, msg)); err != nil {
+		return fmt.Errorf("error al enviar el correo por SMTP: %w", err)
+	}
+	return nil
+}
@@ -1,12 +1,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"gofundme-backend/clientkeys"
+	"gofundme-backend/config"
 	"gofundme-backend/handler"
+	"gofundme-backend/jobs"
+	"gofundme-backend/mail"
+	"gofundme-backend/model"
+	"gofundme-backend/rates"
+	"gofundme-backend/receipt"
+	"gofundme-backend/risk"
 	"gofundme-backend/store"
+	"gofundme-backend/token"
 
 	"github.com/gorilla/mux"
 )
@@ -16,20 +30,189 @@ func main() {
 	store.InitDB("bd.db")
 	log.Println("Base de datos inicializada correctamente.")
 
+	// Tasas de cambio para donaciones en otra moneda
+	if provider, err := rates.NewStaticProvider(config.RatesFile()); err != nil {
+		log.Printf("[WARN] Sin tasas de cambio, solo se aceptarán donaciones en el activo de cada campaña: %v", err)
+	} else {
+		rates.SetProvider(provider)
+	}
+
+	// Reglas del motor de riesgo
+	if rules, err := risk.LoadConfig(config.RiskRulesFile()); err != nil {
+		log.Printf("[WARN] Se usan las reglas de riesgo por defecto: %v", err)
+	} else {
+		risk.SetConfig(rules)
+	}
+
+	// Llave para firmar los comprobantes de donación
+	if signer, err := receipt.LoadOrCreateSigner(config.ReceiptKeyFile()); err != nil {
+		log.Printf("[WARN] Sin llave de firma, los comprobantes JSON no estarán disponibles: %v", err)
+	} else {
+		receipt.SetSigner(signer)
+	}
+
+	// Llave para firmar los enlaces de verificación y de restablecimiento
+	if secret, err := token.LoadOrCreateSecret(config.TokenSecretFile()); err != nil {
+		log.Printf("[WARN] Sin llave de tokens, no se podrán verificar correos ni restablecer contraseñas: %v", err)
+	} else {
+		token.SetSecret(secret)
+	}
+
+	// Llaves maestras para cifrar los secretos guardados en la base de datos
+	if kms, err := store.OpenLocalKMS(config.MasterKey(), config.MasterKeyFile()); err != nil {
+		log.Printf("[WARN] Sin llave maestra, no se podrán usar llaves de cliente ni grants de Open Payments: %v", err)
+	} else {
+		store.SetKMS(kms)
+		if n, err := store.ReencryptSecrets(); err != nil {
+			log.Printf("[WARN] No se pudieron cifrar los secretos guardados en claro: %v", err)
+		} else if n > 0 {
+			log.Printf("%d secretos cifrados con la llave maestra %s", n, kms.CurrentKeyID())
+		}
+		if revoked, err := clientkeys.RevokeCompromised(config.ClientWalletAddress()); err != nil {
+			log.Printf("[WARN] No se pudieron revocar las llaves de cliente comprometidas: %v", err)
+		} else {
+			for _, kid := range revoked {
+				log.Printf("[WARN] Llave de cliente %s revocada por estar comprometida; dala de baja también en la wallet %s", kid, config.ClientWalletAddress())
+			}
+		}
+		if _, err := clientkeys.Current(config.ClientWalletAddress(), time.Now()); err != nil {
+			log.Printf("[WARN] %s no tiene llave de cliente; créala con go run ./cmd/clientkeys: %v", config.ClientWalletAddress(), err)
+		}
+	}
+
+	// Envío de correos
+	switch config.MailDriver() {
+	case "smtp":
+		mail.SetSender(&mail.SMTPSender{Addr: config.SMTPAddr(), Username: config.SMTPUsername(), Password: config.SMTPPassword(), From: config.MailFrom()})
+	case "file":
+		mail.SetSender(&mail.FileSender{Dir: config.MailDir(), From: config.MailFrom()})
+	default:
+		log.Printf("[WARN] MAIL_DRIVER %q desconocido, los correos se guardarán en %s", config.MailDriver(), config.MailDir())
+		mail.SetSender(&mail.FileSender{Dir: config.MailDir(), From: config.MailFrom()})
+	}
+
+	// Primer administrador, para poder asignar roles desde la API
+	if username := config.BootstrapAdmin(); username != "" {
+		if user, err := store.GetUserByUsername(username); err != nil || user == nil {
+			log.Printf("[WARN] No se encontró al usuario %q para hacerlo administrador", username)
+		} else if _, err := store.SetUserRole(user.ID, model.RoleAdmin); err == nil {
+			log.Printf("Usuario %q con rol de administrador", username)
+		}
+	}
+
+	// Trabajos en segundo plano: entregas de webhooks, reintentos y limpiezas
+	// periódicas. Se detienen al apagar el servidor.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	handler.RegisterJobs()
+	jobsDone := make(chan struct{})
+	go func() {
+		jobs.Run(ctx)
+		close(jobsDone)
+	}()
+
 	r := mux.NewRouter()
+	r.Use(handler.RequestContext)
 
 	// Rutas de la API
 	api := r.PathPrefix("/api").Subrouter()
-	api.HandleFunc("/campaigns", handler.CreateCampaignHandler).Methods("POST")
+	api.Handle("/campaigns", handler.Authenticate(http.HandlerFunc(handler.CreateCampaignHandler))).Methods("POST")
 	api.HandleFunc("/campaigns", handler.GetCampaignsHandler).Methods("GET")
 	api.HandleFunc("/campaigns/{id:[0-9]+}", handler.GetCampaignHandler).Methods("GET")
-	api.HandleFunc("/campaigns/{id:[0-9]+}/donations", handler.CreateDonationHandler).Methods("POST")
+	api.HandleFunc("/campaigns/{id:[0-9]+}/donations", handler.Idempotent(handler.CreateDonationHandler)).Methods("POST")
+	api.HandleFunc("/campaigns/{id:[0-9]+}/progress", handler.GetCampaignProgressHandler).Methods("GET")
 	api.HandleFunc("/register", handler.RegisterUser).Methods("POST")
 	api.HandleFunc("/login", handler.LoginUser).Methods("POST")
-	api.HandleFunc("/payments/initiate", handler.InitiatePaymentHandler).Methods("POST")
-	api.HandleFunc("/payments/finalize", handler.FinalizePaymentHandler).Methods("POST")
+	api.HandleFunc("/logout", handler.LogoutUser).Methods("POST")
+	api.HandleFunc("/email/verify", handler.VerifyEmailHandler).Methods("POST")
+	api.HandleFunc("/password/forgot", handler.ForgotPasswordHandler).Methods("POST")
+	api.HandleFunc("/password/reset", handler.ResetPasswordHandler).Methods("POST")
+	api.HandleFunc("/login/2fa", handler.LoginTwoFactorHandler).Methods("POST")
+	api.Handle("/account/email", handler.Authenticate(handler.RequireFreshTwoFactor(handler.UpdateEmailHandler))).Methods("PUT")
+	api.Handle("/account/email/verification", handler.Authenticate(http.HandlerFunc(handler.ResendVerificationHandler))).Methods("POST")
+	api.HandleFunc("/payments/initiate", handler.Idempotent(handler.InitiatePaymentHandler)).Methods("POST")
+	api.HandleFunc("/payments/finalize", handler.Idempotent(handler.FinalizePaymentHandler)).Methods("POST")
 	api.HandleFunc("/chat", handler.ChatHandler).Methods("POST")
 	api.HandleFunc("/all-campaigns", handler.GetAllCampaignsForIndexingHandler).Methods("GET")
+	api.Handle("/campaigns/{id:[0-9]+}/milestones", handler.Authenticate(handler.RequirePermission(model.PermManageOwnCampaigns, handler.CreateMilestoneHandler))).Methods("POST")
+	api.HandleFunc("/campaigns/{id:[0-9]+}/milestones", handler.GetMilestonesHandler).Methods("GET")
+	api.Handle("/campaigns/{id:[0-9]+}/milestones/{milestoneId:[0-9]+}/evidence", handler.Authenticate(handler.RequirePermission(model.PermManageOwnCampaigns, handler.UploadMilestoneEvidenceHandler))).Methods("POST")
+	api.Handle("/campaigns/{id:[0-9]+}/sponsors", handler.Authenticate(handler.Idempotent(handler.CreateSponsorHandler))).Methods("POST")
+	api.HandleFunc("/campaigns/{id:[0-9]+}/sponsors", handler.GetSponsorsHandler).Methods("GET")
+	api.Handle("/sponsors/{id:[0-9]+}/authorize", handler.Authenticate(handler.Idempotent(handler.AuthorizeSponsorHandler))).Methods("POST")
+	api.HandleFunc("/donations/{id:[0-9]+}", handler.GetDonationHandler).Methods("GET")
+	api.Handle("/donations/{id:[0-9]+}/refunds", handler.Authenticate(handler.RequirePermission(model.PermManageOwnCampaigns, handler.Idempotent(handler.CreateRefundHandler)))).Methods("POST")
+	api.Handle("/donations/{id:[0-9]+}/refunds", handler.Authenticate(http.HandlerFunc(handler.GetRefundsHandler))).Methods("GET")
+	api.Handle("/donations/{id:[0-9]+}/receipt", handler.Authenticate(http.HandlerFunc(handler.GetDonationReceiptHandler))).Methods("GET")
+	api.HandleFunc("/receipts/keys", handler.GetReceiptKeysHandler).Methods("GET")
+	api.HandleFunc("/webhooks/openpayments", handler.OpenPaymentsWebhookHandler).Methods("POST")
+	api.HandleFunc("/openpayments/jwks.json", handler.GetClientJWKSHandler).Methods("GET")
+	api.HandleFunc("/receipts/verify", handler.VerifyReceiptHandler).Methods("POST")
+	api.Handle("/refunds/{id:[0-9]+}/finalize", handler.Authenticate(handler.RequirePermission(model.PermManageOwnCampaigns, handler.Idempotent(handler.FinalizeRefundHandler)))).Methods("POST")
+	api.Handle("/campaigns/{id:[0-9]+}/refund-grant", handler.Authenticate(handler.RequirePermission(model.PermManageOwnCampaigns, handler.Idempotent(handler.CreateRefundGrantHandler)))).Methods("POST")
+	api.Handle("/campaigns/{id:[0-9]+}/refund-grant/authorize", handler.Authenticate(handler.RequirePermission(model.PermManageOwnCampaigns, handler.Idempotent(handler.AuthorizeRefundGrantHandler)))).Methods("POST")
+	api.Handle("/campaigns/{id:[0-9]+}/verification", handler.Authenticate(handler.RequirePermission(model.PermManageOwnCampaigns, handler.SubmitVerificationHandler))).Methods("POST")
+	api.HandleFunc("/campaigns/{id:[0-9]+}/verification", handler.GetVerificationHandler).Methods("GET")
+	api.Handle("/users/{id:[0-9]+}/notifications", handler.Authenticate(http.HandlerFunc(handler.GetNotificationsHandler))).Methods("GET")
+	api.Handle("/notifications/{id:[0-9]+}/read", handler.Authenticate(http.HandlerFunc(handler.MarkNotificationReadHandler))).Methods("POST")
+	api.Handle("/campaigns/{id:[0-9]+}/payout", handler.Authenticate(handler.RequirePermission(model.PermManageOwnCampaigns, handler.RequireFreshTwoFactor(handler.UpdateCampaignPayoutHandler)))).Methods("PUT")
+	api.Handle("/me", handler.Authenticate(http.HandlerFunc(handler.GetMeHandler))).Methods("GET")
+	api.Handle("/me", handler.Authenticate(http.HandlerFunc(handler.UpdateMeHandler))).Methods("PATCH")
+	api.Handle("/me", handler.Authenticate(http.HandlerFunc(handler.DeleteMeHandler))).Methods("DELETE")
+	api.Handle("/me/deletion/cancel", handler.Authenticate(http.HandlerFunc(handler.CancelDeletionHandler))).Methods("POST")
+	api.Handle("/me/export", handler.Authenticate(handler.RequireFreshTwoFactor(handler.ExportMeHandler))).Methods("GET")
+	api.Handle("/me/password", handler.Authenticate(http.HandlerFunc(handler.ChangePasswordHandler))).Methods("POST")
+	api.Handle("/me/webhooks", handler.Authenticate(http.HandlerFunc(handler.CreateWebhookEndpointHandler))).Methods("POST")
+	api.Handle("/me/webhooks", handler.Authenticate(http.HandlerFunc(handler.GetWebhookEndpointsHandler))).Methods("GET")
+	api.Handle("/me/webhooks/{id:[0-9]+}", handler.Authenticate(http.HandlerFunc(handler.DeleteWebhookEndpointHandler))).Methods("DELETE")
+	api.Handle("/me/webhooks/{id:[0-9]+}/deliveries", handler.Authenticate(http.HandlerFunc(handler.GetWebhookDeliveriesHandler))).Methods("GET")
+	api.Handle("/me/webhooks/{id:[0-9]+}/deliveries/{deliveryId:[0-9]+}/redeliver", handler.Authenticate(http.HandlerFunc(handler.RedeliverWebhookHandler))).Methods("POST")
+	api.Handle("/campaigns/{id:[0-9]+}/close", handler.Authenticate(handler.RequirePermission(model.PermManageOwnCampaigns, handler.CloseCampaignHandler))).Methods("POST")
+	api.HandleFunc("/users/{username}", handler.GetPublicProfileHandler).Methods("GET")
+	api.Handle("/account/2fa/enroll", handler.Authenticate(http.HandlerFunc(handler.EnrollTwoFactorHandler))).Methods("POST")
+	api.Handle("/account/2fa/activate", handler.Authenticate(http.HandlerFunc(handler.ActivateTwoFactorHandler))).Methods("POST")
+	api.Handle("/account/2fa/verify", handler.Authenticate(http.HandlerFunc(handler.VerifyTwoFactorHandler))).Methods("POST")
+	api.Handle("/account/2fa/recovery-codes", handler.Authenticate(handler.RequireFreshTwoFactor(handler.RegenerateRecoveryCodesHandler))).Methods("POST")
+	api.Handle("/account/2fa", handler.Authenticate(handler.RequireFreshTwoFactor(handler.DisableTwoFactorHandler))).Methods("DELETE")
+	api.Handle("/campaigns/{id:[0-9]+}/reports", handler.Authenticate(http.HandlerFunc(handler.CreateReportHandler))).Methods("POST")
+	api.Handle("/reports", handler.Authenticate(http.HandlerFunc(handler.GetMyReportsHandler))).Methods("GET")
+
+	// Rutas de administración: requieren sesión y el permiso de cada ruta, y
+	// toda acción que modifica algo queda en el registro de auditoría.
+	admin := api.PathPrefix("/admin").Subrouter()
+	admin.Use(handler.Authenticate, handler.AuditAdmin)
+	admin.HandleFunc("/users", handler.RequirePermission(model.PermManageUsers, handler.AdminListUsersHandler)).Methods("GET")
+	admin.HandleFunc("/users/{id:[0-9]+}/suspend", handler.RequirePermission(model.PermManageUsers, handler.AdminSuspendUserHandler)).Methods("POST")
+	admin.HandleFunc("/users/{id:[0-9]+}/unsuspend", handler.RequirePermission(model.PermManageUsers, handler.AdminUnsuspendUserHandler)).Methods("POST")
+	admin.HandleFunc("/users/{id:[0-9]+}/unlock", handler.RequirePermission(model.PermManageUsers, handler.AdminUnlockUserHandler)).Methods("POST")
+	admin.HandleFunc("/users/{id:[0-9]+}/role", handler.RequirePermission(model.PermManageUsers, handler.AdminSetUserRoleHandler)).Methods("PUT")
+	admin.HandleFunc("/campaigns/{id:[0-9]+}/takedown", handler.RequirePermission(model.PermModerateCampaigns, handler.AdminTakedownCampaignHandler)).Methods("POST")
+	admin.HandleFunc("/campaigns/{id:[0-9]+}/restore", handler.RequirePermission(model.PermModerateCampaigns, handler.AdminRestoreCampaignHandler)).Methods("POST")
+	admin.HandleFunc("/reports", handler.RequirePermission(model.PermModerateCampaigns, handler.AdminListReportsHandler)).Methods("GET")
+	admin.HandleFunc("/reports/{id:[0-9]+}/resolve", handler.RequirePermission(model.PermModerateCampaigns, handler.AdminResolveReportHandler)).Methods("POST")
+	admin.HandleFunc("/risk", handler.RequirePermission(model.PermModerateCampaigns, handler.AdminListRiskAssessmentsHandler)).Methods("GET")
+	admin.HandleFunc("/risk/{id:[0-9]+}/clear", handler.RequirePermission(model.PermModerateCampaigns, handler.AdminClearRiskHandler)).Methods("POST")
+	admin.HandleFunc("/risk/{id:[0-9]+}/confirm", handler.RequirePermission(model.PermModerateCampaigns, handler.AdminConfirmRiskHandler)).Methods("POST")
+	admin.HandleFunc("/milestones", handler.RequirePermission(model.PermReviewMilestones, handler.GetSubmittedMilestonesHandler)).Methods("GET")
+	admin.HandleFunc("/milestones/{id:[0-9]+}/evidence/{evidenceId:[0-9]+}", handler.RequirePermission(model.PermReviewMilestones, handler.GetMilestoneEvidenceFileHandler)).Methods("GET")
+	admin.HandleFunc("/milestones/{id:[0-9]+}/approve", handler.RequirePermission(model.PermManagePayments, handler.Idempotent(handler.ApproveMilestoneHandler))).Methods("POST")
+	admin.HandleFunc("/milestones/{id:[0-9]+}/reconcile", handler.RequirePermission(model.PermManagePayments, handler.Idempotent(handler.AdminReconcileMilestoneHandler))).Methods("POST")
+	admin.HandleFunc("/donations", handler.RequirePermission(model.PermViewLedger, handler.AdminLedgerHandler)).Methods("GET")
+	admin.HandleFunc("/donations/{id:[0-9]+}/reverse", handler.RequirePermission(model.PermManagePayments, handler.Idempotent(handler.ReverseDonationHandler))).Methods("POST")
+	admin.HandleFunc("/donations/{id:[0-9]+}/refunds", handler.RequirePermission(model.PermManagePayments, handler.Idempotent(handler.AdminCreateRefundHandler))).Methods("POST")
+	admin.HandleFunc("/payments/failed", handler.RequirePermission(model.PermManagePayments, handler.AdminFailedPaymentsHandler)).Methods("GET")
+	admin.HandleFunc("/webhooks", handler.RequirePermission(model.PermManagePayments, handler.AdminListWebhookEventsHandler)).Methods("GET")
+	admin.HandleFunc("/webhooks/{id}/retry", handler.RequirePermission(model.PermManagePayments, handler.AdminRetryWebhookEventHandler)).Methods("POST")
+	admin.HandleFunc("/jobs", handler.RequirePermission(model.PermManageJobs, handler.AdminListJobsHandler)).Methods("GET")
+	admin.HandleFunc("/jobs/{id:[0-9]+}/retry", handler.RequirePermission(model.PermManageJobs, handler.AdminRetryJobHandler)).Methods("POST")
+	admin.HandleFunc("/sponsor-matches/{id:[0-9]+}/retry", handler.RequirePermission(model.PermManagePayments, handler.Idempotent(handler.AdminRetrySponsorMatchHandler))).Methods("POST")
+	admin.HandleFunc("/verifications", handler.RequirePermission(model.PermReviewVerifications, handler.GetPendingVerificationsHandler)).Methods("GET")
+	admin.HandleFunc("/verifications/{id:[0-9]+}/documents/{documentId:[0-9]+}", handler.RequirePermission(model.PermReviewVerifications, handler.GetVerificationDocumentHandler)).Methods("GET")
+	admin.HandleFunc("/verifications/{id:[0-9]+}/approve", handler.RequirePermission(model.PermReviewVerifications, handler.ApproveVerificationHandler)).Methods("POST")
+	admin.HandleFunc("/verifications/{id:[0-9]+}/reject", handler.RequirePermission(model.PermReviewVerifications, handler.RejectVerificationHandler)).Methods("POST")
+	admin.HandleFunc("/audit-log", handler.RequirePermission(model.PermViewAudit, handler.AdminAuditLogHandler)).Methods("GET")
+	admin.HandleFunc("/audit-events", handler.RequirePermission(model.PermViewAudit, handler.AdminAuditEventsHandler)).Methods("GET")
+	admin.HandleFunc("/audit-events/verify", handler.RequirePermission(model.PermViewAudit, handler.AdminVerifyAuditHandler)).Methods("GET")
 
 	// Ruta de verificación de estado
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -40,8 +223,9 @@ func main() {
 	corsHandler := func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID, Idempotency-Key")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Idempotent-Replayed")
 			if r.Method == "OPTIONS" {
 				w.WriteHeader(http.StatusOK)
 				return
@@ -50,8 +234,26 @@ func main() {
 		})
 	}
 
-	log.Println("Servidor escuchando en http://localhost:8080")
-	if err := http.ListenAndServe(":8080", corsHandler(r)); err != nil {
-		log.Fatal(err)
+	server := &http.Server{Addr: ":8080", Handler: corsHandler(r)}
+	go func() {
+		log.Println("Servidor escuchando en http://localhost:8080")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Al recibir SIGINT o SIGTERM se dejan de aceptar peticiones y se espera a
+	// que terminen las que están en curso y los trabajos en segundo plano.
+	<-ctx.Done()
+	log.Println("Apagando el servidor...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout())
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[WARN] No todas las peticiones terminaron a tiempo: %v", err)
+	}
+	select {
+	case <-jobsDone:
+	case <-shutdownCtx.Done():
+		log.Println("[WARN] Algunos trabajos no terminaron a tiempo; se retomarán al volver a arrancar")
 	}
 }
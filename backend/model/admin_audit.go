@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// AdminAuditEntry es una acción hecha desde la API de administración. Las
+// entradas no se pueden modificar ni borrar.
+type AdminAuditEntry struct {
+	ID         int       `json:"id"`
+	ActorID    int       `json:"actorId"`
+	ActorName  string    `json:"actorName"`
+	Method     string    `json:"method"`
+	Route      string    `json:"route"`
+	Params     string    `json:"params"` // Variables de la ruta en JSON
+	Body       string    `json:"body,omitempty"`
+	StatusCode int       `json:"statusCode"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
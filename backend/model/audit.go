@@ -0,0 +1,101 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Acciones registradas en el log de auditoría.
+const (
+	AuditLoginSucceeded = "login.succeeded"
+	AuditLoginFailed    = "login.failed"
+	AuditLogout         = "logout"
+
+	AuditEmailChanged           = "email.changed"
+	AuditEmailVerified          = "email.verified"
+	AuditPasswordResetRequested = "password.reset_requested"
+	AuditPasswordReset          = "password.reset"
+	AuditPasswordChanged        = "password.changed"
+
+	AuditTwoFactorEnabled         = "2fa.enabled"
+	AuditTwoFactorDisabled        = "2fa.disabled"
+	AuditTwoFactorFailed          = "2fa.failed"
+	AuditRecoveryCodeUsed         = "2fa.recovery_code_used"
+	AuditRecoveryCodesRegenerated = "2fa.recovery_codes_regenerated"
+
+	AuditCampaignCreated       = "campaign.created"
+	AuditCampaignStatusChanged = "campaign.status_changed"
+	AuditCampaignPayoutChanged = "campaign.payout_changed"
+
+	AuditGrantRequested = "grant.requested"
+	AuditGrantContinued = "grant.continued"
+
+	AuditOutgoingPaymentCreated = "outgoing_payment.created"
+	AuditOutgoingPaymentFailed  = "outgoing_payment.failed"
+
+	AuditDonationCompleted = "donation.completed"
+	AuditDonationFailed    = "donation.failed"
+	AuditDonationReversed  = "donation.reversed"
+	AuditDonationUncertain = "donation.uncertain" // La conciliación no pudo saber si se creó un outgoing payment
+
+	AuditMilestoneReconciled = "milestone.reconciled" // Un administrador cerró una liberación sin confirmar
+
+	AuditRefundRequested = "refund.requested"
+	AuditRefundCompleted = "refund.completed"
+	AuditRefundFailed    = "refund.failed"
+
+	AuditUserChanged = "user.changed"
+
+	AuditAccountExported          = "account.exported"
+	AuditAccountDeletionRequested = "account.deletion_requested"
+	AuditAccountDeletionCanceled  = "account.deletion_canceled"
+	AuditAccountDeleted           = "account.deleted"
+
+	AuditAdminAction = "admin.action"
+)
+
+// AuditEvent es una acción que mueve dinero o afecta a la seguridad. Cada
+// evento guarda el hash del anterior, así que modificar o borrar uno rompe la
+// cadena a partir de ese punto.
+type AuditEvent struct {
+	ID          int             `json:"id"`
+	Action      string          `json:"action"`
+	ActorID     int             `json:"actorId,omitempty"`
+	IP          string          `json:"ip,omitempty"`
+	RequestID   string          `json:"requestId,omitempty"`
+	SubjectType string          `json:"subjectType,omitempty"`
+	SubjectID   string          `json:"subjectId,omitempty"`
+	Before      json.RawMessage `json:"before,omitempty"`
+	After       json.RawMessage `json:"after,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	PrevHash    string          `json:"prevHash"`
+	Hash        string          `json:"hash"`
+}
+
+// ComputeHash calcula el hash del evento a partir de su contenido y del hash
+// del evento anterior. El ID no forma parte del hash: el orden lo da la cadena.
+func (e AuditEvent) ComputeHash() string {
+	content, _ := json.Marshal(struct {
+		Action      string          `json:"action"`
+		ActorID     int             `json:"actorId"`
+		IP          string          `json:"ip"`
+		RequestID   string          `json:"requestId"`
+		SubjectType string          `json:"subjectType"`
+		SubjectID   string          `json:"subjectId"`
+		Before      json.RawMessage `json:"before"`
+		After       json.RawMessage `json:"after"`
+		CreatedAt   string          `json:"createdAt"`
+	}{e.Action, e.ActorID, e.IP, e.RequestID, e.SubjectType, e.SubjectID, nullJSON(e.Before), nullJSON(e.After), e.CreatedAt.UTC().Format(time.RFC3339Nano)})
+
+	sum := sha256.Sum256(append([]byte(e.PrevHash), content...))
+	return hex.EncodeToString(sum[:])
+}
+
+func nullJSON(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return json.RawMessage("null")
+	}
+	return raw
+}
@@ -2,6 +2,14 @@ package model
 
 import "time"
 
+// Estados de moderación de una campaña.
+const (
+	CampaignActive      = "active"
+	CampaignUnderReview = "under_review" // Oculta automáticamente por denuncias hasta que la revise un moderador
+	CampaignTakenDown   = "taken_down"   // Retirada por un moderador: no se lista ni recibe donaciones
+	CampaignClosed      = "closed"       // Cerrada por su creador: no se lista ni recibe donaciones
+)
+
 type Campaign struct {
 	ID              int       `json:"id"`
 	UserID          int       `json:"-"` // ID del usuario que creó la campaña
@@ -12,5 +20,60 @@ type Campaign struct {
 	AmountRaised    float64   `json:"amountRaised"`
 	Currency        string    `json:"currency"`
 	PaymentPointer  string    `json:"paymentPointer"`
+	Escrow          bool      `json:"escrow"`               // Las donaciones se retienen hasta aprobar hitos
+	AssetCode       string    `json:"assetCode,omitempty"`  // Activo real de la wallet receptora
+	AssetScale      int       `json:"assetScale,omitempty"` // Escala del activo de la wallet receptora
+	AuthServer      string    `json:"authServer,omitempty"`
+	Verified        bool      `json:"verified"` // Un administrador verificó la identidad del creador
+	Status          string    `json:"status"`
+	TakedownReason  string    `json:"takedownReason,omitempty"`
 	CreatedAt       time.Time `json:"createdAt"`
+
+	// Beneficiaries reparte cada donación entre varias wallets. Solo se
+	// incluye en el detalle de la campaña.
+	Beneficiaries []Beneficiary `json:"beneficiaries,omitempty"`
+
+	// Contrapartidas de patrocinadores: lo ya igualado y lo que todavía pueden igualar.
+	MatchedTotal   float64 `json:"matchedTotal"`
+	MatchRemaining float64 `json:"matchRemaining"`
+}
+
+// Asset devuelve el código del activo de la campaña. Las campañas creadas antes
+// de resolver las wallets solo tienen la moneda escrita por el creador.
+func (c Campaign) Asset() string {
+	if c.AssetCode != "" {
+		return c.AssetCode
+	}
+	return c.Currency
+}
+
+// Scale devuelve la escala del activo de la campaña, o 2 si no se conoce.
+func (c Campaign) Scale() int {
+	if c.AssetCode != "" {
+		return c.AssetScale
+	}
+	return 2
+}
+
+// CampaignProgress es lo recaudado por una campaña expresado en su activo.
+type CampaignProgress struct {
+	AssetCode    string       `json:"assetCode"`
+	Goal         float64      `json:"goal"`
+	AmountRaised float64      `json:"amountRaised"`
+	Percent      float64      `json:"percent"`
+	Breakdown    []AssetTotal `json:"breakdown"`
+}
+
+// AssetTotal agrupa las donaciones completadas que salieron en un mismo activo.
+type AssetTotal struct {
+	AssetCode string  `json:"assetCode"`
+	Amount    float64 `json:"amount"`    // En el activo original
+	Converted float64 `json:"converted"` // En el activo de la campaña
+	Count     int     `json:"count"`
+}
+
+// Beneficiary es una wallet que recibe un porcentaje de cada donación.
+type Beneficiary struct {
+	WalletAddress string  `json:"walletAddress"`
+	Share         float64 `json:"share"` // Porcentaje entre 0 y 100
 }
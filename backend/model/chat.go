@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// ChatMessage es una pregunta de un usuario con sesión al chatbot y su
+// respuesta. Las conversaciones anónimas no se guardan.
+type ChatMessage struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userId"`
+	Prompt    string    `json:"prompt"`
+	Response  string    `json:"response"`
+	Action    string    `json:"action,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
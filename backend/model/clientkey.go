@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// ClientKey es una llave Ed25519 con la que el backend firma las peticiones a
+// Open Payments en nombre de una wallet. La llave privada solo existe cifrada
+// en la base de datos.
+type ClientKey struct {
+	KeyID         string     `json:"kid"`
+	WalletAddress string     `json:"walletAddress"`
+	PublicKey     []byte     `json:"-"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	ActiveFrom    time.Time  `json:"activeFrom"`          // Desde cuándo firma
+	RetiredAt     *time.Time `json:"retiredAt,omitempty"` // Desde cuándo ya no firma
+	RevokedAt     *time.Time `json:"revokedAt,omitempty"` // Revocada: ni firma ni se publica
+}
+
+// Signs indica si la llave puede firmar peticiones en el momento now.
+func (k ClientKey) Signs(now time.Time) bool {
+	return k.RevokedAt == nil && !k.ActiveFrom.After(now) && (k.RetiredAt == nil || k.RetiredAt.After(now))
+}
+
+// Published indica si la llave debe aparecer en el JWKS en el momento now: se
+// publica desde que se crea y hasta overlap después de retirarse.
+func (k ClientKey) Published(now time.Time, overlap time.Duration) bool {
+	return k.RevokedAt == nil && (k.RetiredAt == nil || k.RetiredAt.Add(overlap).After(now))
+}
@@ -0,0 +1,127 @@
+package model
+
+import "time"
+
+// Estados de una donación. Mientras se paga pasa por created → quoted →
+// awaiting_approval → approved → sending → completed, y puede terminar antes
+// en failed o expired. Si se pagó solo una parte, o no se sabe si se pagó,
+// queda en needs_reconciliation. Una vez completada se puede reembolsar o
+// revertir.
+const (
+	DonationCreated          = "created"           // Con sus incoming payments creados
+	DonationQuoted           = "quoted"            // Con una quote por parte y el monto a debitar
+	DonationAwaitingApproval = "awaiting_approval" // Esperando que el donante apruebe el grant en su wallet
+	DonationApproved         = "approved"          // Grant aprobado, antes de crear los outgoing payments
+	DonationSending          = "sending"           // Creando los outgoing payments
+	DonationCompleted        = "completed"
+	DonationFailed           = "failed"
+	DonationExpired          = "expired" // El donante no terminó de pagar a tiempo
+	DonationReversed         = "reversed"
+	DonationHeld             = "held" // Retenida por el motor de riesgo hasta que la revise un moderador
+
+	DonationNeedsReconciliation = "needs_reconciliation" // Pagada a medias o sin confirmar; la revisa un administrador
+
+	DonationRefunded          = "refunded"
+	DonationPartiallyRefunded = "partially_refunded"
+)
+
+// donationTransitions son los cambios de estado permitidos desde cada estado.
+// Un incoming payment puede recibir el pago por fuera del flujo de la API, así
+// que cualquier donación en curso se puede completar.
+var donationTransitions = map[string][]string{
+	DonationCreated:             {DonationQuoted, DonationCompleted, DonationFailed, DonationExpired},
+	DonationQuoted:              {DonationAwaitingApproval, DonationHeld, DonationCompleted, DonationFailed, DonationExpired},
+	DonationHeld:                {DonationQuoted, DonationFailed, DonationExpired},
+	DonationAwaitingApproval:    {DonationQuoted, DonationApproved, DonationCompleted, DonationFailed, DonationExpired},
+	DonationApproved:            {DonationSending, DonationCompleted, DonationFailed, DonationNeedsReconciliation},
+	DonationSending:             {DonationCompleted, DonationFailed, DonationNeedsReconciliation},
+	DonationNeedsReconciliation: {DonationCompleted, DonationFailed},
+	DonationCompleted:           {DonationPartiallyRefunded, DonationRefunded, DonationReversed},
+	DonationPartiallyRefunded:   {DonationPartiallyRefunded, DonationRefunded},
+}
+
+// CanTransitionDonation indica si una donación puede pasar de from a to.
+func CanTransitionDonation(from, to string) bool {
+	for _, next := range donationTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// DonationInProgress indica si una donación con ese estado todavía se está
+// pagando.
+func DonationInProgress(status string) bool {
+	switch status {
+	case DonationCreated, DonationQuoted, DonationAwaitingApproval, DonationApproved, DonationSending:
+		return true
+	}
+	return false
+}
+
+// Donation es el registro en el ledger de una donación a una campaña.
+// Amount y Currency están en el activo de la campaña; OriginalAmount y
+// OriginalCurrency en el activo con el que pagó el donante.
+type Donation struct {
+	ID               int     `json:"id"`
+	CampaignID       int     `json:"campaignId"`
+	Amount           float64 `json:"amount"`
+	Currency         string  `json:"currency"`
+	OriginalAmount   float64 `json:"originalAmount"`
+	OriginalCurrency string  `json:"originalCurrency"`
+	RefundedAmount   float64 `json:"refundedAmount"` // En el activo de la campaña
+
+	// Quién donó: la wallet debitada y, si estaba registrado, su usuario.
+	DonorWalletAddress string `json:"donorWalletAddress,omitempty"`
+	DonorUserID        int    `json:"donorUserId,omitempty"`
+
+	Status          string          `json:"status"`
+	StatusUpdatedAt time.Time       `json:"statusUpdatedAt"`
+	Splits          []DonationSplit `json:"splits"`
+	CreatedAt       time.Time       `json:"createdAt"`
+	CompletedAt     *time.Time      `json:"completedAt,omitempty"`
+}
+
+// DonationTransition es un cambio de estado de una donación. From está vacío
+// en el primero, cuando se crea.
+type DonationTransition struct {
+	ID         int       `json:"id"`
+	DonationID int       `json:"donationId"`
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// DonationSplit es la parte de una donación que corresponde a un beneficiario.
+// Cada parte tiene su propio incoming payment, quote y outgoing payment.
+type DonationSplit struct {
+	ID                int     `json:"id"`
+	DonationID        int     `json:"-"`
+	WalletAddress     string  `json:"walletAddress"`
+	Share             float64 `json:"share"`
+	Amount            int64   `json:"amount"` // En unidades mínimas del activo
+	IncomingPaymentID string  `json:"incomingPaymentId"`
+	QuoteID           string  `json:"quoteId,omitempty"`
+	OutgoingPaymentID string  `json:"outgoingPaymentId,omitempty"`
+	ReceivedAmount    int64   `json:"receivedAmount"` // Lo que confirmó el webhook del incoming payment
+
+	// PaymentStartedAt es cuándo se pidió crear el outgoing payment. Si está
+	// y OutgoingPaymentID no, no se sabe si el pago llegó a crearse.
+	PaymentStartedAt *time.Time `json:"paymentStartedAt,omitempty"`
+}
+
+// Received indica si el incoming payment de la parte ya recibió todo su monto.
+func (s DonationSplit) Received() bool {
+	return s.ReceivedAmount >= s.Amount
+}
+
+// PaymentGrant es el grant interactivo de una donación mientras el donante lo
+// aprueba en su wallet. Se busca por la referencia de interacción.
+type PaymentGrant struct {
+	InteractRef   string
+	DonationID    int
+	ContinueURI   string
+	ContinueToken string
+}
@@ -0,0 +1,79 @@
+package model
+
+import "testing"
+
+func TestDonationTransitions(t *testing.T) {
+	allowed := []struct{ from, to string }{
+		{DonationCreated, DonationQuoted},
+		{DonationCreated, DonationCompleted},
+		{DonationQuoted, DonationAwaitingApproval},
+		{DonationQuoted, DonationHeld},
+		{DonationHeld, DonationQuoted},
+		{DonationAwaitingApproval, DonationApproved},
+		{DonationApproved, DonationSending},
+		{DonationSending, DonationCompleted},
+		{DonationSending, DonationFailed},
+		{DonationSending, DonationNeedsReconciliation},
+		{DonationNeedsReconciliation, DonationCompleted},
+		{DonationCompleted, DonationPartiallyRefunded},
+		{DonationPartiallyRefunded, DonationPartiallyRefunded},
+		{DonationPartiallyRefunded, DonationRefunded},
+		{DonationCompleted, DonationReversed},
+	}
+	for _, tt := range allowed {
+		if !CanTransitionDonation(tt.from, tt.to) {
+			t.Errorf("%s → %s no está permitido", tt.from, tt.to)
+		}
+	}
+
+	forbidden := []struct{ from, to string }{
+		{DonationCreated, DonationSending},
+		{DonationHeld, DonationCompleted},
+		{DonationSending, DonationQuoted},
+		{DonationSending, DonationExpired},
+		{DonationCompleted, DonationFailed},
+		{DonationPartiallyRefunded, DonationReversed},
+		{"desconocido", DonationCompleted},
+	}
+	for _, tt := range forbidden {
+		if CanTransitionDonation(tt.from, tt.to) {
+			t.Errorf("%s → %s está permitido", tt.from, tt.to)
+		}
+	}
+}
+
+func TestDonationTransitionsTable(t *testing.T) {
+	known := map[string]bool{}
+	for _, status := range []string{
+		DonationCreated, DonationQuoted, DonationAwaitingApproval, DonationApproved, DonationSending, DonationCompleted,
+		DonationFailed, DonationExpired, DonationReversed, DonationHeld, DonationNeedsReconciliation,
+		DonationRefunded, DonationPartiallyRefunded,
+	} {
+		known[status] = true
+	}
+
+	for from, targets := range donationTransitions {
+		if !known[from] {
+			t.Errorf("estado de origen desconocido %q", from)
+		}
+		for _, to := range targets {
+			if !known[to] {
+				t.Errorf("%s → estado desconocido %q", from, to)
+			}
+		}
+	}
+
+	// Los estados finales no tienen salida.
+	for _, status := range []string{DonationFailed, DonationExpired, DonationReversed, DonationRefunded} {
+		if len(donationTransitions[status]) > 0 {
+			t.Errorf("%s tiene salidas: %v", status, donationTransitions[status])
+		}
+	}
+
+	// Ninguna donación en curso se queda sin poder cerrarse.
+	for status := range known {
+		if DonationInProgress(status) && !CanTransitionDonation(status, DonationFailed) {
+			t.Errorf("%s no puede pasar a failed", status)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// IdempotencyKey es una petición identificada por su cabecera Idempotency-Key.
+// Mientras se procesa StatusCode es 0; después guarda la respuesta para
+// devolverla igual si la petición se repite.
+type IdempotencyKey struct {
+	ID           int        `json:"id"`
+	Scope        string     `json:"scope"`
+	Key          string     `json:"key"`
+	Fingerprint  string     `json:"fingerprint"`
+	StatusCode   int        `json:"statusCode"`
+	ContentType  string     `json:"contentType"`
+	ResponseBody []byte     `json:"-"`
+	LockedUntil  *time.Time `json:"lockedUntil,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
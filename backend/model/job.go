@@ -0,0 +1,31 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Estados de un trabajo de la cola.
+const (
+	JobQueued    = "queued"    // Esperando a que llegue su run_at
+	JobRunning   = "running"   // Reservado por un worker hasta locked_until
+	JobSucceeded = "succeeded" // Terminó sin error
+	JobFailed    = "failed"    // Falló y se reintentará en run_at
+	JobDead      = "dead"      // Agotó sus intentos; solo se reintenta a mano
+)
+
+// Job es un trabajo en segundo plano. Payload es el JSON que recibe el
+// handler registrado para su tipo.
+type Job struct {
+	ID          int             `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	LastError   string          `json:"lastError,omitempty"`
+	RunAt       time.Time       `json:"runAt"`
+	LockedUntil *time.Time      `json:"lockedUntil,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	FinishedAt  *time.Time      `json:"finishedAt,omitempty"`
+}
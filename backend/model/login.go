@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Tipos de clave con las que se cuentan los intentos de inicio de sesión.
+const (
+	LoginKeyUsername = "username"
+	LoginKeyIP       = "ip"
+)
+
+// LoginAttempt son los intentos fallidos de inicio de sesión de un usuario o
+// de una IP. Se guardan en la base para que reiniciar el servidor no los borre.
+type LoginAttempt struct {
+	Kind          string     `json:"kind"`
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"lastFailureAt"`
+	LockedUntil   *time.Time `json:"lockedUntil,omitempty"`
+}
@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+// Estados de un hito de una campaña con escrow.
+const (
+	MilestonePending   = "pending"   // Creado, sin evidencia
+	MilestoneSubmitted = "submitted" // Con evidencia, esperando revisión
+	MilestoneApproved  = "approved"  // Aprobado, pendiente de liberar fondos
+	MilestoneReleasing = "releasing" // Monto reservado del escrow mientras se paga
+	MilestoneReleased  = "released"  // Fondos enviados al creador
+)
+
+// Milestone es un objetivo de una campaña cuyo cumplimiento libera fondos del escrow.
+type Milestone struct {
+	ID                int                 `json:"id"`
+	CampaignID        int                 `json:"campaignId"`
+	Title             string              `json:"title"`
+	Description       string              `json:"description"`
+	TargetAmount      float64             `json:"targetAmount"`
+	Status            string              `json:"status"`
+	OutgoingPaymentID string              `json:"outgoingPaymentId,omitempty"`
+	ReleaseStartedAt  *time.Time          `json:"releaseStartedAt,omitempty"` // Cuándo se empezó a crear el outgoing payment
+	ReleaseError      string              `json:"releaseError,omitempty"`     // Último error al liberar
+	Evidence          []MilestoneEvidence `json:"evidence"`
+	CreatedAt         time.Time           `json:"createdAt"`
+	ReleasedAt        *time.Time          `json:"releasedAt,omitempty"`
+}
+
+// MilestoneEvidence es un archivo subido por el creador para demostrar un hito.
+type MilestoneEvidence struct {
+	ID          int       `json:"id"`
+	MilestoneID int       `json:"milestoneId"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Path        string    `json:"-"`
+	UploadedAt  time.Time `json:"uploadedAt"`
+}
+
+// Tipos de movimiento del escrow de una campaña.
+const (
+	EscrowDeposit  = "deposit"
+	EscrowRelease  = "release"
+	EscrowRefund   = "refund"
+	EscrowReversal = "reversal" // Deshace el depósito de una donación revertida
+)
+
+// EscrowEntry es un movimiento en el saldo retenido de una campaña.
+type EscrowEntry struct {
+	ID                int       `json:"id"`
+	CampaignID        int       `json:"campaignId"`
+	Kind              string    `json:"kind"`
+	Amount            float64   `json:"amount"`
+	DonationID        *int      `json:"donationId,omitempty"`
+	MilestoneID       *int      `json:"milestoneId,omitempty"`
+	OutgoingPaymentID string    `json:"outgoingPaymentId,omitempty"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
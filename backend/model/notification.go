@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// Notification es un aviso dentro de la app para un usuario.
+type Notification struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"userId"`
+	Kind      string     `json:"kind"`
+	Message   string     `json:"message"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ReadAt    *time.Time `json:"readAt,omitempty"`
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Temas del outbox: eventos que se guardan en la misma transacción que el
+// cambio de estado que los produce y que después se publican en segundo plano.
+const (
+	OutboxDonationPaymentStarted = "donation.payment_started" // Se usó el grant de la donación: hay que conciliarla
+	OutboxDonationCompleted      = "donation.completed"
+	OutboxDonationRefunded       = "donation.refunded"
+)
+
+// Estados de un mensaje del outbox.
+const (
+	OutboxPending   = "pending"
+	OutboxPublished = "published"
+	OutboxDead      = "dead" // Agotó sus intentos de publicación
+)
+
+// OutboxMessage es un evento pendiente de publicar. DedupKey identifica el
+// efecto: el mismo evento solo se guarda una vez, y quien lo publica puede
+// usarlo para no repetir el efecto si se publica más de una vez.
+type OutboxMessage struct {
+	ID          int             `json:"id"`
+	Topic       string          `json:"topic"`
+	DedupKey    string          `json:"dedupKey"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"lastError,omitempty"`
+	AvailableAt time.Time       `json:"availableAt"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	PublishedAt *time.Time      `json:"publishedAt,omitempty"`
+}
+
+// Payloads de los temas del outbox.
+
+type DonationPaymentStartedEvent struct {
+	DonationID int `json:"donationId"`
+}
+
+type DonationCompletedEvent struct {
+	DonationID   int     `json:"donationId"`
+	CampaignID   int     `json:"campaignId"`
+	Amount       float64 `json:"amount"`
+	AmountRaised float64 `json:"amountRaised"` // Lo recaudado por la campaña justo después de esta donación
+}
+
+type DonationRefundedEvent struct {
+	RefundID      int     `json:"refundId"`
+	DonationID    int     `json:"donationId"`
+	CampaignID    int     `json:"campaignId"`
+	Amount        float64 `json:"amount"`
+	FullyRefunded bool    `json:"fullyRefunded"`
+}
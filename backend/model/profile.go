@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// PublicProfile es lo que cualquiera puede ver de un usuario: sin wallet, sin
+// correo y solo con sus campañas visibles.
+type PublicProfile struct {
+	Username    string       `json:"username"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Bio         string       `json:"bio,omitempty"`
+	AvatarURL   string       `json:"avatarUrl,omitempty"`
+	CreatedAt   *time.Time   `json:"createdAt,omitempty"`
+	Campaigns   []Campaign   `json:"campaigns"`
+	Stats       ProfileStats `json:"stats"`
+}
+
+// ProfileStats resume la actividad de un creador en sus campañas visibles.
+type ProfileStats struct {
+	CampaignCount     int                `json:"campaignCount"`
+	VerifiedCampaigns int                `json:"verifiedCampaigns"`
+	DonationCount     int                `json:"donationCount"` // Donaciones completadas
+	Raised            map[string]float64 `json:"raised"`        // Recaudado por activo
+}
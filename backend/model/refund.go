@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// Estados de un reembolso.
+const (
+	RefundAwaitingApproval = "awaiting_approval" // El creador debe aprobar el grant en su wallet
+	RefundCompleted        = "completed"
+	RefundFailed           = "failed"
+)
+
+// Estados del grant de reembolsos preaprobado. Los valores coinciden con los
+// de Sponsor porque las filas viejas se guardaron con esos.
+const (
+	RefundGrantPendingAuthorization = "pending_authorization" // Esperando que el creador lo apruebe en su wallet
+	RefundGrantActive               = "active"
+	RefundGrantExpired              = "expired"
+)
+
+// Quién inició un reembolso.
+const (
+	RefundByCreator = "creator"
+	RefundByAdmin   = "admin"
+)
+
+// Refund es la devolución total o parcial de una donación desde la wallet de
+// la campaña a la wallet del donante.
+type Refund struct {
+	ID                int        `json:"id"`
+	DonationID        int        `json:"donationId"`
+	CampaignID        int        `json:"campaignId"`
+	Amount            float64    `json:"amount"` // En el activo de la campaña
+	Reason            string     `json:"reason"`
+	Status            string     `json:"status"`
+	InitiatedBy       string     `json:"initiatedBy"`
+	OutgoingPaymentID string     `json:"outgoingPaymentId,omitempty"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	CompletedAt       *time.Time `json:"completedAt,omitempty"`
+
+	// Estado del grant interactivo mientras el creador lo aprueba.
+	QuoteID       string `json:"-"`
+	ContinueURI   string `json:"-"`
+	ContinueToken string `json:"-"`
+}
+
+// RefundGrant es un grant de outgoing payment que el creador aprobó de antemano
+// para que los reembolsos de su campaña se paguen sin interacción.
+type RefundGrant struct {
+	CampaignID    int       `json:"campaignId"`
+	Status        string    `json:"status"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	ContinueURI   string    `json:"-"`
+	ContinueToken string    `json:"-"`
+	AccessToken   string    `json:"-"`
+}
@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+// Categorías de una denuncia de campaña.
+const (
+	ReportFraud         = "fraud"         // Estafa o uso indebido de los fondos
+	ReportImpersonation = "impersonation" // Se hace pasar por otra persona u organización
+	ReportMisleading    = "misleading"    // Información falsa o engañosa
+	ReportInappropriate = "inappropriate" // Contenido ofensivo o prohibido
+	ReportSpam          = "spam"
+	ReportOther         = "other"
+)
+
+// Estados de una denuncia.
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed" // Revisada sin encontrar problema
+	ReportActioned  = "actioned"  // Revisada y la campaña fue retirada
+)
+
+// ValidReportCategory indica si una categoría de denuncia existe.
+func ValidReportCategory(category string) bool {
+	switch category {
+	case ReportFraud, ReportImpersonation, ReportMisleading, ReportInappropriate, ReportSpam, ReportOther:
+		return true
+	}
+	return false
+}
+
+// Report es la denuncia de un usuario sobre una campaña.
+type Report struct {
+	ID            int        `json:"id"`
+	CampaignID    int        `json:"campaignId"`
+	CampaignTitle string     `json:"campaignTitle,omitempty"`
+	ReporterID    int        `json:"reporterId"`
+	Category      string     `json:"category"`
+	Details       string     `json:"details,omitempty"`
+	Status        string     `json:"status"`
+	Resolution    string     `json:"resolution,omitempty"` // Nota del moderador
+	ResolvedBy    int        `json:"resolvedBy,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	ResolvedAt    *time.Time `json:"resolvedAt,omitempty"`
+}
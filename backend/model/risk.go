@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+// Acciones del motor de riesgo, de menor a mayor severidad.
+const (
+	RiskNone  = "none"
+	RiskFlag  = "flag"  // Se registra y aparece en la cola de moderación
+	RiskHold  = "hold"  // Se detiene hasta que un moderador lo revise
+	RiskBlock = "block" // Se rechaza
+)
+
+// Tipos de evento que evalúa el motor de riesgo.
+const (
+	RiskSubjectDonation = "donation"
+	RiskSubjectCampaign = "campaign"
+)
+
+// Estados de revisión de una evaluación de riesgo.
+const (
+	RiskLogged    = "logged"    // Tuvo puntaje pero no alcanzó ninguna acción
+	RiskOpen      = "open"      // Pendiente de revisión
+	RiskCleared   = "cleared"   // Un moderador lo consideró legítimo
+	RiskConfirmed = "confirmed" // Un moderador confirmó el fraude
+)
+
+// RiskSignal es una regla que se activó, con su aporte al puntaje y el motivo.
+type RiskSignal struct {
+	Rule   string `json:"rule"`
+	Score  int    `json:"score"`
+	Reason string `json:"reason"`
+}
+
+// RiskAssessment es el resultado de evaluar una donación o una campaña.
+type RiskAssessment struct {
+	ID          int          `json:"id"`
+	SubjectType string       `json:"subjectType"`
+	SubjectID   int          `json:"subjectId"` // 0 si se bloqueó antes de crearse
+	UserID      int          `json:"userId,omitempty"`
+	Score       int          `json:"score"`
+	Action      string       `json:"action"`
+	Signals     []RiskSignal `json:"signals"`
+	Status      string       `json:"status"`
+	ReviewedBy  int          `json:"reviewedBy,omitempty"`
+	CreatedAt   time.Time    `json:"createdAt"`
+	ReviewedAt  *time.Time   `json:"reviewedAt,omitempty"`
+}
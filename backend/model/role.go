@@ -0,0 +1,52 @@
+package model
+
+// Roles de usuario, de menor a mayor privilegio.
+const (
+	RoleUser      = "user"
+	RoleCreator   = "creator" // Creó al menos una campaña
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Permisos que protegen las rutas de administración y las de gestión de
+// campañas propias.
+const (
+	PermManageUsers         = "users:manage"
+	PermModerateCampaigns   = "campaigns:moderate"
+	PermReviewVerifications = "verifications:review"
+	PermReviewMilestones    = "milestones:review"
+	PermViewLedger          = "ledger:view"
+	PermManagePayments      = "payments:manage"
+	PermViewAudit           = "audit:view"
+	PermManageJobs          = "jobs:manage"
+	PermManageOwnCampaigns  = "campaigns:manage_own" // Hitos, reembolsos, verificación y payout de las campañas propias
+)
+
+// rolePermissions indica qué puede hacer cada rol. El rol user solo puede crear
+// campañas; al crear la primera pasa a creator, que gestiona las suyas sin
+// permisos de administración.
+var rolePermissions = map[string][]string{
+	RoleCreator:   {PermManageOwnCampaigns},
+	RoleModerator: {PermManageOwnCampaigns, PermModerateCampaigns, PermReviewVerifications, PermReviewMilestones, PermViewLedger},
+	RoleAdmin: {PermManageOwnCampaigns, PermManageUsers, PermModerateCampaigns, PermReviewVerifications, PermReviewMilestones,
+		PermViewLedger, PermManagePayments, PermViewAudit, PermManageJobs},
+}
+
+// ValidRole indica si un rol existe.
+func ValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleCreator, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// HasPermission indica si un rol tiene un permiso.
+func HasPermission(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
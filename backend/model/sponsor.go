@@ -0,0 +1,61 @@
+package model
+
+import "time"
+
+// Estados de un patrocinador de contrapartida.
+const (
+	SponsorPendingAuthorization = "pending_authorization" // Esperando que apruebe el grant en su wallet
+	SponsorActive               = "active"
+	SponsorExpired              = "expired"
+	SponsorRevoked              = "revoked" // Su dueño borró la cuenta; el grant ya no se usa
+)
+
+// Sponsor es una empresa que iguala las donaciones de una campaña hasta un tope.
+type Sponsor struct {
+	ID            int       `json:"id"`
+	CampaignID    int       `json:"campaignId"`
+	UserID        int       `json:"userId"` // Usuario que registró al patrocinador
+	Name          string    `json:"name"`
+	WalletAddress string    `json:"walletAddress"`
+	Cap           float64   `json:"cap"`
+	MatchRatio    float64   `json:"matchRatio"` // 1 iguala cada peso, 0.5 la mitad, etc.
+	MatchedTotal  float64   `json:"matchedTotal"`
+	Status        string    `json:"status"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+	CreatedAt     time.Time `json:"createdAt"`
+
+	// Datos del grant de intervalo preautorizado. Nunca se envían al cliente.
+	ContinueURI   string `json:"-"`
+	ContinueToken string `json:"-"`
+	AccessToken   string `json:"-"`
+}
+
+// RemainingCapacity devuelve cuánto puede igualar todavía el patrocinador.
+func (s Sponsor) RemainingCapacity() float64 {
+	if s.Status != SponsorActive || time.Now().After(s.ExpiresAt) {
+		return 0
+	}
+	if remaining := s.Cap - s.MatchedTotal; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// Estados de una contrapartida.
+const (
+	MatchPending  = "pending"
+	MatchMatched  = "matched"
+	MatchFailed   = "failed"
+	MatchReversed = "reversed"
+)
+
+// SponsorMatch es la contrapartida de un patrocinador para una donación.
+type SponsorMatch struct {
+	ID                int       `json:"id"`
+	SponsorID         int       `json:"sponsorId"`
+	DonationID        int       `json:"donationId"`
+	Amount            float64   `json:"amount"`
+	Status            string    `json:"status"`
+	OutgoingPaymentID string    `json:"outgoingPaymentId,omitempty"`
+	CreatedAt         time.Time `json:"createdAt"`
+}
@@ -1,8 +1,62 @@
 package model
 
+import "time"
+
 type User struct {
 	ID            int    `json:"id"`
 	Username      string `json:"username"`
 	PasswordHash  string `json:"-"`
 	WalletAddress string `json:"walletAddress"`
-}
\ No newline at end of file
+
+	// Datos de la wallet resueltos al registrarse.
+	WalletAssetCode  string `json:"walletAssetCode,omitempty"`
+	WalletAssetScale int    `json:"walletAssetScale,omitempty"`
+	WalletAuthServer string `json:"walletAuthServer,omitempty"`
+
+	// Perfil público, editable con PATCH /api/me.
+	DisplayName string `json:"displayName,omitempty"`
+	Bio         string `json:"bio,omitempty"`
+	AvatarURL   string `json:"avatarUrl,omitempty"`
+
+	// Correo opcional para recuperar la cuenta. Solo se le envían enlaces de
+	// restablecimiento después de verificarlo.
+	Email           string     `json:"email,omitempty"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty"`
+
+	// Verificación en dos pasos con TOTP. El secreto se guarda al iniciar la
+	// inscripción, pero solo se exige después de activarla.
+	TOTPSecret         string     `json:"-"`
+	TOTPLastStep       int64      `json:"-"` // Último paso aceptado, para no admitir dos veces el mismo código
+	TOTPFailures       int        `json:"-"` // Códigos incorrectos seguidos
+	TwoFactorEnabledAt *time.Time `json:"twoFactorEnabledAt,omitempty"`
+
+	Role          string     `json:"role"`
+	SuspendedAt   *time.Time `json:"suspendedAt,omitempty"`
+	SuspendReason string     `json:"suspendReason,omitempty"`
+	CreatedAt     *time.Time `json:"createdAt,omitempty"` // Nil en cuentas creadas antes de guardarse la fecha
+
+	// Borrado de la cuenta: se pide con DELETE /api/me y se hace efectivo,
+	// anonimizando la cuenta, al terminar el periodo de gracia.
+	DeletionRequestedAt *time.Time `json:"deletionRequestedAt,omitempty"`
+	DeletedAt           *time.Time `json:"deletedAt,omitempty"`
+}
+
+// Suspended indica si un administrador suspendió la cuenta.
+func (u User) Suspended() bool {
+	return u.SuspendedAt != nil
+}
+
+// EmailVerified indica si el usuario confirmó su correo actual.
+func (u User) EmailVerified() bool {
+	return u.Email != "" && u.EmailVerifiedAt != nil
+}
+
+// TwoFactorEnabled indica si la cuenta exige un código TOTP al iniciar sesión.
+func (u User) TwoFactorEnabled() bool {
+	return u.TwoFactorEnabledAt != nil
+}
+
+// Deleted indica si la cuenta ya se anonimizó.
+func (u User) Deleted() bool {
+	return u.DeletedAt != nil
+}
@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+// Estados de una solicitud de verificación de campaña.
+const (
+	VerificationPending  = "pending"
+	VerificationApproved = "approved"
+	VerificationRejected = "rejected"
+)
+
+// VerificationRequest es la solicitud del creador para que un administrador
+// verifique su identidad y la campaña reciba la insignia de verificada.
+type VerificationRequest struct {
+	ID             int                    `json:"id"`
+	CampaignID     int                    `json:"campaignId"`
+	UserID         int                    `json:"userId"`
+	FullName       string                 `json:"fullName"`
+	DocumentType   string                 `json:"documentType"` // INE, pasaporte, etc.
+	DocumentNumber string                 `json:"documentNumber"`
+	Notes          string                 `json:"notes,omitempty"`
+	Status         string                 `json:"status"`
+	Reason         string                 `json:"reason,omitempty"` // Motivo del rechazo
+	Documents      []VerificationDocument `json:"documents"`
+	CreatedAt      time.Time              `json:"createdAt"`
+	ReviewedAt     *time.Time             `json:"reviewedAt,omitempty"`
+}
+
+// VerificationDocument es un archivo de soporte de una solicitud de verificación.
+type VerificationDocument struct {
+	ID          int       `json:"id"`
+	RequestID   int       `json:"requestId"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Path        string    `json:"-"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Tipos de eventos que envía el servidor de recursos de Open Payments.
+const (
+	WebhookIncomingPaymentCompleted = "incoming_payment.completed"
+	WebhookIncomingPaymentExpired   = "incoming_payment.expired"
+	WebhookOutgoingPaymentFailed    = "outgoing_payment.failed"
+)
+
+// Estados de procesamiento de un webhook recibido.
+const (
+	WebhookPending    = "pending"
+	WebhookProcessing = "processing" // Alguien lo está procesando; si no termina, se reintenta al vencer next_attempt_at
+	WebhookProcessed  = "processed"
+	WebhookFailed     = "failed" // Falló; se reintenta en next_attempt_at
+	WebhookDead       = "dead"   // Agotó los reintentos; solo un administrador puede reintentarlo
+)
+
+// WebhookEvent es un webhook recibido de Open Payments. El ID lo asigna quien
+// lo envía y sirve para no procesar dos veces el mismo evento.
+type WebhookEvent struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	Data          json.RawMessage `json:"data"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"lastError,omitempty"`
+	NextAttemptAt *time.Time      `json:"nextAttemptAt,omitempty"`
+	ReceivedAt    time.Time       `json:"receivedAt"`
+	ProcessedAt   *time.Time      `json:"processedAt,omitempty"`
+}
+
+// Eventos que se envían a los endpoints de webhooks de los creadores.
+const (
+	CreatorEventDonationCompleted   = "donation.completed"
+	CreatorEventDonationRefunded    = "donation.refunded"
+	CreatorEventCampaignGoalReached = "campaign.goal_reached"
+	CreatorEventCampaignClosed      = "campaign.closed"
+)
+
+// CreatorEvents son todos los eventos a los que se puede suscribir un endpoint.
+var CreatorEvents = []string{CreatorEventDonationCompleted, CreatorEventDonationRefunded, CreatorEventCampaignGoalReached, CreatorEventCampaignClosed}
+
+// WebhookEndpoint es una URL del creador que recibe eventos de sus campañas.
+// El secreto solo se devuelve al crearlo.
+type WebhookEndpoint struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"-"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Subscribed indica si el endpoint quiere recibir un tipo de evento.
+func (e WebhookEndpoint) Subscribed(eventType string) bool {
+	for _, t := range e.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Estados de una entrega de webhook a un creador.
+const (
+	DeliveryPending    = "pending"
+	DeliveryInProgress = "delivering" // Reservada por un envío; si no termina, se reintenta al vencer next_attempt_at
+	DeliveryDelivered  = "delivered"
+	DeliveryFailed     = "failed" // Falló; se reintenta en next_attempt_at
+	DeliveryDead       = "dead"   // Agotó los reintentos; el creador puede reenviarla
+)
+
+// WebhookDelivery es el envío de un evento a un endpoint. EventID es el mismo
+// en todos los endpoints y reenvíos del evento, para que el receptor descarte
+// duplicados.
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	EndpointID     int             `json:"endpointId"`
+	EventID        string          `json:"eventId"`
+	EventType      string          `json:"eventType"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode int             `json:"lastStatusCode,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+
+	// Log de intentos; solo se incluye en el detalle de una entrega.
+	AttemptLog []WebhookAttempt `json:"attemptLog,omitempty"`
+}
+
+// WebhookAttempt es un intento de entrega con la respuesta del endpoint.
+type WebhookAttempt struct {
+	AttemptedAt time.Time `json:"attemptedAt"`
+	StatusCode  int       `json:"statusCode,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"durationMs"`
+}
@@ -4,44 +4,40 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"time"
 
+	"gofundme-backend/clientkeys"
+	"gofundme-backend/config"
 	"gofundme-backend/openpayments/final"
 	op "github.com/interledger/open-payments-go"
 	as "github.com/interledger/open-payments-go/generated/authserver"
 	rs "github.com/interledger/open-payments-go/generated/resourceserver"
 )
 
-const (
-	privateKeyPath           = "../test/private.key"
-	keyId                    = "685c6458-134d-4f80-b6e9-5011e397ee3f"
-	clientWalletAddressURL   = "https://ilp.interledger-test.dev/clientzerokm"
-)
-
 // Client is a client for interacting with an Open Payments server.
 type Client struct {
 	*op.AuthenticatedClient
 }
 
-// NewClient creates and authenticates a new Open Payments client.
+// NewClient creates a client that signs as the backend's own wallet
+// (config.ClientWalletAddress) with that wallet's current key, so a rotation
+// takes effect on the next request. The backend has a single client identity:
+// donors' and creators' wallets only grant access, they never sign requests.
+// Keys live encrypted in the database and are managed with cmd/clientkeys.
 func NewClient() (*Client, error) {
-	pemFileBytes, err := ioutil.ReadFile(privateKeyPath)
+	walletAddress := config.ClientWalletAddress()
+	key, err := clientkeys.Current(walletAddress, time.Now())
 	if err != nil {
-		// Intentar una ruta alternativa si estamos ejecutando desde el directorio del backend
-		log.Printf("No se pudo leer la clave privada en la ruta inicial, intentando ruta alternativa...")
-		pemFileBytes, err = ioutil.ReadFile("../../test/private.key")
-		if err != nil {
-			return nil, fmt.Errorf("error al leer el archivo de la clave privada desde ambas rutas: %v", err)
-		}
+		return nil, fmt.Errorf("no se pudo obtener la llave de cliente de %s: %v", walletAddress, err)
 	}
 
-	privateKeyBase64 := base64.StdEncoding.EncodeToString(pemFileBytes)
+	privateKeyBase64 := base64.StdEncoding.EncodeToString(key.PrivateKeyPEM)
 
 	authenticatedClient, err := op.NewAuthenticatedClient(
-		clientWalletAddressURL,
+		walletAddress,
 		privateKeyBase64,
-		keyId,
+		key.KeyID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("no se pudo crear el cliente autenticado: %v", err)
@@ -125,3 +121,255 @@ func toFinalResponse(ip *rs.IncomingPaymentWithMethods, walletAddressId *string)
 		CreatedAt: ip.CreatedAt,
 	}
 }
+
+
+// SendPayment envía un pago desde una wallet controlada por el backend hacia otra
+// wallet, sin interacción del usuario: crea el incoming payment en el receptor,
+// la quote y el outgoing payment con un grant no interactivo.
+func (c *Client) SendPayment(ctx context.Context, sendingWalletAddressURL, receivingWalletAddressURL string, amount int64, description string) (*rs.OutgoingPayment, error) {
+	prepared, err := c.PrepareSendPayment(ctx, sendingWalletAddressURL, receivingWalletAddressURL, amount, description)
+	if err != nil {
+		return nil, err
+	}
+	return c.CreateOutgoingPayment(ctx, sendingWalletAddressURL, prepared.AccessToken, prepared.QuoteID)
+}
+
+// PreparedPayment es un pago cotizado y autorizado al que solo le falta crear
+// el outgoing payment.
+type PreparedPayment struct {
+	QuoteID     string
+	AccessToken string
+}
+
+// PrepareSendPayment hace la parte de SendPayment que no mueve dinero: el
+// incoming payment en el receptor, la quote y el grant no interactivo. Si
+// falla, es seguro que no se pagó nada.
+func (c *Client) PrepareSendPayment(ctx context.Context, sendingWalletAddressURL, receivingWalletAddressURL string, amount int64, description string) (*PreparedPayment, error) {
+	incomingPayment, err := c.CreateIncomingPayment(ctx, receivingWalletAddressURL, amount, description)
+	if err != nil {
+		return nil, err
+	}
+
+	sendingWalletAddress, err := c.WalletAddress.Get(ctx, op.WalletAddressGetParams{URL: sendingWalletAddressURL})
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo la wallet emisora: %v", err)
+	}
+
+	quote, err := c.createQuote(ctx, sendingWalletAddressURL, incomingPayment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	limitData := as.LimitsOutgoing1{DebitAmount: as.Amount{AssetCode: quote.DebitAmount.AssetCode, AssetScale: quote.DebitAmount.AssetScale, Value: quote.DebitAmount.Value}}
+	var limits as.LimitsOutgoing
+	if err := limits.FromLimitsOutgoing1(limitData); err != nil {
+		return nil, fmt.Errorf("error al crear los límites para el grant: %v", err)
+	}
+	outgoingAccess := as.AccessOutgoing{
+		Type:       as.OutgoingPayment,
+		Actions:    []as.AccessOutgoingActions{as.AccessOutgoingActionsCreate, as.AccessOutgoingActionsRead},
+		Identifier: *sendingWalletAddress.Id,
+		Limits:     &limits,
+	}
+	outgoingAccessItem := as.AccessItem{}
+	if err := outgoingAccessItem.FromAccessOutgoing(outgoingAccess); err != nil {
+		return nil, fmt.Errorf("error al crear AccessItem para outgoing payment: %v", err)
+	}
+	outgoingPaymentGrant, err := c.Grant.Request(ctx, op.GrantRequestParams{
+		URL: *sendingWalletAddress.AuthServer,
+		RequestBody: as.GrantRequestWithAccessToken{
+			AccessToken: struct {
+				Access as.Access `json:"access"`
+			}{Access: []as.AccessItem{outgoingAccessItem}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error solicitando grant para outgoing payment: %v", err)
+	}
+	if outgoingPaymentGrant.AccessToken.Value == "" {
+		return nil, fmt.Errorf("el servidor de autorización exige interacción para pagar desde %s", sendingWalletAddressURL)
+	}
+
+	return &PreparedPayment{QuoteID: *quote.Id, AccessToken: outgoingPaymentGrant.AccessToken.Value}, nil
+}
+
+// PayWithGrant envía un pago usando un grant de outgoing payment ya aprobado
+// por el dueño de la wallet emisora (por ejemplo, un grant de intervalo).
+func (c *Client) PayWithGrant(ctx context.Context, sendingWalletAddressURL, accessToken, receivingWalletAddressURL string, amount int64, description string) (*rs.OutgoingPayment, error) {
+	incomingPayment, err := c.CreateIncomingPayment(ctx, receivingWalletAddressURL, amount, description)
+	if err != nil {
+		return nil, err
+	}
+	quote, err := c.createQuote(ctx, sendingWalletAddressURL, incomingPayment.ID)
+	if err != nil {
+		return nil, err
+	}
+	return c.CreateOutgoingPayment(ctx, sendingWalletAddressURL, accessToken, *quote.Id)
+}
+
+// createQuote pide un grant de quote en la wallet emisora y cotiza el pago al receptor.
+func (c *Client) createQuote(ctx context.Context, sendingWalletAddressURL, receiver string) (*rs.Quote, error) {
+	sendingWalletAddress, err := c.WalletAddress.Get(ctx, op.WalletAddressGetParams{URL: sendingWalletAddressURL})
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo la wallet emisora: %v", err)
+	}
+
+	quoteAccess := as.AccessQuote{Type: as.Quote, Actions: []as.AccessQuoteActions{as.Create, as.Read}}
+	quoteAccessItem := as.AccessItem{}
+	if err := quoteAccessItem.FromAccessQuote(quoteAccess); err != nil {
+		return nil, fmt.Errorf("error al crear AccessItem para quote: %v", err)
+	}
+	quoteGrant, err := c.Grant.Request(ctx, op.GrantRequestParams{
+		URL: *sendingWalletAddress.AuthServer,
+		RequestBody: as.GrantRequestWithAccessToken{
+			AccessToken: struct {
+				Access as.Access `json:"access"`
+			}{Access: []as.AccessItem{quoteAccessItem}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error solicitando grant para quote: %v", err)
+	}
+
+	quote, err := c.Quote.Create(ctx, op.QuoteCreateParams{
+		BaseURL:     *sendingWalletAddress.ResourceServer,
+		AccessToken: quoteGrant.AccessToken.Value,
+		Payload: rs.CreateQuoteJSONBody0{
+			WalletAddressSchema: *sendingWalletAddress.Id,
+			Receiver:            receiver,
+			Method:              "ilp",
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creando la quote: %v", err)
+	}
+	return &quote, nil
+}
+
+// InteractiveGrant es un grant pendiente de que el dueño de la wallet lo apruebe
+// en la URL de redirección.
+type InteractiveGrant struct {
+	RedirectURL   string
+	ContinueURI   string
+	ContinueToken string
+}
+
+// RequestIntervalGrant solicita un grant interactivo para crear outgoing payments
+// desde una wallet por hasta debitAmount (en unidades mínimas) dentro del
+// intervalo ISO 8601 indicado, por ejemplo "R1/2025-01-01T00:00:00Z/P30D".
+func (c *Client) RequestIntervalGrant(ctx context.Context, walletAddressURL string, debitAmount int64, interval string) (*InteractiveGrant, error) {
+	walletAddress, err := c.WalletAddress.Get(ctx, op.WalletAddressGetParams{URL: walletAddressURL})
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo la wallet: %v", err)
+	}
+
+	limitData := as.LimitsOutgoing1{
+		DebitAmount: as.Amount{AssetCode: walletAddress.AssetCode, AssetScale: walletAddress.AssetScale, Value: fmt.Sprintf("%d", debitAmount)},
+		Interval:    &interval,
+	}
+	return c.requestInteractiveGrant(ctx, *walletAddress.Id, *walletAddress.AuthServer, limitData)
+}
+
+// PrepareInteractivePayment prepara un pago que el dueño de la wallet emisora
+// debe aprobar: crea el incoming payment en el receptor, la quote y un grant
+// interactivo limitado a lo que debita esa quote. Devuelve el grant y el ID de
+// la quote, que se paga con CreateOutgoingPayment una vez continuado el grant.
+func (c *Client) PrepareInteractivePayment(ctx context.Context, sendingWalletAddressURL, receivingWalletAddressURL string, amount int64, description string) (*InteractiveGrant, string, error) {
+	incomingPayment, err := c.CreateIncomingPayment(ctx, receivingWalletAddressURL, amount, description)
+	if err != nil {
+		return nil, "", err
+	}
+	quote, err := c.createQuote(ctx, sendingWalletAddressURL, incomingPayment.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	sendingWalletAddress, err := c.WalletAddress.Get(ctx, op.WalletAddressGetParams{URL: sendingWalletAddressURL})
+	if err != nil {
+		return nil, "", fmt.Errorf("error obteniendo la wallet emisora: %v", err)
+	}
+
+	limitData := as.LimitsOutgoing1{DebitAmount: as.Amount{AssetCode: quote.DebitAmount.AssetCode, AssetScale: quote.DebitAmount.AssetScale, Value: quote.DebitAmount.Value}}
+	grant, err := c.requestInteractiveGrant(ctx, *sendingWalletAddress.Id, *sendingWalletAddress.AuthServer, limitData)
+	if err != nil {
+		return nil, "", err
+	}
+	return grant, *quote.Id, nil
+}
+
+// requestInteractiveGrant solicita un grant interactivo de outgoing payment con los límites indicados.
+func (c *Client) requestInteractiveGrant(ctx context.Context, walletAddressID, authServer string, limitData as.LimitsOutgoing1) (*InteractiveGrant, error) {
+	var limits as.LimitsOutgoing
+	if err := limits.FromLimitsOutgoing1(limitData); err != nil {
+		return nil, fmt.Errorf("error al crear los límites para el grant: %v", err)
+	}
+	outgoingAccess := as.AccessOutgoing{
+		Type:       as.OutgoingPayment,
+		Actions:    []as.AccessOutgoingActions{as.AccessOutgoingActionsCreate, as.AccessOutgoingActionsRead},
+		Identifier: walletAddressID,
+		Limits:     &limits,
+	}
+	outgoingAccessItem := as.AccessItem{}
+	if err := outgoingAccessItem.FromAccessOutgoing(outgoingAccess); err != nil {
+		return nil, fmt.Errorf("error al crear AccessItem para outgoing payment: %v", err)
+	}
+	grant, err := c.Grant.Request(ctx, op.GrantRequestParams{
+		URL: authServer,
+		RequestBody: as.GrantRequestWithAccessToken{
+			AccessToken: struct {
+				Access as.Access `json:"access"`
+			}{Access: []as.AccessItem{outgoingAccessItem}},
+			Interact: &as.InteractRequest{Start: []as.InteractRequestStart{as.InteractRequestStartRedirect}},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error solicitando grant interactivo: %v", err)
+	}
+	if grant.Interact == nil || grant.Continue.Uri == "" {
+		return nil, fmt.Errorf("el servidor de autorización no devolvió una interacción")
+	}
+
+	return &InteractiveGrant{
+		RedirectURL:   grant.Interact.Redirect,
+		ContinueURI:   grant.Continue.Uri,
+		ContinueToken: grant.Continue.AccessToken.Value,
+	}, nil
+}
+
+// ContinueGrant finaliza un grant interactivo ya aprobado y devuelve su access token.
+func (c *Client) ContinueGrant(ctx context.Context, continueURI, continueToken string) (string, error) {
+	grant, err := c.Grant.Continue(ctx, op.GrantContinueParams{
+		URL:         continueURI,
+		AccessToken: continueToken,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error al continuar el grant: %v", err)
+	}
+	return grant.AccessToken.Value, nil
+}
+
+// CreateOutgoingPayment paga una quote existente con un access token ya concedido.
+func (c *Client) CreateOutgoingPayment(ctx context.Context, sendingWalletAddressURL, accessToken, quoteID string) (*rs.OutgoingPayment, error) {
+	sendingWalletAddress, err := c.WalletAddress.Get(ctx, op.WalletAddressGetParams{URL: sendingWalletAddressURL})
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo la wallet emisora: %v", err)
+	}
+
+	var paymentPayload rs.CreateOutgoingPaymentRequest
+	err = paymentPayload.FromCreateOutgoingPaymentWithQuote(rs.CreateOutgoingPaymentWithQuote{
+		WalletAddressSchema: *sendingWalletAddress.Id,
+		QuoteId:             quoteID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creando payload del outgoing payment: %v", err)
+	}
+
+	outgoingPayment, err := c.OutgoingPayment.Create(ctx, op.OutgoingPaymentCreateParams{
+		BaseURL:     *sendingWalletAddress.ResourceServer,
+		AccessToken: accessToken,
+		Payload:     paymentPayload,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creando el outgoing payment: %v", err)
+	}
+	return &outgoingPayment, nil
+}
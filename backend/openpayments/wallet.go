@@ -0,0 +1,83 @@
+package openpayments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	op "github.com/interledger/open-payments-go"
+)
+
+var (
+	// ErrInvalidWalletAddress indica que la dirección no tiene un formato válido.
+	ErrInvalidWalletAddress = errors.New("wallet address inválida")
+	// ErrUnreachableWalletAddress indica que la dirección no se pudo resolver.
+	ErrUnreachableWalletAddress = errors.New("wallet address inalcanzable")
+)
+
+// resolveTimeout limita cuánto esperamos al servidor de la wallet.
+const resolveTimeout = 10 * time.Second
+
+// WalletAddressInfo son los datos públicos de una wallet address resuelta.
+type WalletAddressInfo struct {
+	URL            string `json:"url"`
+	AssetCode      string `json:"assetCode"`
+	AssetScale     int    `json:"assetScale"`
+	AuthServer     string `json:"authServer"`
+	ResourceServer string `json:"resourceServer"`
+}
+
+// NormalizeWalletAddress convierte un payment pointer ($wallet.example/alice) en
+// su URL https y valida que el resultado sea una URL https con host.
+// Un payment pointer sin ruta apunta a /.well-known/pay.
+func NormalizeWalletAddress(raw string) (string, error) {
+	address := strings.TrimSpace(raw)
+	if address == "" {
+		return "", ErrInvalidWalletAddress
+	}
+	if strings.HasPrefix(address, "$") {
+		address = "https://" + strings.TrimPrefix(address, "$")
+		if u, err := url.Parse(address); err == nil && (u.Path == "" || u.Path == "/") {
+			address = strings.TrimSuffix(address, "/") + "/.well-known/pay"
+		}
+	}
+
+	u, err := url.Parse(address)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("%w: %q", ErrInvalidWalletAddress, raw)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// ResolveWalletAddress normaliza la dirección y la consulta en su servidor para
+// confirmar que existe y obtener su activo y su servidor de autorización.
+func (c *Client) ResolveWalletAddress(ctx context.Context, raw string) (*WalletAddressInfo, error) {
+	address, err := NormalizeWalletAddress(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+	walletAddress, err := c.WalletAddress.Get(ctx, op.WalletAddressGetParams{URL: address})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreachableWalletAddress, err)
+	}
+	if walletAddress.Id == nil || walletAddress.AuthServer == nil || walletAddress.AssetCode == "" {
+		return nil, fmt.Errorf("%w: respuesta incompleta de %s", ErrUnreachableWalletAddress, address)
+	}
+
+	info := &WalletAddressInfo{
+		URL:        *walletAddress.Id,
+		AssetCode:  walletAddress.AssetCode,
+		AssetScale: walletAddress.AssetScale,
+		AuthServer: *walletAddress.AuthServer,
+	}
+	if walletAddress.ResourceServer != nil {
+		info.ResourceServer = *walletAddress.ResourceServer
+	}
+	return info, nil
+}
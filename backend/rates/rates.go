@@ -0,0 +1,63 @@
+// Package rates convierte montos entre activos con un proveedor de tasas de
+// cambio intercambiable. El proveedor por defecto solo admite conversiones
+// entre el mismo activo; main configura el proveedor real al arrancar.
+package rates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrRateNotFound indica que el proveedor no conoce la tasa entre dos activos.
+var ErrRateNotFound = errors.New("tasa de cambio no disponible")
+
+// Provider devuelve cuántas unidades de `to` equivalen a una unidad de `from`.
+type Provider interface {
+	Rate(ctx context.Context, from, to string) (float64, error)
+}
+
+var (
+	mu      sync.RWMutex
+	current Provider = identityProvider{}
+)
+
+// SetProvider cambia el proveedor de tasas usado por Convert.
+func SetProvider(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = p
+}
+
+// Convert convierte un monto de un activo a otro con el proveedor actual.
+func Convert(ctx context.Context, amount float64, from, to string) (float64, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return amount, nil
+	}
+
+	mu.RLock()
+	p := current
+	mu.RUnlock()
+
+	rate, err := p.Rate(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	if rate <= 0 {
+		return 0, fmt.Errorf("%w: tasa inválida %s→%s", ErrRateNotFound, from, to)
+	}
+	return amount * rate, nil
+}
+
+// identityProvider solo conoce la tasa de un activo consigo mismo.
+type identityProvider struct{}
+
+func (identityProvider) Rate(_ context.Context, from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	return 0, fmt.Errorf("%w: %s→%s", ErrRateNotFound, from, to)
+}
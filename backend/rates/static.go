@@ -0,0 +1,60 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// StaticProvider usa tasas fijas leídas de un archivo JSON. Sirve para pruebas
+// y para trabajar sin conexión. El archivo expresa cada activo respecto a una
+// base común:
+//
+//	{"base": "USD", "rates": {"USD": 1, "MXN": 18.4, "EUR": 0.92}}
+type StaticProvider struct {
+	base  string
+	rates map[string]float64
+}
+
+// NewStaticProvider carga las tasas desde un archivo JSON.
+func NewStaticProvider(path string) (*StaticProvider, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error al leer el archivo de tasas: %w", err)
+	}
+
+	var file struct {
+		Base  string             `json:"base"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.Unmarshal(bytes, &file); err != nil {
+		return nil, fmt.Errorf("error al deserializar el archivo de tasas: %w", err)
+	}
+
+	p := &StaticProvider{base: strings.ToUpper(file.Base), rates: map[string]float64{}}
+	for asset, rate := range file.Rates {
+		if rate <= 0 {
+			return nil, fmt.Errorf("tasa inválida para %s: %v", asset, rate)
+		}
+		p.rates[strings.ToUpper(asset)] = rate
+	}
+	if p.base != "" {
+		p.rates[p.base] = 1
+	}
+	return p, nil
+}
+
+// Rate implementa Provider a partir de las tasas respecto a la base.
+func (p *StaticProvider) Rate(_ context.Context, from, to string) (float64, error) {
+	fromRate, ok := p.rates[strings.ToUpper(from)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrRateNotFound, from)
+	}
+	toRate, ok := p.rates[strings.ToUpper(to)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrRateNotFound, to)
+	}
+	return toRate / fromRate, nil
+}
@@ -0,0 +1,187 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Dimensiones de una página A4 en puntos y márgenes del comprobante.
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	marginLeft   = 56
+	marginTop    = 64
+	marginBottom = 56
+)
+
+// RenderPDF dibuja el comprobante como un PDF de una o más páginas. Usa solo
+// las fuentes estándar de PDF (Helvetica y Courier), así que no necesita
+// incrustar fuentes ni depender de servicios externos.
+func RenderPDF(r Receipt) []byte {
+	doc := &pdfDocument{}
+	doc.newPage()
+
+	doc.text("F2", 18, "Comprobante de donación")
+	doc.text("F1", 10, "Folio "+r.Number+" · Emitido el "+formatTime(r.IssuedAt))
+	doc.space(14)
+
+	doc.text("F2", 12, "Campaña")
+	doc.field("Título", r.CampaignTitle)
+	doc.field("ID", fmt.Sprintf("%d", r.CampaignID))
+	doc.field("Creador", r.Creator)
+	doc.space(10)
+
+	doc.text("F2", 12, "Donación")
+	doc.field("ID", fmt.Sprintf("%d", r.DonationID))
+	doc.field("Estado", r.Status)
+	doc.field("Monto", formatAmount(r.Amount, r.AssetScale, r.AssetCode))
+	if r.OriginalCurrency != "" {
+		doc.field("Monto pagado", fmt.Sprintf("%.2f %s", r.OriginalAmount, r.OriginalCurrency))
+	}
+	if r.RefundedAmount > 0 {
+		doc.field("Reembolsado", formatAmount(r.RefundedAmount, r.AssetScale, r.AssetCode))
+	}
+	if r.DonorWalletAddress != "" {
+		doc.field("Wallet del donante", r.DonorWalletAddress)
+	}
+	doc.field("Creada", formatTime(r.CreatedAt))
+	if r.CompletedAt != nil {
+		doc.field("Confirmada", formatTime(*r.CompletedAt))
+	}
+	doc.space(10)
+
+	doc.text("F2", 12, "Pagos de Open Payments")
+	for i, p := range r.Payments {
+		doc.text("F1", 10, fmt.Sprintf("%d. %s para %s", i+1, formatAmount(p.Amount, r.AssetScale, r.AssetCode), p.WalletAddress))
+		doc.mono("Incoming payment: " + p.IncomingPaymentID)
+		if p.OutgoingPaymentID != "" {
+			doc.mono("Outgoing payment: " + p.OutgoingPaymentID)
+		}
+		doc.space(4)
+	}
+
+	doc.space(14)
+	doc.text("F1", 8, "Este comprobante también está disponible en formato JSON firmado con Ed25519.")
+	doc.text("F1", 8, "La firma se puede verificar con la llave pública publicada en /api/receipts/keys.")
+
+	return doc.bytes()
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+// pdfDocument acumula el contenido de cada página mientras se escribe de arriba abajo.
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (d *pdfDocument) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pageHeight - marginTop
+}
+
+func (d *pdfDocument) space(h float64) {
+	d.y -= h
+}
+
+// text escribe una línea con la fuente indicada (F1 Helvetica, F2 Helvetica
+// Bold, F3 Courier) y baja el cursor. Si no cabe, pasa a la página siguiente.
+func (d *pdfDocument) text(font string, size float64, s string) {
+	lineHeight := size * 1.4
+	if d.y-lineHeight < marginBottom {
+		d.newPage()
+	}
+	d.y -= lineHeight
+	page := d.pages[len(d.pages)-1]
+	fmt.Fprintf(page, "BT /%s %.1f Tf %d %.1f Td (%s) Tj ET\n", font, size, marginLeft, d.y, escapePDFString(s))
+}
+
+func (d *pdfDocument) field(label, value string) {
+	d.text("F1", 10, label+": "+value)
+}
+
+// mono escribe en Courier partiendo las líneas largas, como los IDs de los pagos.
+func (d *pdfDocument) mono(s string) {
+	const maxChars = 90
+	for len(s) > maxChars {
+		d.text("F3", 8, s[:maxChars])
+		s = "  " + s[maxChars:]
+	}
+	d.text("F3", 8, s)
+}
+
+// bytes serializa el documento: catálogo, árbol de páginas, fuentes y una
+// página con su stream de contenido por cada página escrita.
+func (d *pdfDocument) bytes() []byte {
+	var objects []string
+	add := func(obj string) int {
+		objects = append(objects, obj)
+		return len(objects)
+	}
+
+	catalog := add("") // Se completa cuando se conoce el árbol de páginas
+	pagesObj := add("")
+	fonts := fmt.Sprintf("/F1 %d 0 R /F2 %d 0 R /F3 %d 0 R",
+		add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>"),
+		add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>"),
+		add("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>"))
+
+	var kids []string
+	for _, content := range d.pages {
+		stream := add(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+		page := add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			pagesObj, pageWidth, pageHeight, fonts, stream))
+		kids = append(kids, fmt.Sprintf("%d 0 R", page))
+	}
+	objects[catalog-1] = fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesObj)
+	objects[pagesObj-1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, catalog, xref)
+	return out.Bytes()
+}
+
+// winAnsi traduce los caracteres fuera de Latin-1 que sí existen en WinAnsiEncoding.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+}
+
+// escapePDFString convierte un texto UTF-8 a WinAnsiEncoding y escapa los
+// caracteres especiales de los strings literales de PDF.
+func escapePDFString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 0x80:
+			b.WriteByte(byte(r))
+		case r >= 0xA0 && r <= 0xFF:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case winAnsi[r] != 0:
+			fmt.Fprintf(&b, "\\%03o", winAnsi[r])
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
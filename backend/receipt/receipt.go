@@ -0,0 +1,85 @@
+// Package receipt genera los comprobantes de donación: un PDF para el donante
+// y una versión JSON firmada con Ed25519 que terceros pueden verificar con la
+// llave pública publicada por el backend.
+package receipt
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// Receipt es el contenido de un comprobante de donación. Los montos están en
+// unidades mayores del activo indicado.
+type Receipt struct {
+	Number             string     `json:"number"`
+	IssuedAt           time.Time  `json:"issuedAt"`
+	DonationID         int        `json:"donationId"`
+	Status             string     `json:"status"`
+	CampaignID         int        `json:"campaignId"`
+	CampaignTitle      string     `json:"campaignTitle"`
+	Creator            string     `json:"creator"`
+	Amount             float64    `json:"amount"`
+	AssetCode          string     `json:"assetCode"`
+	AssetScale         int        `json:"assetScale"`
+	OriginalAmount     float64    `json:"originalAmount,omitempty"`
+	OriginalCurrency   string     `json:"originalCurrency,omitempty"`
+	RefundedAmount     float64    `json:"refundedAmount,omitempty"`
+	DonorWalletAddress string     `json:"donorWalletAddress,omitempty"`
+	CreatedAt          time.Time  `json:"createdAt"`
+	CompletedAt        *time.Time `json:"completedAt,omitempty"`
+	Payments           []Payment  `json:"payments"`
+}
+
+// Payment son los pagos de Open Payments con los que se liquidó una parte de la donación.
+type Payment struct {
+	WalletAddress     string  `json:"walletAddress"`
+	Amount            float64 `json:"amount"`
+	IncomingPaymentID string  `json:"incomingPaymentId"`
+	OutgoingPaymentID string  `json:"outgoingPaymentId,omitempty"`
+}
+
+// New arma el comprobante de una donación finalizada.
+func New(campaign *model.Campaign, donation *model.Donation) Receipt {
+	scale := campaign.Scale()
+	r := Receipt{
+		Number:             fmt.Sprintf("DON-%06d", donation.ID),
+		IssuedAt:           time.Now().UTC().Truncate(time.Second),
+		DonationID:         donation.ID,
+		Status:             donation.Status,
+		CampaignID:         campaign.ID,
+		CampaignTitle:      campaign.Title,
+		Creator:            campaign.CreatorUsername,
+		Amount:             donation.Amount,
+		AssetCode:          donation.Currency,
+		AssetScale:         scale,
+		RefundedAmount:     donation.RefundedAmount,
+		DonorWalletAddress: donation.DonorWalletAddress,
+		CreatedAt:          donation.CreatedAt.UTC(),
+		Payments:           []Payment{},
+	}
+	if donation.OriginalCurrency != "" && donation.OriginalCurrency != donation.Currency {
+		r.OriginalAmount = donation.OriginalAmount
+		r.OriginalCurrency = donation.OriginalCurrency
+	}
+	if donation.CompletedAt != nil {
+		completedAt := donation.CompletedAt.UTC()
+		r.CompletedAt = &completedAt
+	}
+	for _, s := range donation.Splits {
+		r.Payments = append(r.Payments, Payment{
+			WalletAddress:     s.WalletAddress,
+			Amount:            float64(s.Amount) / math.Pow10(scale),
+			IncomingPaymentID: s.IncomingPaymentID,
+			OutgoingPaymentID: s.OutgoingPaymentID,
+		})
+	}
+	return r
+}
+
+// formatAmount muestra un monto con los decimales de su activo.
+func formatAmount(amount float64, scale int, asset string) string {
+	return fmt.Sprintf("%.*f %s", scale, amount, asset)
+}
@@ -0,0 +1,189 @@
+package receipt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Algorithm es el algoritmo de firma de los comprobantes, con el nombre que usa JOSE.
+const Algorithm = "EdDSA"
+
+var (
+	// ErrNoSigner indica que el backend arrancó sin llave de firma.
+	ErrNoSigner = errors.New("no hay llave para firmar comprobantes")
+	// ErrInvalidSignature indica que la firma no corresponde al comprobante o a la llave.
+	ErrInvalidSignature = errors.New("la firma del comprobante no es válida")
+)
+
+// SignedReceipt es un comprobante firmado. Payload contiene, en base64url, los
+// bytes JSON exactos que se firmaron; Receipt es la misma información
+// decodificada para leerla cómodamente. Quien verifique debe usar Payload.
+type SignedReceipt struct {
+	Receipt   Receipt `json:"receipt"`
+	Payload   string  `json:"payload"`
+	Signature string  `json:"signature"`
+	KeyID     string  `json:"kid"`
+	Algorithm string  `json:"alg"`
+}
+
+// PublicKey es la llave pública de verificación en formato JWK (RFC 8037).
+type PublicKey struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+// Signer firma comprobantes con una llave Ed25519.
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+var (
+	mu     sync.RWMutex
+	signer *Signer
+)
+
+// SetSigner cambia la llave usada por Sign.
+func SetSigner(s *Signer) {
+	mu.Lock()
+	defer mu.Unlock()
+	signer = s
+}
+
+func currentSigner() (*Signer, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if signer == nil {
+		return nil, ErrNoSigner
+	}
+	return signer, nil
+}
+
+// LoadOrCreateSigner lee la llave privada PKCS#8 en PEM de path. Si el archivo
+// no existe, genera una llave nueva y la guarda ahí para que las firmas sigan
+// siendo verificables después de reiniciar.
+func LoadOrCreateSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+			return nil, fmt.Errorf("no se pudo guardar la llave de comprobantes: %v", err)
+		}
+		return newSigner(key), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s no contiene una llave PEM", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("llave de comprobantes inválida: %v", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("la llave de comprobantes no es Ed25519")
+	}
+	return newSigner(key), nil
+}
+
+func newSigner(key ed25519.PrivateKey) *Signer {
+	sum := sha256.Sum256(key.Public().(ed25519.PublicKey))
+	return &Signer{key: key, keyID: hex.EncodeToString(sum[:8])}
+}
+
+// PublicKey devuelve la llave pública del firmante en formato JWK.
+func (s *Signer) PublicKey() PublicKey {
+	return PublicKey{
+		KeyType:   "OKP",
+		Curve:     "Ed25519",
+		X:         base64.RawURLEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey)),
+		KeyID:     s.keyID,
+		Algorithm: Algorithm,
+		Use:       "sig",
+	}
+}
+
+// Sign firma un comprobante con el firmante configurado.
+func Sign(r Receipt) (*SignedReceipt, error) {
+	s, err := currentSigner()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedReceipt{
+		Receipt:   r,
+		Payload:   base64.RawURLEncoding.EncodeToString(payload),
+		Signature: base64.RawURLEncoding.EncodeToString(ed25519.Sign(s.key, payload)),
+		KeyID:     s.keyID,
+		Algorithm: Algorithm,
+	}, nil
+}
+
+// PublishedKeys devuelve las llaves públicas con las que se pueden verificar los comprobantes.
+func PublishedKeys() ([]PublicKey, error) {
+	s, err := currentSigner()
+	if err != nil {
+		return nil, err
+	}
+	return []PublicKey{s.PublicKey()}, nil
+}
+
+// Verify comprueba la firma de un comprobante con las llaves publicadas y
+// devuelve el comprobante tal como fue firmado.
+func Verify(signed SignedReceipt) (*Receipt, error) {
+	keys, err := PublishedKeys()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(signed.Payload)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	for _, k := range keys {
+		if k.KeyID != signed.KeyID {
+			continue
+		}
+		pub, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(pub) != ed25519.PublicKeySize || !ed25519.Verify(pub, payload, signature) {
+			return nil, ErrInvalidSignature
+		}
+		var r Receipt
+		if err := json.Unmarshal(payload, &r); err != nil {
+			return nil, ErrInvalidSignature
+		}
+		return &r, nil
+	}
+	return nil, ErrInvalidSignature
+}
@@ -0,0 +1,137 @@
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// Duration es un time.Duration que se escribe en JSON como "10m" o "72h".
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Thresholds es el puntaje mínimo de cada acción. Un umbral de 0 desactiva la acción.
+type Thresholds struct {
+	Flag  int `json:"flag"`
+	Hold  int `json:"hold"`
+	Block int `json:"block"`
+}
+
+// Config son los umbrales de las acciones y los parámetros de cada regla. Una
+// regla con puntaje 0 está desactivada. En el archivo JSON basta con escribir
+// lo que cambia respecto a DefaultConfig:
+//
+//	{"thresholds": {"hold": 50}, "donationBurst": {"count": 3, "window": "5m"}}
+type Config struct {
+	Thresholds Thresholds `json:"thresholds"`
+
+	// Varias donaciones desde la misma wallet en poco tiempo.
+	DonationBurst struct {
+		Score  int      `json:"score"`
+		Count  int      `json:"count"`
+		Window Duration `json:"window"`
+	} `json:"donationBurst"`
+
+	// El donante dona a la campaña de alguien que antes le donó a él, o se dona a sí mismo.
+	RoundTrip struct {
+		Score int `json:"score"`
+	} `json:"roundTrip"`
+
+	// Cuentas recién creadas que abren campañas con metas altas.
+	NewAccountHighGoal struct {
+		Score      int      `json:"score"`
+		AccountAge Duration `json:"accountAge"`
+		Goal       float64  `json:"goal"`
+	} `json:"newAccountHighGoal"`
+
+	// Descripciones copiadas de campañas de otros usuarios.
+	DuplicateDescription struct {
+		Score      int     `json:"score"`
+		Similarity float64 `json:"similarity"` // Entre 0 y 1
+	} `json:"duplicateDescription"`
+}
+
+// DefaultConfig devuelve la configuración usada si no hay archivo de reglas.
+func DefaultConfig() Config {
+	var c Config
+	c.Thresholds = Thresholds{Flag: 30, Hold: 60, Block: 90}
+	c.DonationBurst.Score = 40
+	c.DonationBurst.Count = 5
+	c.DonationBurst.Window = Duration{10 * time.Minute}
+	c.RoundTrip.Score = 50
+	c.NewAccountHighGoal.Score = 40
+	c.NewAccountHighGoal.AccountAge = Duration{72 * time.Hour}
+	c.NewAccountHighGoal.Goal = 10000
+	c.DuplicateDescription.Score = 50
+	c.DuplicateDescription.Similarity = 0.8
+	return c
+}
+
+// LoadConfig lee un archivo de reglas JSON sobre la configuración por defecto.
+func LoadConfig(path string) (Config, error) {
+	c := DefaultConfig()
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return c, fmt.Errorf("error al leer el archivo de reglas de riesgo: %w", err)
+	}
+	if err := json.Unmarshal(bytes, &c); err != nil {
+		return c, fmt.Errorf("error al deserializar el archivo de reglas de riesgo: %w", err)
+	}
+	if c.DuplicateDescription.Similarity <= 0 || c.DuplicateDescription.Similarity > 1 {
+		return c, fmt.Errorf("similitud inválida: %v", c.DuplicateDescription.Similarity)
+	}
+	return c, nil
+}
+
+var (
+	mu      sync.RWMutex
+	current = DefaultConfig()
+)
+
+// SetConfig cambia la configuración usada por el motor.
+func SetConfig(c Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = c
+}
+
+func config() Config {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// Action devuelve la acción más severa cuyo umbral alcanza el puntaje.
+func (t Thresholds) Action(score int) string {
+	switch {
+	case t.Block > 0 && score >= t.Block:
+		return model.RiskBlock
+	case t.Hold > 0 && score >= t.Hold:
+		return model.RiskHold
+	case t.Flag > 0 && score >= t.Flag:
+		return model.RiskFlag
+	}
+	return model.RiskNone
+}
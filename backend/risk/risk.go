@@ -0,0 +1,72 @@
+// Package risk puntúa donaciones y campañas con reglas heurísticas para
+// detectar fraude y anomalías. Todo se calcula localmente con los datos de la
+// base de datos; cada regla activada suma puntos y el total decide la acción
+// (flag, hold o block) según los umbrales configurados.
+package risk
+
+import (
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+)
+
+// EvaluateDonation puntúa una donación cuando ya se conoce la wallet del
+// donante. La evaluación no se guarda; ver Record.
+func EvaluateDonation(donation *model.Donation, campaign *model.Campaign) (*model.RiskAssessment, error) {
+	c := config()
+	var signals []model.RiskSignal
+	for _, rule := range []func(Config, *model.Donation, *model.Campaign) (*model.RiskSignal, error){donationBurst, roundTrip} {
+		signal, err := rule(c, donation, campaign)
+		if err != nil {
+			return nil, err
+		}
+		if signal != nil {
+			signals = append(signals, *signal)
+		}
+	}
+	return assess(c, model.RiskSubjectDonation, donation.ID, donation.DonorUserID, signals), nil
+}
+
+// EvaluateCampaign puntúa una campaña antes de crearla, para poder bloquearla.
+// La evaluación no se guarda; ver Record.
+func EvaluateCampaign(campaign *model.Campaign, creator *model.User) (*model.RiskAssessment, error) {
+	c := config()
+	var signals []model.RiskSignal
+	if signal := newAccountHighGoal(c, campaign, creator); signal != nil {
+		signals = append(signals, *signal)
+	}
+	signal, err := duplicateDescription(c, campaign)
+	if err != nil {
+		return nil, err
+	}
+	if signal != nil {
+		signals = append(signals, *signal)
+	}
+	return assess(c, model.RiskSubjectCampaign, campaign.ID, creator.ID, signals), nil
+}
+
+func assess(c Config, subjectType string, subjectID, userID int, signals []model.RiskSignal) *model.RiskAssessment {
+	a := &model.RiskAssessment{
+		SubjectType: subjectType,
+		SubjectID:   subjectID,
+		UserID:      userID,
+		Signals:     signals,
+	}
+	for _, s := range signals {
+		a.Score += s.Score
+	}
+	a.Action = c.Thresholds.Action(a.Score)
+	a.Status = model.RiskOpen
+	if a.Action == model.RiskNone {
+		a.Status = model.RiskLogged
+	}
+	return a
+}
+
+// Record guarda la evaluación si se activó alguna regla. Las evaluaciones sin
+// señales no aportan nada a la cola de revisión y no se guardan.
+func Record(a *model.RiskAssessment) error {
+	if len(a.Signals) == 0 {
+		return nil
+	}
+	return store.SaveRiskAssessment(a)
+}
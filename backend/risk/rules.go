@@ -0,0 +1,167 @@
+package risk
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+)
+
+// Nombres de las reglas, tal como aparecen en las señales guardadas.
+const (
+	RuleDonationBurst        = "donation_burst"
+	RuleRoundTrip            = "round_trip"
+	RuleNewAccountHighGoal   = "new_account_high_goal"
+	RuleDuplicateDescription = "duplicate_description"
+)
+
+// donationBurst se activa si la wallet del donante hizo muchas donaciones en
+// poco tiempo, contando la actual.
+func donationBurst(c Config, donation *model.Donation, _ *model.Campaign) (*model.RiskSignal, error) {
+	rule := c.DonationBurst
+	if rule.Score == 0 || rule.Count <= 0 || donation.DonorWalletAddress == "" {
+		return nil, nil
+	}
+	n, err := store.CountRecentDonationsFromWallet(donation.DonorWalletAddress, rule.Window.Duration)
+	if err != nil {
+		return nil, err
+	}
+	if n < rule.Count {
+		return nil, nil
+	}
+	return &model.RiskSignal{
+		Rule:   RuleDonationBurst,
+		Score:  rule.Score,
+		Reason: fmt.Sprintf("%d donaciones desde %s en los últimos %s", n, donation.DonorWalletAddress, rule.Window.Duration),
+	}, nil
+}
+
+// roundTrip se activa si el donante paga desde una wallet de la propia campaña
+// o de su creador, o si el creador antes le donó a una campaña del donante:
+// dinero que va y vuelve entre las mismas wallets para inflar lo recaudado.
+func roundTrip(c Config, donation *model.Donation, campaign *model.Campaign) (*model.RiskSignal, error) {
+	if c.RoundTrip.Score == 0 || donation.DonorWalletAddress == "" {
+		return nil, nil
+	}
+	creatorWallets := []string{campaign.PaymentPointer}
+	for _, b := range campaign.Beneficiaries {
+		creatorWallets = append(creatorWallets, b.WalletAddress)
+	}
+	creator, err := store.GetUserByID(campaign.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if creator != nil {
+		creatorWallets = append(creatorWallets, creator.WalletAddress)
+	}
+
+	for _, w := range creatorWallets {
+		if w == donation.DonorWalletAddress {
+			return &model.RiskSignal{
+				Rule:   RuleRoundTrip,
+				Score:  c.RoundTrip.Score,
+				Reason: "El donante paga desde una wallet de la propia campaña",
+			}, nil
+		}
+	}
+
+	n, err := store.CountDonationsBetween(creatorWallets, donation.DonorWalletAddress)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	return &model.RiskSignal{
+		Rule:   RuleRoundTrip,
+		Score:  c.RoundTrip.Score,
+		Reason: fmt.Sprintf("El creador hizo %d donaciones a campañas de %s", n, donation.DonorWalletAddress),
+	}, nil
+}
+
+// newAccountHighGoal se activa si una cuenta recién creada abre una campaña
+// con una meta alta. Las cuentas sin fecha de alta no se consideran nuevas.
+func newAccountHighGoal(c Config, campaign *model.Campaign, creator *model.User) *model.RiskSignal {
+	rule := c.NewAccountHighGoal
+	if rule.Score == 0 || creator.CreatedAt == nil || campaign.Goal < rule.Goal {
+		return nil
+	}
+	age := time.Since(*creator.CreatedAt)
+	if age >= rule.AccountAge.Duration {
+		return nil
+	}
+	return &model.RiskSignal{
+		Rule:   RuleNewAccountHighGoal,
+		Score:  rule.Score,
+		Reason: fmt.Sprintf("Cuenta creada hace %s con una meta de %.2f", age.Round(time.Minute), campaign.Goal),
+	}
+}
+
+// duplicateDescription se activa si la descripción se parece demasiado a la de
+// una campaña de otro usuario.
+func duplicateDescription(c Config, campaign *model.Campaign) (*model.RiskSignal, error) {
+	rule := c.DuplicateDescription
+	if rule.Score == 0 {
+		return nil, nil
+	}
+	shingles := shingleSet(campaign.Description)
+	if len(shingles) == 0 {
+		return nil, nil
+	}
+	others, err := store.GetOtherCampaignDescriptions(campaign.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	bestID, best := 0, 0.0
+	for id, description := range others {
+		if id == campaign.ID {
+			continue
+		}
+		if sim := jaccard(shingles, shingleSet(description)); sim > best || (sim == best && id < bestID) {
+			bestID, best = id, sim
+		}
+	}
+	if best < rule.Similarity {
+		return nil, nil
+	}
+	return &model.RiskSignal{
+		Rule:   RuleDuplicateDescription,
+		Score:  rule.Score,
+		Reason: fmt.Sprintf("Descripción %.0f%% igual a la de la campaña %d", best*100, bestID),
+	}, nil
+}
+
+// shingleSize es el número de palabras de cada fragmento que se compara.
+const shingleSize = 3
+
+// shingleSet normaliza un texto (minúsculas, solo letras y números) y lo
+// divide en fragmentos de shingleSize palabras consecutivas. Los textos más
+// cortos que un fragmento no se comparan.
+func shingleSet(text string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	set := map[string]bool{}
+	for i := 0; i+shingleSize <= len(words); i++ {
+		set[strings.Join(words[i:i+shingleSize], " ")] = true
+	}
+	return set
+}
+
+// jaccard es la proporción de fragmentos en común entre dos textos.
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	common := 0
+	for s := range a {
+		if b[s] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// ErrEmailInUse indica que otra cuenta ya verificó ese correo.
+var ErrEmailInUse = errors.New("el correo ya está verificado en otra cuenta")
+
+// GetUserByVerifiedEmail busca la cuenta que verificó un correo.
+func GetUserByVerifiedEmail(email string) (*model.User, error) {
+	return getUser(" WHERE email = ? AND email_verified_at IS NOT NULL", email)
+}
+
+// SetUserEmail cambia el correo de un usuario y lo deja sin verificar.
+func SetUserEmail(id int, email string) error {
+	_, err := DB.Exec("UPDATE users SET email = ?, email_verified_at = NULL WHERE id = ?", email, id)
+	if err != nil {
+		log.Printf("Error al cambiar el correo del usuario: %v", err)
+	}
+	return err
+}
+
+// VerifyUserEmail marca como verificado el correo de un usuario, siempre que
+// siga siendo email. Devuelve false si el usuario cambió de correo o ya lo
+// había verificado, y ErrEmailInUse si otra cuenta lo verificó antes.
+func VerifyUserEmail(id int, email string) (bool, error) {
+	res, err := DB.Exec("UPDATE users SET email_verified_at = CURRENT_TIMESTAMP WHERE id = ? AND email = ? AND email_verified_at IS NULL", id, email)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return false, ErrEmailInUse
+		}
+		log.Printf("Error al verificar el correo del usuario: %v", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// UpdatePassword cambia la contraseña de un usuario y cierra todas sus
+// sesiones menos la de keepToken, que puede ser vacío.
+func UpdatePassword(id int, password, keepToken string) error {
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET password_hash = ? WHERE id = ?", hashedPassword, id); err != nil {
+		log.Printf("Error al cambiar la contraseña del usuario: %v", err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ? AND token_hash != ?", id, hashToken(keepToken)); err != nil {
+		log.Printf("Error al cerrar las sesiones del usuario: %v", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordPasswordResetRequest guarda una solicitud de restablecimiento de
+// contraseña. userID es 0 si el correo no pertenece a ninguna cuenta.
+func RecordPasswordResetRequest(userID int, ip string) error {
+	_, err := DB.Exec("INSERT INTO password_reset_requests (user_id, ip) VALUES (?, ?)", userID, ip)
+	if err != nil {
+		log.Printf("Error al registrar la solicitud de restablecimiento: %v", err)
+	}
+	return err
+}
+
+// CountPasswordResetRequestsByUser cuenta las solicitudes para una cuenta en la última ventana.
+func CountPasswordResetRequestsByUser(userID int, window time.Duration) (int, error) {
+	return countPasswordResetRequests("user_id = ?", userID, window)
+}
+
+// CountPasswordResetRequestsByIP cuenta las solicitudes desde una IP en la última ventana.
+func CountPasswordResetRequestsByIP(ip string, window time.Duration) (int, error) {
+	return countPasswordResetRequests("ip = ?", ip, window)
+}
+
+func countPasswordResetRequests(where string, arg any, window time.Duration) (int, error) {
+	var count int
+	err := DB.QueryRow("SELECT COUNT(*) FROM password_reset_requests WHERE "+where+" AND created_at >= datetime('now', ?)",
+		arg, fmt.Sprintf("-%d seconds", int(window.Seconds()))).Scan(&count)
+	if err != nil {
+		log.Printf("Error al contar las solicitudes de restablecimiento: %v", err)
+	}
+	return count, err
+}
@@ -0,0 +1,42 @@
+package store
+
+import (
+	"log"
+
+	"gofundme-backend/model"
+)
+
+// AddAdminAuditEntry agrega una acción al registro de auditoría de administración.
+func AddAdminAuditEntry(entry *model.AdminAuditEntry) error {
+	_, err := DB.Exec(`
+		INSERT INTO admin_audit_log (actor_id, actor_name, method, route, params, body, status_code)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.ActorID, entry.ActorName, entry.Method, entry.Route, entry.Params, entry.Body, entry.StatusCode)
+	if err != nil {
+		log.Printf("Error al escribir el registro de auditoría: %v", err)
+	}
+	return err
+}
+
+// GetAdminAuditLog devuelve las entradas del registro, las más recientes primero.
+func GetAdminAuditLog(limit, offset int) ([]model.AdminAuditEntry, error) {
+	rows, err := DB.Query(`
+		SELECT id, actor_id, actor_name, method, route, params, body, status_code, created_at
+		FROM admin_audit_log ORDER BY id DESC LIMIT ? OFFSET ?`, limit, offset)
+	if err != nil {
+		log.Printf("Error al consultar el registro de auditoría: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []model.AdminAuditEntry{}
+	for rows.Next() {
+		var e model.AdminAuditEntry
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.ActorName, &e.Method, &e.Route, &e.Params, &e.Body, &e.StatusCode, &e.CreatedAt); err != nil {
+			log.Printf("Error al escanear fila de auditoría: %v", err)
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// auditMu serializa las escrituras del log de auditoría para que dos eventos
+// no se encadenen al mismo anterior.
+var auditMu sync.Mutex
+
+// AddAuditEvent agrega un evento al final de la cadena de auditoría y completa
+// su fecha y sus hashes.
+func AddAuditEvent(e *model.AuditEvent) error {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow("SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1").Scan(&e.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error al leer el último evento de auditoría: %v", err)
+		return err
+	}
+	e.CreatedAt = time.Now().UTC()
+	e.Hash = e.ComputeHash()
+
+	res, err := tx.Exec(`
+		INSERT INTO audit_events (action, actor_id, ip, request_id, subject_type, subject_id, before_state, after_state, created_at, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Action, e.ActorID, e.IP, e.RequestID, e.SubjectType, e.SubjectID, string(e.Before), string(e.After),
+		e.CreatedAt.Format(time.RFC3339Nano), e.PrevHash, e.Hash)
+	if err != nil {
+		log.Printf("Error al escribir el evento de auditoría: %v", err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	e.ID = int(id)
+	return nil
+}
+
+const auditEventSelect = `
+	SELECT id, action, actor_id, ip, request_id, subject_type, subject_id, before_state, after_state, created_at, prev_hash, hash
+	FROM audit_events
+`
+
+func scanAuditEvent(row interface{ Scan(...any) error }) (model.AuditEvent, error) {
+	var e model.AuditEvent
+	var before, after, createdAt string
+	err := row.Scan(&e.ID, &e.Action, &e.ActorID, &e.IP, &e.RequestID, &e.SubjectType, &e.SubjectID, &before, &after, &createdAt, &e.PrevHash, &e.Hash)
+	if err != nil {
+		return e, err
+	}
+	if before != "" {
+		e.Before = json.RawMessage(before)
+	}
+	if after != "" {
+		e.After = json.RawMessage(after)
+	}
+	e.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	return e, err
+}
+
+// AuditFilter son los filtros opcionales de la consulta de eventos.
+type AuditFilter struct {
+	Action      string // Acción exacta, o prefijo terminado en "." (p. ej. "refund.")
+	ActorID     int
+	RequestID   string
+	SubjectType string
+	SubjectID   string
+	From, To    time.Time
+	Limit       int
+	Offset      int
+}
+
+// GetAuditEvents devuelve los eventos que cumplen el filtro, los más recientes primero.
+func GetAuditEvents(f AuditFilter) ([]model.AuditEvent, error) {
+	var where []string
+	var args []any
+	if f.Action != "" {
+		if strings.HasSuffix(f.Action, ".") {
+			where = append(where, "action LIKE ?")
+			args = append(args, f.Action+"%")
+		} else {
+			where = append(where, "action = ?")
+			args = append(args, f.Action)
+		}
+	}
+	if f.ActorID != 0 {
+		where = append(where, "actor_id = ?")
+		args = append(args, f.ActorID)
+	}
+	if f.RequestID != "" {
+		where = append(where, "request_id = ?")
+		args = append(args, f.RequestID)
+	}
+	if f.SubjectType != "" {
+		where = append(where, "subject_type = ?")
+		args = append(args, f.SubjectType)
+	}
+	if f.SubjectID != "" {
+		where = append(where, "subject_id = ?")
+		args = append(args, f.SubjectID)
+	}
+	// created_at se guarda en RFC 3339 UTC, que se ordena igual como texto.
+	if !f.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, f.From.UTC().Format(time.RFC3339Nano))
+	}
+	if !f.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, f.To.UTC().Format(time.RFC3339Nano))
+	}
+
+	query := auditEventSelect
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, f.Limit, f.Offset)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		log.Printf("Error al consultar eventos de auditoría: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.AuditEvent{}
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			log.Printf("Error al escanear fila de evento de auditoría: %v", err)
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// AuditChainError indica el primer evento en el que se rompe la cadena.
+type AuditChainError struct {
+	EventID int
+	Reason  string
+}
+
+func (e *AuditChainError) Error() string {
+	return "evento " + strconv.Itoa(e.EventID) + ": " + e.Reason
+}
+
+// VerifyAuditChain recorre los eventos en orden y comprueba que cada uno
+// apunte al hash del anterior y que su hash coincida con su contenido.
+// Devuelve cuántos eventos comprobó y un *AuditChainError si la cadena está
+// rota. Recibe la conexión para poder usarse desde la herramienta de línea de
+// comandos con la base abierta en solo lectura.
+func VerifyAuditChain(db *sql.DB) (int, error) {
+	rows, err := db.Query(auditEventSelect + " ORDER BY id")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	checked := 0
+	prevHash := ""
+	for rows.Next() {
+		e, err := scanAuditEvent(rows)
+		if err != nil {
+			return checked, fmt.Errorf("error al leer el evento: %w", err)
+		}
+		if e.PrevHash != prevHash {
+			return checked, &AuditChainError{EventID: e.ID, Reason: "no apunta al hash del evento anterior"}
+		}
+		if e.ComputeHash() != e.Hash {
+			return checked, &AuditChainError{EventID: e.ID, Reason: "su contenido no coincide con su hash"}
+		}
+		prevHash = e.Hash
+		checked++
+	}
+	return checked, rows.Err()
+}
@@ -7,12 +7,21 @@ import (
 )
 
 // CreateCampaign inserta una nueva campaña en la base de datos, asociándola a un usuario.
+// Los beneficiarios de la campaña se guardan en la misma transacción.
 func CreateCampaign(campaign model.Campaign) (int, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		log.Printf("Error al iniciar la transacción de creación de campaña: %v", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO campaigns (user_id, title, description, goal, currency, payment_pointer)
-		VALUES (?, ?, ?, ?, ?, ?);
+		INSERT INTO campaigns (user_id, title, description, goal, currency, payment_pointer, escrow, asset_code, asset_scale, auth_server)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 	`
-	res, err := DB.Exec(query, campaign.UserID, campaign.Title, campaign.Description, campaign.Goal, campaign.Currency, campaign.PaymentPointer)
+	res, err := tx.Exec(query, campaign.UserID, campaign.Title, campaign.Description, campaign.Goal, campaign.Currency, campaign.PaymentPointer, campaign.Escrow,
+		campaign.AssetCode, campaign.AssetScale, campaign.AuthServer)
 	if err != nil {
 		log.Printf("Error al ejecutar la consulta de creación de campaña: %v", err)
 		return 0, err
@@ -24,17 +33,110 @@ func CreateCampaign(campaign model.Campaign) (int, error) {
 		return 0, err
 	}
 
+	for _, b := range campaign.Beneficiaries {
+		_, err := tx.Exec("INSERT INTO campaign_beneficiaries (campaign_id, wallet_address, share) VALUES (?, ?, ?)", id, b.WalletAddress, b.Share)
+		if err != nil {
+			log.Printf("Error al insertar beneficiario de la campaña: %v", err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error al confirmar la creación de la campaña: %v", err)
+		return 0, err
+	}
+
 	return int(id), nil
 }
 
+// UpdateCampaignPayout cambia el payment pointer y el reparto de una campaña.
+// Las donaciones ya creadas conservan sus incoming payments.
+func UpdateCampaignPayout(id int, paymentPointer, authServer string, beneficiaries []model.Beneficiary) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE campaigns SET payment_pointer = ?, auth_server = ? WHERE id = ?", paymentPointer, authServer, id); err != nil {
+		log.Printf("Error al cambiar la wallet de la campaña: %v", err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM campaign_beneficiaries WHERE campaign_id = ?", id); err != nil {
+		log.Printf("Error al borrar los beneficiarios de la campaña: %v", err)
+		return err
+	}
+	for _, b := range beneficiaries {
+		_, err := tx.Exec("INSERT INTO campaign_beneficiaries (campaign_id, wallet_address, share) VALUES (?, ?, ?)", id, b.WalletAddress, b.Share)
+		if err != nil {
+			log.Printf("Error al insertar beneficiario de la campaña: %v", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetCampaignBeneficiaries devuelve el reparto de donaciones de una campaña.
+// Las campañas creadas antes de existir los repartos no tienen filas; para
+// ellas se devuelve su payment pointer con el 100%.
+func GetCampaignBeneficiaries(campaign *model.Campaign) ([]model.Beneficiary, error) {
+	rows, err := DB.Query("SELECT wallet_address, share FROM campaign_beneficiaries WHERE campaign_id = ? ORDER BY id", campaign.ID)
+	if err != nil {
+		log.Printf("Error al consultar beneficiarios: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var beneficiaries []model.Beneficiary
+	for rows.Next() {
+		var b model.Beneficiary
+		if err := rows.Scan(&b.WalletAddress, &b.Share); err != nil {
+			log.Printf("Error al escanear fila de beneficiario: %v", err)
+			return nil, err
+		}
+		beneficiaries = append(beneficiaries, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(beneficiaries) == 0 {
+		beneficiaries = []model.Beneficiary{{WalletAddress: campaign.PaymentPointer, Share: 100}}
+	}
+	return beneficiaries, nil
+}
+
+// SetCampaignStatus cambia el estado de moderación de una campaña. Devuelve
+// false si la campaña no existe.
+func SetCampaignStatus(id int, status, reason string) (bool, error) {
+	res, err := DB.Exec("UPDATE campaigns SET status = ?, takedown_reason = ? WHERE id = ?", status, reason, id)
+	if err != nil {
+		log.Printf("Error al cambiar el estado de la campaña: %v", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// campaignSelect es la consulta base para leer campañas junto con el nombre de su creador.
+const campaignSelect = `
+	SELECT c.id, c.user_id, c.title, c.description, c.goal, c.amount_raised, c.currency, c.payment_pointer, c.escrow,
+		c.asset_code, c.asset_scale, c.auth_server, c.verified, c.status, c.takedown_reason, c.created_at, u.username
+	FROM campaigns c
+	JOIN users u ON c.user_id = u.id
+`
+
+// scanCampaign lee una fila producida por campaignSelect.
+func scanCampaign(row interface{ Scan(...any) error }) (model.Campaign, error) {
+	var campaign model.Campaign
+	err := row.Scan(&campaign.ID, &campaign.UserID, &campaign.Title, &campaign.Description, &campaign.Goal, &campaign.AmountRaised, &campaign.Currency, &campaign.PaymentPointer, &campaign.Escrow,
+		&campaign.AssetCode, &campaign.AssetScale, &campaign.AuthServer, &campaign.Verified, &campaign.Status, &campaign.TakedownReason, &campaign.CreatedAt, &campaign.CreatorUsername)
+	return campaign, err
+}
+
 // GetCampaigns recupera todas las campañas de la base de datos
 func GetCampaigns() ([]model.Campaign, error) {
-	query := `
-		SELECT c.id, c.title, c.description, c.goal, c.amount_raised, c.currency, c.payment_pointer, c.created_at, u.username
-		FROM campaigns c
-		JOIN users u ON c.user_id = u.id;
-	`
-	rows, err := DB.Query(query)
+	rows, err := DB.Query(campaignSelect)
 	if err != nil {
 		log.Printf("Error al consultar campañas: %v", err)
 		return nil, err
@@ -43,8 +145,8 @@ func GetCampaigns() ([]model.Campaign, error) {
 
 	var campaigns []model.Campaign
 	for rows.Next() {
-		var campaign model.Campaign
-		if err := rows.Scan(&campaign.ID, &campaign.Title, &campaign.Description, &campaign.Goal, &campaign.AmountRaised, &campaign.Currency, &campaign.PaymentPointer, &campaign.CreatedAt, &campaign.CreatorUsername); err != nil {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
 			log.Printf("Error al escanear fila de campaña: %v", err)
 			return nil, err
 		}
@@ -56,16 +158,8 @@ func GetCampaigns() ([]model.Campaign, error) {
 
 // GetCampaignByID recupera una única campaña por su ID
 func GetCampaignByID(id int) (*model.Campaign, error) {
-	query := `
-		SELECT c.id, c.title, c.description, c.goal, c.amount_raised, c.currency, c.payment_pointer, c.created_at, u.username
-		FROM campaigns c
-		JOIN users u ON c.user_id = u.id
-		WHERE c.id = ?;
-	`
-	row := DB.QueryRow(query, id)
-
-	var campaign model.Campaign
-	if err := row.Scan(&campaign.ID, &campaign.Title, &campaign.Description, &campaign.Goal, &campaign.AmountRaised, &campaign.Currency, &campaign.PaymentPointer, &campaign.CreatedAt, &campaign.CreatorUsername); err != nil {
+	campaign, err := scanCampaign(DB.QueryRow(campaignSelect+" WHERE c.id = ?", id))
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // No encontrado no es un error de aplicación
 		}
@@ -73,20 +167,27 @@ func GetCampaignByID(id int) (*model.Campaign, error) {
 		return nil, err
 	}
 
+	beneficiaries, err := GetCampaignBeneficiaries(&campaign)
+	if err != nil {
+		return nil, err
+	}
+	campaign.Beneficiaries = beneficiaries
+
+	sponsors, err := GetSponsorsByCampaign(campaign.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sponsors {
+		campaign.MatchedTotal += s.MatchedTotal
+		campaign.MatchRemaining += s.RemainingCapacity()
+	}
+
 	return &campaign, nil
 }
 
 func GetCampaignByPaymentPointer(paymentPointer string, db *sql.DB) (*model.Campaign, error) {
-	query := `
-		SELECT c.id, c.title, c.description, c.goal, c.amount_raised, c.currency, c.payment_pointer, c.created_at, u.username
-		FROM campaigns c
-		JOIN users u ON c.user_id = u.id
-		WHERE c.payment_pointer = ?;
-	`
-	row := db.QueryRow(query, paymentPointer)
-
-	var campaign model.Campaign
-	if err := row.Scan(&campaign.ID, &campaign.Title, &campaign.Description, &campaign.Goal, &campaign.AmountRaised, &campaign.Currency, &campaign.PaymentPointer, &campaign.CreatedAt, &campaign.CreatorUsername); err != nil {
+	campaign, err := scanCampaign(db.QueryRow(campaignSelect+" WHERE c.payment_pointer = ?", paymentPointer))
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // No encontrado no es un error de aplicación
 		}
@@ -95,4 +196,4 @@ func GetCampaignByPaymentPointer(paymentPointer string, db *sql.DB) (*model.Camp
 	}
 
 	return &campaign, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,38 @@
+package store
+
+import (
+	"log"
+
+	"gofundme-backend/model"
+)
+
+// SaveChatMessage guarda una pregunta al chatbot y su respuesta.
+func SaveChatMessage(msg *model.ChatMessage) error {
+	_, err := DB.Exec("INSERT INTO chat_messages (user_id, prompt, response, action, url) VALUES (?, ?, ?, ?, ?)",
+		msg.UserID, msg.Prompt, msg.Response, msg.Action, msg.URL)
+	if err != nil {
+		log.Printf("Error al guardar el mensaje del chat: %v", err)
+	}
+	return err
+}
+
+// GetChatMessagesByUser devuelve el historial de chat de un usuario, del más viejo al más nuevo.
+func GetChatMessagesByUser(userID int) ([]model.ChatMessage, error) {
+	rows, err := DB.Query("SELECT id, user_id, prompt, response, action, url, created_at FROM chat_messages WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		log.Printf("Error al consultar el historial de chat: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []model.ChatMessage{}
+	for rows.Next() {
+		var m model.ChatMessage
+		if err := rows.Scan(&m.ID, &m.UserID, &m.Prompt, &m.Response, &m.Action, &m.URL, &m.CreatedAt); err != nil {
+			log.Printf("Error al escanear fila del chat: %v", err)
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
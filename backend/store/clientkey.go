@@ -0,0 +1,109 @@
+package store
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// CreateClientKey guarda una llave de cliente de Open Payments. La llave
+// privada se cifra antes de llegar a la base de datos.
+func CreateClientKey(key *model.ClientKey, privateKey []byte) error {
+	encrypted, err := sealSecret("client_keys.private_key", string(privateKey))
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("INSERT INTO client_keys (kid, wallet_address, public_key, private_key, created_at, active_from) VALUES (?, ?, ?, ?, ?, ?)",
+		key.KeyID, key.WalletAddress, key.PublicKey, encrypted, key.CreatedAt.UTC(), key.ActiveFrom.UTC())
+	if err != nil {
+		log.Printf("Error al guardar la llave de cliente: %v", err)
+	}
+	return err
+}
+
+const clientKeySelect = "SELECT kid, wallet_address, public_key, created_at, active_from, retired_at, revoked_at FROM client_keys"
+
+func scanClientKey(row interface{ Scan(...any) error }) (model.ClientKey, error) {
+	var key model.ClientKey
+	var retiredAt, revokedAt sql.NullTime
+	err := row.Scan(&key.KeyID, &key.WalletAddress, &key.PublicKey, &key.CreatedAt, &key.ActiveFrom, &retiredAt, &revokedAt)
+	if retiredAt.Valid {
+		key.RetiredAt = &retiredAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, err
+}
+
+// GetClientKeys devuelve las llaves de una wallet, las más nuevas primero.
+func GetClientKeys(walletAddress string) ([]model.ClientKey, error) {
+	rows, err := DB.Query(clientKeySelect+" WHERE wallet_address = ? ORDER BY active_from DESC, created_at DESC", walletAddress)
+	if err != nil {
+		log.Printf("Error al consultar las llaves de cliente: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []model.ClientKey{}
+	for rows.Next() {
+		key, err := scanClientKey(rows)
+		if err != nil {
+			log.Printf("Error al escanear fila de llave de cliente: %v", err)
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetClientKey busca una llave por su kid.
+func GetClientKey(kid string) (*model.ClientKey, error) {
+	key, err := scanClientKey(DB.QueryRow(clientKeySelect+" WHERE kid = ?", kid))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error al leer la llave de cliente: %v", err)
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetClientPrivateKey descifra la llave privada de una llave de cliente.
+func GetClientPrivateKey(kid string) ([]byte, error) {
+	var privateKey string
+	if err := DB.QueryRow("SELECT private_key FROM client_keys WHERE kid = ?", kid).Scan(&privateKey); err != nil {
+		log.Printf("Error al leer la llave privada de cliente: %v", err)
+		return nil, err
+	}
+	if err := openSecrets("client_keys.private_key", &privateKey); err != nil {
+		return nil, err
+	}
+	return []byte(privateKey), nil
+}
+
+// RetireClientKeys deja de usar para firmar, a partir de at, las llaves
+// vigentes de una wallet salvo la indicada.
+func RetireClientKeys(walletAddress, exceptKID string, at time.Time) error {
+	_, err := DB.Exec("UPDATE client_keys SET retired_at = ? WHERE wallet_address = ? AND kid != ? AND retired_at IS NULL AND revoked_at IS NULL",
+		at.UTC(), walletAddress, exceptKID)
+	if err != nil {
+		log.Printf("Error al retirar las llaves de cliente: %v", err)
+	}
+	return err
+}
+
+// RevokeClientKey revoca una llave: deja de firmar y de publicarse de
+// inmediato. Devuelve false si no existe o ya estaba revocada.
+func RevokeClientKey(kid string) (bool, error) {
+	res, err := DB.Exec("UPDATE client_keys SET revoked_at = ? WHERE kid = ? AND revoked_at IS NULL", time.Now().UTC(), kid)
+	if err != nil {
+		log.Printf("Error al revocar la llave de cliente: %v", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
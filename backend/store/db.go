@@ -4,6 +4,7 @@ package store
 import (
 	"database/sql"
 	"log"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3" // El driver de SQLite se registra en sql
 )
@@ -13,6 +14,14 @@ var DB *sql.DB
 
 // InitDB inicializa la conexión a la base de datos y crea las tablas necesarias.
 func InitDB(dataSourceName string) {
+	// secure_delete sobrescribe con ceros lo que se borra, para que los secretos
+	// que se vuelven a cifrar no queden en claro en páginas libres del archivo.
+	if strings.Contains(dataSourceName, "?") {
+		dataSourceName += "&_secure_delete=true"
+	} else {
+		dataSourceName += "?_secure_delete=true"
+	}
+
 	var err error
 	DB, err = sql.Open("sqlite3", dataSourceName)
 	if err != nil {
@@ -59,4 +68,739 @@ func createTable() {
 	if err != nil {
 		log.Fatalf("Error al crear la tabla de usuarios: %v", err)
 	}
-}
\ No newline at end of file
+
+	beneficiaryQuery := `
+	CREATE TABLE IF NOT EXISTS campaign_beneficiaries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		campaign_id INTEGER NOT NULL,
+		wallet_address TEXT NOT NULL,
+		share REAL NOT NULL,
+		FOREIGN KEY (campaign_id) REFERENCES campaigns(id)
+	);`
+
+	_, err = DB.Exec(beneficiaryQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de beneficiarios: %v", err)
+	}
+
+	donationQuery := `
+	CREATE TABLE IF NOT EXISTS donations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		campaign_id INTEGER NOT NULL,
+		amount REAL NOT NULL,
+		currency TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'created',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (campaign_id) REFERENCES campaigns(id)
+	);`
+
+	_, err = DB.Exec(donationQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de donaciones: %v", err)
+	}
+
+	splitQuery := `
+	CREATE TABLE IF NOT EXISTS donation_splits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		donation_id INTEGER NOT NULL,
+		wallet_address TEXT NOT NULL,
+		share REAL NOT NULL,
+		amount INTEGER NOT NULL,
+		incoming_payment_id TEXT NOT NULL DEFAULT '',
+		quote_id TEXT NOT NULL DEFAULT '',
+		outgoing_payment_id TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (donation_id) REFERENCES donations(id)
+	);`
+
+	_, err = DB.Exec(splitQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de repartos de donaciones: %v", err)
+	}
+
+	addColumn("campaigns", "escrow", "INTEGER NOT NULL DEFAULT 0")
+	addColumn("campaigns", "asset_code", "TEXT NOT NULL DEFAULT ''")
+	addColumn("campaigns", "asset_scale", "INTEGER NOT NULL DEFAULT 0")
+	addColumn("campaigns", "auth_server", "TEXT NOT NULL DEFAULT ''")
+	addColumn("campaigns", "verified", "INTEGER NOT NULL DEFAULT 0")
+	addColumn("campaigns", "status", "TEXT NOT NULL DEFAULT 'active'")
+	addColumn("campaigns", "takedown_reason", "TEXT NOT NULL DEFAULT ''")
+	addColumn("donations", "original_amount", "REAL NOT NULL DEFAULT 0")
+	addColumn("donations", "original_currency", "TEXT NOT NULL DEFAULT ''")
+	addColumn("donations", "refunded_amount", "REAL NOT NULL DEFAULT 0")
+	addColumn("donations", "donor_wallet_address", "TEXT NOT NULL DEFAULT ''")
+	addColumn("donations", "donor_user_id", "INTEGER NOT NULL DEFAULT 0")
+	addColumn("donations", "completed_at", "DATETIME")
+	addColumn("donations", "status_updated_at", "DATETIME")
+	addColumn("donation_splits", "received_amount", "INTEGER NOT NULL DEFAULT 0")
+	addColumn("donation_splits", "payment_started_at", "DATETIME")
+	addColumn("users", "wallet_asset_code", "TEXT NOT NULL DEFAULT ''")
+	addColumn("users", "wallet_asset_scale", "INTEGER NOT NULL DEFAULT 0")
+	addColumn("users", "wallet_auth_server", "TEXT NOT NULL DEFAULT ''")
+	addColumn("users", "role", "TEXT NOT NULL DEFAULT 'user'")
+	addColumn("users", "suspended_at", "DATETIME")
+	addColumn("users", "suspend_reason", "TEXT NOT NULL DEFAULT ''")
+	addColumn("users", "created_at", "DATETIME")
+	addColumn("users", "email", "TEXT NOT NULL DEFAULT ''")
+	addColumn("users", "email_verified_at", "DATETIME")
+	addColumn("users", "totp_secret", "TEXT NOT NULL DEFAULT ''")
+	addColumn("users", "totp_enabled_at", "DATETIME")
+	addColumn("users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0")
+	addColumn("users", "totp_failures", "INTEGER NOT NULL DEFAULT 0")
+	addColumn("users", "display_name", "TEXT NOT NULL DEFAULT ''")
+	addColumn("users", "bio", "TEXT NOT NULL DEFAULT ''")
+	addColumn("users", "avatar_url", "TEXT NOT NULL DEFAULT ''")
+	addColumn("users", "deletion_requested_at", "DATETIME")
+	addColumn("users", "deleted_at", "DATETIME")
+
+	// Un correo verificado pertenece a una sola cuenta; sin verificar puede
+	// repetirse, para que nadie bloquee el correo de otro.
+	_, err = DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS users_verified_email ON users (email) WHERE email_verified_at IS NOT NULL")
+	if err != nil {
+		log.Fatalf("Error al crear el índice de correos verificados: %v", err)
+	}
+
+	milestoneQuery := `
+	CREATE TABLE IF NOT EXISTS milestones (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		campaign_id INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		description TEXT,
+		target_amount REAL NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		outgoing_payment_id TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		released_at DATETIME,
+		FOREIGN KEY (campaign_id) REFERENCES campaigns(id)
+	);`
+
+	_, err = DB.Exec(milestoneQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de hitos: %v", err)
+	}
+	addColumn("milestones", "release_reserved_at", "DATETIME")
+	addColumn("milestones", "release_started_at", "DATETIME")
+	addColumn("milestones", "release_error", "TEXT NOT NULL DEFAULT ''")
+
+	evidenceQuery := `
+	CREATE TABLE IF NOT EXISTS milestone_evidence (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		milestone_id INTEGER NOT NULL,
+		filename TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		path TEXT NOT NULL,
+		uploaded_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (milestone_id) REFERENCES milestones(id)
+	);`
+
+	_, err = DB.Exec(evidenceQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de evidencias: %v", err)
+	}
+
+	escrowQuery := `
+	CREATE TABLE IF NOT EXISTS escrow_entries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		campaign_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		amount REAL NOT NULL,
+		donation_id INTEGER,
+		milestone_id INTEGER,
+		outgoing_payment_id TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (campaign_id) REFERENCES campaigns(id)
+	);`
+
+	_, err = DB.Exec(escrowQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla del escrow: %v", err)
+	}
+
+	sponsorQuery := `
+	CREATE TABLE IF NOT EXISTS sponsors (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		campaign_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		wallet_address TEXT NOT NULL,
+		cap REAL NOT NULL,
+		match_ratio REAL NOT NULL,
+		matched_total REAL NOT NULL DEFAULT 0,
+		status TEXT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		continue_uri TEXT NOT NULL DEFAULT '',
+		continue_token TEXT NOT NULL DEFAULT '',
+		access_token TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (campaign_id) REFERENCES campaigns(id)
+	);`
+
+	_, err = DB.Exec(sponsorQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de patrocinadores: %v", err)
+	}
+	addColumn("sponsors", "user_id", "INTEGER NOT NULL DEFAULT 0") // Quién lo registró; 0 en los anteriores a la sesión obligatoria
+
+	matchQuery := `
+	CREATE TABLE IF NOT EXISTS sponsor_matches (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		sponsor_id INTEGER NOT NULL,
+		donation_id INTEGER NOT NULL,
+		amount REAL NOT NULL,
+		status TEXT NOT NULL,
+		outgoing_payment_id TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (sponsor_id) REFERENCES sponsors(id),
+		FOREIGN KEY (donation_id) REFERENCES donations(id)
+	);`
+
+	_, err = DB.Exec(matchQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de contrapartidas: %v", err)
+	}
+
+	refundQuery := `
+	CREATE TABLE IF NOT EXISTS refunds (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		donation_id INTEGER NOT NULL,
+		campaign_id INTEGER NOT NULL,
+		amount REAL NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		initiated_by TEXT NOT NULL,
+		outgoing_payment_id TEXT NOT NULL DEFAULT '',
+		quote_id TEXT NOT NULL DEFAULT '',
+		continue_uri TEXT NOT NULL DEFAULT '',
+		continue_token TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		completed_at DATETIME,
+		FOREIGN KEY (donation_id) REFERENCES donations(id),
+		FOREIGN KEY (campaign_id) REFERENCES campaigns(id)
+	);`
+
+	_, err = DB.Exec(refundQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de reembolsos: %v", err)
+	}
+
+	refundGrantQuery := `
+	CREATE TABLE IF NOT EXISTS refund_grants (
+		campaign_id INTEGER PRIMARY KEY,
+		status TEXT NOT NULL,
+		expires_at DATETIME NOT NULL,
+		continue_uri TEXT NOT NULL DEFAULT '',
+		continue_token TEXT NOT NULL DEFAULT '',
+		access_token TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (campaign_id) REFERENCES campaigns(id)
+	);`
+
+	_, err = DB.Exec(refundGrantQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de grants de reembolso: %v", err)
+	}
+
+	notificationQuery := `
+	CREATE TABLE IF NOT EXISTS notifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		kind TEXT NOT NULL,
+		message TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		read_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	_, err = DB.Exec(notificationQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de notificaciones: %v", err)
+	}
+	addColumn("notifications", "dedup_key", "TEXT")
+
+	// Los avisos que salen del outbox se crean una sola vez aunque el evento se publique de nuevo.
+	_, err = DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS notifications_dedup ON notifications (user_id, dedup_key)")
+	if err != nil {
+		log.Fatalf("Error al crear el índice de notificaciones: %v", err)
+	}
+
+	verificationQuery := `
+	CREATE TABLE IF NOT EXISTS verification_requests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		campaign_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		full_name TEXT NOT NULL,
+		document_type TEXT NOT NULL,
+		document_number TEXT NOT NULL,
+		notes TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'pending',
+		reason TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		reviewed_at DATETIME,
+		FOREIGN KEY (campaign_id) REFERENCES campaigns(id),
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	_, err = DB.Exec(verificationQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de solicitudes de verificación: %v", err)
+	}
+
+	verificationDocumentQuery := `
+	CREATE TABLE IF NOT EXISTS verification_documents (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		request_id INTEGER NOT NULL,
+		filename TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		path TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (request_id) REFERENCES verification_requests(id)
+	);`
+
+	_, err = DB.Exec(verificationDocumentQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de documentos de verificación: %v", err)
+	}
+
+	sessionQuery := `
+	CREATE TABLE IF NOT EXISTS sessions (
+		token_hash TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	_, err = DB.Exec(sessionQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de sesiones: %v", err)
+	}
+	addColumn("sessions", "two_factor_at", "DATETIME")
+
+	// Historial del chatbot de los usuarios con sesión.
+	chatQuery := `
+	CREATE TABLE IF NOT EXISTS chat_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		prompt TEXT NOT NULL,
+		response TEXT NOT NULL,
+		action TEXT NOT NULL DEFAULT '',
+		url TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	_, err = DB.Exec(chatQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla del chat: %v", err)
+	}
+
+	// Llaves de cliente de Open Payments. private_key está cifrada (ver
+	// secrets.go); public_key son los 32 bytes de la llave Ed25519.
+	clientKeyQuery := `
+	CREATE TABLE IF NOT EXISTS client_keys (
+		kid TEXT PRIMARY KEY,
+		wallet_address TEXT NOT NULL,
+		public_key BLOB NOT NULL,
+		private_key TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		active_from DATETIME NOT NULL,
+		retired_at DATETIME,
+		revoked_at DATETIME
+	);`
+
+	_, err = DB.Exec(clientKeyQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de llaves de cliente: %v", err)
+	}
+
+	// Grants interactivos de donación esperando a que el donante los apruebe,
+	// por la referencia de interacción. continue_token está cifrado.
+	paymentGrantQuery := `
+	CREATE TABLE IF NOT EXISTS payment_grants (
+		interact_ref TEXT PRIMARY KEY,
+		donation_id INTEGER NOT NULL,
+		continue_uri TEXT NOT NULL,
+		continue_token TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (donation_id) REFERENCES donations(id)
+	);`
+
+	_, err = DB.Exec(paymentGrantQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de grants de pago: %v", err)
+	}
+
+	// Webhooks recibidos del servidor de recursos de Open Payments. El id lo
+	// asigna quien envía el evento, así que un reenvío no se procesa dos veces.
+	webhookEventQuery := `
+	CREATE TABLE IF NOT EXISTS webhook_events (
+		id TEXT PRIMARY KEY,
+		type TEXT NOT NULL,
+		data TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at DATETIME,
+		received_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		processed_at DATETIME
+	);`
+
+	_, err = DB.Exec(webhookEventQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de webhooks: %v", err)
+	}
+	_, err = DB.Exec("CREATE INDEX IF NOT EXISTS webhook_events_due ON webhook_events (status, next_attempt_at)")
+	if err != nil {
+		log.Fatalf("Error al crear el índice de webhooks: %v", err)
+	}
+
+	// Endpoints de webhooks de los creadores. events es la lista de eventos
+	// separada por comas y secret está cifrado.
+	webhookEndpointQuery := `
+	CREATE TABLE IF NOT EXISTS webhook_endpoints (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		url TEXT NOT NULL,
+		events TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	_, err = DB.Exec(webhookEndpointQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de endpoints de webhooks: %v", err)
+	}
+
+	webhookDeliveryQuery := `
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		endpoint_id INTEGER NOT NULL,
+		event_id TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_status_code INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		delivered_at DATETIME,
+		FOREIGN KEY (endpoint_id) REFERENCES webhook_endpoints(id)
+	);`
+
+	_, err = DB.Exec(webhookDeliveryQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de entregas de webhooks: %v", err)
+	}
+	_, err = DB.Exec("CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at)")
+	if err != nil {
+		log.Fatalf("Error al crear el índice de entregas de webhooks: %v", err)
+	}
+
+	// Un evento se entrega una sola vez a cada endpoint aunque se publique de nuevo.
+	_, err = DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS webhook_deliveries_event ON webhook_deliveries (endpoint_id, event_id)")
+	if err != nil {
+		log.Fatalf("Error al crear el índice de eventos de webhooks: %v", err)
+	}
+
+	webhookAttemptQuery := `
+	CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		delivery_id INTEGER NOT NULL,
+		attempted_at DATETIME NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		duration_ms INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries(id)
+	);`
+
+	_, err = DB.Exec(webhookAttemptQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de intentos de entrega: %v", err)
+	}
+
+	// Cola de trabajos en segundo plano
+	jobQuery := `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		type TEXT NOT NULL,
+		payload TEXT NOT NULL DEFAULT '{}',
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		max_attempts INTEGER NOT NULL,
+		last_error TEXT NOT NULL DEFAULT '',
+		run_at DATETIME NOT NULL,
+		locked_until DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME
+	);`
+
+	_, err = DB.Exec(jobQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de trabajos: %v", err)
+	}
+
+	_, err = DB.Exec("CREATE INDEX IF NOT EXISTS jobs_due ON jobs (type, status, run_at)")
+	if err != nil {
+		log.Fatalf("Error al crear el índice de trabajos: %v", err)
+	}
+
+	// Outbox: eventos guardados junto con el cambio de estado que los produce,
+	// pendientes de publicar.
+	outboxQuery := `
+	CREATE TABLE IF NOT EXISTS outbox (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		topic TEXT NOT NULL,
+		dedup_key TEXT NOT NULL UNIQUE,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		available_at DATETIME NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		published_at DATETIME
+	);`
+
+	_, err = DB.Exec(outboxQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla del outbox: %v", err)
+	}
+
+	_, err = DB.Exec("CREATE INDEX IF NOT EXISTS outbox_pending ON outbox (status, available_at)")
+	if err != nil {
+		log.Fatalf("Error al crear el índice del outbox: %v", err)
+	}
+
+	// Claves de idempotencia de las peticiones que mueven dinero, con la
+	// respuesta que se devolvió para repetirla.
+	idempotencyQuery := `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scope TEXT NOT NULL,
+		key TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		content_type TEXT NOT NULL DEFAULT '',
+		response_body BLOB,
+		locked_until DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (scope, key)
+	);`
+
+	_, err = DB.Exec(idempotencyQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de claves de idempotencia: %v", err)
+	}
+
+	// Historial de cambios de estado de las donaciones.
+	donationTransitionQuery := `
+	CREATE TABLE IF NOT EXISTS donation_transitions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		donation_id INTEGER NOT NULL,
+		from_status TEXT NOT NULL DEFAULT '',
+		to_status TEXT NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (donation_id) REFERENCES donations(id)
+	);`
+
+	_, err = DB.Exec(donationTransitionQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de cambios de estado de donaciones: %v", err)
+	}
+
+	_, err = DB.Exec("CREATE INDEX IF NOT EXISTS donation_transitions_donation ON donation_transitions (donation_id)")
+	if err != nil {
+		log.Fatalf("Error al crear el índice de cambios de estado de donaciones: %v", err)
+	}
+
+	// Las donaciones de versiones anteriores estaban todas "pending" hasta
+	// terminar. Se les asigna el paso del pago en que quedaron según lo que
+	// tienen guardado.
+	_, err = DB.Exec(`
+		UPDATE donations SET status = CASE
+			WHEN EXISTS (SELECT 1 FROM donation_splits s WHERE s.donation_id = donations.id AND (s.outgoing_payment_id != '' OR s.payment_started_at IS NOT NULL)) THEN 'sending'
+			WHEN EXISTS (SELECT 1 FROM payment_grants g WHERE g.donation_id = donations.id) THEN 'awaiting_approval'
+			WHEN EXISTS (SELECT 1 FROM donation_splits s WHERE s.donation_id = donations.id AND s.quote_id != '') THEN 'quoted'
+			ELSE 'created'
+		END
+		WHERE status = 'pending'`)
+	if err != nil {
+		log.Fatalf("Error al migrar los estados de las donaciones: %v", err)
+	}
+	_, err = DB.Exec("UPDATE donations SET status_updated_at = COALESCE(completed_at, created_at) WHERE status_updated_at IS NULL")
+	if err != nil {
+		log.Fatalf("Error al migrar los estados de las donaciones: %v", err)
+	}
+
+	// Los usuarios con campañas creadas antes de los roles pasan a creator para
+	// seguir gestionándolas.
+	_, err = DB.Exec("UPDATE users SET role = 'creator' WHERE role = 'user' AND id IN (SELECT user_id FROM campaigns)")
+	if err != nil {
+		log.Fatalf("Error al migrar los roles de los creadores: %v", err)
+	}
+
+	// Intentos fallidos de inicio de sesión por usuario y por IP.
+	loginAttemptQuery := `
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		kind TEXT NOT NULL,
+		key TEXT NOT NULL,
+		failures INTEGER NOT NULL DEFAULT 0,
+		last_failure_at DATETIME NOT NULL,
+		locked_until DATETIME,
+		PRIMARY KEY (kind, key)
+	);`
+
+	_, err = DB.Exec(loginAttemptQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de intentos de inicio de sesión: %v", err)
+	}
+
+	// Códigos de recuperación de la verificación en dos pasos. Solo se guarda
+	// su hash y cada uno sirve una vez.
+	recoveryCodeQuery := `
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		used_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	);`
+
+	_, err = DB.Exec(recoveryCodeQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de códigos de recuperación: %v", err)
+	}
+
+	// Solicitudes de restablecimiento de contraseña, para limitarlas por
+	// cuenta y por IP. user_id es 0 si el correo no era de ninguna cuenta.
+	passwordResetQuery := `
+	CREATE TABLE IF NOT EXISTS password_reset_requests (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL DEFAULT 0,
+		ip TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	_, err = DB.Exec(passwordResetQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de solicitudes de restablecimiento: %v", err)
+	}
+
+	// Cada usuario puede denunciar una misma campaña una sola vez.
+	reportQuery := `
+	CREATE TABLE IF NOT EXISTS campaign_reports (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		campaign_id INTEGER NOT NULL,
+		reporter_id INTEGER NOT NULL,
+		category TEXT NOT NULL,
+		details TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT 'open',
+		resolution TEXT NOT NULL DEFAULT '',
+		resolved_by INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		resolved_at DATETIME,
+		UNIQUE (campaign_id, reporter_id),
+		FOREIGN KEY (campaign_id) REFERENCES campaigns(id),
+		FOREIGN KEY (reporter_id) REFERENCES users(id)
+	);`
+
+	_, err = DB.Exec(reportQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de denuncias: %v", err)
+	}
+
+	riskQuery := `
+	CREATE TABLE IF NOT EXISTS risk_assessments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		subject_type TEXT NOT NULL,
+		subject_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL DEFAULT 0,
+		score INTEGER NOT NULL,
+		action TEXT NOT NULL,
+		signals TEXT NOT NULL,
+		status TEXT NOT NULL,
+		reviewed_by INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		reviewed_at DATETIME
+	);`
+
+	_, err = DB.Exec(riskQuery)
+	if err != nil {
+		log.Fatalf("Error al crear la tabla de evaluaciones de riesgo: %v", err)
+	}
+
+	// El registro de auditoría de administración solo admite inserciones.
+	adminAuditQuery := `
+	CREATE TABLE IF NOT EXISTS admin_audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor_id INTEGER NOT NULL,
+		actor_name TEXT NOT NULL,
+		method TEXT NOT NULL,
+		route TEXT NOT NULL,
+		params TEXT NOT NULL DEFAULT '{}',
+		body TEXT NOT NULL DEFAULT '',
+		status_code INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TRIGGER IF NOT EXISTS admin_audit_log_no_update BEFORE UPDATE ON admin_audit_log
+	BEGIN SELECT RAISE(ABORT, 'el registro de auditoría es inmutable'); END;
+	CREATE TRIGGER IF NOT EXISTS admin_audit_log_no_delete BEFORE DELETE ON admin_audit_log
+	BEGIN SELECT RAISE(ABORT, 'el registro de auditoría es inmutable'); END;`
+
+	_, err = DB.Exec(adminAuditQuery)
+	if err != nil {
+		log.Fatalf("Error al crear el registro de auditoría: %v", err)
+	}
+
+	// Eventos de auditoría encadenados por hash. Como el registro de
+	// administración, solo admiten inserciones.
+	auditEventQuery := `
+	CREATE TABLE IF NOT EXISTS audit_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		action TEXT NOT NULL,
+		actor_id INTEGER NOT NULL DEFAULT 0,
+		ip TEXT NOT NULL DEFAULT '',
+		request_id TEXT NOT NULL DEFAULT '',
+		subject_type TEXT NOT NULL DEFAULT '',
+		subject_id TEXT NOT NULL DEFAULT '',
+		before_state TEXT NOT NULL DEFAULT '',
+		after_state TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		prev_hash TEXT NOT NULL,
+		hash TEXT NOT NULL UNIQUE
+	);
+	CREATE INDEX IF NOT EXISTS audit_events_subject ON audit_events (subject_type, subject_id);
+	CREATE TRIGGER IF NOT EXISTS audit_events_no_update BEFORE UPDATE ON audit_events
+	BEGIN SELECT RAISE(ABORT, 'el log de auditoría es inmutable'); END;
+	CREATE TRIGGER IF NOT EXISTS audit_events_no_delete BEFORE DELETE ON audit_events
+	BEGIN SELECT RAISE(ABORT, 'el log de auditoría es inmutable'); END;`
+
+	_, err = DB.Exec(auditEventQuery)
+	if err != nil {
+		log.Fatalf("Error al crear el log de auditoría: %v", err)
+	}
+}
+
+// addColumn agrega una columna a una tabla existente si todavía no la tiene,
+// para que las bases de datos creadas con versiones anteriores sigan funcionando.
+func addColumn(table, column, definition string) {
+	rows, err := DB.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		log.Fatalf("Error al leer las columnas de %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Fatalf("Error al leer las columnas de %s: %v", table, err)
+		}
+		if name == column {
+			return
+		}
+	}
+
+	if _, err := DB.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition); err != nil {
+		log.Fatalf("Error al agregar la columna %s.%s: %v", table, column, err)
+	}
+}
@@ -0,0 +1,174 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// RequestAccountDeletion programa el borrado de una cuenta. Devuelve false si
+// la cuenta no existe, ya estaba programada o ya se borró.
+func RequestAccountDeletion(id int) (bool, error) {
+	res, err := DB.Exec("UPDATE users SET deletion_requested_at = CURRENT_TIMESTAMP WHERE id = ? AND deletion_requested_at IS NULL AND deleted_at IS NULL", id)
+	if err != nil {
+		log.Printf("Error al programar el borrado de la cuenta: %v", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// CancelAccountDeletion cancela un borrado programado que todavía no se hizo.
+func CancelAccountDeletion(id int) (bool, error) {
+	res, err := DB.Exec("UPDATE users SET deletion_requested_at = NULL WHERE id = ? AND deletion_requested_at IS NOT NULL AND deleted_at IS NULL", id)
+	if err != nil {
+		log.Printf("Error al cancelar el borrado de la cuenta: %v", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// GetUsersDueForDeletion devuelve los IDs de las cuentas cuyo borrado se pidió
+// hace más de grace.
+func GetUsersDueForDeletion(grace time.Duration) ([]int, error) {
+	rows, err := DB.Query("SELECT id FROM users WHERE deletion_requested_at IS NOT NULL AND deleted_at IS NULL AND deletion_requested_at <= datetime('now', ?)",
+		fmt.Sprintf("-%d seconds", int(grace.Seconds())))
+	if err != nil {
+		log.Printf("Error al consultar las cuentas por borrar: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AnonymizeUser borra los datos personales de una cuenta. Las donaciones, los
+// reembolsos y las campañas se conservan porque forman parte del ledger, pero
+// las campañas se retiran y la cuenta queda sin nombre, wallet ni contraseña.
+// Los logs de auditoría son inmutables y tampoco se tocan. Los patrocinios de
+// la cuenta se revocan y los grants de reembolso de sus campañas se borran,
+// junto con los tokens que guardaban. Devuelve las rutas de los documentos de
+// verificación y de las evidencias de hitos que hay que borrar del disco.
+func AnonymizeUser(id int) ([]string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var username string
+	if err := tx.QueryRow("SELECT username FROM users WHERE id = ?", id).Scan(&username); err != nil {
+		log.Printf("Error al leer la cuenta por borrar: %v", err)
+		return nil, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT d.path FROM verification_documents d
+		JOIN verification_requests v ON d.request_id = v.id
+		JOIN campaigns c ON v.campaign_id = c.id
+		WHERE c.user_id = ?
+		UNION ALL
+		SELECT e.path FROM milestone_evidence e
+		JOIN milestones m ON e.milestone_id = m.id
+		JOIN campaigns c ON m.campaign_id = c.id
+		WHERE c.user_id = ?`, id, id)
+	if err != nil {
+		log.Printf("Error al consultar los archivos de las campañas: %v", err)
+		return nil, err
+	}
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+	rows.Close()
+
+	statements := []struct {
+		query string
+		args  []any
+	}{
+		{`UPDATE users SET username = ?, password_hash = '', wallet_address = '', wallet_asset_code = '', wallet_asset_scale = 0, wallet_auth_server = '',
+			email = '', email_verified_at = NULL, display_name = '', bio = '', avatar_url = '',
+			totp_secret = '', totp_enabled_at = NULL, totp_last_step = 0, totp_failures = 0, suspend_reason = '',
+			deleted_at = CURRENT_TIMESTAMP WHERE id = ?`, []any{fmt.Sprintf("deleted-%d-%s", id, hex.EncodeToString(suffix)), id}},
+		{"UPDATE campaigns SET status = ?, takedown_reason = ? WHERE user_id = ? AND status != ?", []any{model.CampaignTakenDown, "El creador eliminó su cuenta", id, model.CampaignTakenDown}},
+		{`DELETE FROM verification_documents WHERE request_id IN (
+			SELECT v.id FROM verification_requests v JOIN campaigns c ON v.campaign_id = c.id WHERE c.user_id = ?)`, []any{id}},
+		{`DELETE FROM milestone_evidence WHERE milestone_id IN (
+			SELECT m.id FROM milestones m JOIN campaigns c ON m.campaign_id = c.id WHERE c.user_id = ?)`, []any{id}},
+		{"UPDATE sponsors SET status = ?, continue_uri = '', continue_token = '', access_token = '' WHERE user_id = ?", []any{model.SponsorRevoked, id}},
+		{"DELETE FROM refund_grants WHERE campaign_id IN (SELECT id FROM campaigns WHERE user_id = ?)", []any{id}},
+		{"DELETE FROM sessions WHERE user_id = ?", []any{id}},
+		{"DELETE FROM recovery_codes WHERE user_id = ?", []any{id}},
+		{"DELETE FROM notifications WHERE user_id = ?", []any{id}},
+		{"DELETE FROM chat_messages WHERE user_id = ?", []any{id}},
+		{"DELETE FROM password_reset_requests WHERE user_id = ?", []any{id}},
+		{`DELETE FROM webhook_delivery_attempts WHERE delivery_id IN (
+			SELECT d.id FROM webhook_deliveries d JOIN webhook_endpoints e ON d.endpoint_id = e.id WHERE e.user_id = ?)`, []any{id}},
+		{"DELETE FROM webhook_deliveries WHERE endpoint_id IN (SELECT id FROM webhook_endpoints WHERE user_id = ?)", []any{id}},
+		{"DELETE FROM webhook_endpoints WHERE user_id = ?", []any{id}},
+		{"DELETE FROM idempotency_keys WHERE scope = ?", []any{fmt.Sprintf("user:%d", id)}},
+		{"DELETE FROM login_attempts WHERE kind = ? AND key = ?", []any{model.LoginKeyUsername, username}},
+	}
+	for _, s := range statements {
+		if _, err := tx.Exec(s.query, s.args...); err != nil {
+			log.Printf("Error al anonimizar la cuenta %d: %v", id, err)
+			return nil, err
+		}
+	}
+	return paths, tx.Commit()
+}
+
+// GetDonationsByDonor devuelve las donaciones hechas por un usuario registrado,
+// las más recientes primero.
+func GetDonationsByDonor(userID int) ([]model.Donation, error) {
+	rows, err := DB.Query("SELECT id FROM donations WHERE donor_user_id = ? ORDER BY id DESC", userID)
+	if err != nil {
+		log.Printf("Error al consultar las donaciones del usuario: %v", err)
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	donations := []model.Donation{}
+	for _, id := range ids {
+		donation, err := GetDonationByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if donation != nil {
+			donations = append(donations, *donation)
+		}
+	}
+	return donations, nil
+}
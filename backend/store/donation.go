@@ -0,0 +1,566 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// ErrDonationNotCompleted indica que la donación no existe o no está completada.
+var ErrDonationNotCompleted = errors.New("la donación no está completada")
+
+// CreateDonation registra una donación recién creada junto con su reparto entre
+// beneficiarios. Asigna los IDs generados a la donación y a cada parte.
+func CreateDonation(donation *model.Donation) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		log.Printf("Error al iniciar la transacción de donación: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO donations (campaign_id, amount, currency, original_amount, original_currency, donor_user_id, status, status_updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+		donation.CampaignID, donation.Amount, donation.Currency, donation.OriginalAmount, donation.OriginalCurrency, donation.DonorUserID, model.DonationCreated)
+	if err != nil {
+		log.Printf("Error al insertar la donación: %v", err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error al obtener el ID de la donación: %v", err)
+		return err
+	}
+	donation.ID = int(id)
+	donation.Status = model.DonationCreated
+	if err := addDonationTransition(tx, donation.ID, "", model.DonationCreated, ""); err != nil {
+		return err
+	}
+
+	for i := range donation.Splits {
+		split := &donation.Splits[i]
+		res, err := tx.Exec(`
+			INSERT INTO donation_splits (donation_id, wallet_address, share, amount, incoming_payment_id)
+			VALUES (?, ?, ?, ?, ?)`,
+			donation.ID, split.WalletAddress, split.Share, split.Amount, split.IncomingPaymentID)
+		if err != nil {
+			log.Printf("Error al insertar el reparto de la donación: %v", err)
+			return err
+		}
+		splitID, err := res.LastInsertId()
+		if err != nil {
+			log.Printf("Error al obtener el ID del reparto: %v", err)
+			return err
+		}
+		split.ID = int(splitID)
+		split.DonationID = donation.ID
+	}
+
+	return tx.Commit()
+}
+
+// GetDonationByID recupera una donación con su reparto.
+func GetDonationByID(id int) (*model.Donation, error) {
+	var donation model.Donation
+	var completedAt sql.NullTime
+	err := DB.QueryRow(`
+		SELECT id, campaign_id, amount, currency, original_amount, original_currency, refunded_amount,
+			donor_wallet_address, donor_user_id, status, status_updated_at, created_at, completed_at
+		FROM donations WHERE id = ?`, id).
+		Scan(&donation.ID, &donation.CampaignID, &donation.Amount, &donation.Currency, &donation.OriginalAmount, &donation.OriginalCurrency, &donation.RefundedAmount,
+			&donation.DonorWalletAddress, &donation.DonorUserID, &donation.Status, &donation.StatusUpdatedAt, &donation.CreatedAt, &completedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No encontrado no es un error de aplicación
+		}
+		log.Printf("Error al escanear fila de donación: %v", err)
+		return nil, err
+	}
+	if completedAt.Valid {
+		donation.CompletedAt = &completedAt.Time
+	}
+
+	splits, err := getDonationSplits(donation.ID)
+	if err != nil {
+		return nil, err
+	}
+	donation.Splits = splits
+	return &donation, nil
+}
+
+// GetDonations devuelve el ledger de donaciones, las más recientes primero,
+// filtrado opcionalmente por campaña (0 = todas) y por estado ("" = todos).
+func GetDonations(campaignID int, status string) ([]model.Donation, error) {
+	rows, err := DB.Query(`
+		SELECT id FROM donations
+		WHERE (? = 0 OR campaign_id = ?) AND (? = '' OR status = ?)
+		ORDER BY id DESC`, campaignID, campaignID, status, status)
+	if err != nil {
+		log.Printf("Error al consultar el ledger de donaciones: %v", err)
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	donations := []model.Donation{}
+	for _, id := range ids {
+		donation, err := GetDonationByID(id)
+		if err != nil {
+			return nil, err
+		}
+		if donation != nil {
+			donations = append(donations, *donation)
+		}
+	}
+	return donations, nil
+}
+
+// GetDonationByIncomingPaymentID busca la donación a la que pertenece un
+// incoming payment por su URL completa.
+func GetDonationByIncomingPaymentID(incomingPaymentID string) (*model.Donation, error) {
+	return getDonationBySplitPayment("incoming_payment_id", incomingPaymentID, false)
+}
+
+// GetDonationByIncomingPaymentRef es como GetDonationByIncomingPaymentID pero
+// también acepta solo el último segmento de la URL, que es lo que mandan los
+// webhooks de Rafiki. Úsese solo con webhooks cuya firma ya se verificó.
+func GetDonationByIncomingPaymentRef(ref string) (*model.Donation, error) {
+	return getDonationBySplitPayment("incoming_payment_id", ref, true)
+}
+
+// GetDonationByOutgoingPaymentRef busca la donación a la que pertenece un
+// outgoing payment, por su URL o por su último segmento como en
+// GetDonationByIncomingPaymentRef.
+func GetDonationByOutgoingPaymentRef(ref string) (*model.Donation, error) {
+	return getDonationBySplitPayment("outgoing_payment_id", ref, true)
+}
+
+// likeEscaper escapa los comodines de LIKE para usarlos con ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// getDonationBySplitPayment busca una donación por el ID de uno de los pagos
+// de su reparto. Con suffix también acepta el último segmento de la URL.
+func getDonationBySplitPayment(column, paymentID string, suffix bool) (*model.Donation, error) {
+	if paymentID == "" {
+		return nil, nil
+	}
+	query := "SELECT donation_id FROM donation_splits WHERE " + column + " = ?"
+	args := []any{paymentID}
+	if suffix && !strings.Contains(paymentID, "/") {
+		query += " OR " + column + ` LIKE ? ESCAPE '\'`
+		args = append(args, "%/"+likeEscaper.Replace(paymentID))
+	}
+	var donationID int
+	err := DB.QueryRow(query, args...).Scan(&donationID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error al buscar la donación por %s: %v", column, err)
+		return nil, err
+	}
+	return GetDonationByID(donationID)
+}
+
+// SetSplitReceived guarda lo que el incoming payment de una parte recibió, en
+// unidades mínimas del activo.
+func SetSplitReceived(splitID int, received int64) error {
+	_, err := DB.Exec("UPDATE donation_splits SET received_amount = ? WHERE id = ?", received, splitID)
+	if err != nil {
+		log.Printf("Error al guardar lo recibido por el reparto: %v", err)
+	}
+	return err
+}
+
+func getDonationSplits(donationID int) ([]model.DonationSplit, error) {
+	rows, err := DB.Query(`
+		SELECT id, donation_id, wallet_address, share, amount, incoming_payment_id, quote_id, outgoing_payment_id, received_amount, payment_started_at
+		FROM donation_splits WHERE donation_id = ? ORDER BY id`, donationID)
+	if err != nil {
+		log.Printf("Error al consultar el reparto de la donación: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var splits []model.DonationSplit
+	for rows.Next() {
+		var s model.DonationSplit
+		var startedAt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.DonationID, &s.WalletAddress, &s.Share, &s.Amount, &s.IncomingPaymentID, &s.QuoteID, &s.OutgoingPaymentID, &s.ReceivedAmount, &startedAt); err != nil {
+			log.Printf("Error al escanear fila de reparto: %v", err)
+			return nil, err
+		}
+		if startedAt.Valid {
+			s.PaymentStartedAt = &startedAt.Time
+		}
+		splits = append(splits, s)
+	}
+	return splits, rows.Err()
+}
+
+// SetSplitQuote guarda la quote creada para una parte de la donación.
+func SetSplitQuote(splitID int, quoteID string) error {
+	_, err := DB.Exec("UPDATE donation_splits SET quote_id = ? WHERE id = ?", quoteID, splitID)
+	if err != nil {
+		log.Printf("Error al guardar la quote del reparto: %v", err)
+	}
+	return err
+}
+
+// StartSplitPayment registra que se va a pedir el outgoing payment de una
+// parte de la donación. Se guarda antes de la llamada remota para que, si el
+// proceso muere antes de guardar el pago, la conciliación sepa que pudo crearse.
+func StartSplitPayment(splitID int) error {
+	_, err := DB.Exec("UPDATE donation_splits SET payment_started_at = ? WHERE id = ?", time.Now().UTC(), splitID)
+	if err != nil {
+		log.Printf("Error al registrar el inicio del pago del reparto: %v", err)
+	}
+	return err
+}
+
+// SetSplitOutgoingPayment guarda el outgoing payment que pagó una parte de la donación.
+func SetSplitOutgoingPayment(splitID int, outgoingPaymentID string) error {
+	_, err := DB.Exec("UPDATE donation_splits SET outgoing_payment_id = ? WHERE id = ?", outgoingPaymentID, splitID)
+	if err != nil {
+		log.Printf("Error al guardar el outgoing payment del reparto: %v", err)
+	}
+	return err
+}
+
+// SetDonationDebit guarda la wallet del donante y lo que realmente se debitará de
+// ella según las quotes, en el activo de esa wallet.
+func SetDonationDebit(id int, walletAddress string, amount float64, currency string) error {
+	_, err := DB.Exec("UPDATE donations SET donor_wallet_address = ?, original_amount = ?, original_currency = ? WHERE id = ?",
+		walletAddress, amount, currency, id)
+	if err != nil {
+		log.Printf("Error al guardar el monto original de la donación: %v", err)
+	}
+	return err
+}
+
+// GetDonationBreakdown agrupa las donaciones completadas de una campaña por el
+// activo con el que pagó el donante, descontando lo ya reembolsado.
+func GetDonationBreakdown(campaignID int) ([]model.AssetTotal, error) {
+	rows, err := DB.Query(`
+		SELECT COALESCE(NULLIF(original_currency, ''), currency) AS asset,
+			SUM((CASE WHEN original_currency = '' THEN amount ELSE original_amount END) * (amount - refunded_amount) / amount),
+			SUM(amount - refunded_amount), COUNT(*)
+		FROM donations
+		WHERE campaign_id = ? AND status IN (?, ?)
+		GROUP BY asset
+		ORDER BY asset`, campaignID, model.DonationCompleted, model.DonationPartiallyRefunded)
+	if err != nil {
+		log.Printf("Error al agrupar donaciones por activo: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := []model.AssetTotal{}
+	for rows.Next() {
+		var t model.AssetTotal
+		if err := rows.Scan(&t.AssetCode, &t.Amount, &t.Converted, &t.Count); err != nil {
+			log.Printf("Error al escanear el total por activo: %v", err)
+			return nil, err
+		}
+		breakdown = append(breakdown, t)
+	}
+	return breakdown, rows.Err()
+}
+
+// TransitionDonation cambia el estado de una donación y lo deja en su
+// historial con reason. Devuelve false sin cambiar nada si la donación no
+// existe o no puede pasar de su estado actual a to.
+func TransitionDonation(id int, to, reason string) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	changed, err := transitionDonation(tx, id, to, reason)
+	if err != nil || !changed {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// transitionDonation es TransitionDonation dentro de una transacción. Todos
+// los cambios de estado de una donación pasan por aquí, que es donde se
+// validan contra model.CanTransitionDonation.
+func transitionDonation(tx *sql.Tx, id int, to, reason string) (bool, error) {
+	var from string
+	if err := tx.QueryRow("SELECT status FROM donations WHERE id = ?", id).Scan(&from); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		log.Printf("Error al leer el estado de la donación: %v", err)
+		return false, err
+	}
+	if !model.CanTransitionDonation(from, to) {
+		return false, nil
+	}
+
+	res, err := tx.Exec(`
+		UPDATE donations SET status = ?, status_updated_at = CURRENT_TIMESTAMP,
+			completed_at = CASE WHEN ? = ? THEN CURRENT_TIMESTAMP ELSE completed_at END
+		WHERE id = ? AND status = ?`,
+		to, to, model.DonationCompleted, id, from)
+	if err != nil {
+		log.Printf("Error al actualizar el estado de la donación: %v", err)
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil // Otro la cambió antes
+	}
+	return true, addDonationTransition(tx, id, from, to, reason)
+}
+
+func addDonationTransition(tx *sql.Tx, donationID int, from, to, reason string) error {
+	_, err := tx.Exec("INSERT INTO donation_transitions (donation_id, from_status, to_status, reason) VALUES (?, ?, ?, ?)",
+		donationID, from, to, reason)
+	if err != nil {
+		log.Printf("Error al guardar el cambio de estado de la donación: %v", err)
+	}
+	return err
+}
+
+// GetDonationTransitions devuelve el historial de estados de una donación, del
+// más antiguo al más reciente.
+func GetDonationTransitions(donationID int) ([]model.DonationTransition, error) {
+	rows, err := DB.Query(`
+		SELECT id, donation_id, from_status, to_status, reason, created_at
+		FROM donation_transitions WHERE donation_id = ? ORDER BY id`, donationID)
+	if err != nil {
+		log.Printf("Error al consultar el historial de la donación: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	transitions := []model.DonationTransition{}
+	for rows.Next() {
+		var t model.DonationTransition
+		if err := rows.Scan(&t.ID, &t.DonationID, &t.From, &t.To, &t.Reason, &t.CreatedAt); err != nil {
+			log.Printf("Error al escanear fila del historial de la donación: %v", err)
+			return nil, err
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions, rows.Err()
+}
+
+// ExpireStaleDonations marca como vencidas las donaciones que llevan más de
+// ttl sin avanzar antes de que el donante apruebe el pago, y borra sus grants
+// para que ya no se puedan continuar. Devuelve cuántas venció.
+func ExpireStaleDonations(ttl time.Duration) (int, error) {
+	rows, err := DB.Query("SELECT id FROM donations WHERE status IN (?, ?, ?) AND status_updated_at <= datetime('now', ?)",
+		model.DonationCreated, model.DonationQuoted, model.DonationAwaitingApproval, fmt.Sprintf("-%d seconds", int(ttl.Seconds())))
+	if err != nil {
+		log.Printf("Error al consultar las donaciones sin terminar: %v", err)
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	expired := 0
+	for _, id := range ids {
+		ok, err := expireDonation(id)
+		if err != nil {
+			return expired, err
+		}
+		if ok {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+func expireDonation(id int) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	expired, err := transitionDonation(tx, id, model.DonationExpired, "el donante no terminó el pago a tiempo")
+	if err != nil || !expired {
+		return false, err
+	}
+	if _, err := tx.Exec("DELETE FROM payment_grants WHERE donation_id = ?", id); err != nil {
+		log.Printf("Error al borrar los grants de la donación vencida: %v", err)
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// CompleteDonation confirma una donación en curso: la marca como completada,
+// suma su monto a lo recaudado y, si la campaña usa escrow, lo deposita ahí.
+// Los avisos de la donación completada quedan en el outbox. Devuelve false
+// sin cambiar nada si la donación ya no estaba en curso, así que se puede
+// llamar desde el flujo de pago y desde los webhooks sin contar dos veces la
+// misma donación.
+func CompleteDonation(id int) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	completed, err := transitionDonation(tx, id, model.DonationCompleted, "")
+	if err != nil || !completed {
+		return false, err
+	}
+
+	var campaignID int
+	var amount float64
+	var escrow bool
+	err = tx.QueryRow("SELECT d.campaign_id, d.amount, c.escrow FROM donations d JOIN campaigns c ON c.id = d.campaign_id WHERE d.id = ?", id).
+		Scan(&campaignID, &amount, &escrow)
+	if err != nil {
+		log.Printf("Error al leer la donación completada: %v", err)
+		return false, err
+	}
+	if _, err := tx.Exec("UPDATE campaigns SET amount_raised = amount_raised + ? WHERE id = ?", amount, campaignID); err != nil {
+		log.Printf("Error al actualizar el monto recaudado: %v", err)
+		return false, err
+	}
+	if escrow {
+		if _, err := tx.Exec("INSERT INTO escrow_entries (campaign_id, kind, amount, donation_id) VALUES (?, ?, ?, ?)",
+			campaignID, model.EscrowDeposit, amount, id); err != nil {
+			log.Printf("Error al registrar el depósito en escrow: %v", err)
+			return false, err
+		}
+	}
+
+	event := model.DonationCompletedEvent{DonationID: id, CampaignID: campaignID, Amount: amount}
+	if err := tx.QueryRow("SELECT amount_raised FROM campaigns WHERE id = ?", campaignID).Scan(&event.AmountRaised); err != nil {
+		return false, err
+	}
+	if err := addOutbox(tx, model.OutboxDonationCompleted, fmt.Sprintf("donation.completed:%d", id), event); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ReverseDonation revierte una donación completada en una sola transacción: la
+// marca como revertida, descuenta su monto de lo recaudado por la campaña, lo
+// saca del escrow si la campaña lo usa y revierte las contrapartidas de los
+// patrocinadores. reason queda en el historial de la donación.
+func ReverseDonation(id int, reason string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reversed, err := transitionDonation(tx, id, model.DonationReversed, reason)
+	if err != nil {
+		return err
+	}
+	if !reversed {
+		return ErrDonationNotCompleted
+	}
+	var campaignID int
+	var amount float64
+	var escrow bool
+	err = tx.QueryRow("SELECT d.campaign_id, d.amount, c.escrow FROM donations d JOIN campaigns c ON c.id = d.campaign_id WHERE d.id = ?", id).
+		Scan(&campaignID, &amount, &escrow)
+	if err != nil {
+		log.Printf("Error al leer la donación a revertir: %v", err)
+		return err
+	}
+	if _, err := tx.Exec("UPDATE campaigns SET amount_raised = amount_raised - ? WHERE id = ?", amount, campaignID); err != nil {
+		log.Printf("Error al descontar la donación revertida: %v", err)
+		return err
+	}
+	if escrow {
+		if _, err := tx.Exec("INSERT INTO escrow_entries (campaign_id, kind, amount, donation_id) VALUES (?, ?, ?, ?)",
+			campaignID, model.EscrowReversal, amount, id); err != nil {
+			log.Printf("Error al registrar la reversión en el escrow: %v", err)
+			return err
+		}
+	}
+	if err := reverseSponsorMatches(tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SavePaymentGrant guarda el grant interactivo de una donación hasta que el
+// donante vuelva de aprobarlo. El continue token se guarda cifrado.
+func SavePaymentGrant(grant *model.PaymentGrant) error {
+	continueToken, err := sealSecret("payment_grants.continue_token", grant.ContinueToken)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("INSERT INTO payment_grants (interact_ref, donation_id, continue_uri, continue_token) VALUES (?, ?, ?, ?)",
+		grant.InteractRef, grant.DonationID, grant.ContinueURI, continueToken)
+	if err != nil {
+		log.Printf("Error al guardar el grant de pago: %v", err)
+	}
+	return err
+}
+
+// TakePaymentGrant devuelve y borra el grant guardado con la referencia de
+// interacción, para que solo se pueda continuar una vez. En la misma
+// transacción deja en el outbox que hay que conciliar la donación, por si el
+// pago no termina. Devuelve nil si no existe.
+func TakePaymentGrant(interactRef string) (*model.PaymentGrant, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	g := model.PaymentGrant{InteractRef: interactRef}
+	err = tx.QueryRow("DELETE FROM payment_grants WHERE interact_ref = ? RETURNING donation_id, continue_uri, continue_token", interactRef).
+		Scan(&g.DonationID, &g.ContinueURI, &g.ContinueToken)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error al leer el grant de pago: %v", err)
+		return nil, err
+	}
+	if err := openSecrets("payment_grants.continue_token", &g.ContinueToken); err != nil {
+		return nil, err
+	}
+	err = addOutbox(tx, model.OutboxDonationPaymentStarted, fmt.Sprintf("donation.payment_started:%d", g.DonationID),
+		model.DonationPaymentStartedEvent{DonationID: g.DonationID})
+	if err != nil {
+		return nil, err
+	}
+	return &g, tx.Commit()
+}
+
+// DeleteExpiredPaymentGrants borra los grants de donaciones que el donante no
+// terminó de aprobar en ttl. Devuelve cuántos borró.
+func DeleteExpiredPaymentGrants(ttl time.Duration) (int64, error) {
+	res, err := DB.Exec("DELETE FROM payment_grants WHERE created_at <= datetime('now', ?)", fmt.Sprintf("-%d seconds", int(ttl.Seconds())))
+	if err != nil {
+		log.Printf("Error al borrar los grants de pago vencidos: %v", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
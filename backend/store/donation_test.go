@@ -0,0 +1,137 @@
+package store_test
+
+import (
+	"fmt"
+	"testing"
+
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+)
+
+// testUsers numera los creadores de prueba, cuyo nombre debe ser único.
+var testUsers int
+
+// createTestCampaign crea un creador y una campaña suya. Con escrow, los
+// fondos quedan retenidos en la wallet de la plataforma.
+func createTestCampaign(t *testing.T, escrow bool) *model.Campaign {
+	t.Helper()
+	// Sin pasar por CreateUser, que hashea con bcrypt y haría lenta la prueba.
+	testUsers++
+	res, err := store.DB.Exec("INSERT INTO users (username, password_hash, wallet_address) VALUES (?, '', 'https://wallet.example/creador')",
+		fmt.Sprintf("creador-%d", testUsers))
+	if err != nil {
+		t.Fatalf("insertar usuario: %v", err)
+	}
+	userID, _ := res.LastInsertId()
+	id, err := store.CreateCampaign(model.Campaign{
+		UserID: int(userID), Title: "Campaña", Goal: 1000, Currency: "USD", AssetCode: "USD", AssetScale: 2, Escrow: escrow,
+		PaymentPointer: "https://wallet.example/campana",
+		Beneficiaries:  []model.Beneficiary{{WalletAddress: "https://wallet.example/campana", Share: 100}},
+	})
+	if err != nil {
+		t.Fatalf("CreateCampaign: %v", err)
+	}
+	campaign, err := store.GetCampaignByID(id)
+	if err != nil || campaign == nil {
+		t.Fatalf("GetCampaignByID: %v", err)
+	}
+	return campaign
+}
+
+// createTestDonation crea una donación de una sola parte pagada al incoming
+// payment incomingPaymentID.
+func createTestDonation(t *testing.T, campaign *model.Campaign, amount float64, incomingPaymentID string) *model.Donation {
+	t.Helper()
+	donation := &model.Donation{
+		CampaignID: campaign.ID, Amount: amount, Currency: campaign.Currency,
+		Splits: []model.DonationSplit{{WalletAddress: campaign.PaymentPointer, Share: 100, Amount: int64(amount * 100), IncomingPaymentID: incomingPaymentID}},
+	}
+	if err := store.CreateDonation(donation); err != nil {
+		t.Fatalf("CreateDonation: %v", err)
+	}
+	return donation
+}
+
+func TestGetDonationBySplitPayment(t *testing.T) {
+	openTestStore(t)
+	campaign := createTestCampaign(t, false)
+	donation := createTestDonation(t, campaign, 10, "https://wallet.example/incoming-payments/ip_1")
+
+	tests := []struct {
+		name   string
+		lookup func(string) (*model.Donation, error)
+		id     string
+		found  bool
+	}{
+		{"URL completa", store.GetDonationByIncomingPaymentID, "https://wallet.example/incoming-payments/ip_1", true},
+		{"segmento sin firma", store.GetDonationByIncomingPaymentID, "ip_1", false},
+		{"comodín %", store.GetDonationByIncomingPaymentID, "%", false},
+		{"segmento del webhook", store.GetDonationByIncomingPaymentRef, "ip_1", true},
+		{"comodín % en el webhook", store.GetDonationByIncomingPaymentRef, "%", false},
+		{"comodín _ en el webhook", store.GetDonationByIncomingPaymentRef, "ip__", false},
+		{"otro segmento", store.GetDonationByIncomingPaymentRef, "p_1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.lookup(tt.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.found && (got == nil || got.ID != donation.ID) {
+				t.Errorf("%q no encontró la donación %d: %v", tt.id, donation.ID, got)
+			}
+			if !tt.found && got != nil {
+				t.Errorf("%q encontró la donación %d", tt.id, got.ID)
+			}
+		})
+	}
+}
+
+func TestTransitionDonationFollowsTheStateMachine(t *testing.T) {
+	openTestStore(t)
+	campaign := createTestCampaign(t, false)
+	donation := createTestDonation(t, campaign, 10, "https://wallet.example/incoming-payments/ip_1")
+
+	steps := []struct {
+		to string
+		ok bool
+	}{
+		{model.DonationSending, false},
+		{model.DonationQuoted, true},
+		{model.DonationAwaitingApproval, true},
+		{model.DonationApproved, true},
+		{model.DonationSending, true},
+		{model.DonationExpired, false},
+		{model.DonationCompleted, true},
+		{model.DonationFailed, false},
+	}
+	for _, step := range steps {
+		ok, err := store.TransitionDonation(donation.ID, step.to, "prueba")
+		if err != nil || ok != step.ok {
+			t.Fatalf("TransitionDonation(%s) = %v, %v, quería %v", step.to, ok, err, step.ok)
+		}
+	}
+	if ok, err := store.TransitionDonation(donation.ID+1000, model.DonationQuoted, "prueba"); err != nil || ok {
+		t.Errorf("donación inexistente: %v, %v", ok, err)
+	}
+
+	got, err := store.GetDonationByID(donation.ID)
+	if err != nil || got.Status != model.DonationCompleted {
+		t.Fatalf("estado final = %v, %v", got, err)
+	}
+	transitions, err := store.GetDonationTransitions(donation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Solo los cambios aceptados quedan en el historial.
+	var path []string
+	for _, tr := range transitions {
+		if tr.From != "" {
+			path = append(path, tr.From+"→"+tr.To)
+		}
+	}
+	want := []string{"created→quoted", "quoted→awaiting_approval", "awaiting_approval→approved", "approved→sending", "sending→completed"}
+	if fmt.Sprint(path) != fmt.Sprint(want) {
+		t.Errorf("historial = %v, quería %v", path, want)
+	}
+}
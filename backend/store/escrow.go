@@ -0,0 +1,86 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"gofundme-backend/model"
+)
+
+// ErrInsufficientEscrow indica que el escrow de la campaña no alcanza para
+// liberar el hito o pagar el reembolso.
+var ErrInsufficientEscrow = errors.New("saldo insuficiente en el escrow")
+
+// escrowAvailable devuelve lo que se puede gastar del escrow de una campaña:
+// su saldo menos lo reservado por los hitos que se están liberando (salvo
+// exceptMilestoneID) y por los reembolsos que todavía no se pagaron. Todos
+// salen de la misma wallet de la plataforma, así que sin esta cuenta una
+// campaña podría gastar lo retenido para otras. Debe llamarse dentro de una
+// transacción que ya tenga el bloqueo de escritura.
+func escrowAvailable(tx *sql.Tx, campaignID, exceptMilestoneID int) (float64, error) {
+	var available float64
+	err := tx.QueryRow(`
+		SELECT (SELECT COALESCE(SUM(CASE WHEN kind = ? THEN amount ELSE -amount END), 0) FROM escrow_entries WHERE campaign_id = ?)
+			- (SELECT COALESCE(SUM(target_amount), 0) FROM milestones WHERE campaign_id = ? AND status = ? AND id != ?)
+			- (SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE campaign_id = ? AND status = ?)`,
+		model.EscrowDeposit, campaignID, campaignID, model.MilestoneReleasing, exceptMilestoneID, campaignID, model.RefundAwaitingApproval).Scan(&available)
+	if err != nil {
+		log.Printf("Error al calcular el saldo disponible del escrow: %v", err)
+	}
+	return available, err
+}
+
+// AddEscrowDeposit registra una donación retenida en el escrow de una campaña.
+func AddEscrowDeposit(campaignID, donationID int, amount float64) error {
+	_, err := DB.Exec("INSERT INTO escrow_entries (campaign_id, kind, amount, donation_id) VALUES (?, ?, ?, ?)",
+		campaignID, model.EscrowDeposit, amount, donationID)
+	if err != nil {
+		log.Printf("Error al registrar el depósito en escrow: %v", err)
+	}
+	return err
+}
+
+// GetEscrowBalance devuelve el saldo retenido de una campaña: depósitos menos liberaciones.
+func GetEscrowBalance(campaignID int) (float64, error) {
+	var balance float64
+	err := DB.QueryRow(`
+		SELECT COALESCE(SUM(CASE WHEN kind = ? THEN amount ELSE -amount END), 0)
+		FROM escrow_entries WHERE campaign_id = ?`, model.EscrowDeposit, campaignID).Scan(&balance)
+	if err != nil {
+		log.Printf("Error al calcular el saldo del escrow: %v", err)
+	}
+	return balance, err
+}
+
+// GetEscrowEntries devuelve los movimientos del escrow de una campaña.
+func GetEscrowEntries(campaignID int) ([]model.EscrowEntry, error) {
+	rows, err := DB.Query(`
+		SELECT id, campaign_id, kind, amount, donation_id, milestone_id, outgoing_payment_id, created_at
+		FROM escrow_entries WHERE campaign_id = ? ORDER BY id`, campaignID)
+	if err != nil {
+		log.Printf("Error al consultar el escrow: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []model.EscrowEntry{}
+	for rows.Next() {
+		var e model.EscrowEntry
+		var donationID, milestoneID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.CampaignID, &e.Kind, &e.Amount, &donationID, &milestoneID, &e.OutgoingPaymentID, &e.CreatedAt); err != nil {
+			log.Printf("Error al escanear fila del escrow: %v", err)
+			return nil, err
+		}
+		if donationID.Valid {
+			id := int(donationID.Int64)
+			e.DonationID = &id
+		}
+		if milestoneID.Valid {
+			id := int(milestoneID.Int64)
+			e.MilestoneID = &id
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,188 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gofundme-backend/model"
+	"gofundme-backend/store"
+)
+
+// completeTestDonation crea una donación y la confirma, con lo que queda en
+// el escrow si la campaña lo usa.
+func completeTestDonation(t *testing.T, campaign *model.Campaign, amount float64, incomingPaymentID string) *model.Donation {
+	t.Helper()
+	donation := createTestDonation(t, campaign, amount, incomingPaymentID)
+	if ok, err := store.CompleteDonation(donation.ID); err != nil || !ok {
+		t.Fatalf("CompleteDonation: %v, %v", ok, err)
+	}
+	return donation
+}
+
+// submittedMilestone crea un hito con evidencia enviada, listo para aprobarse.
+func submittedMilestone(t *testing.T, campaign *model.Campaign, target float64) *model.Milestone {
+	t.Helper()
+	milestone := &model.Milestone{CampaignID: campaign.ID, Title: "Hito", TargetAmount: target}
+	if err := store.CreateMilestone(milestone); err != nil {
+		t.Fatalf("CreateMilestone: %v", err)
+	}
+	if err := store.UpdateMilestoneStatus(milestone.ID, model.MilestoneSubmitted); err != nil {
+		t.Fatalf("UpdateMilestoneStatus: %v", err)
+	}
+	return milestone
+}
+
+func newRefund(campaign *model.Campaign, donation *model.Donation, amount float64) *model.Refund {
+	return &model.Refund{DonationID: donation.ID, CampaignID: campaign.ID, Amount: amount, Status: model.RefundAwaitingApproval, InitiatedBy: model.RefundByCreator}
+}
+
+func TestRefundCannotExceedDonation(t *testing.T) {
+	openTestStore(t)
+	campaign := createTestCampaign(t, false)
+	donation := completeTestDonation(t, campaign, 50, "https://wallet.example/incoming-payments/1")
+
+	if err := store.CreateRefund(newRefund(campaign, donation, 30)); err != nil {
+		t.Fatalf("primer reembolso: %v", err)
+	}
+	second := newRefund(campaign, donation, 20.01)
+	if err := store.CreateRefund(second); !errors.Is(err, store.ErrRefundExceedsDonation) {
+		t.Fatalf("reembolso de más: %v, quería ErrRefundExceedsDonation", err)
+	}
+	second.Amount = 20
+	if err := store.CreateRefund(second); err != nil {
+		t.Fatalf("reembolso del resto: %v", err)
+	}
+	// Un reembolso fallido libera su monto.
+	if err := store.FailRefund(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if refundable, err := store.RefundableAmount(donation); err != nil || refundable != 20 {
+		t.Errorf("RefundableAmount = %v, %v, quería 20", refundable, err)
+	}
+
+	pending := createTestDonation(t, campaign, 10, "https://wallet.example/incoming-payments/2")
+	if err := store.CreateRefund(newRefund(campaign, pending, 5)); !errors.Is(err, store.ErrDonationNotCompleted) {
+		t.Errorf("reembolso de una donación en curso: %v, quería ErrDonationNotCompleted", err)
+	}
+}
+
+func TestEscrowRefundsAndMilestonesShareTheBalance(t *testing.T) {
+	openTestStore(t)
+	campaign := createTestCampaign(t, true)
+	first := completeTestDonation(t, campaign, 60, "https://wallet.example/incoming-payments/1")
+	second := completeTestDonation(t, campaign, 40, "https://wallet.example/incoming-payments/2")
+
+	// Otra campaña con escrow no presta su saldo.
+	other := createTestCampaign(t, true)
+	completeTestDonation(t, other, 500, "https://wallet.example/incoming-payments/3")
+
+	if balance, err := store.GetEscrowBalance(campaign.ID); err != nil || balance != 100 {
+		t.Fatalf("GetEscrowBalance = %v, %v, quería 100", balance, err)
+	}
+
+	milestone := submittedMilestone(t, campaign, 70)
+	if _, err := store.ReserveMilestoneRelease(milestone.ID, time.Minute); err != nil {
+		t.Fatalf("ReserveMilestoneRelease: %v", err)
+	}
+
+	// Quedan 30 libres: el reembolso de 40 de la segunda donación no entra.
+	if err := store.CreateRefund(newRefund(campaign, second, 40)); !errors.Is(err, store.ErrInsufficientEscrow) {
+		t.Fatalf("reembolso sobre lo reservado: %v, quería ErrInsufficientEscrow", err)
+	}
+	refund := newRefund(campaign, first, 30)
+	if err := store.CreateRefund(refund); err != nil {
+		t.Fatalf("reembolso de lo libre: %v", err)
+	}
+
+	// Con el reembolso pendiente ya no queda nada para otro hito.
+	another := submittedMilestone(t, campaign, 1)
+	if available, err := store.ReserveMilestoneRelease(another.ID, time.Minute); !errors.Is(err, store.ErrInsufficientEscrow) || available != 0 {
+		t.Fatalf("hito sobre un reembolso pendiente: %v, %v, quería ErrInsufficientEscrow con 0", available, err)
+	}
+
+	// Al pagarse, el reembolso sale del escrow y la reserva pasa al ledger.
+	if _, err := store.CompleteRefund(refund, "https://wallet.example/outgoing-payments/r1", true); err != nil {
+		t.Fatalf("CompleteRefund: %v", err)
+	}
+	if balance, err := store.GetEscrowBalance(campaign.ID); err != nil || balance != 70 {
+		t.Errorf("saldo tras el reembolso = %v, %v, quería 70", balance, err)
+	}
+	if _, err := store.ReserveMilestoneRelease(another.ID, time.Minute); !errors.Is(err, store.ErrInsufficientEscrow) {
+		t.Errorf("hito tras el reembolso: %v, quería ErrInsufficientEscrow", err)
+	}
+
+	// Al cancelar la liberación del primer hito, su monto vuelve a estar disponible.
+	if ok, err := store.CancelMilestoneRelease(milestone.ID, "prueba"); err != nil || !ok {
+		t.Fatalf("CancelMilestoneRelease: %v, %v", ok, err)
+	}
+	if _, err := store.ReserveMilestoneRelease(another.ID, time.Minute); err != nil {
+		t.Errorf("hito tras cancelar la reserva: %v", err)
+	}
+}
+
+func TestMilestoneReservationCannotOverspendEscrow(t *testing.T) {
+	openTestStore(t)
+	campaign := createTestCampaign(t, true)
+	completeTestDonation(t, campaign, 100, "https://wallet.example/incoming-payments/1")
+
+	a := submittedMilestone(t, campaign, 60)
+	b := submittedMilestone(t, campaign, 60)
+	if _, err := store.ReserveMilestoneRelease(a.ID, time.Minute); err != nil {
+		t.Fatalf("primer hito: %v", err)
+	}
+	available, err := store.ReserveMilestoneRelease(b.ID, time.Minute)
+	if !errors.Is(err, store.ErrInsufficientEscrow) || available != 40 {
+		t.Errorf("segundo hito: %v, %v, quería ErrInsufficientEscrow con 40", available, err)
+	}
+	// Reservar otra vez el mismo hito no es posible mientras se libera.
+	if _, err := store.ReserveMilestoneRelease(a.ID, time.Minute); !errors.Is(err, store.ErrMilestoneNotReleasable) {
+		t.Errorf("reservar dos veces: %v, quería ErrMilestoneNotReleasable", err)
+	}
+}
+
+func TestReleaseMilestoneLeavesTheEscrow(t *testing.T) {
+	openTestStore(t)
+	campaign := createTestCampaign(t, true)
+	completeTestDonation(t, campaign, 100, "https://wallet.example/incoming-payments/1")
+
+	milestone := submittedMilestone(t, campaign, 60)
+	if err := store.ReleaseMilestone(milestone, "https://wallet.example/outgoing-payments/m1"); !errors.Is(err, store.ErrMilestoneNotReleasable) {
+		t.Fatalf("liberar sin reservar: %v, quería ErrMilestoneNotReleasable", err)
+	}
+	if _, err := store.ReserveMilestoneRelease(milestone.ID, time.Minute); err != nil {
+		t.Fatalf("ReserveMilestoneRelease: %v", err)
+	}
+	if err := store.ReleaseMilestone(milestone, "https://wallet.example/outgoing-payments/m1"); err != nil {
+		t.Fatalf("ReleaseMilestone: %v", err)
+	}
+	if balance, err := store.GetEscrowBalance(campaign.ID); err != nil || balance != 40 {
+		t.Errorf("saldo tras liberar = %v, %v, quería 40", balance, err)
+	}
+	if err := store.ReleaseMilestone(milestone, "https://wallet.example/outgoing-payments/m1"); !errors.Is(err, store.ErrMilestoneNotReleasable) {
+		t.Errorf("liberar dos veces: %v, quería ErrMilestoneNotReleasable", err)
+	}
+}
+
+func TestStaleMilestoneReservationCanBeRetaken(t *testing.T) {
+	openTestStore(t)
+	campaign := createTestCampaign(t, true)
+	completeTestDonation(t, campaign, 100, "https://wallet.example/incoming-payments/1")
+
+	milestone := submittedMilestone(t, campaign, 60)
+	if _, err := store.ReserveMilestoneRelease(milestone.ID, time.Minute); err != nil {
+		t.Fatalf("ReserveMilestoneRelease: %v", err)
+	}
+	// Una reserva sin pago empezado vuelve a tomarse pasado el lease.
+	if _, err := store.ReserveMilestoneRelease(milestone.ID, -time.Second); err != nil {
+		t.Fatalf("retomar la reserva vencida: %v", err)
+	}
+
+	// Con el pago empezado ya no: no se sabe si se pagó.
+	if err := store.StartMilestonePayment(milestone.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ReserveMilestoneRelease(milestone.ID, -time.Second); !errors.Is(err, store.ErrMilestoneNotReleasable) {
+		t.Errorf("retomar un pago empezado: %v, quería ErrMilestoneNotReleasable", err)
+	}
+}
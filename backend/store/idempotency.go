@@ -0,0 +1,102 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// ReserveIdempotencyKey reserva durante lease la clave key de scope para la
+// petición con esa huella. Devuelve la fila de la clave y si quedó reservada
+// para quien llama. Si no, la fila es de una petición anterior: terminada,
+// todavía en curso o con otra huella. Una clave de más de ttl se descarta y
+// cuenta como nueva; una en curso cuya reserva venció, porque el servidor se
+// cayó a mitad, se puede volver a reservar con la misma huella.
+func ReserveIdempotencyKey(scope, key, fingerprint string, lease, ttl time.Duration) (*model.IdempotencyKey, bool, error) {
+	_, err := DB.Exec("DELETE FROM idempotency_keys WHERE scope = ? AND key = ? AND created_at <= datetime('now', ?)",
+		scope, key, fmt.Sprintf("-%d seconds", int(ttl.Seconds())))
+	if err != nil {
+		log.Printf("Error al descartar la clave de idempotencia vencida: %v", err)
+		return nil, false, err
+	}
+
+	now := time.Now().UTC()
+	res, err := DB.Exec("INSERT OR IGNORE INTO idempotency_keys (scope, key, fingerprint, locked_until) VALUES (?, ?, ?, ?)",
+		scope, key, fingerprint, now.Add(lease))
+	if err != nil {
+		log.Printf("Error al reservar la clave de idempotencia: %v", err)
+		return nil, false, err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		entry, err := getIdempotencyKey(scope, key)
+		return entry, entry != nil, err
+	}
+
+	entry, err := getIdempotencyKey(scope, key)
+	if err != nil || entry == nil || entry.StatusCode != 0 || entry.Fingerprint != fingerprint {
+		return entry, false, err
+	}
+	res, err = DB.Exec("UPDATE idempotency_keys SET locked_until = ? WHERE id = ? AND status_code = 0 AND locked_until <= ?",
+		now.Add(lease), entry.ID, now)
+	if err != nil {
+		log.Printf("Error al reservar la clave de idempotencia: %v", err)
+		return nil, false, err
+	}
+	n, _ := res.RowsAffected()
+	return entry, n > 0, nil
+}
+
+func getIdempotencyKey(scope, key string) (*model.IdempotencyKey, error) {
+	entry := model.IdempotencyKey{Scope: scope, Key: key}
+	var lockedUntil sql.NullTime
+	err := DB.QueryRow(`
+		SELECT id, fingerprint, status_code, content_type, response_body, locked_until, created_at
+		FROM idempotency_keys WHERE scope = ? AND key = ?`, scope, key).
+		Scan(&entry.ID, &entry.Fingerprint, &entry.StatusCode, &entry.ContentType, &entry.ResponseBody, &lockedUntil, &entry.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error al leer la clave de idempotencia: %v", err)
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		entry.LockedUntil = &lockedUntil.Time
+	}
+	return &entry, nil
+}
+
+// SaveIdempotentResponse guarda la respuesta de la petición que reservó la
+// clave y libera la reserva.
+func SaveIdempotentResponse(id, statusCode int, contentType string, body []byte) error {
+	_, err := DB.Exec("UPDATE idempotency_keys SET status_code = ?, content_type = ?, response_body = ?, locked_until = NULL WHERE id = ?",
+		statusCode, contentType, body, id)
+	if err != nil {
+		log.Printf("Error al guardar la respuesta de la clave de idempotencia %d: %v", id, err)
+	}
+	return err
+}
+
+// ReleaseIdempotencyKey borra la reserva de una clave sin respuesta guardada,
+// para que la misma petición se pueda reintentar.
+func ReleaseIdempotencyKey(id int) error {
+	_, err := DB.Exec("DELETE FROM idempotency_keys WHERE id = ? AND status_code = 0", id)
+	if err != nil {
+		log.Printf("Error al liberar la clave de idempotencia %d: %v", id, err)
+	}
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys borra las claves de idempotencia de más de ttl.
+// Devuelve cuántas borró.
+func DeleteExpiredIdempotencyKeys(ttl time.Duration) (int64, error) {
+	res, err := DB.Exec("DELETE FROM idempotency_keys WHERE created_at <= datetime('now', ?)", fmt.Sprintf("-%d seconds", int(ttl.Seconds())))
+	if err != nil {
+		log.Printf("Error al borrar las claves de idempotencia vencidas: %v", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
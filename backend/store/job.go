@@ -0,0 +1,229 @@
+package store
+
+import (
+	"database/sql"
+	"gofundme-backend/model"
+	"log"
+	"time"
+)
+
+// EnqueueJob guarda un trabajo para que se ejecute a partir de job.RunAt.
+func EnqueueJob(job *model.Job) error {
+	job.Status = model.JobQueued
+	job.RunAt = job.RunAt.UTC()
+	res, err := DB.Exec("INSERT INTO jobs (type, payload, status, max_attempts, run_at) VALUES (?, ?, ?, ?, ?)",
+		job.Type, string(job.Payload), job.Status, job.MaxAttempts, job.RunAt)
+	if err != nil {
+		log.Printf("Error al encolar el trabajo %s: %v", job.Type, err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	job.ID = int(id)
+	return nil
+}
+
+// EnqueueJobOnce encola el trabajo solo si no hay otro del mismo tipo sin
+// terminar. Sirve para los trabajos periódicos, que se vuelven a encolar al
+// acabar. Devuelve false si ya había uno.
+func EnqueueJobOnce(job *model.Job) (bool, error) {
+	job.Status = model.JobQueued
+	job.RunAt = job.RunAt.UTC()
+	res, err := DB.Exec(`
+		INSERT INTO jobs (type, payload, status, max_attempts, run_at)
+		SELECT ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (SELECT 1 FROM jobs WHERE type = ? AND status IN (?, ?, ?))`,
+		job.Type, string(job.Payload), job.Status, job.MaxAttempts, job.RunAt,
+		job.Type, model.JobQueued, model.JobRunning, model.JobFailed)
+	if err != nil {
+		log.Printf("Error al encolar el trabajo %s: %v", job.Type, err)
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+	job.ID = int(id)
+	return true, nil
+}
+
+// ExpediteJob adelanta a ya el trabajo encolado de un tipo que todavía no
+// tocaba ejecutar. Devuelve false si no había ninguno.
+func ExpediteJob(jobType string) (bool, error) {
+	now := time.Now().UTC()
+	res, err := DB.Exec("UPDATE jobs SET run_at = ? WHERE type = ? AND status = ? AND run_at > ?", now, jobType, model.JobQueued, now)
+	if err != nil {
+		log.Printf("Error al adelantar el trabajo %s: %v", jobType, err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+const jobSelect = `
+	SELECT id, type, payload, status, attempts, max_attempts, last_error, run_at, locked_until, created_at, finished_at
+	FROM jobs
+`
+
+func scanJob(row interface{ Scan(...any) error }) (model.Job, error) {
+	var j model.Job
+	var payload string
+	var lockedUntil, finishedAt sql.NullTime
+	err := row.Scan(&j.ID, &j.Type, &payload, &j.Status, &j.Attempts, &j.MaxAttempts, &j.LastError, &j.RunAt, &lockedUntil, &j.CreatedAt, &finishedAt)
+	j.Payload = []byte(payload)
+	if lockedUntil.Valid {
+		j.LockedUntil = &lockedUntil.Time
+	}
+	if finishedAt.Valid {
+		j.FinishedAt = &finishedAt.Time
+	}
+	return j, err
+}
+
+// GetJob busca un trabajo por su ID.
+func GetJob(id int) (*model.Job, error) {
+	j, err := scanJob(DB.QueryRow(jobSelect+" WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error al leer el trabajo: %v", err)
+		return nil, err
+	}
+	return &j, nil
+}
+
+// GetJobs lista los trabajos, los más recientes primero. status y jobType
+// vacíos no filtran.
+func GetJobs(status, jobType string, limit, offset int) ([]model.Job, error) {
+	query := jobSelect + " WHERE 1 = 1"
+	var args []any
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	if jobType != "" {
+		query += " AND type = ?"
+		args = append(args, jobType)
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		log.Printf("Error al consultar los trabajos: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []model.Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			log.Printf("Error al escanear fila de trabajo: %v", err)
+			return nil, err
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// ClaimJobs reserva durante lease hasta limit trabajos de un tipo que ya toca
+// ejecutar, incluidos los que quedaron reservados por un worker que murió. Cada
+// reserva cuenta como un intento.
+func ClaimJobs(jobType string, limit int, lease time.Duration) ([]model.Job, error) {
+	now := time.Now().UTC()
+	rows, err := DB.Query(`
+		SELECT id FROM jobs
+		WHERE type = ? AND ((status IN (?, ?) AND run_at <= ?) OR (status = ? AND locked_until <= ?))
+		ORDER BY run_at LIMIT ?`,
+		jobType, model.JobQueued, model.JobFailed, now, model.JobRunning, now, limit)
+	if err != nil {
+		log.Printf("Error al consultar los trabajos pendientes: %v", err)
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	var jobs []model.Job
+	for _, id := range ids {
+		res, err := DB.Exec(`
+			UPDATE jobs SET status = ?, attempts = attempts + 1, locked_until = ?
+			WHERE id = ? AND ((status IN (?, ?) AND run_at <= ?) OR (status = ? AND locked_until <= ?))`,
+			model.JobRunning, now.Add(lease), id, model.JobQueued, model.JobFailed, now, model.JobRunning, now)
+		if err != nil {
+			log.Printf("Error al reservar el trabajo %d: %v", id, err)
+			return jobs, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue // Lo reservó otro worker
+		}
+		job, err := GetJob(id)
+		if err != nil || job == nil {
+			return jobs, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, nil
+}
+
+// CompleteJob marca un trabajo como terminado.
+func CompleteJob(id int) error {
+	_, err := DB.Exec("UPDATE jobs SET status = ?, last_error = '', locked_until = NULL, finished_at = ? WHERE id = ?",
+		model.JobSucceeded, time.Now().UTC(), id)
+	if err != nil {
+		log.Printf("Error al completar el trabajo %d: %v", id, err)
+	}
+	return err
+}
+
+// FailJob registra un intento fallido. Con nextAttempt nil el trabajo queda
+// muerto hasta que un administrador lo reintente.
+func FailJob(id int, lastError string, nextAttempt *time.Time) error {
+	status, runAt, finishedAt := model.JobDead, any(nil), any(time.Now().UTC())
+	if nextAttempt != nil {
+		status, runAt, finishedAt = model.JobFailed, nextAttempt.UTC(), nil
+	}
+	_, err := DB.Exec("UPDATE jobs SET status = ?, last_error = ?, run_at = COALESCE(?, run_at), locked_until = NULL, finished_at = ? WHERE id = ?",
+		status, lastError, runAt, finishedAt, id)
+	if err != nil {
+		log.Printf("Error al registrar el fallo del trabajo %d: %v", id, err)
+	}
+	return err
+}
+
+// RetryJob vuelve a encolar para ya un trabajo fallido o muerto, con todos sus
+// intentos disponibles. Devuelve false si no existe o no está en esos estados.
+func RetryJob(id int) (bool, error) {
+	res, err := DB.Exec("UPDATE jobs SET status = ?, attempts = 0, run_at = ?, finished_at = NULL WHERE id = ? AND status IN (?, ?)",
+		model.JobQueued, time.Now().UTC(), id, model.JobFailed, model.JobDead)
+	if err != nil {
+		log.Printf("Error al reintentar el trabajo %d: %v", id, err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// PruneJobs borra los trabajos terminados con éxito antes de before.
+func PruneJobs(before time.Time) (int64, error) {
+	res, err := DB.Exec("DELETE FROM jobs WHERE status = ? AND finished_at < ?", model.JobSucceeded, before.UTC())
+	if err != nil {
+		log.Printf("Error al borrar los trabajos antiguos: %v", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
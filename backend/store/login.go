@@ -0,0 +1,52 @@
+package store
+
+import (
+	"database/sql"
+	"log"
+
+	"gofundme-backend/model"
+)
+
+// GetLoginAttempt devuelve los intentos fallidos de una clave, o nil si no tiene.
+func GetLoginAttempt(kind, key string) (*model.LoginAttempt, error) {
+	attempt := model.LoginAttempt{Kind: kind, Key: key}
+	var lockedUntil sql.NullTime
+	err := DB.QueryRow("SELECT failures, last_failure_at, locked_until FROM login_attempts WHERE kind = ? AND key = ?", kind, key).
+		Scan(&attempt.Failures, &attempt.LastFailureAt, &lockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error al leer los intentos de inicio de sesión: %v", err)
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		attempt.LockedUntil = &lockedUntil.Time
+	}
+	return &attempt, nil
+}
+
+// SaveLoginAttempt guarda los intentos fallidos de una clave.
+func SaveLoginAttempt(attempt *model.LoginAttempt) error {
+	var lockedUntil any
+	if attempt.LockedUntil != nil {
+		lockedUntil = attempt.LockedUntil.UTC()
+	}
+	_, err := DB.Exec(`
+		INSERT INTO login_attempts (kind, key, failures, last_failure_at, locked_until) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (kind, key) DO UPDATE SET failures = excluded.failures, last_failure_at = excluded.last_failure_at, locked_until = excluded.locked_until`,
+		attempt.Kind, attempt.Key, attempt.Failures, attempt.LastFailureAt.UTC(), lockedUntil)
+	if err != nil {
+		log.Printf("Error al guardar los intentos de inicio de sesión: %v", err)
+	}
+	return err
+}
+
+// ClearLoginAttempt borra los intentos fallidos de una clave.
+func ClearLoginAttempt(kind, key string) error {
+	_, err := DB.Exec("DELETE FROM login_attempts WHERE kind = ? AND key = ?", kind, key)
+	if err != nil {
+		log.Printf("Error al borrar los intentos de inicio de sesión: %v", err)
+	}
+	return err
+}
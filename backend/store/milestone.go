@@ -0,0 +1,293 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// ErrMilestoneNotReleasable indica que el hito no está en un estado desde el
+// que se pueda liberar.
+var ErrMilestoneNotReleasable = errors.New("el hito no está pendiente de aprobación")
+
+// CreateMilestone inserta un nuevo hito para una campaña.
+func CreateMilestone(milestone *model.Milestone) error {
+	res, err := DB.Exec("INSERT INTO milestones (campaign_id, title, description, target_amount, status) VALUES (?, ?, ?, ?, ?)",
+		milestone.CampaignID, milestone.Title, milestone.Description, milestone.TargetAmount, model.MilestonePending)
+	if err != nil {
+		log.Printf("Error al insertar el hito: %v", err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error al obtener el ID del hito: %v", err)
+		return err
+	}
+	milestone.ID = int(id)
+	milestone.Status = model.MilestonePending
+	return nil
+}
+
+const milestoneSelect = `
+	SELECT id, campaign_id, title, description, target_amount, status, outgoing_payment_id, release_started_at, release_error,
+		created_at, released_at
+	FROM milestones
+`
+
+func scanMilestone(row interface{ Scan(...any) error }) (model.Milestone, error) {
+	var m model.Milestone
+	var description sql.NullString
+	var releaseStartedAt, releasedAt sql.NullTime
+	err := row.Scan(&m.ID, &m.CampaignID, &m.Title, &description, &m.TargetAmount, &m.Status, &m.OutgoingPaymentID,
+		&releaseStartedAt, &m.ReleaseError, &m.CreatedAt, &releasedAt)
+	m.Description = description.String
+	if releaseStartedAt.Valid {
+		m.ReleaseStartedAt = &releaseStartedAt.Time
+	}
+	if releasedAt.Valid {
+		m.ReleasedAt = &releasedAt.Time
+	}
+	return m, err
+}
+
+// GetMilestonesByCampaign devuelve los hitos de una campaña con su evidencia.
+func GetMilestonesByCampaign(campaignID int) ([]model.Milestone, error) {
+	return queryMilestones(" WHERE campaign_id = ? ORDER BY id", campaignID)
+}
+
+// GetMilestonesByStatus devuelve los hitos de todas las campañas en un estado.
+func GetMilestonesByStatus(status string) ([]model.Milestone, error) {
+	return queryMilestones(" WHERE status = ? ORDER BY id", status)
+}
+
+func queryMilestones(where string, args ...any) ([]model.Milestone, error) {
+	rows, err := DB.Query(milestoneSelect+where, args...)
+	if err != nil {
+		log.Printf("Error al consultar hitos: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	milestones := []model.Milestone{}
+	for rows.Next() {
+		m, err := scanMilestone(rows)
+		if err != nil {
+			log.Printf("Error al escanear fila de hito: %v", err)
+			return nil, err
+		}
+		milestones = append(milestones, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range milestones {
+		evidence, err := getMilestoneEvidence(milestones[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		milestones[i].Evidence = evidence
+	}
+	return milestones, nil
+}
+
+// GetMilestoneByID recupera un hito con su evidencia.
+func GetMilestoneByID(id int) (*model.Milestone, error) {
+	m, err := scanMilestone(DB.QueryRow(milestoneSelect+" WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No encontrado no es un error de aplicación
+		}
+		log.Printf("Error al escanear fila de hito: %v", err)
+		return nil, err
+	}
+	evidence, err := getMilestoneEvidence(m.ID)
+	if err != nil {
+		return nil, err
+	}
+	m.Evidence = evidence
+	return &m, nil
+}
+
+func getMilestoneEvidence(milestoneID int) ([]model.MilestoneEvidence, error) {
+	rows, err := DB.Query("SELECT id, milestone_id, filename, content_type, path, uploaded_at FROM milestone_evidence WHERE milestone_id = ? ORDER BY id", milestoneID)
+	if err != nil {
+		log.Printf("Error al consultar evidencia: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	evidence := []model.MilestoneEvidence{}
+	for rows.Next() {
+		var e model.MilestoneEvidence
+		if err := rows.Scan(&e.ID, &e.MilestoneID, &e.Filename, &e.ContentType, &e.Path, &e.UploadedAt); err != nil {
+			log.Printf("Error al escanear fila de evidencia: %v", err)
+			return nil, err
+		}
+		evidence = append(evidence, e)
+	}
+	return evidence, rows.Err()
+}
+
+// AddMilestoneEvidence registra un archivo de evidencia y deja el hito listo para revisión.
+func AddMilestoneEvidence(evidence *model.MilestoneEvidence) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO milestone_evidence (milestone_id, filename, content_type, path) VALUES (?, ?, ?, ?)",
+		evidence.MilestoneID, evidence.Filename, evidence.ContentType, evidence.Path)
+	if err != nil {
+		log.Printf("Error al insertar evidencia: %v", err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	evidence.ID = int(id)
+
+	_, err = tx.Exec("UPDATE milestones SET status = ? WHERE id = ? AND status = ?", model.MilestoneSubmitted, evidence.MilestoneID, model.MilestonePending)
+	if err != nil {
+		log.Printf("Error al actualizar el estado del hito: %v", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateMilestoneStatus cambia el estado de un hito.
+func UpdateMilestoneStatus(id int, status string) error {
+	_, err := DB.Exec("UPDATE milestones SET status = ? WHERE id = ?", status, id)
+	if err != nil {
+		log.Printf("Error al actualizar el estado del hito: %v", err)
+	}
+	return err
+}
+
+// ReserveMilestoneRelease aprueba un hito y reserva su monto del escrow
+// pasándolo a releasing, en una sola transacción. El saldo disponible es el del
+// escrow menos lo reservado por otros hitos y por reembolsos en curso (ver
+// escrowAvailable), así que dos pagos a la vez no pueden pasarse del saldo. Una reserva sin pago
+// empezado de más de lease, porque el servidor se cayó a mitad, se puede
+// volver a tomar. Si no se pudo reservar devuelve ErrMilestoneNotReleasable o
+// ErrInsufficientEscrow con el saldo disponible.
+func ReserveMilestoneRelease(id int, lease time.Duration) (float64, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Escribir primero toma el bloqueo de escritura de SQLite, así ninguna otra
+	// reserva cambia el saldo entre la lectura y la actualización.
+	if _, err := tx.Exec("UPDATE milestones SET status = status WHERE id = ?", id); err != nil {
+		log.Printf("Error al bloquear el hito %d: %v", id, err)
+		return 0, err
+	}
+
+	var campaignID int
+	var status string
+	var target float64
+	var reservedAt, startedAt sql.NullTime
+	err = tx.QueryRow("SELECT campaign_id, status, target_amount, release_reserved_at, release_started_at FROM milestones WHERE id = ?", id).
+		Scan(&campaignID, &status, &target, &reservedAt, &startedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrMilestoneNotReleasable
+		}
+		log.Printf("Error al leer el hito %d: %v", id, err)
+		return 0, err
+	}
+	switch {
+	case status == model.MilestoneSubmitted || status == model.MilestoneApproved:
+	case status == model.MilestoneReleasing && !startedAt.Valid && reservedAt.Valid && time.Since(reservedAt.Time) > lease:
+	default:
+		return 0, ErrMilestoneNotReleasable
+	}
+
+	available, err := escrowAvailable(tx, campaignID, id)
+	if err != nil {
+		return 0, err
+	}
+	if available < target {
+		return available, ErrInsufficientEscrow
+	}
+
+	res, err := tx.Exec("UPDATE milestones SET status = ?, release_reserved_at = ?, release_started_at = NULL, release_error = '' WHERE id = ? AND status = ?",
+		model.MilestoneReleasing, time.Now().UTC(), id, status)
+	if err != nil {
+		log.Printf("Error al reservar la liberación del hito %d: %v", id, err)
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, ErrMilestoneNotReleasable
+	}
+	return available, tx.Commit()
+}
+
+// StartMilestonePayment marca que el outgoing payment del hito está por
+// crearse. Desde aquí, si no se confirma, no se sabe si se pagó y el hito solo
+// se cierra conciliándolo.
+func StartMilestonePayment(id int) error {
+	_, err := DB.Exec("UPDATE milestones SET release_started_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?", id, model.MilestoneReleasing)
+	if err != nil {
+		log.Printf("Error al marcar el pago del hito %d: %v", id, err)
+	}
+	return err
+}
+
+// RecordMilestoneReleaseError guarda el último error al liberar un hito.
+func RecordMilestoneReleaseError(id int, reason string) error {
+	_, err := DB.Exec("UPDATE milestones SET release_error = ? WHERE id = ?", reason, id)
+	if err != nil {
+		log.Printf("Error al registrar el error de liberación del hito %d: %v", id, err)
+	}
+	return err
+}
+
+// CancelMilestoneRelease devuelve a aprobado un hito que no se llegó a pagar y
+// libera su reserva del escrow. Devuelve false si el hito no se estaba liberando.
+func CancelMilestoneRelease(id int, reason string) (bool, error) {
+	res, err := DB.Exec("UPDATE milestones SET status = ?, release_reserved_at = NULL, release_started_at = NULL, release_error = ? WHERE id = ? AND status = ?",
+		model.MilestoneApproved, reason, id, model.MilestoneReleasing)
+	if err != nil {
+		log.Printf("Error al cancelar la liberación del hito %d: %v", id, err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ReleaseMilestone marca como liberado un hito que se estaba liberando y
+// registra la salida de fondos del escrow en la misma transacción. Devuelve
+// ErrMilestoneNotReleasable si el hito no estaba en releasing.
+func ReleaseMilestone(milestone *model.Milestone, outgoingPaymentID string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE milestones SET status = ?, outgoing_payment_id = ?, release_error = '', released_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+		model.MilestoneReleased, outgoingPaymentID, milestone.ID, model.MilestoneReleasing)
+	if err != nil {
+		log.Printf("Error al marcar el hito como liberado: %v", err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrMilestoneNotReleasable
+	}
+	_, err = tx.Exec("INSERT INTO escrow_entries (campaign_id, kind, amount, milestone_id, outgoing_payment_id) VALUES (?, ?, ?, ?, ?)",
+		milestone.CampaignID, model.EscrowRelease, milestone.TargetAmount, milestone.ID, outgoingPaymentID)
+	if err != nil {
+		log.Printf("Error al registrar la liberación del escrow: %v", err)
+		return err
+	}
+	return tx.Commit()
+}
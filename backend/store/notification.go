@@ -0,0 +1,71 @@
+package store
+
+import (
+	"database/sql"
+	"log"
+
+	"gofundme-backend/model"
+)
+
+// CreateNotification guarda un aviso para un usuario. Los errores se registran
+// y se devuelven, pero quien notifica no suele tratarlos como fatales.
+func CreateNotification(userID int, kind, message string) error {
+	if userID == 0 {
+		return nil // Donante anónimo: no hay a quién avisar dentro de la app
+	}
+	_, err := DB.Exec("INSERT INTO notifications (user_id, kind, message) VALUES (?, ?, ?)", userID, kind, message)
+	if err != nil {
+		log.Printf("Error al crear la notificación: %v", err)
+	}
+	return err
+}
+
+// CreateNotificationOnce guarda un aviso salvo que el usuario ya tenga uno con
+// la misma dedupKey.
+func CreateNotificationOnce(userID int, kind, message, dedupKey string) error {
+	if userID == 0 {
+		return nil
+	}
+	_, err := DB.Exec("INSERT OR IGNORE INTO notifications (user_id, kind, message, dedup_key) VALUES (?, ?, ?, ?)", userID, kind, message, dedupKey)
+	if err != nil {
+		log.Printf("Error al crear la notificación: %v", err)
+	}
+	return err
+}
+
+// GetNotificationsByUser devuelve los avisos de un usuario, los más recientes primero.
+func GetNotificationsByUser(userID int) ([]model.Notification, error) {
+	rows, err := DB.Query("SELECT id, user_id, kind, message, created_at, read_at FROM notifications WHERE user_id = ? ORDER BY id DESC", userID)
+	if err != nil {
+		log.Printf("Error al consultar notificaciones: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []model.Notification{}
+	for rows.Next() {
+		var n model.Notification
+		var readAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.Message, &n.CreatedAt, &readAt); err != nil {
+			log.Printf("Error al escanear fila de notificación: %v", err)
+			return nil, err
+		}
+		if readAt.Valid {
+			n.ReadAt = &readAt.Time
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// MarkNotificationRead marca un aviso como leído. Devuelve false si no existe
+// o no pertenece al usuario.
+func MarkNotificationRead(id, userID int) (bool, error) {
+	res, err := DB.Exec("UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP) WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		log.Printf("Error al marcar la notificación como leída: %v", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
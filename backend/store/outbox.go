@@ -0,0 +1,119 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"gofundme-backend/model"
+	"log"
+	"time"
+)
+
+// addOutbox guarda un evento en el outbox dentro de la transacción del cambio
+// de estado que lo produce, así que se guardan los dos o ninguno. Un evento
+// con una dedupKey ya guardada se ignora.
+func addOutbox(tx *sql.Tx, topic, dedupKey string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT OR IGNORE INTO outbox (topic, dedup_key, payload, status, available_at) VALUES (?, ?, ?, ?, ?)",
+		topic, dedupKey, string(data), model.OutboxPending, time.Now().UTC())
+	if err != nil {
+		log.Printf("Error al guardar el evento %s en el outbox: %v", dedupKey, err)
+	}
+	return err
+}
+
+const outboxSelect = `
+	SELECT id, topic, dedup_key, payload, status, attempts, last_error, available_at, created_at, published_at
+	FROM outbox
+`
+
+func scanOutboxMessage(row interface{ Scan(...any) error }) (model.OutboxMessage, error) {
+	var m model.OutboxMessage
+	var payload string
+	var publishedAt sql.NullTime
+	err := row.Scan(&m.ID, &m.Topic, &m.DedupKey, &payload, &m.Status, &m.Attempts, &m.LastError, &m.AvailableAt, &m.CreatedAt, &publishedAt)
+	m.Payload = []byte(payload)
+	if publishedAt.Valid {
+		m.PublishedAt = &publishedAt.Time
+	}
+	return m, err
+}
+
+// ClaimOutboxMessages reserva durante lease hasta limit eventos pendientes que
+// ya se pueden publicar, en el orden en que se guardaron. Cada reserva cuenta
+// como un intento.
+func ClaimOutboxMessages(limit int, lease time.Duration) ([]model.OutboxMessage, error) {
+	now := time.Now().UTC()
+	rows, err := DB.Query("SELECT id FROM outbox WHERE status = ? AND available_at <= ? ORDER BY id LIMIT ?", model.OutboxPending, now, limit)
+	if err != nil {
+		log.Printf("Error al consultar el outbox: %v", err)
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	var messages []model.OutboxMessage
+	for _, id := range ids {
+		res, err := DB.Exec("UPDATE outbox SET attempts = attempts + 1, available_at = ? WHERE id = ? AND status = ? AND available_at <= ?",
+			now.Add(lease), id, model.OutboxPending, now)
+		if err != nil {
+			log.Printf("Error al reservar el evento %d del outbox: %v", id, err)
+			return messages, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue // Lo reservó otro
+		}
+		m, err := scanOutboxMessage(DB.QueryRow(outboxSelect+" WHERE id = ?", id))
+		if err != nil {
+			log.Printf("Error al leer el evento %d del outbox: %v", id, err)
+			return messages, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+// MarkOutboxPublished registra que el evento se publicó.
+func MarkOutboxPublished(id int) error {
+	_, err := DB.Exec("UPDATE outbox SET status = ?, last_error = '', published_at = ? WHERE id = ?", model.OutboxPublished, time.Now().UTC(), id)
+	if err != nil {
+		log.Printf("Error al marcar el evento %d del outbox como publicado: %v", id, err)
+	}
+	return err
+}
+
+// MarkOutboxFailed registra un intento de publicación fallido. Con
+// nextAttempt nil el evento queda muerto.
+func MarkOutboxFailed(id int, lastError string, nextAttempt *time.Time) error {
+	status, availableAt := model.OutboxDead, any(nil)
+	if nextAttempt != nil {
+		status, availableAt = model.OutboxPending, nextAttempt.UTC()
+	}
+	_, err := DB.Exec("UPDATE outbox SET status = ?, last_error = ?, available_at = COALESCE(?, available_at) WHERE id = ?",
+		status, lastError, availableAt, id)
+	if err != nil {
+		log.Printf("Error al registrar el fallo del evento %d del outbox: %v", id, err)
+	}
+	return err
+}
+
+// PruneOutbox borra los eventos publicados antes de before. Su dedupKey deja
+// de protegerlos contra duplicados, así que before debe quedar bastante atrás.
+func PruneOutbox(before time.Time) (int64, error) {
+	res, err := DB.Exec("DELETE FROM outbox WHERE status = ? AND published_at < ?", model.OutboxPublished, before.UTC())
+	if err != nil {
+		log.Printf("Error al borrar los eventos publicados del outbox: %v", err)
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"log"
+
+	"gofundme-backend/model"
+)
+
+// UpdateUserProfile cambia los datos públicos del perfil de un usuario.
+func UpdateUserProfile(id int, displayName, bio, avatarURL string) error {
+	_, err := DB.Exec("UPDATE users SET display_name = ?, bio = ?, avatar_url = ? WHERE id = ?", displayName, bio, avatarURL, id)
+	if err != nil {
+		log.Printf("Error al actualizar el perfil del usuario: %v", err)
+	}
+	return err
+}
+
+// UpdateUserWallet cambia la wallet de un usuario junto con los datos
+// resueltos de ella.
+func UpdateUserWallet(user *model.User) error {
+	_, err := DB.Exec("UPDATE users SET wallet_address = ?, wallet_asset_code = ?, wallet_asset_scale = ?, wallet_auth_server = ? WHERE id = ?",
+		user.WalletAddress, user.WalletAssetCode, user.WalletAssetScale, user.WalletAuthServer, user.ID)
+	if err != nil {
+		log.Printf("Error al cambiar la wallet del usuario: %v", err)
+	}
+	return err
+}
+
+// GetCampaignsByUser devuelve las campañas de un creador, de la más nueva a la más vieja.
+func GetCampaignsByUser(userID int) ([]model.Campaign, error) {
+	rows, err := DB.Query(campaignSelect+" WHERE c.user_id = ? ORDER BY c.created_at DESC, c.id DESC", userID)
+	if err != nil {
+		log.Printf("Error al consultar las campañas del usuario: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	campaigns := []model.Campaign{}
+	for rows.Next() {
+		campaign, err := scanCampaign(rows)
+		if err != nil {
+			log.Printf("Error al escanear fila de campaña: %v", err)
+			return nil, err
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, rows.Err()
+}
+
+// CountCompletedDonations cuenta las donaciones completadas de un conjunto de campañas.
+func CountCompletedDonations(campaignIDs []int) (int, error) {
+	var total int
+	for _, id := range campaignIDs {
+		var n int
+		err := DB.QueryRow("SELECT COUNT(*) FROM donations WHERE campaign_id = ? AND status = ?", id, model.DonationCompleted).Scan(&n)
+		if err != nil {
+			log.Printf("Error al contar las donaciones de la campaña: %v", err)
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
@@ -0,0 +1,304 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// ErrRefundExceedsDonation indica que el reembolso supera lo que queda por devolver.
+var ErrRefundExceedsDonation = errors.New("el reembolso supera el monto reembolsable de la donación")
+
+// CreateRefund registra un reembolso comprobando, en la misma transacción, que
+// la donación esté completada y que la suma de sus reembolsos no supere su
+// monto. Si la campaña usa escrow, el reembolso se paga desde la wallet de la
+// plataforma y queda reservado contra el escrow de la campaña hasta que se
+// paga o falla; si no alcanza devuelve ErrInsufficientEscrow.
+func CreateRefund(refund *model.Refund) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Escribir primero toma el bloqueo de escritura de SQLite, así ningún otro
+	// reembolso o hito cambia el saldo del escrow entre la lectura y el insert.
+	if _, err := tx.Exec("UPDATE campaigns SET id = id WHERE id = ?", refund.CampaignID); err != nil {
+		log.Printf("Error al bloquear la campaña %d: %v", refund.CampaignID, err)
+		return err
+	}
+
+	var amount float64
+	var status string
+	err = tx.QueryRow("SELECT amount, status FROM donations WHERE id = ?", refund.DonationID).Scan(&amount, &status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrDonationNotCompleted
+		}
+		return err
+	}
+	if status != model.DonationCompleted && status != model.DonationPartiallyRefunded {
+		return ErrDonationNotCompleted
+	}
+
+	var committed float64
+	err = tx.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE donation_id = ? AND status IN (?, ?)",
+		refund.DonationID, model.RefundAwaitingApproval, model.RefundCompleted).Scan(&committed)
+	if err != nil {
+		return err
+	}
+	if committed+refund.Amount > amount+0.000001 {
+		return ErrRefundExceedsDonation
+	}
+
+	var escrow bool
+	if err := tx.QueryRow("SELECT escrow FROM campaigns WHERE id = ?", refund.CampaignID).Scan(&escrow); err != nil {
+		log.Printf("Error al leer la campaña del reembolso: %v", err)
+		return err
+	}
+	if escrow {
+		available, err := escrowAvailable(tx, refund.CampaignID, 0)
+		if err != nil {
+			return err
+		}
+		if refund.Amount > available+0.000001 {
+			return ErrInsufficientEscrow
+		}
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO refunds (donation_id, campaign_id, amount, reason, status, initiated_by)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		refund.DonationID, refund.CampaignID, refund.Amount, refund.Reason, refund.Status, refund.InitiatedBy)
+	if err != nil {
+		log.Printf("Error al insertar el reembolso: %v", err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	refund.ID = int(id)
+	return tx.Commit()
+}
+
+// RefundableAmount devuelve lo que todavía se puede reembolsar de una donación.
+func RefundableAmount(donation *model.Donation) (float64, error) {
+	var committed float64
+	err := DB.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE donation_id = ? AND status IN (?, ?)",
+		donation.ID, model.RefundAwaitingApproval, model.RefundCompleted).Scan(&committed)
+	if err != nil {
+		log.Printf("Error al calcular el monto reembolsable: %v", err)
+		return 0, err
+	}
+	return donation.Amount - committed, nil
+}
+
+const refundSelect = `
+	SELECT id, donation_id, campaign_id, amount, reason, status, initiated_by, outgoing_payment_id,
+		quote_id, continue_uri, continue_token, created_at, completed_at
+	FROM refunds
+`
+
+func scanRefund(row interface{ Scan(...any) error }) (model.Refund, error) {
+	var r model.Refund
+	var completedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.DonationID, &r.CampaignID, &r.Amount, &r.Reason, &r.Status, &r.InitiatedBy, &r.OutgoingPaymentID,
+		&r.QuoteID, &r.ContinueURI, &r.ContinueToken, &r.CreatedAt, &completedAt)
+	if err == nil {
+		err = openSecrets("refunds.continue_token", &r.ContinueToken)
+	}
+	if completedAt.Valid {
+		r.CompletedAt = &completedAt.Time
+	}
+	return r, err
+}
+
+// GetRefundByID recupera un reembolso.
+func GetRefundByID(id int) (*model.Refund, error) {
+	r, err := scanRefund(DB.QueryRow(refundSelect+" WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No encontrado no es un error de aplicación
+		}
+		log.Printf("Error al escanear fila de reembolso: %v", err)
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetRefundsByDonation devuelve los reembolsos de una donación.
+func GetRefundsByDonation(donationID int) ([]model.Refund, error) {
+	return queryRefunds(" WHERE donation_id = ? ORDER BY id", donationID)
+}
+
+func queryRefunds(where string, args ...any) ([]model.Refund, error) {
+	rows, err := DB.Query(refundSelect+where, args...)
+	if err != nil {
+		log.Printf("Error al consultar reembolsos: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	refunds := []model.Refund{}
+	for rows.Next() {
+		r, err := scanRefund(rows)
+		if err != nil {
+			log.Printf("Error al escanear fila de reembolso: %v", err)
+			return nil, err
+		}
+		refunds = append(refunds, r)
+	}
+	return refunds, rows.Err()
+}
+
+// GetRefundsByStatus devuelve los reembolsos de todas las campañas en un estado.
+func GetRefundsByStatus(status string) ([]model.Refund, error) {
+	return queryRefunds(" WHERE status = ? ORDER BY id", status)
+}
+
+// SetRefundGrant guarda la quote y el grant interactivo que el creador debe aprobar.
+func SetRefundGrant(id int, quoteID, continueURI, continueToken string) error {
+	continueToken, err := sealSecret("refunds.continue_token", continueToken)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("UPDATE refunds SET quote_id = ?, continue_uri = ?, continue_token = ? WHERE id = ?",
+		quoteID, continueURI, continueToken, id)
+	if err != nil {
+		log.Printf("Error al guardar el grant del reembolso: %v", err)
+	}
+	return err
+}
+
+// FailRefund marca un reembolso como fallido; su monto vuelve a ser reembolsable.
+func FailRefund(id int) error {
+	_, err := DB.Exec("UPDATE refunds SET status = ?, continue_token = '' WHERE id = ?", model.RefundFailed, id)
+	if err != nil {
+		log.Printf("Error al marcar el reembolso como fallido: %v", err)
+	}
+	return err
+}
+
+// CompleteRefund registra en el ledger un reembolso pagado: actualiza la
+// donación (reembolsada total o parcialmente), descuenta lo recaudado por la
+// campaña y, si la campaña usa escrow, registra la salida del escrow. Si la
+// donación queda reembolsada por completo, revierte también sus
+// contrapartidas. Los avisos del reembolso quedan en el outbox. Devuelve true si la donación quedó
+// reembolsada por completo.
+func CompleteRefund(refund *model.Refund, outgoingPaymentID string, escrow bool) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE refunds SET status = ?, outgoing_payment_id = ?, continue_token = '', completed_at = CURRENT_TIMESTAMP WHERE id = ?",
+		model.RefundCompleted, outgoingPaymentID, refund.ID)
+	if err != nil {
+		log.Printf("Error al completar el reembolso: %v", err)
+		return false, err
+	}
+
+	var amount, refunded float64
+	err = tx.QueryRow("SELECT amount, refunded_amount + ? FROM donations WHERE id = ?", refund.Amount, refund.DonationID).Scan(&amount, &refunded)
+	if err != nil {
+		return false, err
+	}
+	full := refunded >= amount-0.000001
+	status := model.DonationPartiallyRefunded
+	if full {
+		status = model.DonationRefunded
+	}
+	if _, err := tx.Exec("UPDATE donations SET refunded_amount = ? WHERE id = ?", refunded, refund.DonationID); err != nil {
+		log.Printf("Error al actualizar la donación reembolsada: %v", err)
+		return false, err
+	}
+	changed, err := transitionDonation(tx, refund.DonationID, status, fmt.Sprintf("reembolso %d", refund.ID))
+	if err != nil {
+		return false, err
+	}
+	if !changed {
+		// El reembolso ya se pagó, así que se registra igual.
+		log.Printf("[WARN] La donación %d no pudo pasar a %s tras el reembolso %d", refund.DonationID, status, refund.ID)
+	}
+	if _, err := tx.Exec("UPDATE campaigns SET amount_raised = amount_raised - ? WHERE id = ?", refund.Amount, refund.CampaignID); err != nil {
+		log.Printf("Error al descontar el reembolso de la campaña: %v", err)
+		return false, err
+	}
+	if escrow {
+		_, err := tx.Exec("INSERT INTO escrow_entries (campaign_id, kind, amount, donation_id, outgoing_payment_id) VALUES (?, ?, ?, ?, ?)",
+			refund.CampaignID, model.EscrowRefund, refund.Amount, refund.DonationID, outgoingPaymentID)
+		if err != nil {
+			log.Printf("Error al registrar el reembolso en el escrow: %v", err)
+			return false, err
+		}
+	}
+	if full {
+		if err := reverseSponsorMatches(tx, refund.DonationID); err != nil {
+			return false, err
+		}
+	}
+	event := model.DonationRefundedEvent{RefundID: refund.ID, DonationID: refund.DonationID, CampaignID: refund.CampaignID, Amount: refund.Amount, FullyRefunded: full}
+	if err := addOutbox(tx, model.OutboxDonationRefunded, fmt.Sprintf("donation.refunded:%d", refund.ID), event); err != nil {
+		return false, err
+	}
+	return full, tx.Commit()
+}
+
+// GetRefundGrant devuelve el grant de reembolsos preaprobado de una campaña.
+func GetRefundGrant(campaignID int) (*model.RefundGrant, error) {
+	var g model.RefundGrant
+	err := DB.QueryRow("SELECT campaign_id, status, expires_at, continue_uri, continue_token, access_token FROM refund_grants WHERE campaign_id = ?", campaignID).
+		Scan(&g.CampaignID, &g.Status, &g.ExpiresAt, &g.ContinueURI, &g.ContinueToken, &g.AccessToken)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error al leer el grant de reembolsos: %v", err)
+		return nil, err
+	}
+	if err := openSecrets("refund_grants.continue_token", &g.ContinueToken, "refund_grants.access_token", &g.AccessToken); err != nil {
+		return nil, err
+	}
+	if g.Status == model.RefundGrantActive && g.ExpiresAt.Before(time.Now()) {
+		g.Status = model.RefundGrantExpired
+	}
+	return &g, nil
+}
+
+// SaveRefundGrant guarda (o reemplaza) el grant de reembolsos pendiente de aprobar.
+func SaveRefundGrant(grant *model.RefundGrant) error {
+	continueToken, err := sealSecret("refund_grants.continue_token", grant.ContinueToken)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec(`
+		INSERT INTO refund_grants (campaign_id, status, expires_at, continue_uri, continue_token, access_token)
+		VALUES (?, ?, ?, ?, ?, '')
+		ON CONFLICT(campaign_id) DO UPDATE SET status = excluded.status, expires_at = excluded.expires_at,
+			continue_uri = excluded.continue_uri, continue_token = excluded.continue_token, access_token = ''`,
+		grant.CampaignID, model.RefundGrantPendingAuthorization, grant.ExpiresAt, grant.ContinueURI, continueToken)
+	if err != nil {
+		log.Printf("Error al guardar el grant de reembolsos: %v", err)
+	}
+	return err
+}
+
+// ActivateRefundGrant guarda el access token del grant de reembolsos aprobado.
+func ActivateRefundGrant(campaignID int, accessToken string) error {
+	accessToken, err := sealSecret("refund_grants.access_token", accessToken)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("UPDATE refund_grants SET status = ?, access_token = ?, continue_token = '' WHERE campaign_id = ?",
+		model.RefundGrantActive, accessToken, campaignID)
+	if err != nil {
+		log.Printf("Error al activar el grant de reembolsos: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,202 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"gofundme-backend/model"
+)
+
+var (
+	// ErrDuplicateReport indica que el usuario ya denunció esa campaña.
+	ErrDuplicateReport = errors.New("el usuario ya denunció esta campaña")
+	// ErrReportNotOpen indica que la denuncia ya fue resuelta.
+	ErrReportNotOpen = errors.New("la denuncia ya fue resuelta")
+)
+
+// CreateReport guarda la denuncia de un usuario. Si con ella la campaña llega a
+// threshold denuncias abiertas y sigue activa, queda oculta en revisión; en ese
+// caso hidden es true. Un threshold de 0 no oculta nunca.
+func CreateReport(report *model.Report, threshold int) (hidden bool, err error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRow("SELECT COUNT(*) FROM campaign_reports WHERE campaign_id = ? AND reporter_id = ?", report.CampaignID, report.ReporterID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	if exists > 0 {
+		return false, ErrDuplicateReport
+	}
+
+	res, err := tx.Exec("INSERT INTO campaign_reports (campaign_id, reporter_id, category, details, status) VALUES (?, ?, ?, ?, ?)",
+		report.CampaignID, report.ReporterID, report.Category, report.Details, model.ReportOpen)
+	if err != nil {
+		log.Printf("Error al insertar la denuncia: %v", err)
+		return false, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+	report.ID = int(id)
+	report.Status = model.ReportOpen
+
+	if threshold > 0 {
+		var open int
+		err = tx.QueryRow("SELECT COUNT(*) FROM campaign_reports WHERE campaign_id = ? AND status = ?", report.CampaignID, model.ReportOpen).Scan(&open)
+		if err != nil {
+			return false, err
+		}
+		if open >= threshold {
+			res, err := tx.Exec("UPDATE campaigns SET status = ? WHERE id = ? AND status = ?", model.CampaignUnderReview, report.CampaignID, model.CampaignActive)
+			if err != nil {
+				log.Printf("Error al ocultar la campaña denunciada: %v", err)
+				return false, err
+			}
+			n, _ := res.RowsAffected()
+			hidden = n > 0
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return hidden, nil
+}
+
+const reportSelect = `
+	SELECT r.id, r.campaign_id, c.title, r.reporter_id, r.category, r.details, r.status, r.resolution, r.resolved_by, r.created_at, r.resolved_at
+	FROM campaign_reports r
+	JOIN campaigns c ON r.campaign_id = c.id
+`
+
+func scanReport(row interface{ Scan(...any) error }) (model.Report, error) {
+	var r model.Report
+	var resolvedAt sql.NullTime
+	err := row.Scan(&r.ID, &r.CampaignID, &r.CampaignTitle, &r.ReporterID, &r.Category, &r.Details, &r.Status, &r.Resolution, &r.ResolvedBy, &r.CreatedAt, &resolvedAt)
+	if resolvedAt.Valid {
+		r.ResolvedAt = &resolvedAt.Time
+	}
+	return r, err
+}
+
+// GetReportByID recupera una denuncia por su ID.
+func GetReportByID(id int) (*model.Report, error) {
+	r, err := scanReport(DB.QueryRow(reportSelect+" WHERE r.id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No encontrado no es un error de aplicación
+		}
+		log.Printf("Error al escanear fila de denuncia: %v", err)
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetReportsByStatus devuelve las denuncias en un estado. Las de las campañas
+// con más denuncias van primero y, dentro de cada campaña, las más antiguas.
+func GetReportsByStatus(status string) ([]model.Report, error) {
+	return queryReports(reportSelect+` WHERE r.status = ?
+		ORDER BY (SELECT COUNT(*) FROM campaign_reports o WHERE o.campaign_id = r.campaign_id AND o.status = r.status) DESC, r.campaign_id, r.id`, status)
+}
+
+// GetReportsByReporter devuelve las denuncias hechas por un usuario.
+func GetReportsByReporter(reporterID int) ([]model.Report, error) {
+	return queryReports(reportSelect+" WHERE r.reporter_id = ? ORDER BY r.id DESC", reporterID)
+}
+
+func queryReports(query string, args ...any) ([]model.Report, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		log.Printf("Error al consultar denuncias: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []model.Report{}
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			log.Printf("Error al escanear fila de denuncia: %v", err)
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// ResolveReports cierra todas las denuncias abiertas de la campaña a la que
+// pertenece la denuncia id, ya que se revisan juntas. Si se descartan, la
+// campaña vuelve a publicarse si estaba oculta en revisión; si se actúa sobre
+// ellas, queda retirada con la nota del moderador como motivo. Devuelve las
+// denuncias cerradas para avisar a quienes las hicieron.
+func ResolveReports(id int, status, resolution string, moderatorID int) ([]model.Report, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var campaignID int
+	err = tx.QueryRow("SELECT campaign_id FROM campaign_reports WHERE id = ? AND status = ?", id, model.ReportOpen).Scan(&campaignID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrReportNotOpen
+		}
+		return nil, err
+	}
+
+	rows, err := tx.Query("SELECT id FROM campaign_reports WHERE campaign_id = ? AND status = ?", campaignID, model.ReportOpen)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var reportID int
+		if err := rows.Scan(&reportID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, reportID)
+	}
+	rows.Close()
+
+	_, err = tx.Exec(`UPDATE campaign_reports SET status = ?, resolution = ?, resolved_by = ?, resolved_at = CURRENT_TIMESTAMP
+		WHERE campaign_id = ? AND status = ?`, status, resolution, moderatorID, campaignID, model.ReportOpen)
+	if err != nil {
+		log.Printf("Error al resolver las denuncias: %v", err)
+		return nil, err
+	}
+
+	if status == model.ReportActioned {
+		_, err = tx.Exec("UPDATE campaigns SET status = ?, takedown_reason = ? WHERE id = ?", model.CampaignTakenDown, resolution, campaignID)
+	} else {
+		_, err = tx.Exec("UPDATE campaigns SET status = ? WHERE id = ? AND status = ?", model.CampaignActive, campaignID, model.CampaignUnderReview)
+	}
+	if err != nil {
+		log.Printf("Error al actualizar la campaña denunciada: %v", err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	resolved := make([]model.Report, 0, len(ids))
+	for _, reportID := range ids {
+		r, err := GetReportByID(reportID)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			resolved = append(resolved, *r)
+		}
+	}
+	return resolved, nil
+}
@@ -0,0 +1,225 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// ErrRiskNotOpen indica que la evaluación de riesgo no está pendiente de revisión.
+var ErrRiskNotOpen = errors.New("la evaluación de riesgo no está pendiente de revisión")
+
+// SaveRiskAssessment guarda una evaluación de riesgo con sus señales.
+func SaveRiskAssessment(a *model.RiskAssessment) error {
+	signals, err := json.Marshal(a.Signals)
+	if err != nil {
+		return err
+	}
+	res, err := DB.Exec("INSERT INTO risk_assessments (subject_type, subject_id, user_id, score, action, signals, status) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		a.SubjectType, a.SubjectID, a.UserID, a.Score, a.Action, string(signals), a.Status)
+	if err != nil {
+		log.Printf("Error al insertar la evaluación de riesgo: %v", err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	a.ID = int(id)
+	return nil
+}
+
+const riskSelect = `
+	SELECT id, subject_type, subject_id, user_id, score, action, signals, status, reviewed_by, created_at, reviewed_at
+	FROM risk_assessments
+`
+
+func scanRiskAssessment(row interface{ Scan(...any) error }) (model.RiskAssessment, error) {
+	var a model.RiskAssessment
+	var signals string
+	var reviewedAt sql.NullTime
+	err := row.Scan(&a.ID, &a.SubjectType, &a.SubjectID, &a.UserID, &a.Score, &a.Action, &signals, &a.Status, &a.ReviewedBy, &a.CreatedAt, &reviewedAt)
+	if err != nil {
+		return a, err
+	}
+	if reviewedAt.Valid {
+		a.ReviewedAt = &reviewedAt.Time
+	}
+	if err := json.Unmarshal([]byte(signals), &a.Signals); err != nil {
+		return a, fmt.Errorf("señales de riesgo inválidas: %w", err)
+	}
+	return a, nil
+}
+
+// GetRiskAssessmentByID recupera una evaluación de riesgo por su ID.
+func GetRiskAssessmentByID(id int) (*model.RiskAssessment, error) {
+	a, err := scanRiskAssessment(DB.QueryRow(riskSelect+" WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No encontrado no es un error de aplicación
+		}
+		log.Printf("Error al escanear fila de evaluación de riesgo: %v", err)
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetRiskAssessmentsByStatus devuelve las evaluaciones en un estado, las de
+// mayor puntaje primero.
+func GetRiskAssessmentsByStatus(status string) ([]model.RiskAssessment, error) {
+	return queryRiskAssessments(riskSelect+" WHERE status = ? ORDER BY score DESC, id", status)
+}
+
+// GetRiskAssessmentsBySubject devuelve las evaluaciones de una donación o campaña.
+func GetRiskAssessmentsBySubject(subjectType string, subjectID int) ([]model.RiskAssessment, error) {
+	return queryRiskAssessments(riskSelect+" WHERE subject_type = ? AND subject_id = ? ORDER BY id", subjectType, subjectID)
+}
+
+func queryRiskAssessments(query string, args ...any) ([]model.RiskAssessment, error) {
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		log.Printf("Error al consultar evaluaciones de riesgo: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	assessments := []model.RiskAssessment{}
+	for rows.Next() {
+		a, err := scanRiskAssessment(rows)
+		if err != nil {
+			log.Printf("Error al escanear fila de evaluación de riesgo: %v", err)
+			return nil, err
+		}
+		assessments = append(assessments, a)
+	}
+	return assessments, rows.Err()
+}
+
+// RiskCleared indica si un moderador ya dio por buena una donación o campaña,
+// para no volver a retenerla.
+func RiskCleared(subjectType string, subjectID int) (bool, error) {
+	var n int
+	err := DB.QueryRow("SELECT COUNT(*) FROM risk_assessments WHERE subject_type = ? AND subject_id = ? AND status = ?",
+		subjectType, subjectID, model.RiskCleared).Scan(&n)
+	if err != nil {
+		log.Printf("Error al consultar evaluaciones de riesgo: %v", err)
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ReviewRiskAssessment marca una evaluación abierta como legítima o fraudulenta.
+// Si retuvo su donación o campaña, la libera o la descarta en la misma transacción.
+func ReviewRiskAssessment(id int, status string, reviewerID int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var subjectType, action string
+	var subjectID int
+	err = tx.QueryRow("SELECT subject_type, subject_id, action FROM risk_assessments WHERE id = ? AND status = ?", id, model.RiskOpen).
+		Scan(&subjectType, &subjectID, &action)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrRiskNotOpen
+		}
+		return err
+	}
+	_, err = tx.Exec("UPDATE risk_assessments SET status = ?, reviewed_by = ?, reviewed_at = CURRENT_TIMESTAMP WHERE id = ?", status, reviewerID, id)
+	if err != nil {
+		log.Printf("Error al revisar la evaluación de riesgo: %v", err)
+		return err
+	}
+
+	if action == model.RiskHold && subjectID != 0 {
+		switch subjectType {
+		case model.RiskSubjectDonation:
+			next, reason := model.DonationQuoted, "liberada por un moderador"
+			if status == model.RiskConfirmed {
+				next, reason = model.DonationFailed, "riesgo confirmado por un moderador"
+			}
+			_, err = transitionDonation(tx, subjectID, next, reason)
+		case model.RiskSubjectCampaign:
+			if status == model.RiskConfirmed {
+				_, err = tx.Exec("UPDATE campaigns SET status = ?, takedown_reason = ? WHERE id = ?", model.CampaignTakenDown, "Actividad fraudulenta", subjectID)
+			} else {
+				_, err = tx.Exec("UPDATE campaigns SET status = ? WHERE id = ? AND status = ?", model.CampaignActive, subjectID, model.CampaignUnderReview)
+			}
+		}
+		if err != nil {
+			log.Printf("Error al liberar lo retenido por la evaluación de riesgo: %v", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CountRecentDonationsFromWallet cuenta las donaciones debitadas de una wallet
+// en la ventana indicada, contando hacia atrás desde ahora.
+func CountRecentDonationsFromWallet(walletAddress string, window time.Duration) (int, error) {
+	var n int
+	err := DB.QueryRow("SELECT COUNT(*) FROM donations WHERE donor_wallet_address = ? AND created_at >= datetime('now', ?)",
+		walletAddress, fmt.Sprintf("-%d seconds", int(window.Seconds()))).Scan(&n)
+	if err != nil {
+		log.Printf("Error al contar donaciones de la wallet: %v", err)
+	}
+	return n, err
+}
+
+// CountDonationsBetween cuenta las donaciones completadas que alguna de las
+// wallets from hizo a campañas de la wallet to, ya sea su payment pointer o
+// la wallet de su creador.
+func CountDonationsBetween(from []string, to string) (int, error) {
+	if len(from) == 0 {
+		return 0, nil
+	}
+	query := `
+		SELECT COUNT(*) FROM donations d
+		JOIN campaigns c ON d.campaign_id = c.id
+		JOIN users u ON c.user_id = u.id
+		WHERE d.donor_wallet_address IN (?` + strings.Repeat(", ?", len(from)-1) + `)
+			AND (c.payment_pointer = ? OR u.wallet_address = ?)
+			AND d.status IN (?, ?, ?)`
+	args := make([]any, 0, len(from)+5)
+	for _, w := range from {
+		args = append(args, w)
+	}
+	args = append(args, to, to, model.DonationCompleted, model.DonationPartiallyRefunded, model.DonationRefunded)
+
+	var n int
+	if err := DB.QueryRow(query, args...).Scan(&n); err != nil {
+		log.Printf("Error al contar donaciones entre wallets: %v", err)
+		return 0, err
+	}
+	return n, nil
+}
+
+// GetOtherCampaignDescriptions devuelve las descripciones de las campañas que
+// no son del usuario indicado, por ID de campaña.
+func GetOtherCampaignDescriptions(userID int) (map[int]string, error) {
+	rows, err := DB.Query("SELECT id, description FROM campaigns WHERE user_id != ? AND description IS NOT NULL AND description != ''", userID)
+	if err != nil {
+		log.Printf("Error al consultar descripciones de campañas: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	descriptions := map[int]string{}
+	for rows.Next() {
+		var id int
+		var description string
+		if err := rows.Scan(&id, &description); err != nil {
+			return nil, err
+		}
+		descriptions[id] = description
+	}
+	return descriptions, rows.Err()
+}
@@ -0,0 +1,426 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Los secretos se guardan con cifrado de sobre: cada valor se cifra con su
+// propia llave de datos AES-256-GCM, y esa llave se guarda envuelta por la
+// llave maestra del KMS. Rotar la llave maestra solo obliga a volver a
+// envolver las llaves de datos, no a descifrar y cifrar de nuevo cada valor.
+//
+// Un valor cifrado tiene la forma
+//
+//	enc1:<id de la llave maestra>:<llave de datos envuelta>:<nonce y texto cifrado>
+//
+// con las dos últimas partes en base64. El nombre de la columna va como dato
+// asociado, así que un valor copiado a otra columna no se puede descifrar.
+const secretPrefix = "enc1:"
+
+var (
+	// ErrNoMasterKey indica que no se configuró la llave maestra.
+	ErrNoMasterKey = errors.New("no hay llave maestra para cifrar secretos")
+	// ErrUnknownMasterKey indica que el valor se cifró con una llave maestra que ya no está en el KMS.
+	ErrUnknownMasterKey = errors.New("el secreto se cifró con una llave maestra desconocida")
+)
+
+// KMS envuelve y desenvuelve llaves de datos con una llave maestra que nunca
+// sale de él. LocalKMS es la implementación con llaves en un archivo local;
+// un KMS externo solo tiene que implementar esta interfaz.
+type KMS interface {
+	// CurrentKeyID es la llave maestra con la que se envuelven las llaves nuevas.
+	CurrentKeyID() string
+	// Wrap envuelve una llave de datos con la llave maestra actual.
+	Wrap(dataKey []byte) (keyID string, wrapped []byte, err error)
+	// Unwrap desenvuelve una llave de datos con la llave maestra keyID.
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+}
+
+var (
+	kmsMu sync.RWMutex
+	kms   KMS
+)
+
+// SetKMS cambia el KMS con el que se cifran los secretos guardados en la base de datos.
+func SetKMS(k KMS) {
+	kmsMu.Lock()
+	defer kmsMu.Unlock()
+	kms = k
+}
+
+func currentKMS() (KMS, error) {
+	kmsMu.RLock()
+	defer kmsMu.RUnlock()
+	if kms == nil {
+		return nil, ErrNoMasterKey
+	}
+	return kms, nil
+}
+
+// LocalKMS guarda las llaves maestras en un llavero de texto con una llave por
+// línea, "id:hex". La última línea es la llave actual; las anteriores se
+// conservan para leer lo que todavía no se volvió a cifrar.
+type LocalKMS struct {
+	keys    map[string][]byte
+	current string
+}
+
+// ParseLocalKMS lee un llavero. Las llaves pueden ir separadas por saltos de
+// línea o por comas, para poder pasarlas en una variable de entorno. Una sola
+// llave sin id se acepta con el id "1".
+func ParseLocalKMS(text string) (*LocalKMS, error) {
+	k := &LocalKMS{keys: map[string][]byte{}}
+	for _, line := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ',' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, encoded, found := strings.Cut(line, ":")
+		if !found {
+			id, encoded = "1", line
+		}
+		key, err := hex.DecodeString(encoded)
+		if err != nil || len(key) != 32 || id == "" {
+			return nil, fmt.Errorf("llave maestra inválida: %q", id)
+		}
+		if _, ok := k.keys[id]; ok {
+			return nil, fmt.Errorf("llave maestra repetida: %q", id)
+		}
+		k.keys[id] = key
+		k.current = id
+	}
+	if k.current == "" {
+		return nil, ErrNoMasterKey
+	}
+	return k, nil
+}
+
+// LoadOrCreateLocalKMS lee el llavero de path. Si el archivo no existe, lo
+// crea con una llave nueva.
+func LoadOrCreateLocalKMS(path string) (*LocalKMS, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err := AddLocalMasterKey(path); err != nil {
+			return nil, err
+		}
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al leer la llave maestra: %w", err)
+	}
+	return ParseLocalKMS(string(data))
+}
+
+// OpenLocalKMS usa el llavero keyring si no está vacío (por ejemplo, tomado de
+// una variable de entorno) y si no, el del archivo path.
+func OpenLocalKMS(keyring, path string) (*LocalKMS, error) {
+	if keyring != "" {
+		return ParseLocalKMS(keyring)
+	}
+	return LoadOrCreateLocalKMS(path)
+}
+
+// AddLocalMasterKey agrega al llavero de path una llave nueva, que pasa a ser
+// la actual, y devuelve su id. Las llaves anteriores se conservan.
+func AddLocalMasterKey(path string) (string, error) {
+	key := make([]byte, 32)
+	id := make([]byte, 4)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	keyID := "k" + hex.EncodeToString(id)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return "", fmt.Errorf("error al abrir el llavero: %w", err)
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s:%s\n", keyID, hex.EncodeToString(key)); err != nil {
+		return "", fmt.Errorf("error al guardar la llave maestra: %w", err)
+	}
+	return keyID, nil
+}
+
+// KeyIDs devuelve los ids de las llaves del llavero.
+func (k *LocalKMS) KeyIDs() []string {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (k *LocalKMS) CurrentKeyID() string {
+	return k.current
+}
+
+func (k *LocalKMS) Wrap(dataKey []byte) (string, []byte, error) {
+	wrapped, err := sealAESGCM(k.keys[k.current], dataKey, []byte(k.current))
+	return k.current, wrapped, err
+}
+
+func (k *LocalKMS) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, ErrUnknownMasterKey
+	}
+	return openAESGCM(key, wrapped, []byte(keyID))
+}
+
+// sealAESGCM cifra con AES-256-GCM y pone el nonce delante del texto cifrado.
+func sealAESGCM(key, plaintext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// openAESGCM descifra lo que produjo sealAESGCM.
+func openAESGCM(key, ciphertext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("secreto cifrado inválido")
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo descifrar el secreto: %w", err)
+	}
+	return plaintext, nil
+}
+
+// envelope es un valor cifrado separado en sus partes.
+type envelope struct {
+	keyID      string
+	wrappedKey []byte
+	ciphertext []byte
+}
+
+func parseEnvelope(value string) (*envelope, error) {
+	parts := strings.Split(strings.TrimPrefix(value, secretPrefix), ":")
+	if len(parts) != 3 {
+		return nil, errors.New("secreto cifrado inválido")
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("secreto cifrado inválido")
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("secreto cifrado inválido")
+	}
+	return &envelope{keyID: parts[0], wrappedKey: wrapped, ciphertext: ciphertext}, nil
+}
+
+func (e *envelope) String() string {
+	return secretPrefix + e.keyID + ":" + base64.RawStdEncoding.EncodeToString(e.wrappedKey) + ":" + base64.RawStdEncoding.EncodeToString(e.ciphertext)
+}
+
+// sealSecret cifra el valor de una columna sensible con una llave de datos
+// nueva. El texto vacío se guarda tal cual: marca los tokens ya usados.
+func sealSecret(column, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	k, err := currentKMS()
+	if err != nil {
+		return "", err
+	}
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	ciphertext, err := sealAESGCM(dataKey, []byte(plaintext), []byte(column))
+	if err != nil {
+		return "", err
+	}
+	keyID, wrapped, err := k.Wrap(dataKey)
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(keyID, ":") {
+		return "", fmt.Errorf("id de llave maestra inválido: %q", keyID)
+	}
+	return (&envelope{keyID: keyID, wrappedKey: wrapped, ciphertext: ciphertext}).String(), nil
+}
+
+// openSecret descifra el valor de una columna sensible. Los valores guardados
+// antes de cifrar esa columna se devuelven tal cual hasta que
+// ReencryptSecrets los cifre.
+func openSecret(column, stored string) (string, error) {
+	if !strings.HasPrefix(stored, secretPrefix) {
+		return stored, nil
+	}
+	k, err := currentKMS()
+	if err != nil {
+		return "", err
+	}
+	env, err := parseEnvelope(stored)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := k.Unwrap(env.keyID, env.wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openAESGCM(dataKey, env.ciphertext, []byte(column))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// openSecrets descifra en su lugar varios campos leídos de la base de datos.
+// Recibe pares de nombre de columna y puntero al campo.
+func openSecrets(fields ...any) error {
+	for i := 0; i+1 < len(fields); i += 2 {
+		column, dst := fields[i].(string), fields[i+1].(*string)
+		plaintext, err := openSecret(column, *dst)
+		if err != nil {
+			log.Printf("Error al descifrar %s: %v", column, err)
+			return err
+		}
+		*dst = plaintext
+	}
+	return nil
+}
+
+// secretColumns son las columnas que se guardan cifradas.
+var secretColumns = []struct{ table, column string }{
+	{"client_keys", "private_key"},
+	{"payment_grants", "continue_token"},
+	{"sponsors", "continue_token"},
+	{"sponsors", "access_token"},
+	{"refunds", "continue_token"},
+	{"refund_grants", "continue_token"},
+	{"refund_grants", "access_token"},
+	{"webhook_endpoints", "secret"},
+	{"users", "totp_secret"},
+}
+
+// ReencryptSecrets deja todas las columnas sensibles cifradas con la llave
+// maestra actual: cifra los valores que seguían en claro y vuelve a envolver
+// las llaves de datos de los que usan otra llave maestra. Devuelve cuántos
+// valores cambió. Se puede ejecutar tantas veces como se quiera.
+func ReencryptSecrets() (int, error) {
+	k, err := currentKMS()
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, c := range secretColumns {
+		name := c.table + "." + c.column
+		rows, err := DB.Query("SELECT rowid, " + c.column + " FROM " + c.table + " WHERE " + c.column + " != ''")
+		if err != nil {
+			log.Printf("Error al leer %s: %v", name, err)
+			return changed, err
+		}
+		updates := map[int64]string{}
+		for rows.Next() {
+			var rowID int64
+			var stored string
+			if err := rows.Scan(&rowID, &stored); err != nil {
+				rows.Close()
+				return changed, err
+			}
+
+			var next string
+			if !strings.HasPrefix(stored, secretPrefix) {
+				if next, err = sealSecret(name, stored); err != nil {
+					rows.Close()
+					return changed, err
+				}
+			} else {
+				env, err := parseEnvelope(stored)
+				if err != nil {
+					rows.Close()
+					return changed, fmt.Errorf("%s fila %d: %w", name, rowID, err)
+				}
+				if env.keyID == k.CurrentKeyID() {
+					continue
+				}
+				dataKey, err := k.Unwrap(env.keyID, env.wrappedKey)
+				if err != nil {
+					rows.Close()
+					return changed, fmt.Errorf("%s fila %d: %w", name, rowID, err)
+				}
+				if env.keyID, env.wrappedKey, err = k.Wrap(dataKey); err != nil {
+					rows.Close()
+					return changed, err
+				}
+				next = env.String()
+			}
+			updates[rowID] = next
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return changed, err
+		}
+
+		for rowID, value := range updates {
+			if _, err := DB.Exec("UPDATE "+c.table+" SET "+c.column+" = ? WHERE rowid = ?", value, rowID); err != nil {
+				log.Printf("Error al volver a cifrar %s: %v", name, err)
+				return changed, err
+			}
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// SecretKeyIDsInUse cuenta cuántos valores cifrados dependen de cada llave
+// maestra, para saber cuáles ya se pueden borrar del llavero.
+func SecretKeyIDsInUse() (map[string]int, error) {
+	inUse := map[string]int{}
+	for _, c := range secretColumns {
+		rows, err := DB.Query("SELECT " + c.column + " FROM " + c.table + " WHERE " + c.column + " LIKE '" + secretPrefix + "%'")
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var stored string
+			if err := rows.Scan(&stored); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if env, err := parseEnvelope(stored); err == nil {
+				inUse[env.keyID]++
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return inUse, nil
+}
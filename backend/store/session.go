@@ -0,0 +1,89 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// CreateSession abre una sesión para un usuario y devuelve su token. En la base
+// solo se guarda el hash del token.
+func CreateSession(userID int, ttl time.Duration) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(raw)
+	expiresAt := time.Now().Add(ttl).UTC()
+
+	_, err := DB.Exec("INSERT INTO sessions (token_hash, user_id, expires_at) VALUES (?, ?, ?)", hashToken(token), userID, expiresAt)
+	if err != nil {
+		log.Printf("Error al crear la sesión: %v", err)
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// GetSessionUser devuelve el usuario de una sesión vigente, o nil si el token
+// no existe o ya expiró.
+func GetSessionUser(token string) (*model.User, error) {
+	var userID int
+	var expiresAt time.Time
+	err := DB.QueryRow("SELECT user_id, expires_at FROM sessions WHERE token_hash = ?", hashToken(token)).Scan(&userID, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error al leer la sesión: %v", err)
+		return nil, err
+	}
+	if expiresAt.Before(time.Now()) {
+		DeleteSession(token)
+		return nil, nil
+	}
+	return GetUserByID(userID)
+}
+
+// MarkSessionTwoFactor anota que en la sesión se acaba de comprobar un código
+// de verificación en dos pasos.
+func MarkSessionTwoFactor(token string) error {
+	_, err := DB.Exec("UPDATE sessions SET two_factor_at = ? WHERE token_hash = ?", time.Now().UTC(), hashToken(token))
+	if err != nil {
+		log.Printf("Error al marcar la sesión: %v", err)
+	}
+	return err
+}
+
+// GetSessionTwoFactorAt devuelve cuándo se comprobó por última vez un código
+// de verificación en dos pasos en la sesión, o nil si nunca.
+func GetSessionTwoFactorAt(token string) (*time.Time, error) {
+	var at sql.NullTime
+	err := DB.QueryRow("SELECT two_factor_at FROM sessions WHERE token_hash = ?", hashToken(token)).Scan(&at)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Error al leer la sesión: %v", err)
+		return nil, err
+	}
+	if !at.Valid {
+		return nil, nil
+	}
+	return &at.Time, nil
+}
+
+// DeleteSession cierra una sesión.
+func DeleteSession(token string) error {
+	_, err := DB.Exec("DELETE FROM sessions WHERE token_hash = ?", hashToken(token))
+	if err != nil {
+		log.Printf("Error al cerrar la sesión: %v", err)
+	}
+	return err
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
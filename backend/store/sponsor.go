@@ -0,0 +1,288 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+var (
+	// ErrMatchCapExceeded indica que el patrocinador ya no tiene capacidad para igualar.
+	ErrMatchCapExceeded = errors.New("el patrocinador alcanzó su tope de contrapartida")
+	// ErrMatchNotFailed indica que la contrapartida no existe o no está fallida.
+	ErrMatchNotFailed = errors.New("la contrapartida no está fallida")
+)
+
+// CreateSponsor inserta un patrocinador pendiente de autorizar su grant.
+func CreateSponsor(sponsor *model.Sponsor) error {
+	continueToken, err := sealSecret("sponsors.continue_token", sponsor.ContinueToken)
+	if err != nil {
+		return err
+	}
+	res, err := DB.Exec(`
+		INSERT INTO sponsors (campaign_id, user_id, name, wallet_address, cap, match_ratio, status, expires_at, continue_uri, continue_token)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sponsor.CampaignID, sponsor.UserID, sponsor.Name, sponsor.WalletAddress, sponsor.Cap, sponsor.MatchRatio,
+		model.SponsorPendingAuthorization, sponsor.ExpiresAt, sponsor.ContinueURI, continueToken)
+	if err != nil {
+		log.Printf("Error al insertar el patrocinador: %v", err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("Error al obtener el ID del patrocinador: %v", err)
+		return err
+	}
+	sponsor.ID = int(id)
+	sponsor.Status = model.SponsorPendingAuthorization
+	return nil
+}
+
+const sponsorSelect = `
+	SELECT id, campaign_id, user_id, name, wallet_address, cap, match_ratio, matched_total, status, expires_at,
+		continue_uri, continue_token, access_token, created_at
+	FROM sponsors
+`
+
+func scanSponsor(row interface{ Scan(...any) error }) (model.Sponsor, error) {
+	var s model.Sponsor
+	err := row.Scan(&s.ID, &s.CampaignID, &s.UserID, &s.Name, &s.WalletAddress, &s.Cap, &s.MatchRatio, &s.MatchedTotal, &s.Status, &s.ExpiresAt,
+		&s.ContinueURI, &s.ContinueToken, &s.AccessToken, &s.CreatedAt)
+	if err == nil {
+		err = openSecrets("sponsors.continue_token", &s.ContinueToken, "sponsors.access_token", &s.AccessToken)
+	}
+	if err == nil && s.Status == model.SponsorActive && s.ExpiresAt.Before(time.Now()) {
+		s.Status = model.SponsorExpired
+	}
+	return s, err
+}
+
+// GetSponsorByID recupera un patrocinador.
+func GetSponsorByID(id int) (*model.Sponsor, error) {
+	s, err := scanSponsor(DB.QueryRow(sponsorSelect+" WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No encontrado no es un error de aplicación
+		}
+		log.Printf("Error al escanear fila de patrocinador: %v", err)
+		return nil, err
+	}
+	return &s, nil
+}
+
+// GetSponsorsByCampaign devuelve los patrocinadores de una campaña.
+func GetSponsorsByCampaign(campaignID int) ([]model.Sponsor, error) {
+	rows, err := DB.Query(sponsorSelect+" WHERE campaign_id = ? ORDER BY id", campaignID)
+	if err != nil {
+		log.Printf("Error al consultar patrocinadores: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	sponsors := []model.Sponsor{}
+	for rows.Next() {
+		s, err := scanSponsor(rows)
+		if err != nil {
+			log.Printf("Error al escanear fila de patrocinador: %v", err)
+			return nil, err
+		}
+		sponsors = append(sponsors, s)
+	}
+	return sponsors, rows.Err()
+}
+
+// ActivateSponsor guarda el access token del grant aprobado por el patrocinador.
+func ActivateSponsor(id int, accessToken string) error {
+	accessToken, err := sealSecret("sponsors.access_token", accessToken)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec("UPDATE sponsors SET status = ?, access_token = ?, continue_token = '' WHERE id = ?",
+		model.SponsorActive, accessToken, id)
+	if err != nil {
+		log.Printf("Error al activar el patrocinador: %v", err)
+	}
+	return err
+}
+
+// ReserveSponsorMatch aparta una contrapartida antes de enviar el pago, para que
+// dos donaciones simultáneas no superen el tope del patrocinador.
+func ReserveSponsorMatch(sponsorID, donationID int, amount float64) (*model.SponsorMatch, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE sponsors SET matched_total = matched_total + ? WHERE id = ? AND matched_total + ? <= cap + 0.000001",
+		amount, sponsorID, amount)
+	if err != nil {
+		log.Printf("Error al reservar la contrapartida: %v", err)
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrMatchCapExceeded
+	}
+
+	res, err = tx.Exec("INSERT INTO sponsor_matches (sponsor_id, donation_id, amount, status) VALUES (?, ?, ?, ?)",
+		sponsorID, donationID, amount, model.MatchPending)
+	if err != nil {
+		log.Printf("Error al insertar la contrapartida: %v", err)
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &model.SponsorMatch{ID: int(id), SponsorID: sponsorID, DonationID: donationID, Amount: amount, Status: model.MatchPending}, nil
+}
+
+// RetrySponsorMatch vuelve a reservar la capacidad de una contrapartida fallida
+// y la deja pendiente para pagarla otra vez.
+func RetrySponsorMatch(matchID int) (*model.SponsorMatch, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	match := model.SponsorMatch{ID: matchID, Status: model.MatchPending}
+	err = tx.QueryRow("SELECT sponsor_id, donation_id, amount FROM sponsor_matches WHERE id = ? AND status = ?", matchID, model.MatchFailed).
+		Scan(&match.SponsorID, &match.DonationID, &match.Amount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrMatchNotFailed
+		}
+		return nil, err
+	}
+	res, err := tx.Exec("UPDATE sponsors SET matched_total = matched_total + ? WHERE id = ? AND matched_total + ? <= cap + 0.000001",
+		match.Amount, match.SponsorID, match.Amount)
+	if err != nil {
+		log.Printf("Error al reservar la contrapartida: %v", err)
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrMatchCapExceeded
+	}
+	if _, err := tx.Exec("UPDATE sponsor_matches SET status = ? WHERE id = ?", model.MatchPending, matchID); err != nil {
+		log.Printf("Error al reintentar la contrapartida: %v", err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &match, nil
+}
+
+// CompleteSponsorMatch marca una contrapartida como pagada.
+func CompleteSponsorMatch(matchID int, outgoingPaymentID string) error {
+	_, err := DB.Exec("UPDATE sponsor_matches SET status = ?, outgoing_payment_id = ? WHERE id = ?",
+		model.MatchMatched, outgoingPaymentID, matchID)
+	if err != nil {
+		log.Printf("Error al completar la contrapartida: %v", err)
+	}
+	return err
+}
+
+// FailSponsorMatch marca una contrapartida como fallida y libera la capacidad reservada.
+func FailSponsorMatch(match *model.SponsorMatch) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := releaseSponsorMatch(tx, match.ID, model.MatchFailed, model.MatchPending); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// reverseSponsorMatches revierte en el ledger, dentro de tx, las
+// contrapartidas pagadas de una donación y devuelve su capacidad a cada
+// patrocinador.
+func reverseSponsorMatches(tx *sql.Tx, donationID int) error {
+	rows, err := tx.Query("SELECT id FROM sponsor_matches WHERE donation_id = ? AND status = ?", donationID, model.MatchMatched)
+	if err != nil {
+		log.Printf("Error al consultar contrapartidas: %v", err)
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := releaseSponsorMatch(tx, id, model.MatchReversed, model.MatchMatched); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseSponsorMatch pasa una contrapartida de `from` a `to` y descuenta su monto
+// de lo igualado por el patrocinador.
+func releaseSponsorMatch(tx *sql.Tx, matchID int, to, from string) error {
+	var sponsorID int
+	var amount float64
+	err := tx.QueryRow("SELECT sponsor_id, amount FROM sponsor_matches WHERE id = ? AND status = ?", matchID, from).Scan(&sponsorID, &amount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil // Ya estaba en otro estado
+		}
+		return err
+	}
+	if _, err := tx.Exec("UPDATE sponsor_matches SET status = ? WHERE id = ?", to, matchID); err != nil {
+		log.Printf("Error al actualizar la contrapartida: %v", err)
+		return err
+	}
+	if _, err := tx.Exec("UPDATE sponsors SET matched_total = matched_total - ? WHERE id = ?", amount, sponsorID); err != nil {
+		log.Printf("Error al actualizar lo igualado por el patrocinador: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetMatchesByDonation devuelve las contrapartidas de una donación.
+func GetMatchesByDonation(donationID int) ([]model.SponsorMatch, error) {
+	return queryMatches(" WHERE donation_id = ? ORDER BY id", donationID)
+}
+
+// GetMatchesByStatus devuelve las contrapartidas de todas las campañas en un estado.
+func GetMatchesByStatus(status string) ([]model.SponsorMatch, error) {
+	return queryMatches(" WHERE status = ? ORDER BY id", status)
+}
+
+func queryMatches(where string, args ...any) ([]model.SponsorMatch, error) {
+	rows, err := DB.Query(`
+		SELECT id, sponsor_id, donation_id, amount, status, outgoing_payment_id, created_at
+		FROM sponsor_matches`+where, args...)
+	if err != nil {
+		log.Printf("Error al consultar contrapartidas: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []model.SponsorMatch{}
+	for rows.Next() {
+		var m model.SponsorMatch
+		if err := rows.Scan(&m.ID, &m.SponsorID, &m.DonationID, &m.Amount, &m.Status, &m.OutgoingPaymentID, &m.CreatedAt); err != nil {
+			log.Printf("Error al escanear fila de contrapartida: %v", err)
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"database/sql"
+	"log"
+)
+
+// SetPendingTOTPSecret guarda, cifrado, el secreto de una inscripción en
+// curso. No hace nada si la cuenta ya tiene la verificación en dos pasos
+// activada.
+func SetPendingTOTPSecret(userID int, secret string) (bool, error) {
+	secret, err := sealSecret("users.totp_secret", secret)
+	if err != nil {
+		return false, err
+	}
+	res, err := DB.Exec("UPDATE users SET totp_secret = ? WHERE id = ? AND totp_enabled_at IS NULL", secret, userID)
+	if err != nil {
+		log.Printf("Error al guardar el secreto TOTP: %v", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// EnableTOTP activa la verificación en dos pasos con el secreto pendiente y
+// reemplaza los códigos de recuperación. step es el paso del código con el que
+// se confirmó, que ya no se podrá volver a usar.
+func EnableTOTP(userID int, step int64, codeHashes []string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totp_enabled_at = CURRENT_TIMESTAMP, totp_last_step = ?, totp_failures = 0 WHERE id = ?", step, userID)
+	if err != nil {
+		log.Printf("Error al activar la verificación en dos pasos: %v", err)
+		return err
+	}
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DisableTOTP desactiva la verificación en dos pasos y borra el secreto y los
+// códigos de recuperación.
+func DisableTOTP(userID int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totp_secret = '', totp_enabled_at = NULL, totp_last_step = 0, totp_failures = 0 WHERE id = ?", userID)
+	if err != nil {
+		log.Printf("Error al desactivar la verificación en dos pasos: %v", err)
+		return err
+	}
+	if err := replaceRecoveryCodes(tx, userID, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep acepta un código TOTP del paso indicado y reinicia el contador
+// de fallos. Devuelve false si ya se aceptó un código de ese paso o de uno
+// posterior, para que un código interceptado no sirva dos veces.
+func UseTOTPStep(userID int, step int64) (bool, error) {
+	res, err := DB.Exec("UPDATE users SET totp_last_step = ?, totp_failures = 0 WHERE id = ? AND totp_last_step < ?", step, userID, step)
+	if err != nil {
+		log.Printf("Error al registrar el código TOTP: %v", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// AddTOTPFailure suma un código incorrecto y devuelve cuántos lleva seguidos.
+func AddTOTPFailure(userID int) (int, error) {
+	var failures int
+	err := DB.QueryRow("UPDATE users SET totp_failures = totp_failures + 1 WHERE id = ? RETURNING totp_failures", userID).Scan(&failures)
+	if err != nil {
+		log.Printf("Error al registrar el código incorrecto: %v", err)
+	}
+	return failures, err
+}
+
+// UseRecoveryCode marca como usado un código de recuperación sin usar y
+// reinicia el contador de fallos. Devuelve false si no existe o ya se usó.
+func UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE recovery_codes SET used_at = CURRENT_TIMESTAMP WHERE user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash)
+	if err != nil {
+		log.Printf("Error al usar el código de recuperación: %v", err)
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec("UPDATE users SET totp_failures = 0 WHERE id = ?", userID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ReplaceRecoveryCodes invalida los códigos de recuperación de un usuario y
+// guarda los nuevos.
+func ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		log.Printf("Error al borrar los códigos de recuperación: %v", err)
+		return err
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			log.Printf("Error al guardar el código de recuperación: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// CountRecoveryCodes cuenta los códigos de recuperación que le quedan a un usuario.
+func CountRecoveryCodes(userID int) (int, error) {
+	var n int
+	err := DB.QueryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID).Scan(&n)
+	if err != nil {
+		log.Printf("Error al contar los códigos de recuperación: %v", err)
+	}
+	return n, err
+}
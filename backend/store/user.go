@@ -27,7 +27,7 @@ func CreateUser(user *model.User, password string) error {
 		return err
 	}
 
-	query := "INSERT INTO users (username, password_hash, wallet_address) VALUES (?, ?, ?)"
+	query := "INSERT INTO users (username, password_hash, wallet_address, wallet_asset_code, wallet_asset_scale, wallet_auth_server, email, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)"
 	stmt, err := DB.Prepare(query)
 	if err != nil {
 		log.Printf("Error preparing query: %v", err)
@@ -35,7 +35,7 @@ func CreateUser(user *model.User, password string) error {
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(user.Username, hashedPassword, user.WalletAddress)
+	res, err := stmt.Exec(user.Username, hashedPassword, user.WalletAddress, user.WalletAssetCode, user.WalletAssetScale, user.WalletAuthServer, user.Email)
 	if err != nil {
 		log.Printf("Error executing query: %v", err)
 		return err
@@ -52,13 +52,58 @@ func CreateUser(user *model.User, password string) error {
 	return nil
 }
 
+// userSelect es la consulta base para leer usuarios.
+const userSelect = `
+	SELECT id, username, password_hash, wallet_address, wallet_asset_code, wallet_asset_scale, wallet_auth_server,
+		role, suspended_at, suspend_reason, created_at, email, email_verified_at,
+		totp_secret, totp_enabled_at, totp_last_step, totp_failures, display_name, bio, avatar_url,
+		deletion_requested_at, deleted_at
+	FROM users
+`
+
+func scanUser(row interface{ Scan(...any) error }) (model.User, error) {
+	var user model.User
+	var suspendedAt, createdAt, emailVerifiedAt, totpEnabledAt, deletionRequestedAt, deletedAt sql.NullTime
+	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.WalletAddress, &user.WalletAssetCode, &user.WalletAssetScale, &user.WalletAuthServer,
+		&user.Role, &suspendedAt, &user.SuspendReason, &createdAt, &user.Email, &emailVerifiedAt,
+		&user.TOTPSecret, &totpEnabledAt, &user.TOTPLastStep, &user.TOTPFailures, &user.DisplayName, &user.Bio, &user.AvatarURL,
+		&deletionRequestedAt, &deletedAt)
+	if err == nil {
+		err = openSecrets("users.totp_secret", &user.TOTPSecret)
+	}
+	if suspendedAt.Valid {
+		user.SuspendedAt = &suspendedAt.Time
+	}
+	if createdAt.Valid {
+		user.CreatedAt = &createdAt.Time
+	}
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	if totpEnabledAt.Valid {
+		user.TwoFactorEnabledAt = &totpEnabledAt.Time
+	}
+	if deletionRequestedAt.Valid {
+		user.DeletionRequestedAt = &deletionRequestedAt.Time
+	}
+	if deletedAt.Valid {
+		user.DeletedAt = &deletedAt.Time
+	}
+	return user, err
+}
+
 // GetUserByUsername busca un usuario por su nombre de usuario.
 func GetUserByUsername(username string) (*model.User, error) {
-	query := "SELECT id, username, password_hash, wallet_address FROM users WHERE username = ?"
-	row := DB.QueryRow(query, username)
+	return getUser(" WHERE username = ?", username)
+}
 
-	var user model.User
-	err := row.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.WalletAddress)
+// GetUserByID busca un usuario por su ID.
+func GetUserByID(id int) (*model.User, error) {
+	return getUser(" WHERE id = ?", id)
+}
+
+func getUser(where string, args ...any) (*model.User, error) {
+	user, err := scanUser(DB.QueryRow(userSelect+where, args...))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // No es un error, simplemente no se encontró el usuario.
@@ -69,3 +114,79 @@ func GetUserByUsername(username string) (*model.User, error) {
 
 	return &user, nil
 }
+
+// GetUsers devuelve todos los usuarios ordenados por ID.
+func GetUsers() ([]model.User, error) {
+	rows, err := DB.Query(userSelect + " ORDER BY id")
+	if err != nil {
+		log.Printf("Error al consultar usuarios: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			log.Printf("Error scanning user row: %v", err)
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// SetUserRole cambia el rol de un usuario. Devuelve false si no existe.
+func SetUserRole(id int, role string) (bool, error) {
+	res, err := DB.Exec("UPDATE users SET role = ? WHERE id = ?", role, id)
+	if err != nil {
+		log.Printf("Error al cambiar el rol del usuario: %v", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// PromoteToCreator marca como creador a un usuario con rol básico. Los roles
+// de moderación no se tocan.
+func PromoteToCreator(id int) error {
+	_, err := DB.Exec("UPDATE users SET role = ? WHERE id = ? AND role = ?", model.RoleCreator, id, model.RoleUser)
+	if err != nil {
+		log.Printf("Error al promover al usuario a creador: %v", err)
+	}
+	return err
+}
+
+// SuspendUser suspende una cuenta y cierra sus sesiones. Devuelve false si no existe.
+func SuspendUser(id int, reason string) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE users SET suspended_at = CURRENT_TIMESTAMP, suspend_reason = ? WHERE id = ?", reason, id)
+	if err != nil {
+		log.Printf("Error al suspender al usuario: %v", err)
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", id); err != nil {
+		log.Printf("Error al cerrar las sesiones del usuario: %v", err)
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// UnsuspendUser reactiva una cuenta suspendida. Devuelve false si no existe.
+func UnsuspendUser(id int) (bool, error) {
+	res, err := DB.Exec("UPDATE users SET suspended_at = NULL, suspend_reason = '' WHERE id = ?", id)
+	if err != nil {
+		log.Printf("Error al reactivar al usuario: %v", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"gofundme-backend/model"
+)
+
+// ErrVerificationNotPending indica que la solicitud ya fue revisada.
+var ErrVerificationNotPending = errors.New("la solicitud de verificación ya fue revisada")
+
+// CreateVerificationRequest guarda una solicitud de verificación junto con sus
+// documentos en una sola transacción.
+func CreateVerificationRequest(request *model.VerificationRequest) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO verification_requests (campaign_id, user_id, full_name, document_type, document_number, notes, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		request.CampaignID, request.UserID, request.FullName, request.DocumentType, request.DocumentNumber, request.Notes, model.VerificationPending)
+	if err != nil {
+		log.Printf("Error al insertar la solicitud de verificación: %v", err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	request.ID = int(id)
+	request.Status = model.VerificationPending
+
+	for i := range request.Documents {
+		doc := &request.Documents[i]
+		res, err := tx.Exec("INSERT INTO verification_documents (request_id, filename, content_type, path) VALUES (?, ?, ?, ?)",
+			request.ID, doc.Filename, doc.ContentType, doc.Path)
+		if err != nil {
+			log.Printf("Error al insertar el documento de verificación: %v", err)
+			return err
+		}
+		docID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		doc.ID = int(docID)
+		doc.RequestID = request.ID
+	}
+	return tx.Commit()
+}
+
+const verificationSelect = `
+	SELECT id, campaign_id, user_id, full_name, document_type, document_number, notes, status, reason, created_at, reviewed_at
+	FROM verification_requests
+`
+
+func scanVerificationRequest(row interface{ Scan(...any) error }) (model.VerificationRequest, error) {
+	var v model.VerificationRequest
+	var reviewedAt sql.NullTime
+	err := row.Scan(&v.ID, &v.CampaignID, &v.UserID, &v.FullName, &v.DocumentType, &v.DocumentNumber, &v.Notes, &v.Status, &v.Reason, &v.CreatedAt, &reviewedAt)
+	if reviewedAt.Valid {
+		v.ReviewedAt = &reviewedAt.Time
+	}
+	return v, err
+}
+
+// GetVerificationRequestByID recupera una solicitud con sus documentos.
+func GetVerificationRequestByID(id int) (*model.VerificationRequest, error) {
+	return getVerificationRequest(" WHERE id = ?", id)
+}
+
+// GetLatestVerificationRequest devuelve la última solicitud de una campaña.
+func GetLatestVerificationRequest(campaignID int) (*model.VerificationRequest, error) {
+	return getVerificationRequest(" WHERE campaign_id = ? ORDER BY id DESC LIMIT 1", campaignID)
+}
+
+func getVerificationRequest(where string, args ...any) (*model.VerificationRequest, error) {
+	v, err := scanVerificationRequest(DB.QueryRow(verificationSelect+where, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No encontrado no es un error de aplicación
+		}
+		log.Printf("Error al escanear fila de verificación: %v", err)
+		return nil, err
+	}
+	documents, err := getVerificationDocuments(v.ID)
+	if err != nil {
+		return nil, err
+	}
+	v.Documents = documents
+	return &v, nil
+}
+
+// GetVerificationRequestsByStatus devuelve las solicitudes en un estado, las
+// más antiguas primero, con sus documentos.
+func GetVerificationRequestsByStatus(status string) ([]model.VerificationRequest, error) {
+	rows, err := DB.Query(verificationSelect+" WHERE status = ? ORDER BY id", status)
+	if err != nil {
+		log.Printf("Error al consultar solicitudes de verificación: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []model.VerificationRequest{}
+	for rows.Next() {
+		v, err := scanVerificationRequest(rows)
+		if err != nil {
+			log.Printf("Error al escanear fila de verificación: %v", err)
+			return nil, err
+		}
+		requests = append(requests, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range requests {
+		documents, err := getVerificationDocuments(requests[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		requests[i].Documents = documents
+	}
+	return requests, nil
+}
+
+func getVerificationDocuments(requestID int) ([]model.VerificationDocument, error) {
+	rows, err := DB.Query("SELECT id, request_id, filename, content_type, path, created_at FROM verification_documents WHERE request_id = ? ORDER BY id", requestID)
+	if err != nil {
+		log.Printf("Error al consultar documentos de verificación: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []model.VerificationDocument{}
+	for rows.Next() {
+		var d model.VerificationDocument
+		if err := rows.Scan(&d.ID, &d.RequestID, &d.Filename, &d.ContentType, &d.Path, &d.CreatedAt); err != nil {
+			log.Printf("Error al escanear fila de documento: %v", err)
+			return nil, err
+		}
+		documents = append(documents, d)
+	}
+	return documents, rows.Err()
+}
+
+// ReviewVerificationRequest aprueba o rechaza una solicitud pendiente. Al
+// aprobarla, la campaña queda marcada como verificada.
+func ReviewVerificationRequest(id int, status, reason string) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var campaignID int
+	err = tx.QueryRow("SELECT campaign_id FROM verification_requests WHERE id = ? AND status = ?", id, model.VerificationPending).Scan(&campaignID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrVerificationNotPending
+		}
+		return err
+	}
+	_, err = tx.Exec("UPDATE verification_requests SET status = ?, reason = ?, reviewed_at = CURRENT_TIMESTAMP WHERE id = ?", status, reason, id)
+	if err != nil {
+		log.Printf("Error al revisar la solicitud de verificación: %v", err)
+		return err
+	}
+	if status == model.VerificationApproved {
+		if _, err := tx.Exec("UPDATE campaigns SET verified = 1 WHERE id = ?", campaignID); err != nil {
+			log.Printf("Error al marcar la campaña como verificada: %v", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// SaveWebhookEvent guarda un webhook recibido. Si ya existía un evento con el
+// mismo ID no lo modifica y devuelve false.
+func SaveWebhookEvent(event *model.WebhookEvent) (bool, error) {
+	res, err := DB.Exec("INSERT OR IGNORE INTO webhook_events (id, type, data, status) VALUES (?, ?, ?, ?)",
+		event.ID, event.Type, string(event.Data), model.WebhookPending)
+	if err != nil {
+		log.Printf("Error al guardar el webhook: %v", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+const webhookEventSelect = "SELECT id, type, data, status, attempts, last_error, next_attempt_at, received_at, processed_at FROM webhook_events"
+
+func scanWebhookEvent(row interface{ Scan(...any) error }) (model.WebhookEvent, error) {
+	var e model.WebhookEvent
+	var data string
+	var nextAttemptAt, processedAt sql.NullTime
+	err := row.Scan(&e.ID, &e.Type, &data, &e.Status, &e.Attempts, &e.LastError, &nextAttemptAt, &e.ReceivedAt, &processedAt)
+	e.Data = []byte(data)
+	if nextAttemptAt.Valid {
+		e.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if processedAt.Valid {
+		e.ProcessedAt = &processedAt.Time
+	}
+	return e, err
+}
+
+// GetWebhookEvent busca un webhook por su ID.
+func GetWebhookEvent(id string) (*model.WebhookEvent, error) {
+	e, err := scanWebhookEvent(DB.QueryRow(webhookEventSelect+" WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error al leer el webhook: %v", err)
+		return nil, err
+	}
+	return &e, nil
+}
+
+func queryWebhookEvents(where string, args ...any) ([]model.WebhookEvent, error) {
+	rows, err := DB.Query(webhookEventSelect+where, args...)
+	if err != nil {
+		log.Printf("Error al consultar webhooks: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.WebhookEvent{}
+	for rows.Next() {
+		e, err := scanWebhookEvent(rows)
+		if err != nil {
+			log.Printf("Error al escanear fila de webhook: %v", err)
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// GetWebhookEvents devuelve los webhooks en un estado ("" = todos), los más recientes primero.
+func GetWebhookEvents(status string, limit int) ([]model.WebhookEvent, error) {
+	if status == "" {
+		return queryWebhookEvents(" ORDER BY received_at DESC LIMIT ?", limit)
+	}
+	return queryWebhookEvents(" WHERE status = ? ORDER BY received_at DESC LIMIT ?", status, limit)
+}
+
+// GetDueWebhookEvents devuelve los webhooks fallidos, o que quedaron a medio
+// procesar, cuyo siguiente intento ya venció.
+func GetDueWebhookEvents(now time.Time, limit int) ([]model.WebhookEvent, error) {
+	return queryWebhookEvents(" WHERE status IN (?, ?) AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ?",
+		model.WebhookFailed, model.WebhookProcessing, now.UTC(), limit)
+}
+
+// ClaimWebhookEvent marca un webhook como en proceso para que nadie más lo
+// procese a la vez. lease es cuánto tiempo se reserva: si el proceso muere, el
+// evento se reintenta al vencer. Devuelve false si otro ya lo tenía o si ya
+// estaba procesado. force permite reclamar eventos que agotaron sus reintentos.
+func ClaimWebhookEvent(id string, lease time.Duration, force bool) (bool, error) {
+	now := time.Now().UTC()
+	query := "UPDATE webhook_events SET status = ?, next_attempt_at = ? WHERE id = ? AND (status IN (?, ?) OR (status = ? AND next_attempt_at <= ?))"
+	args := []any{model.WebhookProcessing, now.Add(lease), id, model.WebhookPending, model.WebhookFailed, model.WebhookProcessing, now}
+	if force {
+		query += " OR (id = ? AND status = ?)"
+		args = append(args, id, model.WebhookDead)
+	}
+	res, err := DB.Exec(query, args...)
+	if err != nil {
+		log.Printf("Error al reservar el webhook: %v", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// MarkWebhookEventProcessed registra que el webhook se procesó.
+func MarkWebhookEventProcessed(id string) error {
+	_, err := DB.Exec("UPDATE webhook_events SET status = ?, attempts = attempts + 1, last_error = '', next_attempt_at = NULL, processed_at = CURRENT_TIMESTAMP WHERE id = ?",
+		model.WebhookProcessed, id)
+	if err != nil {
+		log.Printf("Error al marcar el webhook como procesado: %v", err)
+	}
+	return err
+}
+
+// MarkWebhookEventFailed registra un intento fallido. Con nextAttempt nil el
+// evento queda muerto hasta que un administrador lo reintente.
+func MarkWebhookEventFailed(id, lastError string, nextAttempt *time.Time) error {
+	status := model.WebhookDead
+	var next any
+	if nextAttempt != nil {
+		status = model.WebhookFailed
+		next = nextAttempt.UTC()
+	}
+	_, err := DB.Exec("UPDATE webhook_events SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?",
+		status, lastError, next, id)
+	if err != nil {
+		log.Printf("Error al marcar el webhook como fallido: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,265 @@
+package store
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+	"time"
+
+	"gofundme-backend/model"
+)
+
+// CreateWebhookEndpoint registra un endpoint de webhooks de un creador. El
+// secreto se guarda cifrado.
+func CreateWebhookEndpoint(endpoint *model.WebhookEndpoint) error {
+	secret, err := sealSecret("webhook_endpoints.secret", endpoint.Secret)
+	if err != nil {
+		return err
+	}
+	res, err := DB.Exec("INSERT INTO webhook_endpoints (user_id, url, events, secret) VALUES (?, ?, ?, ?)",
+		endpoint.UserID, endpoint.URL, strings.Join(endpoint.Events, ","), secret)
+	if err != nil {
+		log.Printf("Error al guardar el endpoint de webhooks: %v", err)
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	endpoint.ID = int(id)
+	endpoint.CreatedAt = time.Now()
+	return nil
+}
+
+const webhookEndpointSelect = "SELECT id, user_id, url, events, secret, created_at FROM webhook_endpoints"
+
+func scanWebhookEndpoint(row interface{ Scan(...any) error }) (model.WebhookEndpoint, error) {
+	var e model.WebhookEndpoint
+	var events string
+	err := row.Scan(&e.ID, &e.UserID, &e.URL, &events, &e.Secret, &e.CreatedAt)
+	if err == nil {
+		e.Events = strings.Split(events, ",")
+		err = openSecrets("webhook_endpoints.secret", &e.Secret)
+	}
+	return e, err
+}
+
+// GetWebhookEndpoint busca un endpoint por su ID, con el secreto descifrado.
+func GetWebhookEndpoint(id int) (*model.WebhookEndpoint, error) {
+	e, err := scanWebhookEndpoint(DB.QueryRow(webhookEndpointSelect+" WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error al leer el endpoint de webhooks: %v", err)
+		return nil, err
+	}
+	return &e, nil
+}
+
+// GetWebhookEndpointsByUser devuelve los endpoints de un creador, con los
+// secretos descifrados.
+func GetWebhookEndpointsByUser(userID int) ([]model.WebhookEndpoint, error) {
+	rows, err := DB.Query(webhookEndpointSelect+" WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		log.Printf("Error al consultar los endpoints de webhooks: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []model.WebhookEndpoint{}
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			log.Printf("Error al escanear fila de endpoint de webhooks: %v", err)
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, rows.Err()
+}
+
+// DeleteWebhookEndpoint borra un endpoint y su log de entregas.
+func DeleteWebhookEndpoint(id int) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM webhook_delivery_attempts WHERE delivery_id IN (SELECT id FROM webhook_deliveries WHERE endpoint_id = ?)",
+		"DELETE FROM webhook_deliveries WHERE endpoint_id = ?",
+		"DELETE FROM webhook_endpoints WHERE id = ?",
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			log.Printf("Error al borrar el endpoint de webhooks: %v", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CreateWebhookDelivery encola la entrega de un evento a un endpoint, lista
+// para enviarse de inmediato. Devuelve false si el evento ya tenía una entrega
+// para ese endpoint.
+func CreateWebhookDelivery(delivery *model.WebhookDelivery) (bool, error) {
+	now := time.Now().UTC()
+	res, err := DB.Exec("INSERT OR IGNORE INTO webhook_deliveries (endpoint_id, event_id, event_type, payload, status, next_attempt_at) VALUES (?, ?, ?, ?, ?, ?)",
+		delivery.EndpointID, delivery.EventID, delivery.EventType, string(delivery.Payload), model.DeliveryPending, now)
+	if err != nil {
+		log.Printf("Error al encolar la entrega del webhook: %v", err)
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return false, err
+	}
+	delivery.ID = int(id)
+	delivery.Status = model.DeliveryPending
+	delivery.NextAttemptAt = &now
+	return true, nil
+}
+
+const webhookDeliverySelect = `
+	SELECT id, endpoint_id, event_id, event_type, payload, status, attempts, last_status_code, last_error, next_attempt_at, created_at, delivered_at
+	FROM webhook_deliveries
+`
+
+func scanWebhookDelivery(row interface{ Scan(...any) error }) (model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	var payload string
+	var nextAttemptAt, deliveredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.LastStatusCode, &d.LastError,
+		&nextAttemptAt, &d.CreatedAt, &deliveredAt)
+	d.Payload = []byte(payload)
+	if nextAttemptAt.Valid {
+		d.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return d, err
+}
+
+// GetWebhookDelivery busca una entrega con su log de intentos.
+func GetWebhookDelivery(id int) (*model.WebhookDelivery, error) {
+	d, err := scanWebhookDelivery(DB.QueryRow(webhookDeliverySelect+" WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		log.Printf("Error al leer la entrega del webhook: %v", err)
+		return nil, err
+	}
+
+	rows, err := DB.Query("SELECT attempted_at, status_code, error, duration_ms FROM webhook_delivery_attempts WHERE delivery_id = ? ORDER BY id", id)
+	if err != nil {
+		log.Printf("Error al consultar los intentos de entrega: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a model.WebhookAttempt
+		if err := rows.Scan(&a.AttemptedAt, &a.StatusCode, &a.Error, &a.DurationMs); err != nil {
+			log.Printf("Error al escanear fila de intento de entrega: %v", err)
+			return nil, err
+		}
+		d.AttemptLog = append(d.AttemptLog, a)
+	}
+	return &d, rows.Err()
+}
+
+func queryWebhookDeliveries(where string, args ...any) ([]model.WebhookDelivery, error) {
+	rows, err := DB.Query(webhookDeliverySelect+where, args...)
+	if err != nil {
+		log.Printf("Error al consultar las entregas de webhooks: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []model.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			log.Printf("Error al escanear fila de entrega de webhook: %v", err)
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// GetWebhookDeliveriesByEndpoint devuelve el log de entregas de un endpoint,
+// las más recientes primero.
+func GetWebhookDeliveriesByEndpoint(endpointID, limit int) ([]model.WebhookDelivery, error) {
+	return queryWebhookDeliveries(" WHERE endpoint_id = ? ORDER BY id DESC LIMIT ?", endpointID, limit)
+}
+
+// GetDueWebhookDeliveries devuelve las entregas pendientes o fallidas, o que
+// quedaron a medio enviar, cuyo siguiente intento ya venció.
+func GetDueWebhookDeliveries(now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	return queryWebhookDeliveries(" WHERE status IN (?, ?, ?) AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ?",
+		model.DeliveryPending, model.DeliveryFailed, model.DeliveryInProgress, now.UTC(), limit)
+}
+
+// ClaimWebhookDelivery reserva una entrega durante lease para que nadie más la
+// envíe a la vez. Devuelve false si otro ya la tenía, si ya se entregó o si
+// todavía no le toca. force permite reenviarla en cualquier estado salvo en
+// pleno envío, como pide el reenvío manual.
+func ClaimWebhookDelivery(id int, lease time.Duration, force bool) (bool, error) {
+	now := time.Now().UTC()
+	query := "UPDATE webhook_deliveries SET status = ?, next_attempt_at = ? WHERE id = ? AND status IN (?, ?, ?) AND next_attempt_at <= ?"
+	args := []any{model.DeliveryInProgress, now.Add(lease), id, model.DeliveryPending, model.DeliveryFailed, model.DeliveryInProgress, now}
+	if force {
+		query = "UPDATE webhook_deliveries SET status = ?, next_attempt_at = ? WHERE id = ? AND (status != ? OR next_attempt_at <= ?)"
+		args = []any{model.DeliveryInProgress, now.Add(lease), id, model.DeliveryInProgress, now}
+	}
+	res, err := DB.Exec(query, args...)
+	if err != nil {
+		log.Printf("Error al reservar la entrega del webhook: %v", err)
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// RecordWebhookAttempt guarda el resultado de un intento de entrega. Si
+// attempt no tiene error la entrega queda entregada; si no, se reintenta en
+// nextAttempt, o queda muerta si nextAttempt es nil.
+func RecordWebhookAttempt(deliveryID int, attempt model.WebhookAttempt, nextAttempt *time.Time) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO webhook_delivery_attempts (delivery_id, attempted_at, status_code, error, duration_ms) VALUES (?, ?, ?, ?, ?)",
+		deliveryID, attempt.AttemptedAt.UTC(), attempt.StatusCode, attempt.Error, attempt.DurationMs); err != nil {
+		log.Printf("Error al guardar el intento de entrega: %v", err)
+		return err
+	}
+
+	var status string
+	var next, deliveredAt any
+	switch {
+	case attempt.Error == "":
+		status, deliveredAt = model.DeliveryDelivered, attempt.AttemptedAt.UTC()
+	case nextAttempt != nil:
+		status, next = model.DeliveryFailed, nextAttempt.UTC()
+	default:
+		status = model.DeliveryDead
+	}
+	_, err = tx.Exec(`
+		UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, last_status_code = ?, last_error = ?, next_attempt_at = ?,
+			delivered_at = COALESCE(?, delivered_at)
+		WHERE id = ?`, status, attempt.StatusCode, attempt.Error, next, deliveredAt, deliveryID)
+	if err != nil {
+		log.Printf("Error al actualizar la entrega del webhook: %v", err)
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,139 @@
+// Package token emite y valida tokens firmados con HMAC-SHA256, de un solo
+// propósito y con caducidad, como los de verificación de correo y los de
+// restablecimiento de contraseña. El token lleva sus datos firmados, así que
+// no hace falta guardarlo en la base de datos.
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Propósitos de los tokens. Un token emitido para uno no sirve para otro.
+const (
+	PurposeVerifyEmail    = "verify_email"
+	PurposeResetPassword  = "reset_password"
+	PurposeLoginTwoFactor = "login_2fa"
+)
+
+var (
+	// ErrInvalid indica un token mal formado, con firma incorrecta o de otro propósito.
+	ErrInvalid = errors.New("token inválido")
+	// ErrExpired indica un token válido pero caducado.
+	ErrExpired = errors.New("token caducado")
+)
+
+// Claims son los datos firmados dentro de un token. Binding ata el token a un
+// estado de la cuenta (el correo a verificar, la contraseña vigente): si ese
+// estado cambia, quien lo valida debe rechazar el token.
+type Claims struct {
+	Purpose   string `json:"p"`
+	UserID    int    `json:"u"`
+	Binding   string `json:"b"`
+	ExpiresAt int64  `json:"e"`
+}
+
+var (
+	mu     sync.RWMutex
+	secret []byte
+)
+
+// SetSecret cambia la llave con la que se firman y validan los tokens.
+func SetSecret(key []byte) {
+	mu.Lock()
+	defer mu.Unlock()
+	secret = key
+}
+
+func currentSecret() ([]byte, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(secret) == 0 {
+		return nil, errors.New("no hay llave para firmar tokens")
+	}
+	return secret, nil
+}
+
+// LoadOrCreateSecret lee la llave en hexadecimal de path. Si el archivo no
+// existe, genera una llave de 32 bytes y la guarda ahí, para que los tokens
+// emitidos sigan siendo válidos después de reiniciar.
+func LoadOrCreateSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) < 32 {
+			return nil, fmt.Errorf("llave de tokens inválida en %s", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error al leer la llave de tokens: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("error al guardar la llave de tokens: %w", err)
+	}
+	return key, nil
+}
+
+// Issue emite un token para un usuario que caduca en ttl.
+func Issue(purpose string, userID int, binding string, ttl time.Duration) (string, error) {
+	key, err := currentSecret()
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(Claims{Purpose: purpose, UserID: userID, Binding: binding, ExpiresAt: time.Now().Add(ttl).Unix()})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(key, encoded)), nil
+}
+
+// Parse valida la firma, el propósito y la caducidad de un token y devuelve sus datos.
+func Parse(tok, purpose string) (*Claims, error) {
+	key, err := currentSecret()
+	if err != nil {
+		return nil, err
+	}
+	encoded, signature, ok := strings.Cut(tok, ".")
+	if !ok {
+		return nil, ErrInvalid
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, sign(key, encoded)) {
+		return nil, ErrInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Purpose != purpose {
+		return nil, ErrInvalid
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+	return &claims, nil
+}
+
+func sign(key []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
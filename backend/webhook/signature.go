@@ -0,0 +1,86 @@
+// Package webhook firma y verifica webhooks con el esquema de Rafiki: la
+// cabecera lleva el momento de la firma y un HMAC-SHA256 de "<t>.<cuerpo>".
+//
+//	Rafiki-Signature: t=1700000000, v1=5f1c...
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader es la cabecera donde va la firma.
+const SignatureHeader = "Rafiki-Signature"
+
+var (
+	// ErrInvalidSignature indica que la firma falta, está mal formada o no corresponde al cuerpo.
+	ErrInvalidSignature = errors.New("firma de webhook inválida")
+	// ErrStaleSignature indica que la firma es demasiado vieja (o del futuro), posible reenvío.
+	ErrStaleSignature = errors.New("la firma del webhook expiró")
+)
+
+func mac(secret string, timestamp int64, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// Sign devuelve el valor de la cabecera de firma para body firmado en el momento at.
+func Sign(secret string, body []byte, at time.Time) string {
+	t := at.Unix()
+	return "t=" + strconv.FormatInt(t, 10) + ", v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+// Verify comprueba la cabecera de firma de body. La firma debe tener como
+// mucho tolerance de diferencia con now.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var timestamp int64
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "t":
+			t, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return ErrInvalidSignature
+			}
+			timestamp = t
+		case "v1":
+			sig, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrInvalidSignature
+			}
+			signatures = append(signatures, sig)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	expected := mac(secret, timestamp, body)
+	valid := false
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			valid = true
+		}
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > tolerance || age < -tolerance {
+		return ErrStaleSignature
+	}
+	return nil
+}
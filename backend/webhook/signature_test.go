@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testSecret = "secreto-compartido"
+
+var testBody = []byte(`{"id":"evt-1","type":"incoming_payment.completed","data":{}}`)
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	header := Sign(testSecret, testBody, now)
+	if err := Verify(testSecret, header, testBody, now, 5*time.Minute); err != nil {
+		t.Fatalf("Verify(%q) = %v", header, err)
+	}
+}
+
+func TestVerifyRejectsForgedSignatures(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	header := Sign(testSecret, testBody, now)
+
+	if err := Verify("otro-secreto", header, testBody, now, 5*time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("con otro secreto: %v, quería ErrInvalidSignature", err)
+	}
+	tampered := append([]byte{}, testBody...)
+	tampered[len(tampered)-2] = ' '
+	if err := Verify(testSecret, header, tampered, now, 5*time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("con el cuerpo cambiado: %v, quería ErrInvalidSignature", err)
+	}
+	// Cambiar t invalida el HMAC aunque v1 sea el original.
+	moved := "t=" + strconv.FormatInt(now.Unix()+1, 10) + header[len("t=1700000000"):]
+	if err := Verify(testSecret, moved, testBody, now, 5*time.Minute); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("con otra hora: %v, quería ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyParsesHeader(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	valid := Sign(testSecret, testBody, now)
+	v1 := valid[len("t=1700000000, "):]
+
+	tests := []struct {
+		name   string
+		header string
+		want   error
+	}{
+		{"vacía", "", ErrInvalidSignature},
+		{"sin t", v1, ErrInvalidSignature},
+		{"sin v1", "t=1700000000", ErrInvalidSignature},
+		{"t no numérico", "t=ayer, " + v1, ErrInvalidSignature},
+		{"v1 no hexadecimal", "t=1700000000, v1=zz", ErrInvalidSignature},
+		{"partes sin =", "basura, t=1700000000, " + v1, nil},
+		{"sin espacios", "t=1700000000," + v1, nil},
+		{"esquema desconocido", "t=1700000000, v0=abcd, " + v1, nil},
+		{"varias firmas", "t=1700000000, v1=00ff, " + v1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(testSecret, tt.header, testBody, now, 5*time.Minute)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Verify(%q) = %v, quería %v", tt.header, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyTolerance(t *testing.T) {
+	signedAt := time.Unix(1700000000, 0)
+	header := Sign(testSecret, testBody, signedAt)
+	tolerance := 5 * time.Minute
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want error
+	}{
+		{"al firmar", signedAt, nil},
+		{"justo en el límite", signedAt.Add(tolerance), nil},
+		{"pasado el límite", signedAt.Add(tolerance + time.Second), ErrStaleSignature},
+		{"reloj del emisor adelantado", signedAt.Add(-tolerance), nil},
+		{"firma del futuro", signedAt.Add(-tolerance - time.Second), ErrStaleSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(testSecret, header, testBody, tt.now, tolerance); !errors.Is(err, tt.want) {
+				t.Errorf("Verify a %v = %v, quería %v", tt.now.Sub(signedAt), err, tt.want)
+			}
+		})
+	}
+}